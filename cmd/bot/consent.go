@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/telegram"
+)
+
+type ConsentChecker interface {
+	Consent(ctx context.Context, userID int64) (db.Consent, error)
+}
+
+type ConsentStore interface {
+	ConsentChecker
+	SetConsent(ctx context.Context, userID int64, version string, accepted bool) error
+}
+
+// consentKeyboard returns the Accept / Decline buttons for the current
+// policy. The version shown to the user travels with the button so a stale
+// button cannot accept a newer policy, and the buttons are bound to the user
+// so other group members cannot press them.
+func consentKeyboard(userID int64, lang string) (telegram.InlineKeyboardMarkup, error) {
+	accept, err := callbacks.Encode(userID, actionConsent, "y", help.PolicyVersion)
+	if err != nil {
+		return telegram.InlineKeyboardMarkup{}, err
+	}
+	decline, err := callbacks.Encode(userID, actionConsent, "n", help.PolicyVersion)
+	if err != nil {
+		return telegram.InlineKeyboardMarkup{}, err
+	}
+	return telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+		telegram.InlineRow(
+			telegram.InlineKeyboardButton{Text: help.Phrase(lang, "consent.accept"), CallbackData: accept},
+			telegram.InlineKeyboardButton{Text: help.Phrase(lang, "consent.decline"), CallbackData: decline},
+		),
+	}}, nil
+}
+
+// sendConsentRequest asks the user to accept the data policy. Users who
+// accepted an older version are told that the policy changed.
+func sendConsentRequest(ctx context.Context, tg TelegramSender, o origin, prev db.Consent) error {
+	lang := langFor(o.UserID)
+	key := "consent.request"
+	if prev.Accepted && prev.Version != help.PolicyVersion {
+		key = "consent.updated"
+	}
+	kb, err := consentKeyboard(o.UserID, lang)
+	if err != nil {
+		return err
+	}
+	return tg.SendMessageMarkup(ctx, o.ChatID, fmt.Sprintf(help.Phrase(lang, key), help.PolicyURL), kb)
+}
+
+// handleStart greets the user and asks for consent unless the current policy
+// has already been accepted.
+func handleStart(ctx context.Context, tg TelegramSender, repo ConsentChecker, o origin) error {
+	chatID := o.ChatID
+	lang := langFor(o.UserID)
+	c, err := repo.Consent(ctx, o.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "db consent", "err", err)
+		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
+			return sendErr
+		}
+		return nil
+	}
+	if c.Valid(help.PolicyVersion) {
+		return tg.SendMessage(ctx, chatID, help.Phrase(lang, "start.welcome")+"\n\n"+help.Phrase(lang, "start.ready"))
+	}
+	if err := tg.SendMessage(ctx, chatID, help.Phrase(lang, "start.welcome")); err != nil {
+		return err
+	}
+	return sendConsentRequest(ctx, tg, o, c)
+}
+
+// handleConsent records the decision made with a consent button for the
+// given policy version. Buttons of an older version are not recorded, so
+// pressing one cannot overwrite a decision on the current policy; the
+// current policy is offered instead.
+func handleConsent(ctx context.Context, tg TelegramSender, repo ConsentStore, o origin, version string, accepted bool) error {
+	chatID := o.ChatID
+	if version != help.PolicyVersion {
+		slog.InfoContext(ctx, "stale consent button", "user_id", o.UserID, "version", version)
+		c, err := repo.Consent(ctx, o.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "db consent", "err", err)
+			return tg.SendMessage(ctx, chatID, temporaryErrorMsg)
+		}
+		if c.Valid(help.PolicyVersion) {
+			return nil
+		}
+		return sendConsentRequest(ctx, tg, o, c)
+	}
+	if err := repo.SetConsent(ctx, o.UserID, version, accepted); err != nil {
+		slog.ErrorContext(ctx, "db consent", "err", err)
+		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
+			return sendErr
+		}
+		return nil
+	}
+	lang := langFor(o.UserID)
+	if !accepted {
+		return tg.SendMessage(ctx, chatID, help.Phrase(lang, "consent.declined"))
+	}
+	return tg.SendMessage(ctx, chatID, help.Phrase(lang, "consent.accepted"))
+}
+
+// checkConsent reports whether claims from the user may be processed and
+// asks for consent when they may not.
+func checkConsent(ctx context.Context, tg TelegramSender, repo ConsentChecker, o origin) (bool, error) {
+	c, err := repo.Consent(ctx, o.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "db consent", "err", err)
+		return false, tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	if c.Valid(help.PolicyVersion) {
+		return true, nil
+	}
+	return false, sendConsentRequest(ctx, tg, o, c)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/telegram"
+)
+
+func consentButtons(t *testing.T, m telegram.ReplyMarkup) []telegram.InlineKeyboardButton {
+	t.Helper()
+	kb, ok := m.(telegram.InlineKeyboardMarkup)
+	if !ok || len(kb.InlineKeyboard) != 1 || len(kb.InlineKeyboard[0]) != 2 {
+		t.Fatalf("unexpected markup %#v", m)
+	}
+	return kb.InlineKeyboard[0]
+}
+
+func TestHandleStartAsksForConsent(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	if err := handleStart(context.Background(), tg, repo, private(5)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.messages) != 2 || tg.messages[0] != help.Phrase("en", "start.welcome") {
+		t.Fatalf("unexpected messages %q", tg.messages)
+	}
+	if !strings.Contains(tg.text, help.PolicyURL) {
+		t.Fatalf("policy link missing: %q", tg.text)
+	}
+	b := consentButtons(t, tg.markup)
+	if b[0].Text != "Accept" || b[1].Text != "Decline" {
+		t.Fatalf("unexpected buttons %+v", b)
+	}
+	action, args, err := callbacks.Decode(5, b[0].CallbackData)
+	if err != nil || action != actionConsent || args[0] != "y" || args[1] != help.PolicyVersion {
+		t.Fatalf("unexpected accept data %s %v %v", action, args, err)
+	}
+}
+
+func TestHandleStartAlreadyAccepted(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	if err := handleStart(context.Background(), tg, &mockRepo{}, private(5)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.messages) != 1 || tg.markup != nil {
+		t.Fatalf("consent should not be requested again: %q", tg.messages)
+	}
+}
+
+func TestHandleStartPolicyChanged(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	handleLang(5, "ru")
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{Version: "old", Accepted: true}}
+	if err := handleStart(context.Background(), tg, repo, private(5)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tg.text, "Политика обработки данных изменилась") {
+		t.Fatalf("unexpected text %q", tg.text)
+	}
+	if b := consentButtons(t, tg.markup); b[0].Text != "Принимаю" {
+		t.Fatalf("buttons not localized: %+v", b)
+	}
+}
+
+func TestHandleConsentAccept(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	if err := handleConsent(context.Background(), tg, repo, private(5), help.PolicyVersion, true); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.consent.Valid(help.PolicyVersion) || repo.userID != 5 {
+		t.Fatalf("consent not stored: %+v", repo.consent)
+	}
+	if tg.text != help.Phrase("en", "consent.accepted") {
+		t.Fatalf("unexpected text %q", tg.text)
+	}
+}
+
+func TestHandleConsentDecline(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	if err := handleConsent(context.Background(), tg, repo, private(5), help.PolicyVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	if repo.consent.Accepted || repo.consent.Version != help.PolicyVersion {
+		t.Fatalf("unexpected consent %+v", repo.consent)
+	}
+	if tg.text != help.Phrase("en", "consent.declined") {
+		t.Fatalf("unexpected text %q", tg.text)
+	}
+}
+
+func TestHandleConsentStaleButton(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	if err := handleConsent(context.Background(), tg, repo, private(5), "old", true); err != nil {
+		t.Fatal(err)
+	}
+	if repo.consent.Version != "" || repo.consent.Accepted {
+		t.Fatalf("old policy recorded: %+v", repo.consent)
+	}
+	if b := consentButtons(t, tg.markup); len(b) != 2 {
+		t.Fatal("current policy not offered")
+	}
+
+	// An old decline button does not withdraw consent to the current policy.
+	tg = &mockTelegram{}
+	repo = &mockRepo{consent: &db.Consent{Version: help.PolicyVersion, Accepted: true}}
+	if err := handleConsent(context.Background(), tg, repo, private(5), "old", false); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.consent.Valid(help.PolicyVersion) || len(tg.messages) != 0 {
+		t.Fatalf("old button overwrote the decision: %+v %q", repo.consent, tg.messages)
+	}
+}
+
+func TestHandleClaimWithoutConsent(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: "ok"}
+	repo := &mockRepo{consent: &db.Consent{Version: help.PolicyVersion, Accepted: false}}
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(5), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if or.prompt != "" || len(repo.states) != 0 {
+		t.Fatal("claim processed without consent")
+	}
+	consentButtons(t, tg.markup)
+}
+
+func TestHandleClaimConsentError(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: "ok"}
+	repo := &mockRepo{consentErr: errors.New("db")}
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(5), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if or.prompt != "" || tg.text != temporaryErrorMsg {
+		t.Fatalf("unexpected result %q", tg.text)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"legalbot/internal/db"
+	"legalbot/internal/extract"
+	"legalbot/internal/help"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
+)
+
+// Upload limits. Contracts and receipts are far smaller than the 20 MB
+// Telegram lets bots download.
+const (
+	maxUploadSize = 10 << 20
+	// maxPendingFiles is how many files can be attached to one claim.
+	maxPendingFiles = 5
+	// maxEvidenceText is how much extracted text is kept per file, in
+	// characters. The prompt builder cuts it further.
+	maxEvidenceText = 20000
+	// pendingTTL is how long files wait for the question they belong to.
+	pendingTTL = 30 * time.Minute
+)
+
+// uploadTypes are the content types accepted as evidence, mapped to whether
+// text can be extracted from them.
+var uploadTypes = map[string]bool{
+	extract.PDF:  true,
+	extract.DOCX: true,
+	extract.TXT:  true,
+	extract.JPEG: false,
+	extract.PNG:  false,
+}
+
+type FileDownloader interface {
+	GetFile(ctx context.Context, fileID string) (telegram.File, error)
+	DownloadFile(ctx context.Context, f telegram.File, maxBytes int64) ([]byte, error)
+}
+
+type AttachmentSaver interface {
+	SaveAttachment(ctx context.Context, a db.Attachment) (int64, error)
+}
+
+// Uploader sends replies and downloads files.
+type Uploader interface {
+	TelegramSender
+	FileDownloader
+}
+
+// pendingFiles holds uploaded files until the user submits the claim they
+// belong to, in the chat they were sent to. Like language preferences they
+// are kept in memory only.
+type pendingFiles struct {
+	mu sync.Mutex
+	m  map[origin][]pendingFile
+}
+
+type pendingFile struct {
+	a     db.Attachment
+	added time.Time
+}
+
+var pending = pendingFiles{m: map[origin][]pendingFile{}}
+
+// fresh drops expired files. The caller holds the lock.
+func (p *pendingFiles) fresh(o origin) []pendingFile {
+	files := p.m[o][:0]
+	for _, f := range p.m[o] {
+		if timeNow().Sub(f.added) < pendingTTL {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		delete(p.m, o)
+		return nil
+	}
+	p.m[o] = files
+	return files
+}
+
+func (p *pendingFiles) count(o origin) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.fresh(o))
+}
+
+func (p *pendingFiles) add(o origin, a db.Attachment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.m[o] = append(p.fresh(o), pendingFile{a: a, added: timeNow()})
+}
+
+// take removes and returns the files in upload order.
+func (p *pendingFiles) take(o origin) []db.Attachment {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []db.Attachment
+	for _, f := range p.fresh(o) {
+		out = append(out, f.a)
+	}
+	delete(p.m, o)
+	return out
+}
+
+// clear drops a user's files in every chat.
+func (p *pendingFiles) clear(userID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for o := range p.m {
+		if o.UserID == userID {
+			delete(p.m, o)
+		}
+	}
+}
+
+// upload describes the file of a document or photo message.
+type upload struct {
+	fileID, uniqueID string
+	name, mimeType   string
+	size             int64
+}
+
+// uploadOf returns the file attached to m. Photos come in several sizes;
+// the largest carries the most readable detail.
+func uploadOf(m *telegram.Message) (upload, bool) {
+	switch {
+	case m.Document != nil:
+		d := m.Document
+		mt, _, _ := mime.ParseMediaType(d.MimeType)
+		name := d.FileName
+		if name == "" {
+			name = "document"
+		}
+		return upload{fileID: d.FileID, uniqueID: d.FileUniqueID, name: name, mimeType: mt, size: d.FileSize}, true
+	case len(m.Photo) > 0:
+		p := m.Photo[len(m.Photo)-1]
+		return upload{fileID: p.FileID, uniqueID: p.FileUniqueID, name: fmt.Sprintf("photo_%d.jpg", m.MessageID), mimeType: extract.JPEG, size: p.FileSize}, true
+	}
+	return upload{}, false
+}
+
+// handleUpload downloads a document or photo, extracts its text and keeps it
+// for the user's next claim in the chat. It reports whether the file was
+// accepted; the user is told why when it was not. Files are only downloaded
+// after the user accepted the data policy.
+func handleUpload(ctx context.Context, tg Uploader, repo ConsentChecker, o origin, m *telegram.Message, quiet bool) (bool, error) {
+	u, ok := uploadOf(m)
+	if !ok {
+		return false, nil
+	}
+	if ok, err := checkConsent(ctx, tg, repo, o); !ok {
+		return false, err
+	}
+	chatID := o.ChatID
+	lang := langFor(o.UserID)
+	if _, ok := uploadTypes[u.mimeType]; !ok {
+		return false, tg.SendMessage(ctx, chatID, help.Phrase(lang, "upload.unsupported"))
+	}
+	tooLarge := fmt.Sprintf(help.Phrase(lang, "upload.too_large"), maxUploadSize>>20)
+	if u.size > maxUploadSize {
+		return false, tg.SendMessage(ctx, chatID, tooLarge)
+	}
+	if n := pending.count(o); n >= maxPendingFiles {
+		return false, tg.SendMessage(ctx, chatID, fmt.Sprintf(help.Phrase(lang, "upload.too_many"), n))
+	}
+
+	f, err := tg.GetFile(ctx, u.fileID)
+	if err == nil {
+		var data []byte
+		data, err = tg.DownloadFile(ctx, f, maxUploadSize)
+		if err == nil {
+			return acceptUpload(ctx, tg, o, u, data, quiet)
+		}
+	}
+	if errors.Is(err, telegram.ErrFileTooLarge) {
+		return false, tg.SendMessage(ctx, chatID, tooLarge)
+	}
+	slog.ErrorContext(ctx, "download upload", "chat_id", chatID, "err", err)
+	return false, tg.SendMessage(ctx, chatID, temporaryErrorMsg)
+}
+
+// acceptUpload checks that the contents match the declared type and keeps
+// the file with its text. Unless quiet, the user is asked for the question.
+func acceptUpload(ctx context.Context, tg TelegramSender, o origin, u upload, data []byte, quiet bool) (bool, error) {
+	chatID := o.ChatID
+	lang := langFor(o.UserID)
+	if ct := extract.Detect(data); ct != u.mimeType {
+		slog.WarnContext(ctx, "upload content does not match its type", "chat_id", chatID, "declared", u.mimeType, "detected", ct)
+		return false, tg.SendMessage(ctx, chatID, help.Phrase(lang, "upload.unsupported"))
+	}
+	var text string
+	if uploadTypes[u.mimeType] {
+		var err error
+		text, err = extract.Text(data)
+		if err != nil && !errors.Is(err, extract.ErrNoText) {
+			slog.WarnContext(ctx, "extract upload text", "chat_id", chatID, "mime_type", u.mimeType, "err", err)
+		}
+		text = truncateRunes(text, maxEvidenceText)
+	}
+	pending.add(o, db.Attachment{
+		FileID:       u.fileID,
+		FileUniqueID: u.uniqueID,
+		FileName:     u.name,
+		MimeType:     u.mimeType,
+		Size:         int64(len(data)),
+		Text:         text,
+	})
+	if quiet {
+		return true, nil
+	}
+	key := "upload.received"
+	if text == "" {
+		key = "upload.no_text"
+	}
+	return true, tg.SendMessage(ctx, chatID, fmt.Sprintf(help.Phrase(lang, key), u.name))
+}
+
+// attachEvidence links the user's pending files to the claim and returns
+// their text for the prompt. Failing to store a file does not stop the
+// claim.
+func attachEvidence(ctx context.Context, repo AttachmentSaver, claimID int64, o origin) []prompt.Evidence {
+	files := pending.take(o)
+	var ev []prompt.Evidence
+	for _, a := range files {
+		if claimID != 0 {
+			a.ClaimID = claimID
+			if _, err := repo.SaveAttachment(ctx, a); err != nil {
+				slog.ErrorContext(ctx, "save attachment", "claim_id", claimID, "err", err)
+			}
+		}
+		ev = append(ev, prompt.Evidence{Name: a.FileName, Text: a.Text})
+	}
+	return ev
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
+)
+
+const testPDF = "%PDF-1.4\n" +
+	"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+	"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+	"3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n" +
+	"4 0 obj << /Length 44 >> stream\nBT 72 720 Td (Prepayment 10000 RUB) Tj ET\nendstream endobj\n" +
+	"trailer << /Root 1 0 R >>\n%%EOF"
+
+func resetPending(t *testing.T) {
+	t.Helper()
+	langPref = langPrefs{m: map[int64]string{}}
+	pending = pendingFiles{m: map[origin][]pendingFile{}}
+}
+
+func documentMessage(chatID int64, fileID, name, mimeType string, size int64, caption string) *telegram.Message {
+	return &telegram.Message{
+		MessageID: 10,
+		Chat:      telegram.Chat{ID: chatID, Type: "private"},
+		Caption:   caption,
+		Document:  &telegram.Document{FileID: fileID, FileUniqueID: "u-" + fileID, FileName: name, MimeType: mimeType, FileSize: size},
+	}
+}
+
+func TestUploadThenClaim(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{files: map[string][]byte{"F1": []byte(testPDF)}}
+	repo := &mockRepo{id: 1, claimID: 77}
+	pb := &mockPrompt{}
+	d := newTestDispatcher(tg, repo, &mockOpenRouter{resp: "answer"})
+	d.pb = pb
+	ctx := context.Background()
+
+	m := documentMessage(5, "F1", "contract.pdf", "application/pdf", int64(len(testPDF)), "")
+	if err := d.dispatch(ctx, telegram.Update{Message: m}); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf(help.Phrase("en", "upload.received"), "contract.pdf"); tg.text != want {
+		t.Fatalf("unexpected reply %q", tg.text)
+	}
+	if pending.count(private(5)) != 1 {
+		t.Fatal("file not kept for the claim")
+	}
+
+	if err := d.dispatch(ctx, telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 5}, Text: "Продавец не возвращает предоплату"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []prompt.Evidence{{Name: "contract.pdf", Text: "Prepayment 10000 RUB"}}
+	if len(pb.req.Evidence) != 1 || pb.req.Evidence[0] != want[0] {
+		t.Fatalf("evidence not in prompt: %+v", pb.req.Evidence)
+	}
+	if len(repo.attachments) != 1 || repo.attachments[0].ClaimID != 77 || repo.attachments[0].MimeType != "application/pdf" {
+		t.Fatalf("attachment not linked to the claim: %+v", repo.attachments)
+	}
+	if pending.count(private(5)) != 0 {
+		t.Fatal("files should be consumed by the claim")
+	}
+}
+
+func TestUploadWithCaptionSubmitsClaim(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{files: map[string][]byte{"T1": []byte("Чек №15\nИтого: 500 руб.")}}
+	pb := &mockPrompt{}
+	d := newTestDispatcher(tg, &mockRepo{claimID: 3}, &mockOpenRouter{resp: "answer"})
+	d.pb = pb
+	m := documentMessage(6, "T1", "receipt.txt", "text/plain; charset=utf-8", 30, "/claim Магазин не вернул деньги")
+	if err := d.dispatch(context.Background(), telegram.Update{Message: m}); err != nil {
+		t.Fatal(err)
+	}
+	if pb.req.UserText != "Магазин не вернул деньги" || len(pb.req.Evidence) != 1 || pb.req.Evidence[0].Text != "Чек №15\nИтого: 500 руб." {
+		t.Fatalf("unexpected prompt request %+v", pb.req)
+	}
+	if len(tg.messages) != 1 || tg.text != "answer" {
+		t.Fatalf("expected only the answer, got %q", tg.messages)
+	}
+}
+
+func TestUploadPhotoWithoutText(t *testing.T) {
+	resetPending(t)
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01")
+	tg := &mockTelegram{files: map[string][]byte{"P2": jpeg}}
+	m := &telegram.Message{MessageID: 9, Chat: telegram.Chat{ID: 7}, Photo: []telegram.PhotoSize{
+		{FileID: "P1", Width: 90, Height: 90}, {FileID: "P2", Width: 1280, Height: 960, FileSize: int64(len(jpeg))},
+	}}
+	ok, err := handleUpload(context.Background(), tg, &mockRepo{}, private(7), m, false)
+	if err != nil || !ok {
+		t.Fatalf("photo rejected: %v", err)
+	}
+	if want := fmt.Sprintf(help.Phrase("en", "upload.no_text"), "photo_9.jpg"); tg.text != want {
+		t.Fatalf("unexpected reply %q", tg.text)
+	}
+	files := pending.take(private(7))
+	if len(files) != 1 || files[0].FileID != "P2" || files[0].Text != "" || files[0].MimeType != "image/jpeg" {
+		t.Fatalf("unexpected pending files %+v", files)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	cases := []struct {
+		name  string
+		msg   *telegram.Message
+		files map[string][]byte
+		want  string
+	}{
+		{
+			name: "declared type",
+			msg:  documentMessage(8, "Z", "archive.zip", "application/zip", 100, ""),
+			want: help.Phrase("en", "upload.unsupported"),
+		},
+		{
+			name:  "contents",
+			msg:   documentMessage(8, "E", "contract.pdf", "application/pdf", 5, ""),
+			files: map[string][]byte{"E": []byte("MZ\x90\x00\x03")},
+			want:  help.Phrase("en", "upload.unsupported"),
+		},
+		{
+			name: "declared size",
+			msg:  documentMessage(8, "L", "scan.pdf", "application/pdf", maxUploadSize+1, ""),
+			want: fmt.Sprintf(help.Phrase("en", "upload.too_large"), 10),
+		},
+		{
+			name:  "actual size",
+			msg:   documentMessage(8, "L", "scan.pdf", "application/pdf", 0, ""),
+			files: map[string][]byte{"L": make([]byte, maxUploadSize+1)},
+			want:  fmt.Sprintf(help.Phrase("en", "upload.too_large"), 10),
+		},
+	}
+	for _, c := range cases {
+		resetPending(t)
+		tg := &mockTelegram{files: c.files}
+		ok, err := handleUpload(context.Background(), tg, &mockRepo{}, private(8), c.msg, false)
+		if err != nil || ok {
+			t.Fatalf("%s: file accepted (%v)", c.name, err)
+		}
+		if tg.text != c.want {
+			t.Errorf("%s: unexpected reply %q", c.name, tg.text)
+		}
+		if pending.count(private(8)) != 0 {
+			t.Errorf("%s: rejected file kept", c.name)
+		}
+	}
+}
+
+func TestUploadRequiresConsent(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{files: map[string][]byte{"F": []byte(testPDF)}}
+	repo := &mockRepo{consent: &db.Consent{}}
+	ok, err := handleUpload(context.Background(), tg, repo, private(9), documentMessage(9, "F", "a.pdf", "application/pdf", 10, ""), false)
+	if err != nil || ok {
+		t.Fatalf("file accepted without consent: %v", err)
+	}
+	if !strings.HasPrefix(tg.text, strings.Split(help.Phrase("en", "consent.request"), "\n")[0]) {
+		t.Fatalf("consent not requested: %q", tg.text)
+	}
+}
+
+func TestUploadLimitsPendingFiles(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{files: map[string][]byte{"T": []byte("receipt")}}
+	m := documentMessage(4, "T", "r.txt", "text/plain", 7, "")
+	for i := 0; i < maxPendingFiles; i++ {
+		if ok, err := handleUpload(context.Background(), tg, &mockRepo{}, private(4), m, false); !ok || err != nil {
+			t.Fatalf("upload %d rejected: %v", i, err)
+		}
+	}
+	if ok, _ := handleUpload(context.Background(), tg, &mockRepo{}, private(4), m, false); ok {
+		t.Fatal("too many files accepted")
+	}
+	if want := fmt.Sprintf(help.Phrase("en", "upload.too_many"), maxPendingFiles); tg.text != want {
+		t.Fatalf("unexpected reply %q", tg.text)
+	}
+}
+
+func TestPendingFilesExpireAndDelete(t *testing.T) {
+	resetPending(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	pending.add(private(1), db.Attachment{FileID: "old"})
+	now = now.Add(pendingTTL - time.Minute)
+	pending.add(private(1), db.Attachment{FileID: "new"})
+	now = now.Add(2 * time.Minute)
+	if files := pending.take(private(1)); len(files) != 1 || files[0].FileID != "new" {
+		t.Fatalf("expired file not dropped: %+v", files)
+	}
+
+	pending.add(private(2), db.Attachment{FileID: "x"})
+	if err := handleDelete(context.Background(), &mockTelegram{}, &mockRepo{}, private(2)); err != nil {
+		t.Fatal(err)
+	}
+	if pending.count(private(2)) != 0 {
+		t.Fatal("/delete kept pending files")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/telegram"
+)
+
+// origin is who a handler acts for: the chat replies go to and the user who
+// sent the message. Claims, consent, rate limits, language and history belong
+// to the user. In private chats both IDs are equal.
+type origin struct {
+	ChatID int64
+	UserID int64
+}
+
+// private returns the origin of a private chat, whose ID is its user's ID.
+func private(id int64) origin {
+	return origin{ChatID: id, UserID: id}
+}
+
+// originOf returns who sent m. Messages without a sender are attributed to
+// the chat.
+func originOf(m *telegram.Message) origin {
+	o := private(m.Chat.ID)
+	if m.From != nil {
+		o.UserID = m.From.ID
+	}
+	return o
+}
+
+// group reports whether the origin is a member of a group chat.
+func (o origin) group() bool {
+	return o.ChatID != o.UserID
+}
+
+// GroupAccessStore keeps who may file claims in groups, e.g. *db.Repository.
+type GroupAccessStore interface {
+	GroupAccess(ctx context.Context, chatID int64) (db.GroupAccess, error)
+	SetGroupRestricted(ctx context.Context, chatID int64, restricted bool, by int64) error
+	AllowClaimant(ctx context.Context, chatID, userID, by int64) error
+	RemoveClaimant(ctx context.Context, chatID, userID int64) error
+	IsClaimant(ctx context.Context, chatID, userID int64) (bool, error)
+}
+
+// ChatMemberGetter looks up group members, e.g. *telegram.Client.
+type ChatMemberGetter interface {
+	GetChatMember(ctx context.Context, chatID, userID int64) (telegram.ChatMember, error)
+}
+
+// GroupAdmin replies in groups and checks who administers them.
+type GroupAdmin interface {
+	TelegramSender
+	ChatMemberGetter
+}
+
+// addressed reports whether a group message is meant for the bot and returns
+// its text with the bot's mention removed. In groups the bot only answers
+// commands addressed to it as /command@bot, messages mentioning @bot and
+// replies to its own messages; everything else is talk between members.
+func addressed(bot telegram.User, m *telegram.Message, text string) (string, bool) {
+	if bot.Username != "" && strings.HasPrefix(text, "/") {
+		cmd, _, _ := strings.Cut(text, " ")
+		if _, to, ok := strings.Cut(cmd, "@"); ok {
+			if !strings.EqualFold(to, bot.Username) {
+				return "", false
+			}
+			return text, true
+		}
+	}
+	if bot.Username != "" {
+		if rest, ok := cutMention(text, bot.Username); ok {
+			return rest, true
+		}
+	}
+	reply := m.ReplyToMessage
+	if bot.ID != 0 && reply != nil && reply.From != nil && reply.From.ID == bot.ID {
+		return text, true
+	}
+	return "", false
+}
+
+// cutMention removes the first @username mention from text. Usernames are
+// case-insensitive and "@LegalBot" does not match "@LegalBotHelper".
+func cutMention(text, username string) (string, bool) {
+	mention := "@" + username
+	for i := 0; i+len(mention) <= len(text); i++ {
+		if text[i] != '@' || !strings.EqualFold(text[i:i+len(mention)], mention) {
+			continue
+		}
+		after := text[i+len(mention):]
+		if after != "" && isUsernameChar(after[0]) {
+			continue
+		}
+		before := strings.TrimRight(text[:i], " ")
+		after = strings.TrimLeft(after, " ,:")
+		if before != "" && after != "" {
+			return before + " " + after, true
+		}
+		return before + after, true
+	}
+	return "", false
+}
+
+func isUsernameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isAdmin reports whether the user administers the group.
+func isAdmin(ctx context.Context, tg ChatMemberGetter, o origin) (bool, error) {
+	m, err := tg.GetChatMember(ctx, o.ChatID, o.UserID)
+	if err != nil {
+		return false, fmt.Errorf("get chat member: %w", err)
+	}
+	return m.IsAdmin(), nil
+}
+
+// checkGroupAccess reports whether the user may file claims in the chat and
+// tells them when they may not. Private chats and unrestricted groups allow
+// everyone; restricted groups allow admins and the members admins allowed.
+func checkGroupAccess(ctx context.Context, tg GroupAdmin, repo GroupAccessStore, o origin) (bool, error) {
+	if !o.group() {
+		return true, nil
+	}
+	a, err := repo.GroupAccess(ctx, o.ChatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "db group access", "chat_id", o.ChatID, "err", err)
+		return false, tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	if !a.Restricted {
+		return true, nil
+	}
+	ok, err := repo.IsClaimant(ctx, o.ChatID, o.UserID)
+	if err == nil && !ok {
+		ok, err = isAdmin(ctx, tg, o)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "group access", "chat_id", o.ChatID, "user_id", o.UserID, "err", err)
+		return false, tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	if !ok {
+		return false, tg.SendMessage(ctx, o.ChatID, help.Phrase(langFor(o.UserID), "group.restricted"))
+	}
+	return true, nil
+}
+
+// handleAccess shows or changes who may file claims in a group:
+//
+//	/access           shows the current setting
+//	/access everyone  lets every member file claims
+//	/access admins    limits claims to admins and allowed members
+//	/access allow     in reply to a member's message, allows that member
+//	/access deny      in reply to a member's message, withdraws it
+//
+// Only admins may change the setting.
+func handleAccess(ctx context.Context, tg GroupAdmin, repo GroupAccessStore, o origin, arg string, reply *telegram.Message) error {
+	lang := langFor(o.UserID)
+	if !o.group() {
+		return tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "group.only"))
+	}
+	arg = strings.ToLower(arg)
+	if arg == "" {
+		return sendAccess(ctx, tg, repo, o)
+	}
+	switch arg {
+	case "everyone", "admins", "allow", "deny":
+	default:
+		return tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "access.usage"))
+	}
+	admin, err := isAdmin(ctx, tg, o)
+	if err != nil {
+		slog.ErrorContext(ctx, "group admin", "chat_id", o.ChatID, "user_id", o.UserID, "err", err)
+		return tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	if !admin {
+		return tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "group.admins_only"))
+	}
+
+	var member *telegram.User
+	if arg == "allow" || arg == "deny" {
+		if reply == nil || reply.From == nil || reply.From.IsBot {
+			return tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "access.reply"))
+		}
+		member = reply.From
+	}
+	switch arg {
+	case "everyone", "admins":
+		err = repo.SetGroupRestricted(ctx, o.ChatID, arg == "admins", o.UserID)
+	case "allow":
+		err = repo.AllowClaimant(ctx, o.ChatID, member.ID, o.UserID)
+	case "deny":
+		err = repo.RemoveClaimant(ctx, o.ChatID, member.ID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "db group access", "chat_id", o.ChatID, "err", err)
+		return tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	switch arg {
+	case "allow":
+		return tg.SendMessage(ctx, o.ChatID, fmt.Sprintf(help.Phrase(lang, "access.allowed"), displayName(*member)))
+	case "deny":
+		return tg.SendMessage(ctx, o.ChatID, fmt.Sprintf(help.Phrase(lang, "access.denied"), displayName(*member)))
+	}
+	return sendAccess(ctx, tg, repo, o)
+}
+
+// sendAccess tells the group who may file claims.
+func sendAccess(ctx context.Context, tg TelegramSender, repo GroupAccessStore, o origin) error {
+	lang := langFor(o.UserID)
+	a, err := repo.GroupAccess(ctx, o.ChatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "db group access", "chat_id", o.ChatID, "err", err)
+		return tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg)
+	}
+	if !a.Restricted {
+		return tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "access.everyone"))
+	}
+	return tg.SendMessage(ctx, o.ChatID, fmt.Sprintf(help.Phrase(lang, "access.admins"), a.Allowed))
+}
+
+// displayName names a member in group replies.
+func displayName(u telegram.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return u.FirstName
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/telegram"
+)
+
+var testBot = telegram.User{ID: 42, IsBot: true, FirstName: "Legal", Username: "LegalBot"}
+
+const testGroup = -100500
+
+func groupMessage(userID int64, text string) *telegram.Message {
+	return &telegram.Message{
+		MessageID: 3,
+		From:      &telegram.User{ID: userID, FirstName: "Ann"},
+		Chat:      telegram.Chat{ID: testGroup, Type: telegram.ChatSupergroup},
+		Text:      text,
+	}
+}
+
+func newGroupDispatcher(tg *mockTelegram, repo *mockRepo) *dispatcher {
+	d := newTestDispatcher(tg, repo, &mockOpenRouter{resp: "answer"})
+	d.bot = testBot
+	return d
+}
+
+func TestAddressed(t *testing.T) {
+	fromBot := &telegram.Message{From: &testBot}
+	cases := []struct {
+		text  string
+		reply *telegram.Message
+		want  string
+		ok    bool
+	}{
+		{"/claim@LegalBot question", nil, "/claim@LegalBot question", true},
+		{"/claim@legalbot question", nil, "/claim@legalbot question", true},
+		{"/claim@OtherBot question", nil, "", false},
+		{"/claim question", nil, "", false},
+		{"/status", fromBot, "/status", true},
+		{"@LegalBot, the landlord kept my deposit", nil, "the landlord kept my deposit", true},
+		{"Hi @legalbot what now?", nil, "Hi what now?", true},
+		{"@LegalBotHelper hi", nil, "", false},
+		{"just talking", nil, "", false},
+		{"thanks, but what about the fine?", fromBot, "thanks, but what about the fine?", true},
+		{"agreed", &telegram.Message{From: &telegram.User{ID: 7}}, "", false},
+	}
+	for _, c := range cases {
+		m := &telegram.Message{Text: c.text, ReplyToMessage: c.reply}
+		got, ok := addressed(testBot, m, c.text)
+		if got != c.want || ok != c.ok {
+			t.Errorf("addressed(%q) = %q, %v; want %q, %v", c.text, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestGroupIgnoresUnaddressedMessages(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{}
+	pb := &mockPrompt{}
+	d := newGroupDispatcher(tg, &mockRepo{})
+	d.pb = pb
+	for _, text := range []string{"is anyone around?", "/claim my case", "/help"} {
+		if err := d.dispatch(context.Background(), telegram.Update{Message: groupMessage(7, text)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tg.messages) != 0 || pb.req.UserText != "" {
+		t.Fatalf("bot answered group chatter: %q", tg.messages)
+	}
+}
+
+func TestGroupClaimInTopic(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{}
+	repo := &mockRepo{claimID: 5}
+	pb := &mockPrompt{}
+	lim := &recordingLimiter{}
+	d := newGroupDispatcher(tg, repo)
+	d.pb = pb
+	d.limiter = lim
+	m := groupMessage(7, "/claim@LegalBot Работодатель не платит зарплату")
+	m.Chat.IsForum = true
+	m.IsTopicMessage = true
+	m.MessageThreadID = 11
+	if err := d.dispatch(context.Background(), telegram.Update{Message: m}); err != nil {
+		t.Fatal(err)
+	}
+	if pb.req.UserText != "Работодатель не платит зарплату" {
+		t.Fatalf("unexpected claim %q", pb.req.UserText)
+	}
+	if tg.chatID != testGroup || tg.thread != 11 || tg.text != "answer" {
+		t.Fatalf("answer sent to chat %d thread %d: %q", tg.chatID, tg.thread, tg.text)
+	}
+	if repo.chatID != testGroup || repo.userID != 7 {
+		t.Fatalf("result stored for chat %d user %d", repo.chatID, repo.userID)
+	}
+	if len(lim.ids) != 1 || lim.ids[0] != 7 {
+		t.Fatalf("rate limited by %v, want the user", lim.ids)
+	}
+}
+
+func TestGroupRestrictedClaims(t *testing.T) {
+	cases := []struct {
+		name    string
+		user    int64
+		allowed bool
+	}{
+		{"member", 7, false},
+		{"admin", 1, true},
+		{"allowed member", 8, true},
+	}
+	for _, c := range cases {
+		resetPending(t)
+		tg := &mockTelegram{admins: map[int64]bool{1: true}}
+		repo := &mockRepo{group: db.GroupAccess{Restricted: true, Allowed: 1}, claimants: map[int64]bool{8: true}}
+		pb := &mockPrompt{}
+		d := newGroupDispatcher(tg, repo)
+		d.pb = pb
+		if err := d.dispatch(context.Background(), telegram.Update{Message: groupMessage(c.user, "@LegalBot my claim")}); err != nil {
+			t.Fatal(err)
+		}
+		if got := pb.req.UserText == "my claim"; got != c.allowed {
+			t.Errorf("%s: claim submitted = %v", c.name, got)
+		}
+		if !c.allowed && tg.text != help.Phrase("en", "group.restricted") {
+			t.Errorf("%s: unexpected reply %q", c.name, tg.text)
+		}
+	}
+}
+
+func TestAccessCommand(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{admins: map[int64]bool{1: true}}
+	repo := &mockRepo{}
+	d := newGroupDispatcher(tg, repo)
+	ctx := context.Background()
+	send := func(userID int64, text string, reply *telegram.Message) {
+		t.Helper()
+		m := groupMessage(userID, text)
+		m.ReplyToMessage = reply
+		if err := d.dispatch(ctx, telegram.Update{Message: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(7, "/access@LegalBot admins", nil)
+	if tg.text != help.Phrase("en", "group.admins_only") || repo.group.Restricted {
+		t.Fatalf("member changed access: %q", tg.text)
+	}
+	send(1, "/access@LegalBot admins", nil)
+	if !repo.group.Restricted || tg.text != fmt.Sprintf(help.Phrase("en", "access.admins"), 0) {
+		t.Fatalf("access not restricted: %q", tg.text)
+	}
+	send(1, "/access@LegalBot allow", nil)
+	if tg.text != help.Phrase("en", "access.reply") {
+		t.Fatalf("allow without reply: %q", tg.text)
+	}
+	member := &telegram.Message{From: &telegram.User{ID: 7, FirstName: "Bob", Username: "bob"}}
+	send(1, "/access@LegalBot allow", member)
+	if !repo.claimants[7] || tg.text != fmt.Sprintf(help.Phrase("en", "access.allowed"), "@bob") {
+		t.Fatalf("member not allowed: %q", tg.text)
+	}
+	send(7, "/access@LegalBot", nil)
+	if tg.text != fmt.Sprintf(help.Phrase("en", "access.admins"), 1) {
+		t.Fatalf("unexpected access summary %q", tg.text)
+	}
+	send(1, "/access@LegalBot deny", member)
+	if repo.claimants[7] {
+		t.Fatal("member still allowed")
+	}
+	send(1, "/access@LegalBot everyone", nil)
+	if repo.group.Restricted || tg.text != help.Phrase("en", "access.everyone") {
+		t.Fatalf("access not opened: %q", tg.text)
+	}
+
+	if err := handleAccess(ctx, tg, repo, private(7), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if tg.text != help.Phrase("en", "group.only") {
+		t.Fatalf("access in private chat: %q", tg.text)
+	}
+}
+
+func TestGroupConsentButtonBoundToUser(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	d := newGroupDispatcher(tg, repo)
+	if err := d.dispatch(context.Background(), telegram.Update{Message: groupMessage(7, "/start@LegalBot")}); err != nil {
+		t.Fatal(err)
+	}
+	accept := consentButtons(t, tg.markup)[0].CallbackData
+	press := func(id string, userID int64) {
+		t.Helper()
+		q := &telegram.CallbackQuery{ID: id, From: telegram.User{ID: userID}, Message: &telegram.Message{Chat: telegram.Chat{ID: testGroup, Type: telegram.ChatSupergroup}}, Data: accept}
+		if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	press("other", 8)
+	if repo.consent.Accepted {
+		t.Fatal("another member accepted on the user's behalf")
+	}
+	press("own", 7)
+	if !repo.consent.Valid(help.PolicyVersion) || repo.userID != 7 || tg.chatID != testGroup {
+		t.Fatalf("consent not stored for the user: %+v user %d", repo.consent, repo.userID)
+	}
+	if len(tg.answered) != 2 {
+		t.Fatalf("callbacks not answered: %v", tg.answered)
+	}
+}
+
+func TestGroupUploadsArePerUser(t *testing.T) {
+	resetPending(t)
+	tg := &mockTelegram{files: map[string][]byte{"T": []byte("receipt")}}
+	d := newGroupDispatcher(tg, &mockRepo{})
+	m := documentMessage(testGroup, "T", "r.txt", "text/plain", 7, "@LegalBot")
+	m.From = &telegram.User{ID: 7}
+	m.Chat.Type = telegram.ChatGroup
+	if err := d.dispatch(context.Background(), telegram.Update{Message: m}); err != nil {
+		t.Fatal(err)
+	}
+	if pending.count(origin{ChatID: testGroup, UserID: 7}) != 1 {
+		t.Fatal("upload not kept for the member")
+	}
+	if pending.count(origin{ChatID: testGroup, UserID: 8}) != 0 || pending.count(private(7)) != 0 {
+		t.Fatal("upload visible to another member or chat")
+	}
+
+	// Files sent to the group without addressing the bot are ignored.
+	m.Caption = "for the team"
+	tg.messages = nil
+	if err := d.dispatch(context.Background(), telegram.Update{Message: m}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.messages) != 0 || pending.count(origin{ChatID: testGroup, UserID: 7}) != 1 {
+		t.Fatal("unaddressed upload handled")
+	}
+
+	if err := handleDelete(context.Background(), tg, &mockRepo{}, private(7)); err != nil {
+		t.Fatal(err)
+	}
+	if pending.count(origin{ChatID: testGroup, UserID: 7}) != 0 {
+		t.Fatal("/delete kept the member's group files")
+	}
+}
+
+type recordingLimiter struct{ ids []int64 }
+
+func (l *recordingLimiter) Allow(id int64) bool {
+	l.ids = append(l.ids, id)
+	return true
+}
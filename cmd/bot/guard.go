@@ -0,0 +1,251 @@
+package main
+
+import (
+	"container/list"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"legalbot/internal/config"
+)
+
+// Reasons a webhook request is rejected, the labels of
+// bot_webhook_rejections_total.
+const (
+	rejectSource      = "source"
+	rejectRateLimited = "rate_limited"
+	rejectMethod      = "method"
+	rejectContentType = "content_type"
+	rejectTooLarge    = "body_too_large"
+	rejectSecret      = "secret_token"
+)
+
+// webhookGuard screens webhook requests before the secret token is
+// checked: the source address may be limited to Telegram's networks, only
+// JSON POSTs of bounded size get through, and addresses that keep sending
+// a wrong secret token are refused for a while. Every rejection is counted
+// and logged with the client address.
+type webhookGuard struct {
+	// allowed holds the networks requests may come from; nil admits all.
+	allowed []netip.Prefix
+	// proxies are trusted to report the client in X-Forwarded-For.
+	proxies  []netip.Prefix
+	maxBody  int64
+	failures *failureLimiter
+	logger   *slog.Logger
+}
+
+// newWebhookGuard creates the guard the bot settings describe.
+func newWebhookGuard(b config.Bot, logger *slog.Logger) (*webhookGuard, error) {
+	proxies, err := b.ProxyNetworks()
+	if err != nil {
+		return nil, err
+	}
+	g := &webhookGuard{
+		proxies:  proxies,
+		maxBody:  int64(b.WebhookMaxBody),
+		failures: newFailureLimiter(b.WebhookFailureLimit, b.WebhookFailureWindow),
+		logger:   logger,
+	}
+	if b.WebhookAllowlist {
+		if g.allowed, err = b.AllowedNetworks(); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// wrap returns next behind the guard. Responses of 401 from next count as
+// secret token failures of the client address.
+func (g *webhookGuard) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := g.clientAddr(r)
+		switch {
+		case g.allowed != nil && !contains(g.allowed, client):
+			g.reject(w, r, client, rejectSource, http.StatusForbidden)
+			return
+		case !g.failures.allow(client):
+			g.reject(w, r, client, rejectRateLimited, http.StatusTooManyRequests)
+			return
+		case r.Method != http.MethodPost:
+			w.Header().Set("Allow", http.MethodPost)
+			g.reject(w, r, client, rejectMethod, http.StatusMethodNotAllowed)
+			return
+		case !isJSON(r.Header.Get("Content-Type")):
+			g.reject(w, r, client, rejectContentType, http.StatusUnsupportedMediaType)
+			return
+		case r.ContentLength > g.maxBody:
+			g.reject(w, r, client, rejectTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, g.maxBody)
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		switch sw.status {
+		case http.StatusUnauthorized:
+			g.failures.record(client)
+			g.rejected(r, client, rejectSecret)
+		case http.StatusRequestEntityTooLarge:
+			g.rejected(r, client, rejectTooLarge)
+		}
+	})
+}
+
+func (g *webhookGuard) reject(w http.ResponseWriter, r *http.Request, client netip.Addr, reason string, status int) {
+	g.rejected(r, client, reason)
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (g *webhookGuard) rejected(r *http.Request, client netip.Addr, reason string) {
+	webhookRejections.Inc(reason)
+	g.logger.WarnContext(r.Context(), "webhook request rejected", "reason", reason, "remote", client, "peer", r.RemoteAddr)
+}
+
+// clientAddr returns the address the request came from. X-Forwarded-For is
+// only read when the peer is a trusted proxy; it is walked from the right,
+// skipping further trusted proxies, so a client cannot forge its address by
+// sending the header itself.
+func (g *webhookGuard) clientAddr(r *http.Request) netip.Addr {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := peer.Addr().Unmap()
+	if !contains(g.proxies, addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !contains(g.proxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+func contains(nets []netip.Prefix, a netip.Addr) bool {
+	for _, n := range nets {
+		if n.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == "application/json"
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// maxFailureAddrs caps how many addresses the failure limiter remembers.
+const maxFailureAddrs = 10000
+
+// failureLimiter refuses addresses with limit failures within window. IPv6
+// addresses are counted per /64, which a single host can usually pick
+// addresses from freely. Only the maxFailureAddrs addresses that failed most
+// recently are remembered, so a scan from many addresses cannot grow it
+// without bound.
+type failureLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	order *list.List // most recent failure at the front
+	addrs map[netip.Prefix]*list.Element
+}
+
+// failures are the recent failures of one address or /64, oldest first.
+type failures struct {
+	key   netip.Prefix
+	times []time.Time
+}
+
+func newFailureLimiter(limit int, window time.Duration) *failureLimiter {
+	return &failureLimiter{limit: limit, window: window, now: time.Now, order: list.New(), addrs: map[netip.Prefix]*list.Element{}}
+}
+
+// failureKey returns the prefix failures of a are counted under.
+func failureKey(a netip.Addr) netip.Prefix {
+	a = a.Unmap()
+	bits := 32
+	if a.Is6() {
+		bits = 64
+	}
+	p, _ := a.Prefix(bits)
+	return p
+}
+
+// allow reports whether a has fewer than limit recent failures.
+func (l *failureLimiter) allow(a netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recent(failureKey(a), l.now())) < l.limit
+}
+
+// record counts a failure of a.
+func (l *failureLimiter) record(a netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	key := failureKey(a)
+	times := l.recent(key, now)
+	e, ok := l.addrs[key]
+	if ok {
+		l.order.MoveToFront(e)
+	} else {
+		e = l.order.PushFront(&failures{key: key})
+		l.addrs[key] = e
+		if l.order.Len() > maxFailureAddrs {
+			l.forget(l.order.Back())
+		}
+	}
+	e.Value.(*failures).times = append(times, now)
+}
+
+// recent drops the failures of key older than window and returns the rest.
+func (l *failureLimiter) recent(key netip.Prefix, now time.Time) []time.Time {
+	e, ok := l.addrs[key]
+	if !ok {
+		return nil
+	}
+	f := e.Value.(*failures)
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(f.times) && !f.times[i].After(cutoff) {
+		i++
+	}
+	f.times = f.times[i:]
+	if len(f.times) == 0 {
+		l.forget(e)
+	}
+	return f.times
+}
+
+func (l *failureLimiter) forget(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.addrs, e.Value.(*failures).key)
+}
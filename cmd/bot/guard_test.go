@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/secrets"
+)
+
+func newTestGuard(t *testing.T, edit func(*config.Bot)) *webhookGuard {
+	t.Helper()
+	b := config.Default().Bot
+	if edit != nil {
+		edit(&b)
+	}
+	g, err := newWebhookGuard(b, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// guardedRequest sends an update from remote through g to a webhook
+// accepting the secret "s".
+func guardedRequest(g *webhookGuard, remote, secret string, edit func(*http.Request)) int {
+	d := newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{})
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1}`))
+	r.RemoteAddr = remote
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	if edit != nil {
+		edit(r)
+	}
+	w := httptest.NewRecorder()
+	g.wrap(newWebhook(d, secrets.NewValue("s"))).ServeHTTP(w, r)
+	d.wait()
+	return w.Code
+}
+
+func TestGuardClientAddr(t *testing.T) {
+	g := newTestGuard(t, func(b *config.Bot) { b.TrustedProxies = []string{"10.0.0.0/8"} })
+	for _, tc := range []struct {
+		remote, xff, want string
+	}{
+		{"203.0.113.5:4000", "", "203.0.113.5"},
+		// Only trusted proxies are believed.
+		{"203.0.113.5:4000", "149.154.167.1", "203.0.113.5"},
+		{"10.0.0.2:4000", "149.154.167.1", "149.154.167.1"},
+		// A client prepending a forged address does not get it used.
+		{"10.0.0.2:4000", "149.154.167.1, 203.0.113.9", "203.0.113.9"},
+		// Chains of trusted proxies are skipped.
+		{"10.0.0.2:4000", "149.154.167.1, 10.0.0.3", "149.154.167.1"},
+		{"10.0.0.2:4000", "garbage", "10.0.0.2"},
+		{"[::ffff:203.0.113.5]:4000", "", "203.0.113.5"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if got := g.clientAddr(r); got != netip.MustParseAddr(tc.want) {
+			t.Errorf("%s with X-Forwarded-For %q: %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
+
+func TestGuardAllowlist(t *testing.T) {
+	g := newTestGuard(t, func(b *config.Bot) {
+		b.WebhookAllowlist = true
+		b.TrustedProxies = []string{"10.0.0.1"}
+	})
+	before := webhookRejections.Value(rejectSource)
+	if code := guardedRequest(g, "149.154.167.99:443", "s", nil); code != http.StatusOK {
+		t.Fatalf("Telegram address: %d", code)
+	}
+	if code := guardedRequest(g, "203.0.113.5:443", "s", nil); code != http.StatusForbidden {
+		t.Fatalf("outside address: %d, want 403", code)
+	}
+	forwarded := func(r *http.Request) { r.Header.Set("X-Forwarded-For", "91.108.4.10") }
+	if code := guardedRequest(g, "10.0.0.1:443", "s", forwarded); code != http.StatusOK {
+		t.Fatalf("Telegram behind the proxy: %d", code)
+	}
+	if code := guardedRequest(g, "203.0.113.5:443", "s", forwarded); code != http.StatusForbidden {
+		t.Fatalf("forged X-Forwarded-For: %d, want 403", code)
+	}
+	if got := webhookRejections.Value(rejectSource) - before; got != 2 {
+		t.Fatalf("source rejections = %v, want 2", got)
+	}
+
+	// Without the allowlist any address may try.
+	if code := guardedRequest(newTestGuard(t, nil), "203.0.113.5:443", "s", nil); code != http.StatusOK {
+		t.Fatalf("allowlist off: %d", code)
+	}
+}
+
+func TestGuardRequestShape(t *testing.T) {
+	g := newTestGuard(t, func(b *config.Bot) { b.WebhookMaxBody = 64 })
+	for _, tc := range []struct {
+		name string
+		edit func(*http.Request)
+		want int
+	}{
+		{"GET", func(r *http.Request) { r.Method = http.MethodGet }, http.StatusMethodNotAllowed},
+		{"form", func(r *http.Request) { r.Header.Set("Content-Type", "application/x-www-form-urlencoded") }, http.StatusUnsupportedMediaType},
+		{"no content type", func(r *http.Request) { r.Header.Del("Content-Type") }, http.StatusUnsupportedMediaType},
+		{"charset", func(r *http.Request) { r.Header.Set("Content-Type", "application/json; charset=utf-8") }, http.StatusOK},
+		{"declared too large", func(r *http.Request) {
+			body := `{"update_id":1,"message":{"text":"` + strings.Repeat("x", 100) + `"}}`
+			r.Body, r.ContentLength = io.NopCloser(strings.NewReader(body)), int64(len(body))
+		}, http.StatusRequestEntityTooLarge},
+		{"chunked too large", func(r *http.Request) {
+			r.Body, r.ContentLength = io.NopCloser(strings.NewReader(`{"update_id":1,"message":{"text":"`+strings.Repeat("x", 100)+`"}}`)), -1
+		}, http.StatusRequestEntityTooLarge},
+	} {
+		if code := guardedRequest(g, "203.0.113.5:443", "s", tc.edit); code != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, code, tc.want)
+		}
+	}
+}
+
+func TestGuardLimitsSecretFailures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(t, func(b *config.Bot) { b.WebhookFailureLimit = 3 })
+	g.failures.now = func() time.Time { return now }
+	before := webhookRejections.Value(rejectSecret)
+	for i := 0; i < 3; i++ {
+		if code := guardedRequest(g, "203.0.113.5:443", "wrong", nil); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: %d, want 401", i, code)
+		}
+	}
+	if got := webhookRejections.Value(rejectSecret) - before; got != 3 {
+		t.Fatalf("secret rejections = %v, want 3", got)
+	}
+	// The address is now refused even with the right secret; others are not.
+	if code := guardedRequest(g, "203.0.113.5:443", "s", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("after the limit: %d, want 429", code)
+	}
+	if code := guardedRequest(g, "203.0.113.6:443", "s", nil); code != http.StatusOK {
+		t.Fatalf("other address: %d", code)
+	}
+	now = now.Add(time.Minute)
+	if code := guardedRequest(g, "203.0.113.5:443", "s", nil); code != http.StatusOK {
+		t.Fatalf("after the window: %d", code)
+	}
+}
+
+func TestFailureLimiterBounded(t *testing.T) {
+	l := newFailureLimiter(1, time.Hour)
+	first := netip.MustParseAddr("198.51.100.1")
+	l.record(first)
+	for i := 0; i < maxFailureAddrs; i++ {
+		l.record(netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}))
+	}
+	if len(l.addrs) != maxFailureAddrs || l.order.Len() != maxFailureAddrs {
+		t.Fatalf("remembers %d addresses, want %d", len(l.addrs), maxFailureAddrs)
+	}
+	if !l.allow(first) {
+		t.Fatal("the oldest address was not forgotten")
+	}
+	if l.allow(netip.AddrFrom4([4]byte{10, 0, 0, 1})) {
+		t.Fatal("a recent address was forgotten")
+	}
+}
+
+func TestFailureLimiterGroupsIPv6By64(t *testing.T) {
+	l := newFailureLimiter(2, time.Hour)
+	l.record(netip.MustParseAddr("2001:db8:1:2::1"))
+	l.record(netip.MustParseAddr("2001:db8:1:2::ffff"))
+	if l.allow(netip.MustParseAddr("2001:db8:1:2:abcd::1")) {
+		t.Fatal("addresses of one /64 are counted separately")
+	}
+	if !l.allow(netip.MustParseAddr("2001:db8:1:3::1")) {
+		t.Fatal("another /64 is refused")
+	}
+	l.record(netip.MustParseAddr("::ffff:192.0.2.1"))
+	l.record(netip.MustParseAddr("192.0.2.1"))
+	if l.allow(netip.MustParseAddr("192.0.2.1")) || !l.allow(netip.MustParseAddr("192.0.2.2")) {
+		t.Fatal("IPv4 addresses are not counted one by one")
+	}
+}
@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"strings"
 	"sync"
+	"time"
 
+	"legalbot/internal/claim"
 	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/pii"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
 )
 
 // langPrefs stores user language preferences using a mutex for safe concurrent access.
@@ -36,26 +42,51 @@ func (l *langPrefs) get(id int64) string {
 
 var langPref = langPrefs{m: map[int64]string{}}
 
-// handleLang changes the language preference for a chat.
-func handleLang(chatID int64, lang string) {
-	langPref.set(chatID, lang)
+// handleLang changes the language preference of a user.
+func handleLang(userID int64, lang string) {
+	langPref.set(userID, lang)
 }
 
-// langFor returns language preference or default "en".
-func langFor(chatID int64) string {
-	return langPref.get(chatID)
+// langFor returns the user's language preference or default "en".
+func langFor(userID int64) string {
+	return langPref.get(userID)
 }
 
 type TelegramSender interface {
 	SendMessage(ctx context.Context, chatID int64, text string) error
+	SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error
+	SendFormatted(ctx context.Context, chatID int64, f telegram.Formatted, markup telegram.ReplyMarkup) error
 }
 
 type OpenRouterClient interface {
 	ChatCompletion(ctx context.Context, prompt string) (string, error)
 }
 
+type PromptBuilder interface {
+	Build(ctx context.Context, req prompt.Request) (prompt.Result, error)
+}
+
 type ResultSaver interface {
-	SaveResult(ctx context.Context, chatID int64, data string) (int64, error)
+	SaveResult(ctx context.Context, chatID, userID int64, data string, meta db.ResultMeta) (int64, error)
+}
+
+type ClaimTracker interface {
+	CreateClaim(ctx context.Context, chatID, userID int64, receivedAt time.Time) (int64, error)
+	TransitionClaim(ctx context.Context, id int64, from, to db.ClaimState, reason string) error
+	SetClaimResult(ctx context.Context, id, resultID int64) error
+}
+
+// ClaimRepository stores claim results and attachments, tracks their
+// lifecycle and knows whether the user consented to the data policy.
+type ClaimRepository interface {
+	ResultSaver
+	ClaimTracker
+	AttachmentSaver
+	ConsentChecker
+}
+
+type ClaimLister interface {
+	ChatClaims(ctx context.Context, chatID, userID int64, limit int) ([]db.Claim, error)
 }
 
 type ResultFetcher interface {
@@ -63,25 +94,14 @@ type ResultFetcher interface {
 }
 
 type HistoryDeleter interface {
-	DeleteHistory(ctx context.Context, chatID int64) error
+	DeleteHistory(ctx context.Context, userID int64) error
 }
 
 type RateLimiter interface {
-	Allow(chatID int64) bool
-}
-
-// loadDocsBaseURL returns the documentation base URL using the DOCS_BASE_URL
-// environment variable if set, otherwise falling back to the default value.
-func loadDocsBaseURL() string {
-	if v := os.Getenv("DOCS_BASE_URL"); v != "" {
-		return v
-	}
-	return "https://example.com/docs"
+	Allow(userID int64) bool
 }
 
-var docsBaseURL = loadDocsBaseURL()
-
-const temporaryErrorMsg = "temporary error, please try again later"
+const temporaryErrorMsg = claim.TemporaryErrorMsg
 
 // checkSecretToken validates the Telegram secret token header.
 // It returns true if the header matches the expected token.
@@ -96,50 +116,146 @@ func checkSecretToken(r *http.Request, expected string, l *slog.Logger) bool {
 	return true
 }
 
-// handleClaim processes user claim: sends prompt to OpenRouter, saves the result and sends it back to Telegram.
-func handleClaim(ctx context.Context, tg TelegramSender, or OpenRouterClient, repo ResultSaver, limiter RateLimiter, chatID int64, prompt string) error {
-	if len(prompt) > 8000 {
-		return fmt.Errorf("message too long: %d characters", len(prompt))
+// startClaim creates the claim o is filing and returns its ID, or zero if
+// it could not be tracked. Tracking errors never stop the claim from being
+// answered.
+func startClaim(ctx context.Context, repo ClaimTracker, o origin) int64 {
+	id, err := repo.CreateClaim(ctx, o.ChatID, o.UserID, receivedAt(ctx))
+	if err != nil {
+		slog.ErrorContext(ctx, "claim create", "chat_id", o.ChatID, "user_id", o.UserID, "err", err)
+		return 0
+	}
+	return id
+}
+
+// ClaimQueue queues accepted claims for cmd/worker.
+type ClaimQueue interface {
+	Publish(ctx context.Context, t claim.Task) error
+}
+
+// claimQueue is set by main when a broker is configured. Without it, or
+// when publishing fails, handleClaim answers the claim itself.
+var claimQueue ClaimQueue
+
+// handleClaim accepts a user's claim and queues it for the worker, which
+// builds the golden prompt, sends it to OpenRouter, saves the result and
+// sends it back to Telegram.
+// Claims are refused until the user accepts the current data policy, and are
+// rate limited per user. Every accepted claim is tracked so the user can
+// follow it with /status, and files uploaded before it are attached as
+// evidence.
+func handleClaim(ctx context.Context, tg TelegramSender, or OpenRouterClient, pb PromptBuilder, repo ClaimRepository, limiter RateLimiter, o origin, text string) error {
+	chatID := o.ChatID
+	outcome := outcomeDelivered
+	defer observeClaim(&outcome, receivedAt(ctx))
+	if len(text) > 8000 {
+		outcome = outcomeTooLong
+		return fmt.Errorf("message too long: %d characters", len(text))
+	}
+	if ok, err := checkConsent(ctx, tg, repo, o); !ok {
+		outcome = outcomeNoConsent
+		return err
 	}
-	if !limiter.Allow(chatID) {
+	if !limiter.Allow(o.UserID) {
+		outcome = outcomeRateLimited
 		if err := tg.SendMessage(ctx, chatID, "rate limit exceeded, try again later"); err != nil {
 			return err
 		}
 		return nil
 	}
-	resp, err := or.ChatCompletion(ctx, prompt)
+	id := startClaim(ctx, repo, o)
+	task := claim.Task{
+		ClaimID:    id,
+		ChatID:     chatID,
+		UserID:     o.UserID,
+		ThreadID:   telegram.ThreadID(ctx),
+		Text:       text,
+		Evidence:   attachEvidence(ctx, repo, id, o),
+		ReceivedAt: receivedAt(ctx),
+	}
+	if claimQueue != nil {
+		err := claimQueue.Publish(ctx, task)
+		if err == nil {
+			outcome = outcomeQueued
+			return nil
+		}
+		slog.ErrorContext(ctx, "queue claim, answering it here", "claim_id", id, "err", err)
+	}
+	p := claim.Processor{Telegram: tg, Prompt: pb, Model: or, Repo: repo, Redactor: redactor, Callbacks: callbacks}
+	outcome, err := p.Process(ctx, task)
+	return err
+}
+
+// statusLimit is how many of the latest claims /status lists.
+const statusLimit = 10
+
+// timeNow is replaced in tests.
+var timeNow = time.Now
+
+// redactor removes personal data from claims before they reach the model.
+// main replaces it with the one the configuration describes.
+var redactor = pii.New(pii.Redact)
+
+// handleStatus lists the in-flight and recent claims the user filed in the
+// chat with elapsed times. In groups members only see their own claims.
+func handleStatus(ctx context.Context, tg TelegramSender, repo ClaimLister, o origin) error {
+	claims, err := repo.ChatClaims(ctx, o.ChatID, o.UserID, statusLimit)
 	if err != nil {
-		slog.Error("openrouter", "err", err)
-		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
+		slog.ErrorContext(ctx, "db claims", "err", err)
+		if sendErr := tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg); sendErr != nil {
 			return sendErr
 		}
 		return nil
 	}
-	if _, err := repo.SaveResult(ctx, chatID, resp); err != nil {
-		slog.Error("db save", "err", err)
-		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
-			return sendErr
+	return tg.SendMessage(ctx, o.ChatID, formatStatus(langFor(o.UserID), claims, timeNow()))
+}
+
+// formatStatus renders claims, newest first, split into in-flight and finished.
+func formatStatus(lang string, claims []db.Claim, now time.Time) string {
+	if len(claims) == 0 {
+		return help.Phrase(lang, "status.none")
+	}
+	var active, recent []string
+	for _, c := range claims {
+		line := fmt.Sprintf("#%d %s — %s", c.ID, help.Phrase(lang, "state."+string(c.State)), help.Duration(lang, c.Elapsed(now)))
+		if c.State.Terminal() {
+			recent = append(recent, line)
+		} else {
+			active = append(active, line)
 		}
-		return nil
 	}
-	if err := tg.SendMessage(ctx, chatID, resp); err != nil {
-		return err
+	var b strings.Builder
+	if len(active) > 0 {
+		b.WriteString(help.Phrase(lang, "status.active"))
+		b.WriteString("\n" + strings.Join(active, "\n"))
 	}
-	return nil
+	if len(recent) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(help.Phrase(lang, "status.recent"))
+		b.WriteString("\n" + strings.Join(recent, "\n"))
+	}
+	return b.String()
 }
 
-// handleRecent sends links to recent documents for a chat.
-func handleRecent(ctx context.Context, tg TelegramSender, repo ResultFetcher, chatID int64) error {
+// handleRecent sends links to the user's recent documents, under docsURL.
+// Groups are refused so members do not see each other's documents.
+func handleRecent(ctx context.Context, tg TelegramSender, repo ResultFetcher, docsURL string, o origin) error {
+	chatID := o.ChatID
+	if o.group() {
+		return tg.SendMessage(ctx, chatID, help.Phrase(langFor(o.UserID), "private.only"))
+	}
 	res, err := repo.RecentResults(ctx, chatID, 5)
 	if err != nil {
-		slog.Error("db recent", "err", err)
+		slog.ErrorContext(ctx, "db recent", "err", err)
 		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
 			return sendErr
 		}
 		return nil
 	}
 	for _, r := range res {
-		link := fmt.Sprintf("%s/%d", docsBaseURL, r.ID)
+		link := fmt.Sprintf("%s/%d", strings.TrimRight(docsURL, "/"), r.ID)
 		if err := tg.SendMessage(ctx, chatID, link); err != nil {
 			return err
 		}
@@ -147,14 +263,16 @@ func handleRecent(ctx context.Context, tg TelegramSender, repo ResultFetcher, ch
 	return nil
 }
 
-// handleDelete removes chat history.
-func handleDelete(ctx context.Context, tg TelegramSender, repo HistoryDeleter, chatID int64) error {
-	if err := repo.DeleteHistory(ctx, chatID); err != nil {
-		slog.Error("db delete", "err", err)
-		if sendErr := tg.SendMessage(ctx, chatID, temporaryErrorMsg); sendErr != nil {
+// handleDelete removes the user's history in every chat, including files
+// not yet attached to a claim.
+func handleDelete(ctx context.Context, tg TelegramSender, repo HistoryDeleter, o origin) error {
+	pending.clear(o.UserID)
+	if err := repo.DeleteHistory(ctx, o.UserID); err != nil {
+		slog.ErrorContext(ctx, "db delete", "err", err)
+		if sendErr := tg.SendMessage(ctx, o.ChatID, temporaryErrorMsg); sendErr != nil {
 			return sendErr
 		}
 		return nil
 	}
-	return tg.SendMessage(ctx, chatID, "history deleted")
+	return tg.SendMessage(ctx, o.ChatID, "history deleted")
 }
@@ -2,28 +2,85 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"log/slog"
 
+	"legalbot/internal/claim"
 	"legalbot/internal/db"
+	"legalbot/internal/help"
+	"legalbot/internal/openrouter"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
 )
 
 type mockTelegram struct {
-	chatID   int64
-	text     string
-	messages []string
-	err      error
+	chatID    int64
+	thread    int64
+	text      string
+	messages  []string
+	markup    telegram.ReplyMarkup
+	answered  []string
+	notices   []string
+	formatted []telegram.Formatted
+	err       error
+	// files maps file IDs to their contents for GetFile and DownloadFile.
+	files map[string][]byte
+	// admins are the user IDs GetChatMember reports as administrators.
+	admins map[int64]bool
+}
+
+func (m *mockTelegram) GetChatMember(ctx context.Context, chatID, userID int64) (telegram.ChatMember, error) {
+	if m.admins[userID] {
+		return telegram.ChatMember{Status: "administrator", User: telegram.User{ID: userID}}, nil
+	}
+	return telegram.ChatMember{Status: "member", User: telegram.User{ID: userID}}, nil
+}
+
+func (m *mockTelegram) GetFile(ctx context.Context, fileID string) (telegram.File, error) {
+	data, ok := m.files[fileID]
+	if !ok {
+		return telegram.File{}, &telegram.APIError{Method: "getFile", Code: 400, Description: "Bad Request: invalid file_id"}
+	}
+	return telegram.File{FileID: fileID, FilePath: fileID, FileSize: int64(len(data))}, nil
+}
+
+func (m *mockTelegram) DownloadFile(ctx context.Context, f telegram.File, maxBytes int64) ([]byte, error) {
+	if f.FileSize > maxBytes {
+		return nil, telegram.ErrFileTooLarge
+	}
+	return m.files[f.FilePath], nil
+}
+
+func (m *mockTelegram) SendFormatted(ctx context.Context, chatID int64, f telegram.Formatted, markup telegram.ReplyMarkup) error {
+	m.formatted = append(m.formatted, f)
+	m.markup = markup
+	return m.SendMessage(ctx, chatID, f.Text)
+}
+
+func (m *mockTelegram) AnswerCallbackQuery(ctx context.Context, queryID, text string, showAlert bool) error {
+	m.answered = append(m.answered, queryID)
+	m.notices = append(m.notices, text)
+	return nil
+}
+
+func (m *mockTelegram) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	m.markup = markup
+	return m.SendMessage(ctx, chatID, text)
 }
 
 func (m *mockTelegram) SendMessage(ctx context.Context, chatID int64, text string) error {
 	m.chatID = chatID
+	m.thread = telegram.ThreadID(ctx)
 	m.text = text
 	m.messages = append(m.messages, text)
 	return m.err
@@ -40,21 +97,131 @@ func (m *mockOpenRouter) ChatCompletion(ctx context.Context, prompt string) (str
 	return m.resp, m.err
 }
 
+type mockPrompt struct {
+	req prompt.Request
+	err error
+}
+
+func (m *mockPrompt) Build(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+	m.req = req
+	return prompt.Result{Prompt: "prompt:" + req.UserText, Version: "v-test", Category: "consumer"}, m.err
+}
+
 type mockRepo struct {
 	chatID  int64
+	userID  int64
 	data    string
+	meta    db.ResultMeta
 	id      int64
 	results []db.Result
 	err     error
+
+	claimID  int64
+	states   []db.ClaimState
+	reason   string
+	resultID int64
+	claims   []db.Claim
+	trackErr error
+	received time.Time
+
+	attachments []db.Attachment
+
+	// consent is returned by Consent; nil means the current policy was accepted.
+	consent    *db.Consent
+	consentErr error
+
+	group     db.GroupAccess
+	claimants map[int64]bool
+
+	// rated is the result rated last and rating its score.
+	rated  int64
+	rating int
+}
+
+func (m *mockRepo) GroupAccess(ctx context.Context, chatID int64) (db.GroupAccess, error) {
+	return m.group, m.err
+}
+
+func (m *mockRepo) SetGroupRestricted(ctx context.Context, chatID int64, restricted bool, by int64) error {
+	m.group.Restricted = restricted
+	return m.err
+}
+
+func (m *mockRepo) AllowClaimant(ctx context.Context, chatID, userID, by int64) error {
+	if m.claimants == nil {
+		m.claimants = map[int64]bool{}
+	}
+	m.claimants[userID] = true
+	m.group.Allowed = len(m.claimants)
+	return m.err
+}
+
+func (m *mockRepo) RemoveClaimant(ctx context.Context, chatID, userID int64) error {
+	delete(m.claimants, userID)
+	m.group.Allowed = len(m.claimants)
+	return m.err
+}
+
+func (m *mockRepo) IsClaimant(ctx context.Context, chatID, userID int64) (bool, error) {
+	return m.claimants[userID], m.err
+}
+
+func (m *mockRepo) Consent(ctx context.Context, userID int64) (db.Consent, error) {
+	if m.consent == nil {
+		return db.Consent{Version: help.PolicyVersion, Accepted: true}, m.consentErr
+	}
+	return *m.consent, m.consentErr
+}
+
+func (m *mockRepo) SetConsent(ctx context.Context, userID int64, version string, accepted bool) error {
+	m.userID = userID
+	m.consent = &db.Consent{Version: version, Accepted: accepted}
+	return m.consentErr
+}
+
+func (m *mockRepo) CreateClaim(ctx context.Context, chatID, userID int64, receivedAt time.Time) (int64, error) {
+	m.received = receivedAt
+	if m.trackErr != nil {
+		return 0, m.trackErr
+	}
+	m.states = append(m.states, db.ClaimQueued)
+	return m.claimID, nil
+}
+
+func (m *mockRepo) TransitionClaim(ctx context.Context, id int64, from, to db.ClaimState, reason string) error {
+	if id != m.claimID || from != m.states[len(m.states)-1] || !from.CanTransition(to) {
+		return db.ErrInvalidTransition
+	}
+	m.states = append(m.states, to)
+	m.reason = reason
+	return nil
+}
+
+func (m *mockRepo) SaveAttachment(ctx context.Context, a db.Attachment) (int64, error) {
+	m.attachments = append(m.attachments, a)
+	return int64(len(m.attachments)), nil
+}
+
+func (m *mockRepo) SetClaimResult(ctx context.Context, id, resultID int64) error {
+	m.resultID = resultID
+	return nil
+}
+
+func (m *mockRepo) ChatClaims(ctx context.Context, chatID, userID int64, limit int) ([]db.Claim, error) {
+	m.chatID = chatID
+	m.userID = userID
+	return m.claims, m.err
 }
 
 type mockLimiter struct{ ok bool }
 
 func (m *mockLimiter) Allow(id int64) bool { return m.ok }
 
-func (m *mockRepo) SaveResult(ctx context.Context, chatID int64, data string) (int64, error) {
+func (m *mockRepo) SaveResult(ctx context.Context, chatID, userID int64, data string, meta db.ResultMeta) (int64, error) {
 	m.chatID = chatID
+	m.userID = userID
 	m.data = data
+	m.meta = meta
 	return m.id, m.err
 }
 
@@ -63,8 +230,13 @@ func (m *mockRepo) RecentResults(ctx context.Context, chatID int64, limit int) (
 	return m.results, m.err
 }
 
-func (m *mockRepo) DeleteHistory(ctx context.Context, chatID int64) error {
-	m.chatID = chatID
+func (m *mockRepo) RateResult(ctx context.Context, id, chatID int64, rating int) error {
+	m.rated, m.chatID, m.rating = id, chatID, rating
+	return m.err
+}
+
+func (m *mockRepo) DeleteHistory(ctx context.Context, userID int64) error {
+	m.userID = userID
 	return m.err
 }
 
@@ -74,26 +246,104 @@ func TestHandleClaimSuccess(t *testing.T) {
 	repo := &mockRepo{id: 1}
 	lim := &mockLimiter{ok: true}
 	ctx := context.Background()
-	if err := handleClaim(ctx, tg, or, repo, lim, 123, "hi"); err != nil {
+	if err := handleClaim(ctx, tg, or, &mockPrompt{}, repo, lim, private(123), "hi"); err != nil {
 		t.Fatal(err)
 	}
-	if or.prompt != "hi" {
+	if or.prompt != "prompt:hi" {
 		t.Errorf("unexpected prompt %s", or.prompt)
 	}
 	if repo.chatID != 123 || repo.data != "ok" {
 		t.Errorf("repo got %d %s", repo.chatID, repo.data)
 	}
+	if repo.meta.PromptVersion != "v-test" || repo.meta.Category != "consumer" || repo.meta.ParseOK {
+		t.Errorf("unexpected meta %+v", repo.meta)
+	}
 	if tg.chatID != 123 || tg.text != "ok" {
 		t.Errorf("telegram got %d %s", tg.chatID, tg.text)
 	}
 }
 
+func TestHandleClaimParsedAnswer(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: `{"advice_md":"a","claim_md":"c","lawsuit_md":"l"}`}
+	pb := &mockPrompt{}
+	repo := &mockRepo{id: 1}
+	lim := &mockLimiter{ok: true}
+	if err := handleClaim(context.Background(), tg, or, pb, repo, lim, private(42), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if pb.req.ChatID != 42 {
+		t.Errorf("chat id not passed to prompt builder: %+v", pb.req)
+	}
+	if !repo.meta.ParseOK {
+		t.Errorf("expected parse ok, got %+v", repo.meta)
+	}
+	if len(tg.formatted) != 3 || tg.formatted[0].ParseMode != telegram.ParseModeHTML || tg.messages[2] != "l" {
+		t.Errorf("answer not sent as formatted parts: %q", tg.messages)
+	}
+}
+
+func TestHandleClaimChatCompletionResponse(t *testing.T) {
+	content := "```json\n{\"advice_md\":\"**Совет**\",\"claim_md\":\"Претензия\",\"lawsuit_md\":\"Иск\"}\n```"
+	envelope, _ := json.Marshal(map[string]any{
+		"id":      "gen-1",
+		"object":  "chat.completion",
+		"model":   "openai/gpt-4o-mini",
+		"choices": []any{map[string]any{"index": 0, "finish_reason": "stop", "message": map[string]string{"role": "assistant", "content": content}}},
+		"usage":   map[string]int{"prompt_tokens": 900, "completion_tokens": 120, "total_tokens": 1020},
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(envelope)
+	}))
+	defer srv.Close()
+
+	or := openrouter.NewWithOptions("key", openrouter.WithEndpoint(srv.URL), openrouter.WithLogger(nil))
+	tg := &mockTelegram{}
+	repo := &mockRepo{id: 1}
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(42), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.meta.ParseOK || !strings.Contains(repo.data, "Претензия") || strings.Contains(repo.data, "choices") {
+		t.Errorf("completion content not parsed: ok=%v data=%s", repo.meta.ParseOK, repo.data)
+	}
+	if len(tg.formatted) != 3 || tg.messages[0] != "<b>Совет</b>" || tg.messages[2] != "Иск" {
+		t.Errorf("answer not sent as formatted parts: %q", tg.messages)
+	}
+}
+
+func TestHandleClaimRedactsPersonalData(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: `{"advice_md":"a","claim_md":"Истец: паспорт [PASSPORT_1], тел. [PHONE_1]","lawsuit_md":"Вернуть на карту CARD_1"}`}
+	pb := &mockPrompt{}
+	repo := &mockRepo{id: 1}
+	text := "Паспорт 45 06 123456, телефон +7 (999) 123-45-67. Списали деньги с карты 4111 1111 1111 1111."
+	if err := handleClaim(context.Background(), tg, or, pb, repo, &mockLimiter{ok: true}, private(42), text); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"123456", "123-45-67", "4111"} {
+		if strings.Contains(pb.req.UserText, v) || strings.Contains(or.prompt, v) {
+			t.Errorf("%q sent towards the model: %q", v, or.prompt)
+		}
+	}
+	if !strings.Contains(pb.req.UserText, "[PHONE_1]") {
+		t.Errorf("no placeholder in %q", pb.req.UserText)
+	}
+	if len(tg.messages) != 3 || !strings.Contains(tg.messages[1], "45 06 123456") || !strings.Contains(tg.messages[1], "+7 (999) 123-45-67") ||
+		!strings.Contains(tg.messages[2], "4111 1111 1111 1111") {
+		t.Errorf("originals not restored in the answer: %q", tg.messages)
+	}
+	if !strings.Contains(repo.data, "45 06 123456") || !repo.meta.ParseOK {
+		t.Errorf("originals not restored in the saved result: %s", repo.data)
+	}
+}
+
 func TestHandleClaimOpenRouterError(t *testing.T) {
 	tg := &mockTelegram{}
 	or := &mockOpenRouter{err: errors.New("boom")}
 	repo := &mockRepo{}
 	lim := &mockLimiter{ok: true}
-	if err := handleClaim(context.Background(), tg, or, repo, lim, 1, "hi"); err != nil {
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if repo.data != "" {
@@ -104,12 +354,32 @@ func TestHandleClaimOpenRouterError(t *testing.T) {
 	}
 }
 
+func TestHandleClaimPromptError(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{}
+	pb := &mockPrompt{err: errors.New("templates")}
+	repo := &mockRepo{}
+	lim := &mockLimiter{ok: true}
+	if err := handleClaim(context.Background(), tg, or, pb, repo, lim, private(1), "hi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pb.req.UserText != "hi" {
+		t.Errorf("unexpected prompt request %+v", pb.req)
+	}
+	if or.prompt != "" {
+		t.Errorf("openrouter should not be called")
+	}
+	if tg.text != temporaryErrorMsg {
+		t.Errorf("unexpected message %s", tg.text)
+	}
+}
+
 func TestHandleClaimRepoError(t *testing.T) {
 	tg := &mockTelegram{}
 	or := &mockOpenRouter{resp: "x"}
 	repo := &mockRepo{err: errors.New("db")}
 	lim := &mockLimiter{ok: true}
-	if err := handleClaim(context.Background(), tg, or, repo, lim, 1, "hi"); err != nil {
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if repo.chatID != 1 || repo.data != "x" {
@@ -125,11 +395,149 @@ func TestHandleClaimTelegramError(t *testing.T) {
 	or := &mockOpenRouter{resp: "x"}
 	repo := &mockRepo{}
 	lim := &mockLimiter{ok: true}
-	if err := handleClaim(context.Background(), tg, or, repo, lim, 1, "hi"); err == nil {
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), "hi"); err == nil {
 		t.Fatal("expected error")
 	}
 }
 
+func TestHandleClaimTracksLifecycle(t *testing.T) {
+	tg := &mockTelegram{}
+	repo := &mockRepo{id: 5, claimID: 9}
+	lim := &mockLimiter{ok: true}
+	if err := handleClaim(context.Background(), tg, &mockOpenRouter{resp: "ok"}, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	want := []db.ClaimState{db.ClaimQueued, db.ClaimBuildingPrompt, db.ClaimCallingModel, db.ClaimRenderingDocs, db.ClaimDelivered}
+	if fmt.Sprint(repo.states) != fmt.Sprint(want) {
+		t.Fatalf("unexpected states %v", repo.states)
+	}
+	if repo.resultID != 5 {
+		t.Fatalf("result not linked: %d", repo.resultID)
+	}
+}
+
+func TestHandleClaimTracksFailure(t *testing.T) {
+	tg := &mockTelegram{}
+	repo := &mockRepo{claimID: 9}
+	lim := &mockLimiter{ok: true}
+	or := &mockOpenRouter{err: errors.New("timeout")}
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if last := repo.states[len(repo.states)-1]; last != db.ClaimFailed || repo.reason != "openrouter: timeout" {
+		t.Fatalf("unexpected final state %s %q", last, repo.reason)
+	}
+}
+
+func TestHandleClaimTrackingErrorStillAnswers(t *testing.T) {
+	tg := &mockTelegram{}
+	repo := &mockRepo{trackErr: errors.New("db down")}
+	lim := &mockLimiter{ok: true}
+	if err := handleClaim(context.Background(), tg, &mockOpenRouter{resp: "ok"}, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if tg.text != "ok" || len(repo.states) != 0 {
+		t.Fatalf("unexpected result %q %v", tg.text, repo.states)
+	}
+}
+
+type mockQueue struct {
+	tasks []claim.Task
+	err   error
+}
+
+func (m *mockQueue) Publish(ctx context.Context, t claim.Task) error {
+	m.tasks = append(m.tasks, t)
+	return m.err
+}
+
+func withQueue(t *testing.T, q ClaimQueue) {
+	claimQueue = q
+	t.Cleanup(func() { claimQueue = nil })
+}
+
+func TestHandleClaimQueued(t *testing.T) {
+	q := &mockQueue{}
+	withQueue(t, q)
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: "ok"}
+	repo := &mockRepo{claimID: 9}
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ctx := telegram.WithThread(withReceived(context.Background(), received), 11)
+	queued := claimsTotal.Value(outcomeQueued)
+	if err := handleClaim(ctx, tg, or, &mockPrompt{}, repo, &mockLimiter{ok: true}, origin{ChatID: testGroup, UserID: 5}, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	want := claim.Task{ClaimID: 9, ChatID: testGroup, UserID: 5, ThreadID: 11, Text: "hi", ReceivedAt: received}
+	if len(q.tasks) != 1 || fmt.Sprint(q.tasks[0]) != fmt.Sprint(want) {
+		t.Fatalf("queued %+v", q.tasks)
+	}
+	if or.prompt != "" || len(tg.messages) != 0 || fmt.Sprint(repo.states) != "[queued]" {
+		t.Fatalf("queued claim answered by the bot: prompt %q, messages %q, states %v", or.prompt, tg.messages, repo.states)
+	}
+	if claimsTotal.Value(outcomeQueued) != queued+1 {
+		t.Fatal("queued claim not counted")
+	}
+}
+
+func TestHandleClaimQueueErrorAnswersInline(t *testing.T) {
+	withQueue(t, &mockQueue{err: errors.New("broker down")})
+	tg := &mockTelegram{}
+	repo := &mockRepo{id: 5, claimID: 9}
+	if err := handleClaim(context.Background(), tg, &mockOpenRouter{resp: "ok"}, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(1), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if tg.text != "ok" || repo.states[len(repo.states)-1] != db.ClaimDelivered {
+		t.Fatalf("claim not answered: %q %v", tg.text, repo.states)
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	done := now.Add(-time.Hour + 40*time.Second)
+	repo := &mockRepo{claims: []db.Claim{
+		{ID: 3, State: db.ClaimCallingModel, CreatedAt: now.Add(-8 * time.Second)},
+		{ID: 2, State: db.ClaimDelivered, CreatedAt: now.Add(-time.Hour), FinishedAt: &done},
+		{ID: 1, State: db.ClaimFailed, CreatedAt: now.Add(-2 * time.Hour), FinishedAt: &now},
+	}}
+	tg := &mockTelegram{}
+	if err := handleStatus(context.Background(), tg, repo, private(7)); err != nil {
+		t.Fatal(err)
+	}
+	want := "In progress:\n#3 waiting for the answer — 8 s\n\nRecent:\n#2 delivered — 40 s\n#1 failed — 2 h 0 min"
+	if tg.text != want {
+		t.Fatalf("unexpected status:\n%s", tg.text)
+	}
+	if repo.chatID != 7 {
+		t.Fatalf("repo not called")
+	}
+}
+
+func TestHandleStatusEmptyRU(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	handleLang(7, "ru")
+	tg := &mockTelegram{}
+	if err := handleStatus(context.Background(), tg, &mockRepo{}, private(7)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tg.text, "У вас пока нет обращений") {
+		t.Fatalf("unexpected text %q", tg.text)
+	}
+}
+
+func TestHandleStatusRepoError(t *testing.T) {
+	tg := &mockTelegram{}
+	if err := handleStatus(context.Background(), tg, &mockRepo{err: errors.New("db")}, private(7)); err != nil {
+		t.Fatal(err)
+	}
+	if tg.text != temporaryErrorMsg {
+		t.Fatalf("unexpected text %q", tg.text)
+	}
+}
+
 func TestHandleLang(t *testing.T) {
 	langPref = langPrefs{m: map[int64]string{}}
 	handleLang(1, "ru")
@@ -171,9 +579,7 @@ func TestLangConcurrentAccess(t *testing.T) {
 func TestHandleRecent(t *testing.T) {
 	tg := &mockTelegram{}
 	repo := &mockRepo{results: []db.Result{{ID: 1}, {ID: 2}}}
-	t.Setenv("DOCS_BASE_URL", "http://d")
-	docsBaseURL = loadDocsBaseURL()
-	if err := handleRecent(context.Background(), tg, repo, 10); err != nil {
+	if err := handleRecent(context.Background(), tg, repo, "http://d/", private(10)); err != nil {
 		t.Fatal(err)
 	}
 	if len(tg.messages) != 2 {
@@ -187,7 +593,7 @@ func TestHandleRecent(t *testing.T) {
 func TestHandleRecentRepoError(t *testing.T) {
 	tg := &mockTelegram{}
 	repo := &mockRepo{err: errors.New("db")}
-	if err := handleRecent(context.Background(), tg, repo, 10); err != nil {
+	if err := handleRecent(context.Background(), tg, repo, "http://d", private(10)); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if tg.text != temporaryErrorMsg {
@@ -195,16 +601,28 @@ func TestHandleRecentRepoError(t *testing.T) {
 	}
 }
 
+func TestHandleRecentInGroup(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{results: []db.Result{{ID: 1}}}
+	if err := handleRecent(context.Background(), tg, repo, "http://d", origin{ChatID: -100, UserID: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.messages) != 1 || tg.text != help.Phrase("en", "private.only") {
+		t.Fatalf("group members' documents listed: %q", tg.messages)
+	}
+}
+
 func TestHandleDelete(t *testing.T) {
 	tg := &mockTelegram{}
 	repo := &mockRepo{}
-	if err := handleDelete(context.Background(), tg, repo, 20); err != nil {
+	if err := handleDelete(context.Background(), tg, repo, private(20)); err != nil {
 		t.Fatal(err)
 	}
 	if tg.text != "history deleted" {
 		t.Fatalf("unexpected text %s", tg.text)
 	}
-	if repo.chatID != 20 {
+	if repo.userID != 20 {
 		t.Fatalf("repo not called")
 	}
 }
@@ -212,7 +630,7 @@ func TestHandleDelete(t *testing.T) {
 func TestHandleDeleteRepoError(t *testing.T) {
 	tg := &mockTelegram{}
 	repo := &mockRepo{err: errors.New("db")}
-	if err := handleDelete(context.Background(), tg, repo, 99); err != nil {
+	if err := handleDelete(context.Background(), tg, repo, private(99)); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if tg.text != temporaryErrorMsg {
@@ -244,7 +662,7 @@ func TestHandleClaimTooLong(t *testing.T) {
 	repo := &mockRepo{}
 	lim := &mockLimiter{ok: true}
 	long := strings.Repeat("a", 8001)
-	if err := handleClaim(context.Background(), tg, or, repo, lim, 1, long); err == nil {
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), long); err == nil {
 		t.Fatalf("expected length error")
 	}
 }
@@ -254,7 +672,7 @@ func TestHandleClaimRateLimit(t *testing.T) {
 	or := &mockOpenRouter{}
 	repo := &mockRepo{}
 	lim := &mockLimiter{ok: false}
-	if err := handleClaim(context.Background(), tg, or, repo, lim, 1, "hi"); err != nil {
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, lim, private(1), "hi"); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if tg.text != "rate limit exceeded, try again later" {
@@ -1,33 +1,249 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"legalbot/internal/certs"
+	"legalbot/internal/claim"
+	"legalbot/internal/config"
+	"legalbot/internal/db"
+	"legalbot/internal/dedup"
+	"legalbot/internal/health"
+	"legalbot/internal/limiter"
+	"legalbot/internal/metrics"
+	"legalbot/internal/openrouter"
+	"legalbot/internal/pii"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/secrets"
+	"legalbot/internal/telegram"
+	"legalbot/internal/telegram/queue"
+	"legalbot/internal/tracing"
 )
 
 func main() {
-	addr := flag.String("listen", ":8080", "listen address")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "TOML configuration file; environment variables override it")
+	probe := flag.String("probe", "", "request this URL and exit 0 on a 2xx answer, for container healthchecks")
 	flag.Parse()
-
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	if *probe != "" {
+		os.Exit(health.Probe(*probe))
+	}
+	logger := slog.New(reqctx.NewLogHandler(slog.NewTextHandler(os.Stdout, nil)))
 	slog.SetDefault(logger)
-	secret := os.Getenv("TELEGRAM_SECRET_TOKEN")
-	if secret == "" {
-		logger.Warn("TELEGRAM_SECRET_TOKEN not set")
-	}
-	logger.Info("starting bot", "addr", *addr)
-	if err := http.ListenAndServe(*addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !checkSecretToken(r, secret, logger) {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	cfg, err := config.Load(*configPath, os.Getenv)
+	var keys *secrets.Watcher
+	if err == nil {
+		keys, err = secrets.Open(context.Background(), cfg, logger)
+	}
+	if err == nil {
+		err = cfg.Validate(config.BotBinary)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if tracer := tracing.FromConfig(cfg.Tracing, "bot", tracing.WithLogger(logger)); tracer != nil {
+		tracing.SetDefault(tracer)
+		defer tracer.Shutdown(context.Background())
+		logger.Info("tracing enabled", "endpoint", tracer.Endpoint, "sample_ratio", tracer.SampleRatio)
+	}
+	if key := cfg.Telegram.CallbackKey(); key != nil {
+		callbacks = telegram.NewCallbackCodec(key)
+	} else {
+		logger.Warn("no callback secret set, inline buttons will not survive a restart")
+	}
+	redactor = pii.FromConfig(cfg.PII)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := db.New(ctx, cfg.DB)
+	if err != nil {
+		logger.Error("db", "err", err)
+		os.Exit(1)
+	}
+	defer repo.Close()
+	keys.OnChange(secrets.PostgresDSN, func(dsn string) {
+		dbc := cfg.DB
+		dbc.DSN = config.Secret(dsn)
+		if err := repo.Reconnect(ctx, dbc); err != nil {
+			logger.Error("reconnect with the rotated DSN", "err", err)
+		}
+	})
+
+	client := telegram.New(string(cfg.Telegram.Token), telegram.WithBaseURL(cfg.Telegram.APIURL))
+	keys.OnChange(secrets.TelegramToken, client.SetToken)
+	model := openrouter.New(cfg.OpenRouter)
+	keys.OnChange(secrets.OpenRouterKey, model.SetAPIKey)
+	webhookSecret := secrets.NewValue(string(cfg.Telegram.WebhookSecret))
+	keys.OnChange(secrets.WebhookSecret, webhookSecret.Store)
+	go keys.Run(ctx)
+	mtls, err := certs.FromConfig(cfg.MTLS, logger)
+	if err != nil {
+		logger.Error("load certificates", "err", err)
+		os.Exit(1)
+	}
+	promptHTTP := &http.Client{Timeout: 5 * time.Second}
+	if mtls != nil {
+		promptHTTP = mtls.HTTPClient(5 * time.Second)
+	}
+	if cfg.Bot.QueueURL != "" {
+		var queueTLS *tls.Config
+		if mtls != nil {
+			queueTLS = mtls.ClientConfig()
+		}
+		pub := claim.NewPublisher(string(cfg.Bot.QueueURL), queueTLS)
+		defer pub.Close()
+		claimQueue = pub
+		logger.Info("queueing claims for the worker", "queue", claim.Queue)
+	}
+	sendq := queue.New(client, queue.WithLogger(logger))
+	metrics.NewGaugeFunc("bot_send_queue_depth", "Messages waiting in the flood-control queue.", func() float64 {
+		return float64(sendq.Pending())
+	})
+	checks := health.New()
+	checks.Add("db", repo.Ping)
+	checks.Add("prompt", health.HTTPCheck(promptHTTP, cfg.Bot.PromptURL+"/healthz"))
+	var ops *http.Server
+	if cfg.Bot.MetricsListen != "" {
+		ops = &http.Server{Addr: cfg.Bot.MetricsListen, Handler: newOpsMux(checks)}
+		go func() {
+			if err := ops.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("metrics server error", "err", err)
+			}
+		}()
+	}
+	// The bot's username tells which group messages are addressed to it.
+	me, err := client.GetMe(ctx)
+	if err != nil {
+		logger.Error("get bot user", "err", err)
+		os.Exit(1)
+	}
+
+	d := &dispatcher{
+		tg:      outbound{Queue: sendq, client: client},
+		or:      model,
+		pb:      prompt.NewClient(cfg.Bot.PromptURL, prompt.WithHTTPClient(promptHTTP)),
+		repo:    repo,
+		limiter: limiter.New(cfg.Bot.RateLimit, cfg.Bot.RateWindow),
+		logger:  logger,
+		updates: dedup.New(repo, 10000),
+		bot:     me,
+		docsURL: cfg.Bot.DocsBaseURL,
+	}
+	go pruneUpdates(ctx, repo, logger)
+	var srv *http.Server
+	switch cfg.Bot.Mode {
+	case "polling":
+		// getUpdates is refused while a webhook is set.
+		if err := client.DeleteWebhook(ctx, false); err != nil {
+			logger.Error("delete webhook", "err", err)
+			return
+		}
+		logger.Info("starting bot", "mode", cfg.Bot.Mode, "poll_timeout", cfg.Bot.PollTimeout)
+		if err := poll(ctx, client, d, cfg.Bot.PollTimeout); err != nil && ctx.Err() == nil {
+			logger.Error("polling error", "err", err)
+		}
+	case "webhook":
+		guard, err := newWebhookGuard(cfg.Bot, logger)
+		if err != nil {
+			logger.Error("webhook guard", "err", err)
 			return
 		}
-		if reqID := r.Header.Get("X-Request-ID"); reqID != "" {
-			logger.Info("ping", "request_id", reqID)
+		srv = &http.Server{Addr: cfg.Bot.Listen, Handler: guard.wrap(newWebhook(d, webhookSecret))}
+		serve := srv.ListenAndServe
+		if cfg.Bot.TLSCertFile != "" {
+			cert, err := certs.NewReloader(cfg.Bot.TLSCertFile, cfg.Bot.TLSKeyFile, certs.WithLogger(logger))
+			if err != nil {
+				logger.Error("load webhook certificate", "err", err)
+				return
+			}
+			srv.TLSConfig = certs.ServerConfig(cert, nil)
+			serve = func() error { return srv.ListenAndServeTLS("", "") }
 		}
-		w.Write([]byte("ok"))
-	})); err != nil {
-		logger.Error("server error", "err", err)
+		logger.Info("starting bot", "addr", cfg.Bot.Listen, "tls", srv.TLSConfig != nil, "allowlist", cfg.Bot.WebhookAllowlist)
+		go func() {
+			if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("server error", "err", err)
+				stop()
+			}
+		}()
+		<-ctx.Done()
 	}
+
+	// Stop taking updates, then give claims in progress and their queued
+	// replies until the deadline. A second signal kills the process.
+	stop()
+	logger.Info("shutting down", "timeout", cfg.Bot.ShutdownTimeout)
+	checks.SetDraining()
+	sctx, cancel := context.WithTimeout(context.Background(), cfg.Bot.ShutdownTimeout)
+	defer cancel()
+	if srv != nil {
+		if err := srv.Shutdown(sctx); err != nil {
+			logger.Error("stop webhook server", "err", err)
+		}
+	}
+	if err := d.drain(sctx); err != nil {
+		logger.Error("claims still in progress at shutdown", "err", err)
+	}
+	if err := sendq.Shutdown(sctx); err != nil {
+		logger.Error("replies still queued at shutdown", "pending", sendq.Pending(), "err", err)
+	}
+	if ops != nil {
+		ops.Shutdown(sctx)
+	}
+	logger.Info("bot stopped")
+}
+
+// updateTTL is how long processed update_ids are kept. Telegram stops
+// redelivering an update after 24 hours.
+const updateTTL = 48 * time.Hour
+
+// pruneUpdates forgets old update_ids once an hour until ctx is done.
+func pruneUpdates(ctx context.Context, repo *db.Repository, logger *slog.Logger) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		if _, err := repo.PruneUpdates(ctx, updateTTL); err != nil {
+			logger.ErrorContext(ctx, "prune updates", "err", err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// outbound sends messages through the flood-control queue. Callback query
+// answers, member lookups and file downloads do not count towards message
+// limits and go to the API directly.
+type outbound struct {
+	*queue.Queue
+	client *telegram.Client
+}
+
+func (o outbound) AnswerCallbackQuery(ctx context.Context, queryID, text string, showAlert bool) error {
+	return o.client.AnswerCallbackQuery(ctx, queryID, text, showAlert)
+}
+
+func (o outbound) GetChatMember(ctx context.Context, chatID, userID int64) (telegram.ChatMember, error) {
+	return o.client.GetChatMember(ctx, chatID, userID)
+}
+
+func (o outbound) GetFile(ctx context.Context, fileID string) (telegram.File, error) {
+	return o.client.GetFile(ctx, fileID)
+}
+
+func (o outbound) DownloadFile(ctx context.Context, f telegram.File, maxBytes int64) ([]byte, error) {
+	return o.client.DownloadFile(ctx, f, maxBytes)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"legalbot/internal/claim"
+	"legalbot/internal/health"
+	"legalbot/internal/metrics"
+	"legalbot/internal/slo"
+)
+
+// Outcomes of handleClaim. Every claim ends in exactly one of them; queued
+// claims get theirs from the worker.
+const (
+	outcomeQueued      = "queued"
+	outcomeTooLong     = "too_long"
+	outcomeNoConsent   = "no_consent"
+	outcomeRateLimited = "rate_limited"
+	outcomeDelivered   = claim.OutcomeDelivered
+	outcomePromptError = claim.OutcomePromptError
+	outcomeModelError  = claim.OutcomeModelError
+	outcomeDBError     = claim.OutcomeDBError
+	outcomeSendError   = claim.OutcomeSendError
+)
+
+var (
+	webhookDuration = metrics.NewHistogram("bot_webhook_duration_seconds",
+		"Time to acknowledge a webhook request by HTTP status. The SLA is 400ms at P95.",
+		metrics.LatencyBuckets, "status")
+	webhookRejections = metrics.NewCounter("bot_webhook_rejections_total",
+		"Webhook requests rejected before an update was handled, by reason.", "reason")
+	claimsTotal = metrics.NewCounter("bot_claims_total",
+		"Claims handled by outcome.", "outcome")
+	claimDuration = metrics.NewHistogram("bot_claim_duration_seconds",
+		"Time from receiving the update to sending the answer by outcome. The SLA is 10s for 95% of answers.",
+		metrics.LatencyBuckets, "outcome")
+)
+
+// claimSLO tracks the claim objectives in process for /debug/slo.
+var claimSLO = slo.New(slo.Default)
+
+// observeClaim records a claim whose update was received at start. It takes
+// the outcome by pointer so handleClaim can defer it and set the outcome as
+// it returns. Claims refused before processing do not count towards the SLOs.
+func observeClaim(outcome *string, start time.Time) {
+	elapsed := time.Since(start)
+	claimsTotal.Inc(*outcome)
+	claimDuration.Observe(elapsed.Seconds(), *outcome)
+	switch *outcome {
+	case outcomeDelivered:
+		claimSLO.Record(elapsed, false)
+	case outcomePromptError, outcomeModelError, outcomeDBError, outcomeSendError:
+		claimSLO.Record(elapsed, true)
+	}
+}
+
+type receivedKey struct{}
+
+// withReceived returns a context carrying when the update being handled
+// arrived, so claim timing covers everything before handleClaim.
+func withReceived(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, receivedKey{}, t)
+}
+
+// receivedAt returns when the update being handled arrived, or now if ctx
+// does not say.
+func receivedAt(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(receivedKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// newOpsMux serves /metrics, /debug/slo, /healthz and /readyz. They are
+// served apart from the webhook, whose port is reachable from the internet.
+func newOpsMux(checks *health.Checker) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /debug/slo", claimSLO.Handler())
+	checks.Register(mux)
+	return mux
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/db"
+	"legalbot/internal/secrets"
+	"legalbot/internal/slo"
+)
+
+func TestHandleClaimCountsOutcomes(t *testing.T) {
+	cases := []struct {
+		outcome string
+		tg      *mockTelegram
+		or      *mockOpenRouter
+		pb      *mockPrompt
+		repo    *mockRepo
+		limit   bool
+		text    string
+	}{
+		{outcomeDelivered, &mockTelegram{}, &mockOpenRouter{resp: "ok"}, &mockPrompt{}, &mockRepo{}, true, "hi"},
+		{outcomeTooLong, &mockTelegram{}, &mockOpenRouter{}, &mockPrompt{}, &mockRepo{}, true, strings.Repeat("a", 8001)},
+		{outcomeNoConsent, &mockTelegram{}, &mockOpenRouter{}, &mockPrompt{}, &mockRepo{consent: &db.Consent{}}, true, "hi"},
+		{outcomeRateLimited, &mockTelegram{}, &mockOpenRouter{}, &mockPrompt{}, &mockRepo{}, false, "hi"},
+		{outcomePromptError, &mockTelegram{}, &mockOpenRouter{}, &mockPrompt{err: errors.New("templates")}, &mockRepo{}, true, "hi"},
+		{outcomeModelError, &mockTelegram{}, &mockOpenRouter{err: errors.New("boom")}, &mockPrompt{}, &mockRepo{}, true, "hi"},
+		{outcomeDBError, &mockTelegram{}, &mockOpenRouter{resp: "x"}, &mockPrompt{}, &mockRepo{err: errors.New("db")}, true, "hi"},
+		{outcomeSendError, &mockTelegram{err: errors.New("tg")}, &mockOpenRouter{resp: "x"}, &mockPrompt{}, &mockRepo{}, true, "hi"},
+	}
+	for _, c := range cases {
+		before := claimsTotal.Value(c.outcome)
+		observed := claimDuration.Count(c.outcome)
+		handleClaim(context.Background(), c.tg, c.or, c.pb, c.repo, &mockLimiter{ok: c.limit}, private(1), c.text)
+		if claimsTotal.Value(c.outcome) != before+1 || claimDuration.Count(c.outcome) != observed+1 {
+			t.Errorf("%s: claim not counted", c.outcome)
+		}
+	}
+}
+
+func TestWebhookRecordsDuration(t *testing.T) {
+	h := newWebhook(newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{}), secrets.NewValue("s"))
+	before := webhookDuration.Count("400")
+	postUpdate(t, h, `{`)
+	if webhookDuration.Count("400") != before+1 {
+		t.Fatal("webhook request not observed")
+	}
+}
+
+// sloWindow returns the objective's counts over the last five minutes.
+func sloWindow(name string) slo.WindowReport {
+	for _, o := range claimSLO.Report().Objectives {
+		if o.Name == name {
+			return o.Windows[0]
+		}
+	}
+	return slo.WindowReport{}
+}
+
+func TestHandleClaimTimedFromReceipt(t *testing.T) {
+	received := time.Now().Add(-15 * time.Second)
+	ctx := withReceived(context.Background(), received)
+	repo := &mockRepo{claimID: 1}
+	latency, avail := sloWindow("claim_latency"), sloWindow("claim_availability")
+	if err := handleClaim(ctx, &mockTelegram{}, &mockOpenRouter{resp: "ok"}, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(1), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.received.Equal(received) {
+		t.Fatalf("claim received at %v, want %v", repo.received, received)
+	}
+	// Delivered after 15s: answered, but too slow.
+	if w := sloWindow("claim_latency"); w.Total != latency.Total+1 || w.Good != latency.Good {
+		t.Fatalf("latency SLO = %+v, was %+v", w, latency)
+	}
+	if w := sloWindow("claim_availability"); w.Total != avail.Total+1 || w.Good != avail.Good+1 {
+		t.Fatalf("availability SLO = %+v, was %+v", w, avail)
+	}
+
+	// Refused claims are not processed and do not count.
+	latency, avail = sloWindow("claim_latency"), sloWindow("claim_availability")
+	handleClaim(ctx, &mockTelegram{}, &mockOpenRouter{}, &mockPrompt{}, &mockRepo{}, &mockLimiter{ok: false}, private(1), "hi")
+	if sloWindow("claim_latency") != latency || sloWindow("claim_availability") != avail {
+		t.Fatal("rate limited claim counted towards the SLOs")
+	}
+}
+
+func TestWebhookPassesReceiptTime(t *testing.T) {
+	repo := &mockRepo{claimID: 1}
+	d := newTestDispatcher(&mockTelegram{}, repo, &mockOpenRouter{resp: "answer"})
+	before := time.Now()
+	postUpdate(t, newWebhook(d, secrets.NewValue("s")), `{"update_id":1,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"question"}}`)
+	d.wait()
+	if repo.received.Before(before) || repo.received.After(time.Now()) {
+		t.Fatalf("claim received at %v, webhook called at %v", repo.received, before)
+	}
+}
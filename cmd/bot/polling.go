@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"legalbot/internal/reqctx"
+	"legalbot/internal/telegram"
+	"legalbot/internal/tracing"
+)
+
+// UpdatesGetter fetches pending updates, e.g. *telegram.Client.
+type UpdatesGetter interface {
+	GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]telegram.Update, error)
+}
+
+// pollBackoff bounds the delay between failed getUpdates calls.
+var pollBackoff = struct{ min, max time.Duration }{time.Second, 30 * time.Second}
+
+// poll long-polls for updates and feeds them to the dispatcher until ctx is
+// done. The offset acknowledges handled updates, so a restart resumes after
+// the last one. An update being handled when ctx is done is finished; the
+// rest of its batch is left for the next start.
+func poll(ctx context.Context, api UpdatesGetter, d *dispatcher, timeout time.Duration) error {
+	var offset int64
+	backoff := pollBackoff.min
+	for {
+		updates, err := api.GetUpdates(ctx, offset, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.logger.ErrorContext(ctx, "get updates", "err", err, "retry_in", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff = min(backoff*2, pollBackoff.max)
+			continue
+		}
+		backoff = pollBackoff.min
+		received := withReceived(context.WithoutCancel(ctx), time.Now())
+		for _, u := range updates {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.firstDelivery(ctx, u.UpdateID) {
+				uctx, span := tracing.StartRequest(reqctx.Start(received), "bot.poll")
+				d.handle(uctx, u)
+				span.End()
+			}
+			offset = u.UpdateID + 1
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/telegram"
+)
+
+type mockUpdates struct {
+	offsets []int64
+	batches [][]telegram.Update
+	errs    []error
+	cancel  context.CancelFunc
+}
+
+func (m *mockUpdates) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]telegram.Update, error) {
+	m.offsets = append(m.offsets, offset)
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	if len(m.batches) == 0 {
+		m.cancel()
+		return nil, ctx.Err()
+	}
+	b := m.batches[0]
+	m.batches = m.batches[1:]
+	return b, nil
+}
+
+func message(updateID, chatID int64, text string) telegram.Update {
+	return telegram.Update{UpdateID: updateID, Message: &telegram.Message{Chat: telegram.Chat{ID: chatID}, Text: text}}
+}
+
+func TestPollDispatchesAndAdvancesOffset(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	old := pollBackoff
+	pollBackoff.min, pollBackoff.max = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { pollBackoff = old })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api := &mockUpdates{
+		batches: [][]telegram.Update{
+			{message(10, 1, "/help"), message(11, 2, "/help")},
+			{message(12, 3, "/help")},
+		},
+		errs:   []error{errors.New("network down")},
+		cancel: cancel,
+	}
+	tg := &mockTelegram{}
+	d := newTestDispatcher(tg, &mockRepo{}, &mockOpenRouter{})
+	if err := poll(ctx, api, d, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []int64{0, 0, 12, 13}
+	if len(api.offsets) != len(want) {
+		t.Fatalf("unexpected offsets %v", api.offsets)
+	}
+	for i := range want {
+		if api.offsets[i] != want[i] {
+			t.Fatalf("unexpected offsets %v", api.offsets)
+		}
+	}
+	if len(tg.messages) != 3 {
+		t.Fatalf("expected 3 replies, got %q", tg.messages)
+	}
+}
+
+func TestPollGivesEachUpdateARequestID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	api := &mockUpdates{
+		batches: [][]telegram.Update{{message(20, 1, "first question"), message(21, 2, "second question")}},
+		cancel:  cancel,
+	}
+	d := newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{resp: "answer"})
+	var ids []string
+	d.pb = promptFunc(func(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+		ids = append(ids, reqctx.RequestID(ctx))
+		return (&mockPrompt{}).Build(ctx, req)
+	})
+	poll(ctx, api, d, time.Second)
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] {
+		t.Fatalf("request IDs %q", ids)
+	}
+}
+
+func TestPollFinishesUpdateOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	api := &mockUpdates{
+		batches: [][]telegram.Update{{message(30, 1, "first question"), message(31, 2, "second question")}},
+		cancel:  cancel,
+	}
+	tg := &mockTelegram{}
+	d := newTestDispatcher(tg, &mockRepo{}, &mockOpenRouter{resp: "answer"})
+	var handled int
+	var claimErr error
+	d.pb = promptFunc(func(claimCtx context.Context, req prompt.Request) (prompt.Result, error) {
+		handled++
+		cancel() // SIGTERM arrives while the claim is being answered.
+		claimErr = claimCtx.Err()
+		return (&mockPrompt{}).Build(claimCtx, req)
+	})
+	if err := poll(ctx, api, d, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if handled != 1 || claimErr != nil {
+		t.Fatalf("handled %d updates, claim context error %v; want the first finished", handled, claimErr)
+	}
+	if len(tg.messages) == 0 {
+		t.Fatal("claim in progress was not answered")
+	}
+}
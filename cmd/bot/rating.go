@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"legalbot/internal/help"
+)
+
+type ResultRater interface {
+	RateResult(ctx context.Context, id, chatID int64, rating int) error
+}
+
+// handleRate stores the rating pressed under an answer and returns the
+// notice shown to the user. Pressing again replaces the rating.
+func handleRate(ctx context.Context, repo ResultRater, o origin, resultID, score string) string {
+	id, err := strconv.ParseInt(resultID, 10, 64)
+	rating, err2 := strconv.Atoi(score)
+	if err != nil || err2 != nil {
+		slog.WarnContext(ctx, "invalid rating callback", "result_id", resultID, "score", score)
+		return ""
+	}
+	if err := repo.RateResult(ctx, id, o.ChatID, rating); err != nil {
+		slog.ErrorContext(ctx, "db rate result", "err", err)
+		return temporaryErrorMsg
+	}
+	return help.Phrase(langFor(o.UserID), "rating.thanks")
+}
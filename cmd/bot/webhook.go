@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"legalbot/internal/claim"
+	"legalbot/internal/help"
+	"legalbot/internal/metrics"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/secrets"
+	"legalbot/internal/telegram"
+	"legalbot/internal/tracing"
+)
+
+// Telegram is the Bot API surface used by the webhook, e.g. *telegram.Client.
+type Telegram interface {
+	TelegramSender
+	FileDownloader
+	ChatMemberGetter
+	AnswerCallbackQuery(ctx context.Context, queryID, text string, showAlert bool) error
+}
+
+// Repository is everything the bot stores, e.g. *db.Repository.
+type Repository interface {
+	ClaimRepository
+	ClaimLister
+	ResultFetcher
+	HistoryDeleter
+	ConsentStore
+	GroupAccessStore
+	ResultRater
+}
+
+// UpdateFilter recognises redelivered updates, e.g. *dedup.Filter.
+type UpdateFilter interface {
+	First(ctx context.Context, updateID int64) (bool, error)
+}
+
+// Callback actions carried in inline button data.
+const (
+	actionConsent = "consent"
+	actionLang    = "lang"
+	actionRate    = claim.ActionRate
+)
+
+// languages are offered by the /lang picker.
+var languages = []struct{ Code, Name string }{
+	{"ru", "Русский"},
+	{"en", "English"},
+}
+
+// randomKey returns a key for signing inline button data when none is
+// configured. Buttons sent before a restart then stop working.
+func randomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// callbacks signs inline button data. main replaces it with a codec keyed
+// by the configured secret.
+var callbacks = telegram.NewCallbackCodec(randomKey())
+
+// dispatcher routes updates to the command and button handlers.
+type dispatcher struct {
+	tg      Telegram
+	or      OpenRouterClient
+	pb      PromptBuilder
+	repo    Repository
+	limiter RateLimiter
+	logger  *slog.Logger
+	// updates skips redelivered updates; nil handles every delivery.
+	updates UpdateFilter
+	// bot is the bot's own user. Group messages are only answered when
+	// they address it.
+	bot telegram.User
+	// docsURL is where /recent links to documents.
+	docsURL string
+
+	inflight sync.WaitGroup
+}
+
+// maxUpdateBody caps update bodies even without a guard in front.
+const maxUpdateBody = 1 << 20
+
+// newWebhook returns the HTTP handler Telegram delivers updates to. Updates
+// are acknowledged with 200 as soon as they are decoded and handled in the
+// background, so a slow model call does not make Telegram redeliver them.
+// Redeliveries that still happen are recognised by update_id and skipped.
+// main puts a webhookGuard in front of it.
+func newWebhook(d *dispatcher, secret *secrets.Value) http.Handler {
+	return metrics.InstrumentHandler(webhookDuration, reqctx.Middleware(tracing.Middleware("bot.webhook", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := time.Now()
+		// The guard in front logs failures with the client address.
+		if !checkSecretToken(r, secret.Load(), nil) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(reqctx.HeaderRequestID) != "" {
+			d.logger.InfoContext(r.Context(), "ping")
+		}
+		var u telegram.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateBody)).Decode(&u); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		if d.firstDelivery(r.Context(), u.UpdateID) {
+			d.inflight.Add(1)
+			go func() {
+				defer d.inflight.Done()
+				d.handle(withReceived(context.WithoutCancel(r.Context()), received), u)
+			}()
+		}
+		w.Write([]byte("ok"))
+	}))))
+}
+
+// firstDelivery reports whether the update should be handled. If the filter
+// cannot record the update it is handled anyway: answering twice is better
+// than not answering.
+func (d *dispatcher) firstDelivery(ctx context.Context, updateID int64) bool {
+	if d.updates == nil {
+		return true
+	}
+	first, err := d.updates.First(ctx, updateID)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "record update", "update_id", updateID, "err", err)
+	}
+	if !first {
+		d.logger.InfoContext(ctx, "duplicate update skipped", "update_id", updateID)
+	}
+	return first
+}
+
+// handle dispatches one update and logs its error.
+func (d *dispatcher) handle(ctx context.Context, u telegram.Update) {
+	ctx, span := tracing.Start(ctx, "bot.update", tracing.Internal)
+	span.SetInt("update_id", u.UpdateID)
+	err := d.dispatch(ctx, u)
+	span.EndError(err)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "handle update", "update_id", u.UpdateID, "err", err)
+	}
+}
+
+// wait blocks until updates handled in the background are done.
+func (d *dispatcher) wait() {
+	d.inflight.Wait()
+}
+
+// drain is wait bounded by ctx, for shutdown. It returns ctx.Err() if
+// updates are still being handled when ctx is done.
+func (d *dispatcher) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatch handles one update.
+func (d *dispatcher) dispatch(ctx context.Context, u telegram.Update) error {
+	switch {
+	case u.CallbackQuery != nil:
+		return d.onCallback(ctx, u.CallbackQuery)
+	case u.Message != nil:
+		return d.onMessage(ctx, u.Message)
+	}
+	return nil
+}
+
+// parseCommand splits "/claim@LegalBot text" into "/claim" and "text". Text
+// that is not a command yields an empty command.
+func parseCommand(text string) (cmd, arg string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+	cmd, arg, _ = strings.Cut(text, " ")
+	cmd, _, _ = strings.Cut(cmd, "@")
+	return strings.ToLower(cmd), strings.TrimSpace(arg)
+}
+
+// onMessage routes a message to its handler. In groups only messages
+// addressed to the bot are handled, replies go to the message's forum topic
+// and claims are subject to the group's access setting.
+func (d *dispatcher) onMessage(ctx context.Context, m *telegram.Message) error {
+	o := originOf(m)
+	lang := langFor(o.UserID)
+	text := m.Text
+	if m.Document != nil || len(m.Photo) > 0 {
+		text = m.Caption
+	}
+	if m.Chat.IsGroup() {
+		var ok bool
+		if text, ok = addressed(d.bot, m, text); !ok {
+			return nil
+		}
+		if m.IsTopicMessage {
+			ctx = telegram.WithThread(ctx, m.MessageThreadID)
+		}
+	}
+	if m.Document != nil || len(m.Photo) > 0 {
+		return d.onUpload(ctx, o, m, text)
+	}
+	cmd, arg := parseCommand(text)
+	switch cmd {
+	case "/start":
+		return handleStart(ctx, d.tg, d.repo, o)
+	case "/help":
+		return d.tg.SendMessage(ctx, o.ChatID, help.Message(lang))
+	case "/claim":
+		if arg == "" {
+			return d.tg.SendMessage(ctx, o.ChatID, help.Phrase(lang, "claim.prompt"))
+		}
+		return d.claim(ctx, o, arg)
+	case "/status":
+		return handleStatus(ctx, d.tg, d.repo, o)
+	case "/recent":
+		return handleRecent(ctx, d.tg, d.repo, d.docsURL, o)
+	case "/delete":
+		return handleDelete(ctx, d.tg, d.repo, o)
+	case "/lang":
+		if arg != "" {
+			return d.setLang(ctx, o, arg)
+		}
+		return d.sendLangPicker(ctx, o)
+	case "/access":
+		return handleAccess(ctx, d.tg, d.repo, o, arg, m.ReplyToMessage)
+	case "":
+		if arg == "" {
+			return nil
+		}
+		return d.claim(ctx, o, arg)
+	default:
+		return d.tg.SendMessage(ctx, o.ChatID, help.Message(lang))
+	}
+}
+
+// claim submits a claim if the group lets the user file one.
+func (d *dispatcher) claim(ctx context.Context, o origin, text string) error {
+	if ok, err := checkGroupAccess(ctx, d.tg, d.repo, o); !ok {
+		return err
+	}
+	return handleClaim(ctx, d.tg, d.or, d.pb, d.repo, d.limiter, o, text)
+}
+
+// onUpload keeps an uploaded file for the next claim. A caption is taken as
+// the question, so a file sent with its description is submitted at once.
+func (d *dispatcher) onUpload(ctx context.Context, o origin, m *telegram.Message, caption string) error {
+	cmd, question := parseCommand(caption)
+	if cmd != "" && cmd != "/claim" {
+		question = ""
+	}
+	if ok, err := checkGroupAccess(ctx, d.tg, d.repo, o); !ok {
+		return err
+	}
+	ok, err := handleUpload(ctx, d.tg, d.repo, o, m, question != "")
+	if err != nil || !ok || question == "" {
+		return err
+	}
+	return handleClaim(ctx, d.tg, d.or, d.pb, d.repo, d.limiter, o, question)
+}
+
+// onCallback handles a pressed inline button. Buttons are bound to the user
+// they were sent to, so in groups other members cannot press them. The query
+// is always answered so the button stops showing a loading indicator.
+func (d *dispatcher) onCallback(ctx context.Context, q *telegram.CallbackQuery) error {
+	o := private(q.From.ID)
+	if q.Message != nil {
+		o.ChatID = q.Message.Chat.ID
+		if q.Message.IsTopicMessage {
+			ctx = telegram.WithThread(ctx, q.Message.MessageThreadID)
+		}
+	}
+	action, args, err := callbacks.Decode(o.UserID, q.Data)
+	if err != nil {
+		d.logger.WarnContext(ctx, "rejected callback data", "chat_id", o.ChatID, "user_id", o.UserID, "err", err)
+		return d.tg.AnswerCallbackQuery(ctx, q.ID, "", false)
+	}
+	var handleErr error
+	var notice string
+	switch {
+	case action == actionConsent && len(args) == 2:
+		handleErr = handleConsent(ctx, d.tg, d.repo, o, args[1], args[0] == "y")
+	case action == actionLang && len(args) == 1:
+		handleErr = d.setLang(ctx, o, args[0])
+	case action == actionRate && len(args) == 2:
+		notice = handleRate(ctx, d.repo, o, args[0], args[1])
+	default:
+		d.logger.WarnContext(ctx, "unknown callback action", "chat_id", o.ChatID, "action", action)
+	}
+	return errors.Join(handleErr, d.tg.AnswerCallbackQuery(ctx, q.ID, notice, false))
+}
+
+// sendLangPicker offers the supported languages as inline buttons.
+func (d *dispatcher) sendLangPicker(ctx context.Context, o origin) error {
+	row := make([]telegram.InlineKeyboardButton, 0, len(languages))
+	for _, l := range languages {
+		data, err := callbacks.Encode(o.UserID, actionLang, l.Code)
+		if err != nil {
+			return err
+		}
+		row = append(row, telegram.InlineKeyboardButton{Text: l.Name, CallbackData: data})
+	}
+	kb := telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{row}}
+	return d.tg.SendMessageMarkup(ctx, o.ChatID, help.Phrase(langFor(o.UserID), "lang.choose"), kb)
+}
+
+// setLang switches the user to a supported language and confirms it.
+func (d *dispatcher) setLang(ctx context.Context, o origin, code string) error {
+	for _, l := range languages {
+		if l.Code == code {
+			handleLang(o.UserID, code)
+			return d.tg.SendMessage(ctx, o.ChatID, help.Phrase(code, "lang.set"))
+		}
+	}
+	return d.sendLangPicker(ctx, o)
+}
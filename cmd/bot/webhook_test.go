@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"legalbot/internal/db"
+	"legalbot/internal/dedup"
+	"legalbot/internal/help"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/secrets"
+	"legalbot/internal/telegram"
+	"legalbot/internal/tracing"
+)
+
+func newTestDispatcher(tg *mockTelegram, repo *mockRepo, or *mockOpenRouter) *dispatcher {
+	return &dispatcher{
+		tg:      tg,
+		or:      or,
+		pb:      &mockPrompt{},
+		repo:    repo,
+		limiter: &mockLimiter{ok: true},
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func postUpdate(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestWebhookRejectsBadSecret(t *testing.T) {
+	h := newWebhook(newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{}), secrets.NewValue("s"))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestWebhookSecretRotation(t *testing.T) {
+	secret := secrets.NewValue("old")
+	h := newWebhook(newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{}), secret)
+	secret.Store("s")
+	if w := postUpdate(t, h, `{`); w.Code != http.StatusBadRequest {
+		t.Fatalf("rotated secret rejected: %d", w.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	r.Header.Set("X-Telegram-Bot-Api-Secret-Token", "old")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("old secret accepted after rotation: %d", w.Code)
+	}
+}
+
+func TestWebhookInvalidJSON(t *testing.T) {
+	h := newWebhook(newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{}), secrets.NewValue("s"))
+	if w := postUpdate(t, h, `{`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestWebhookPlainTextIsClaim(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &mockOpenRouter{resp: "answer"}
+	d := newTestDispatcher(tg, &mockRepo{}, or)
+	h := newWebhook(d, secrets.NewValue("s"))
+	w := postUpdate(t, h, `{"update_id":1,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"Магазин не возвращает деньги"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	d.wait()
+	if or.prompt != "prompt:Магазин не возвращает деньги" || tg.text != "answer" || tg.chatID != 7 {
+		t.Fatalf("claim not handled: %q %q", or.prompt, tg.text)
+	}
+}
+
+// slowOpenRouter blocks every completion until release is closed.
+type slowOpenRouter struct {
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (m *slowOpenRouter) ChatCompletion(ctx context.Context, prompt string) (string, error) {
+	if m.calls.Add(1) == 1 {
+		close(m.started)
+	}
+	<-m.release
+	return "answer", nil
+}
+
+func TestWebhookRedeliveryDuringModelCall(t *testing.T) {
+	tg := &mockTelegram{}
+	or := &slowOpenRouter{started: make(chan struct{}), release: make(chan struct{})}
+	d := newTestDispatcher(tg, &mockRepo{}, nil)
+	d.or = or
+	d.updates = dedup.New(nil, 100)
+	h := newWebhook(d, secrets.NewValue("s"))
+	body := `{"update_id":42,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"Магазин не возвращает деньги"}}`
+
+	// The update is acknowledged while the model is still answering.
+	if w := postUpdate(t, h, body); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	<-or.started
+	// Telegram gives up waiting and delivers the same update again.
+	if w := postUpdate(t, h, body); w.Code != http.StatusOK {
+		t.Fatalf("redelivery not acknowledged: %d", w.Code)
+	}
+	close(or.release)
+	d.wait()
+
+	if n := or.calls.Load(); n != 1 {
+		t.Fatalf("model called %d times", n)
+	}
+	if len(tg.messages) != 1 || tg.text != "answer" {
+		t.Fatalf("claim answered %d times: %q", len(tg.messages), tg.messages)
+	}
+}
+
+type failingFilter struct{}
+
+func (failingFilter) First(ctx context.Context, updateID int64) (bool, error) {
+	return true, errors.New("db down")
+}
+
+func TestWebhookFilterErrorStillHandles(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	d := newTestDispatcher(tg, &mockRepo{}, &mockOpenRouter{})
+	d.updates = failingFilter{}
+	postUpdate(t, newWebhook(d, secrets.NewValue("s")), `{"update_id":1,"message":{"chat":{"id":3},"text":"/help"}}`)
+	d.wait()
+	if tg.text != help.Message("en") {
+		t.Fatalf("update dropped: %q", tg.text)
+	}
+}
+
+func TestDispatchCommands(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	cases := map[string]string{
+		"/help":              help.Message("en"),
+		"/claim":             help.Phrase("en", "claim.prompt"),
+		"/claim@LegalBot hi": "answer",
+		"/unknown":           help.Message("en"),
+		"/recent":            "https://docs.example.com/7",
+	}
+	for text, want := range cases {
+		tg := &mockTelegram{}
+		d := newTestDispatcher(tg, &mockRepo{results: []db.Result{{ID: 7}}}, &mockOpenRouter{resp: "answer"})
+		d.docsURL = "https://docs.example.com"
+		if err := d.dispatch(context.Background(), telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 3}, Text: text}}); err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		if tg.text != want {
+			t.Errorf("%s: got %q, want %q", text, tg.text, want)
+		}
+	}
+}
+
+func TestDispatchConsentCallback(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	d := newTestDispatcher(tg, repo, &mockOpenRouter{})
+	if err := handleStart(context.Background(), tg, repo, private(9)); err != nil {
+		t.Fatal(err)
+	}
+	accept := consentButtons(t, tg.markup)[0].CallbackData
+	q := &telegram.CallbackQuery{ID: "q1", From: telegram.User{ID: 9}, Message: &telegram.Message{Chat: telegram.Chat{ID: 9}}, Data: accept}
+	if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.consent.Valid(help.PolicyVersion) {
+		t.Fatalf("consent not stored: %+v", repo.consent)
+	}
+	if len(tg.answered) != 1 || tg.answered[0] != "q1" {
+		t.Fatalf("callback not answered: %v", tg.answered)
+	}
+}
+
+func TestDispatchForgedCallback(t *testing.T) {
+	tg := &mockTelegram{}
+	repo := &mockRepo{consent: &db.Consent{}}
+	d := newTestDispatcher(tg, repo, &mockOpenRouter{})
+	data, err := callbacks.Encode(9, actionConsent, "y", help.PolicyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A button issued for chat 9 pressed in chat 10.
+	q := &telegram.CallbackQuery{ID: "q2", From: telegram.User{ID: 10}, Message: &telegram.Message{Chat: telegram.Chat{ID: 10}}, Data: data}
+	if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.consent.Accepted || len(tg.messages) != 0 {
+		t.Fatalf("forged callback handled: %+v", repo.consent)
+	}
+	if len(tg.answered) != 1 {
+		t.Fatal("callback not answered")
+	}
+}
+
+func TestDispatchRatingCallback(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	repo := &mockRepo{id: 77}
+	or := &mockOpenRouter{resp: `{"advice_md":"a","claim_md":"c"}`}
+	d := newTestDispatcher(tg, repo, or)
+	if err := handleClaim(context.Background(), tg, or, &mockPrompt{}, repo, &mockLimiter{ok: true}, private(9), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	// The buttons come with the last part of the answer only.
+	if len(tg.formatted) != 2 {
+		t.Fatalf("unexpected answer %q", tg.messages)
+	}
+	kb, ok := tg.markup.(telegram.InlineKeyboardMarkup)
+	if !ok || len(kb.InlineKeyboard) != 1 || len(kb.InlineKeyboard[0]) != 5 {
+		t.Fatalf("no rating keyboard: %#v", tg.markup)
+	}
+	four := kb.InlineKeyboard[0][3]
+	q := &telegram.CallbackQuery{ID: "q4", From: telegram.User{ID: 9}, Message: &telegram.Message{Chat: telegram.Chat{ID: 9}}, Data: four.CallbackData}
+	if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.rated != 77 || repo.rating != 4 || repo.chatID != 9 {
+		t.Fatalf("rating not stored: result %d rated %d in chat %d", repo.rated, repo.rating, repo.chatID)
+	}
+	if len(tg.notices) != 1 || tg.notices[0] != help.Phrase("en", "rating.thanks") {
+		t.Fatalf("unexpected notice %q", tg.notices)
+	}
+
+	// Another user cannot rate someone else's answer.
+	repo.rated = 0
+	q = &telegram.CallbackQuery{ID: "q5", From: telegram.User{ID: 10}, Message: &telegram.Message{Chat: telegram.Chat{ID: 9}}, Data: four.CallbackData}
+	if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.rated != 0 {
+		t.Fatal("rating by another user stored")
+	}
+}
+
+func TestDispatchLangPicker(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	d := newTestDispatcher(tg, &mockRepo{}, &mockOpenRouter{})
+	if err := d.dispatch(context.Background(), telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 4}, Text: "/lang"}}); err != nil {
+		t.Fatal(err)
+	}
+	kb, ok := tg.markup.(telegram.InlineKeyboardMarkup)
+	if !ok || len(kb.InlineKeyboard[0]) != len(languages) {
+		t.Fatalf("unexpected picker %#v", tg.markup)
+	}
+	ru := kb.InlineKeyboard[0][0]
+	q := &telegram.CallbackQuery{ID: "q3", From: telegram.User{ID: 4}, Message: &telegram.Message{Chat: telegram.Chat{ID: 4}}, Data: ru.CallbackData}
+	if err := d.dispatch(context.Background(), telegram.Update{CallbackQuery: q}); err != nil {
+		t.Fatal(err)
+	}
+	if langFor(4) != "ru" || tg.text != help.Phrase("ru", "lang.set") {
+		t.Fatalf("language not switched: %s %q", langFor(4), tg.text)
+	}
+}
+
+func TestDispatchLangArgument(t *testing.T) {
+	langPref = langPrefs{m: map[int64]string{}}
+	tg := &mockTelegram{}
+	d := newTestDispatcher(tg, &mockRepo{}, &mockOpenRouter{})
+	d.dispatch(context.Background(), telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 4}, Text: "/lang xx"}})
+	if langFor(4) != "en" || tg.markup == nil {
+		t.Fatalf("unsupported language accepted")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct{ in, cmd, arg string }{
+		{"/start", "/start", ""},
+		{"/Claim@LegalBot  text here", "/claim", "text here"},
+		{"plain text", "", "plain text"},
+	}
+	for _, c := range cases {
+		cmd, arg := parseCommand(c.in)
+		if cmd != c.cmd || arg != c.arg {
+			t.Errorf("parseCommand(%q) = %q, %q", c.in, cmd, arg)
+		}
+	}
+}
+
+// promptFunc builds prompts with a function, e.g. to inspect the context.
+type promptFunc func(ctx context.Context, req prompt.Request) (prompt.Result, error)
+
+func (f promptFunc) Build(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+	return f(ctx, req)
+}
+
+func TestWebhookAssignsRequestID(t *testing.T) {
+	var claimCtx context.Context
+	d := newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{resp: "answer"})
+	d.pb = promptFunc(func(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+		claimCtx = ctx
+		return (&mockPrompt{}).Build(ctx, req)
+	})
+	w := postUpdate(t, newWebhook(d, secrets.NewValue("s")), `{"update_id":1,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"question"}}`)
+	d.wait()
+	id := w.Header().Get(reqctx.HeaderRequestID)
+	if id == "" || reqctx.RequestID(claimCtx) != id {
+		t.Fatalf("claim handled with request ID %q, response had %q", reqctx.RequestID(claimCtx), id)
+	}
+	if _, ok := reqctx.Trace(claimCtx); !ok {
+		t.Fatal("claim handled without trace context")
+	}
+}
+
+// exportedSpan is the part of an OTLP span the tracing tests look at.
+type exportedSpan struct {
+	Name         string `json:"name"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+}
+
+func TestWebhookTracesUpdate(t *testing.T) {
+	var mu sync.Mutex
+	var spans []exportedSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+	tracer := tracing.New(collector.URL, "bot")
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(nil)
+
+	var claimCtx context.Context
+	d := newTestDispatcher(&mockTelegram{}, &mockRepo{}, &mockOpenRouter{resp: "answer"})
+	d.pb = promptFunc(func(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+		claimCtx = ctx
+		return (&mockPrompt{}).Build(ctx, req)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"question"}}`))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s")
+	req.Header.Set(reqctx.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	newWebhook(d, secrets.NewValue("s")).ServeHTTP(httptest.NewRecorder(), req)
+	d.wait()
+	tracer.Shutdown(context.Background())
+
+	byName := map[string]string{}
+	parents := map[string]string{}
+	for _, s := range spans {
+		byName[s.Name] = s.SpanID
+		parents[s.Name] = s.ParentSpanID
+	}
+	if parents["bot.webhook"] != "00f067aa0ba902b7" || parents["bot.update"] != byName["bot.webhook"] || byName["bot.update"] == "" {
+		t.Fatalf("spans %+v do not form webhook -> update", spans)
+	}
+	if tc, _ := reqctx.Trace(claimCtx); tc.SpanIDString() != byName["bot.update"] {
+		t.Fatalf("claim handled in span %s, want bot.update %s", tc.SpanIDString(), byName["bot.update"])
+	}
+}
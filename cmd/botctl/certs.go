@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"legalbot/internal/certs"
+)
+
+// devServices are the services dev-certs issues certificates for; each is
+// valid for its compose service name.
+var devServices = []string{"bot", "prompt", "worker"}
+
+// devCerts creates or reuses a CA in dir and issues a certificate for each
+// service, for the [mtls] settings of a development deployment.
+func devCerts(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("dev-certs", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := fs.String("dir", "certs", "directory for the CA and the service certificates")
+	hosts := fs.String("hosts", "", "comma-separated extra host names and IPs for every certificate")
+	days := fs.Int("days", 90, "validity of the service certificates in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days <= 0 {
+		return fmt.Errorf("-days must be positive")
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	ca, err := loadOrCreateCA(*dir, out)
+	if err != nil {
+		return err
+	}
+	extra := []string{"localhost", "127.0.0.1"}
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			extra = append(extra, h)
+		}
+	}
+	for _, svc := range devServices {
+		certPEM, keyPEM, err := ca.Issue(svc, append([]string{svc}, extra...), time.Duration(*days)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		if err := writeFiles(out, *dir, svc+".pem", certPEM, svc+"-key.pem", keyPEM); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "\nset mtls.ca_file to %s and mtls.cert_file and mtls.key_file to each service's pair\n",
+		filepath.Join(*dir, "ca.pem"))
+	return nil
+}
+
+// loadOrCreateCA reuses the CA in dir so certificates can be reissued
+// without redistributing ca.pem.
+func loadOrCreateCA(dir string, out io.Writer) (*certs.CA, error) {
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	ca, err := certs.LoadCA(certFile, keyFile)
+	if err == nil {
+		fmt.Fprintf(out, "using CA %s\n", certFile)
+		return ca, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ca, err = certs.NewCA("LegalBot development CA", 10*365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ca.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+	return ca, writeFiles(out, dir, "ca.pem", ca.CertPEM(), "ca-key.pem", keyPEM)
+}
+
+// writeFiles writes a certificate and its key; the key is only readable
+// by the owner.
+func writeFiles(out io.Writer, dir, certName string, certPEM []byte, keyName string, keyPEM []byte) error {
+	certFile, keyFile := filepath.Join(dir, certName), filepath.Join(dir, keyName)
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s and %s\n", certFile, keyFile)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"legalbot/internal/certs"
+)
+
+func TestDevCerts(t *testing.T) {
+	dir := t.TempDir()
+	var out strings.Builder
+	if err := run(context.Background(), []string{"dev-certs", "-dir", dir, "-hosts", "bot.internal"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := certs.LoadCAPool(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range devServices {
+		pair, err := tls.LoadX509KeyPair(filepath.Join(dir, svc+".pem"), filepath.Join(dir, svc+"-key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, host := range []string{svc, "localhost", "127.0.0.1", "bot.internal"} {
+			opts := x509.VerifyOptions{Roots: roots, DNSName: host, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}
+			if _, err := pair.Leaf.Verify(opts); err != nil {
+				t.Errorf("%s certificate for %s: %v", svc, host, err)
+			}
+		}
+	}
+	st, err := os.Stat(filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0o600 {
+		t.Fatalf("CA key mode %v, want 0600", st.Mode().Perm())
+	}
+
+	// Running again reissues the certificates under the same CA.
+	caPEM, _ := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err := run(context.Background(), []string{"dev-certs", "-dir", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if !bytes.Equal(caPEM, again) || !strings.Contains(out.String(), "using CA") {
+		t.Fatal("existing CA replaced")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestConfigExampleUpToDate fails when deploy/config.example.toml was not
+// regenerated after changing the settings or their defaults.
+func TestConfigExampleUpToDate(t *testing.T) {
+	var b strings.Builder
+	if err := run(context.Background(), []string{"config", "-defaults"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../../deploy/config.example.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(committed) {
+		t.Fatal("deploy/config.example.toml is stale; run go run ./cmd/botctl config -defaults > deploy/config.example.toml")
+	}
+}
+
+func TestRunConfigRedactsSecrets(t *testing.T) {
+	t.Setenv("TELEGRAM_TOKEN", "123:abc")
+	t.Setenv("BOT_MODE", "polling")
+	var b strings.Builder
+	if err := run(context.Background(), []string{"config"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "123:abc") || !strings.Contains(b.String(), `token = "[redacted]"`) {
+		t.Fatalf("token not redacted:\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), `mode = "polling" # BOT_MODE`) {
+		t.Fatalf("environment not applied:\n%s", b.String())
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	t.Setenv("POSTGRES_MAX_CONNS", "many")
+	err := run(context.Background(), []string{"slo-rules"}, &strings.Builder{})
+	if err == nil || !strings.Contains(err.Error(), "POSTGRES_MAX_CONNS") {
+		t.Fatalf("err = %v, want the malformed variable named", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Command botctl runs administrative tasks against LegalBot's infrastructure.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"legalbot/internal/config"
+	"legalbot/internal/db"
+	"legalbot/internal/secrets"
+	"legalbot/internal/slo"
+)
+
+const usage = `usage: botctl [-config FILE] <command>
+
+commands:
+  config          print the effective configuration with secrets redacted
+                  (-defaults prints the built-in defaults)
+  migrate         apply database migrations
+  prompt-report   compare ratings and JSON parse failures per prompt version
+  set-webhook     register the webhook URL and secret token with Telegram
+                  (-url, -secret-file, -allowed-updates, -max-connections, -drop-pending)
+  webhook-info    show the webhook URL, pending updates and last delivery error
+  slo-rules       print the Prometheus SLO recording and burn-rate alert rules
+  dev-certs       create a development CA and mutual TLS certificates for
+                  bot, prompt and worker (-dir, -hosts, -days)
+`
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		logger.Error("botctl", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("botctl", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "TOML configuration file; environment variables override it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fmt.Fprint(out, usage)
+		return fmt.Errorf("missing command")
+	}
+	cfg, err := config.Load(*configPath, os.Getenv)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "migrate", "prompt-report", "set-webhook", "webhook-info":
+		// These need the token or the DSN, which may be kept in Vault.
+		if _, err := secrets.Open(ctx, cfg, slog.Default()); err != nil {
+			return err
+		}
+	}
+	switch args[0] {
+	case "config":
+		return printConfig(cfg, args[1:], out)
+	case "migrate":
+		repo, err := openDB(ctx, cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+		return repo.Migrate(ctx)
+	case "prompt-report":
+		repo, err := openDB(ctx, cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+		stats, err := repo.PromptVersionReport(ctx)
+		if err != nil {
+			return err
+		}
+		return writePromptReport(out, stats)
+	case "set-webhook":
+		return setWebhook(ctx, cfg.Telegram, args[1:], out)
+	case "webhook-info":
+		return webhookInfo(ctx, cfg.Telegram, out)
+	case "slo-rules":
+		return slo.WriteRules(out, slo.Default)
+	case "dev-certs":
+		return devCerts(args[1:], out)
+	default:
+		fmt.Fprint(out, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func openDB(ctx context.Context, cfg config.DB) (*db.Repository, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return db.New(ctx, cfg)
+}
+
+// printConfig writes the configuration botctl loaded, which is what the
+// services see given the same file and environment.
+func printConfig(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(out)
+	defaults := fs.Bool("defaults", false, "print the built-in defaults instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *defaults {
+		cfg = config.Default()
+	}
+	return config.Write(out, cfg)
+}
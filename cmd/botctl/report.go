@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"legalbot/internal/db"
+)
+
+// writePromptReport prints per-version stats as an aligned table.
+func writePromptReport(w io.Writer, stats []db.VersionStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tRESULTS\tRATED\tAVG RATING\tPARSE FAILURES")
+	for _, s := range stats {
+		version := s.Version
+		if version == "" {
+			version = "(none)"
+		}
+		rating := "-"
+		if s.Rated > 0 {
+			rating = fmt.Sprintf("%.2f", s.AvgRating)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d (%.1f%%)\n",
+			version, s.Results, s.Rated, rating, s.ParseFailures, 100*s.ParseFailureRate())
+	}
+	return tw.Flush()
+}
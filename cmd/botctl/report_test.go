@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"legalbot/internal/db"
+)
+
+func TestWritePromptReport(t *testing.T) {
+	var b strings.Builder
+	err := writePromptReport(&b, []db.VersionStats{
+		{Version: "", Results: 3},
+		{Version: "golden-v1", Results: 10, Rated: 4, AvgRating: 4.25, ParseFailures: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `VERSION    RESULTS  RATED  AVG RATING  PARSE FAILURES
+(none)     3        0      -           0 (0.0%)
+golden-v1  10       4      4.25        1 (10.0%)
+`
+	if b.String() != want {
+		t.Fatalf("unexpected report:\n%s", b.String())
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	var b strings.Builder
+	if err := run(context.Background(), []string{"nope"}, &b); err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.HasPrefix(b.String(), "usage:") {
+		t.Fatalf("usage not printed: %q", b.String())
+	}
+}
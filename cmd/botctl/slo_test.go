@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSLORulesUpToDate fails when deploy/slo-rules.yml was not regenerated
+// after changing the objectives.
+func TestSLORulesUpToDate(t *testing.T) {
+	var b strings.Builder
+	if err := run(context.Background(), []string{"slo-rules"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../../deploy/slo-rules.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(committed) {
+		t.Fatal("deploy/slo-rules.yml is stale; run go run ./cmd/botctl slo-rules > deploy/slo-rules.yml")
+	}
+}
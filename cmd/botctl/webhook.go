@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/telegram"
+)
+
+// setWebhook registers the bot's webhook URL together with the secret token
+// the webhook handler checks. The token comes from the configuration, e.g.
+// TELEGRAM_SECRET_TOKEN, or from -secret-file, never from the command line
+// where other users could see it.
+func setWebhook(ctx context.Context, tc config.Telegram, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("set-webhook", flag.ContinueOnError)
+	fs.SetOutput(out)
+	hookURL := fs.String("url", tc.WebhookURL, "public HTTPS URL of the bot")
+	secretFile := fs.String("secret-file", "", "file holding the secret token sent in X-Telegram-Bot-Api-Secret-Token (default telegram.webhook_secret or TELEGRAM_SECRET_TOKEN)")
+	allowed := fs.String("allowed-updates", strings.Join(telegram.AllowedUpdates, ","), "comma-separated update types to receive")
+	maxConns := fs.Int("max-connections", 40, "maximum simultaneous webhook connections (1-100)")
+	drop := fs.Bool("drop-pending", false, "drop updates queued while no webhook was set")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *hookURL == "" {
+		return fmt.Errorf("set-webhook: -url, telegram.webhook_url or WEBHOOK_URL is required")
+	}
+	if *maxConns < 1 || *maxConns > 100 {
+		return fmt.Errorf("set-webhook: -max-connections must be between 1 and 100")
+	}
+	secret := string(tc.WebhookSecret)
+	if *secretFile != "" {
+		data, err := os.ReadFile(*secretFile)
+		if err != nil {
+			return fmt.Errorf("set-webhook: %w", err)
+		}
+		secret = strings.TrimRight(string(data), "\r\n")
+	}
+	if secret == "" {
+		fmt.Fprintln(out, "warning: no secret token, the webhook will accept unauthenticated requests")
+	}
+	cfg := telegram.WebhookConfig{
+		URL:                *hookURL,
+		SecretToken:        secret,
+		AllowedUpdates:     splitList(*allowed),
+		MaxConnections:     *maxConns,
+		DropPendingUpdates: *drop,
+	}
+	if err := newTelegram(tc).SetWebhook(ctx, cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "webhook set to %s\n", cfg.URL)
+	return nil
+}
+
+// webhookInfo prints the webhook status Telegram reports.
+func webhookInfo(ctx context.Context, tc config.Telegram, out io.Writer) error {
+	info, err := newTelegram(tc).GetWebhookInfo(ctx)
+	if err != nil {
+		return err
+	}
+	return writeWebhookInfo(out, info)
+}
+
+func writeWebhookInfo(w io.Writer, info telegram.WebhookInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	url := info.URL
+	if url == "" {
+		url = "(none)"
+	}
+	fmt.Fprintf(tw, "URL\t%s\n", url)
+	fmt.Fprintf(tw, "PENDING UPDATES\t%d\n", info.PendingUpdateCount)
+	if info.MaxConnections > 0 {
+		fmt.Fprintf(tw, "MAX CONNECTIONS\t%d\n", info.MaxConnections)
+	}
+	if len(info.AllowedUpdates) > 0 {
+		fmt.Fprintf(tw, "ALLOWED UPDATES\t%s\n", strings.Join(info.AllowedUpdates, ","))
+	}
+	if info.IPAddress != "" {
+		fmt.Fprintf(tw, "IP ADDRESS\t%s\n", info.IPAddress)
+	}
+	if info.LastErrorMessage != "" {
+		fmt.Fprintf(tw, "LAST ERROR\t%s (%s)\n", info.LastErrorMessage, info.LastError().UTC().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func newTelegram(tc config.Telegram) *telegram.Client {
+	return telegram.New(string(tc.Token), telegram.WithBaseURL(tc.APIURL))
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
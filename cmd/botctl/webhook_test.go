@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"legalbot/internal/telegram"
+)
+
+func fakeBotAPI(t *testing.T, result string) *url.Values {
+	t.Helper()
+	form := &url.Values{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		*form = r.PostForm
+		form.Set("method", strings.TrimPrefix(r.URL.Path, "/botTOKEN/"))
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("TELEGRAM_API_URL", srv.URL)
+	t.Setenv("TELEGRAM_TOKEN", "TOKEN")
+	return form
+}
+
+func TestRunSetWebhook(t *testing.T) {
+	form := fakeBotAPI(t, "true")
+	t.Setenv("TELEGRAM_SECRET_TOKEN", "s3cret")
+	var b strings.Builder
+	args := []string{"set-webhook", "-url", "https://bot.example.com/", "-max-connections", "10", "-drop-pending"}
+	if err := run(context.Background(), args, &b); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"method":               "setWebhook",
+		"url":                  "https://bot.example.com/",
+		"secret_token":         "s3cret",
+		"allowed_updates":      `["message","callback_query"]`,
+		"max_connections":      "10",
+		"drop_pending_updates": "true",
+	}
+	for k, v := range want {
+		if form.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, form.Get(k), v)
+		}
+	}
+	if b.String() != "webhook set to https://bot.example.com/\n" {
+		t.Fatalf("unexpected output %q", b.String())
+	}
+}
+
+func TestRunSetWebhookSecretFile(t *testing.T) {
+	form := fakeBotAPI(t, "true")
+	t.Setenv("TELEGRAM_SECRET_TOKEN", "from-env")
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"set-webhook", "-url", "https://bot.example.com/", "-secret-file", path}
+	if err := run(context.Background(), args, &strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("secret_token") != "from-file" {
+		t.Fatalf("secret_token = %q", form.Get("secret_token"))
+	}
+
+	args = []string{"set-webhook", "-url", "https://bot.example.com/", "-secret-file", path + ".missing"}
+	if err := run(context.Background(), args, &strings.Builder{}); err == nil {
+		t.Fatal("expected error for a missing secret file")
+	}
+}
+
+func TestRunSetWebhookValidation(t *testing.T) {
+	fakeBotAPI(t, "true")
+	t.Setenv("WEBHOOK_URL", "")
+	for _, args := range [][]string{
+		{"set-webhook"},
+		{"set-webhook", "-url", "https://x", "-max-connections", "500"},
+	} {
+		if err := run(context.Background(), args, &strings.Builder{}); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
+
+func TestRunWebhookInfo(t *testing.T) {
+	form := fakeBotAPI(t, `{"url":"https://bot.example.com/","pending_update_count":2,
+		"last_error_date":1700000000,"last_error_message":"Connection refused","max_connections":40}`)
+	var b strings.Builder
+	if err := run(context.Background(), []string{"webhook-info"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("method") != "getWebhookInfo" {
+		t.Fatalf("unexpected method %q", form.Get("method"))
+	}
+	want := `URL              https://bot.example.com/
+PENDING UPDATES  2
+MAX CONNECTIONS  40
+LAST ERROR       Connection refused (2023-11-14T22:13:20Z)
+`
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestWriteWebhookInfoUnset(t *testing.T) {
+	var b strings.Builder
+	if err := writeWebhookInfo(&b, telegram.WebhookInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "URL              (none)\nPENDING UPDATES  0\n" {
+		t.Fatalf("unexpected output %q", b.String())
+	}
+}
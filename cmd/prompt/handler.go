@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"legalbot/internal/certs"
+	"legalbot/internal/health"
+	"legalbot/internal/metrics"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/tracing"
+)
+
+// maxBuildBody caps the Build request body; user text is limited to 8000
+// characters plus law excerpts and the text of up to five attached files.
+const maxBuildBody = 1 << 20
+
+// PromptBuilder renders a prompt for a request.
+type PromptBuilder interface {
+	Build(ctx context.Context, req prompt.Request) (prompt.Result, error)
+}
+
+var buildDuration = metrics.NewHistogram("prompt_build_duration_seconds",
+	"Time to build a prompt by HTTP status.", metrics.LatencyBuckets, "status")
+
+// newMux wires the prompt service routes. The service is internal, so
+// /metrics, /healthz and /readyz are served on the same port. Request IDs and trace context sent by
+// the bot are picked up for the logs, and builds are traced as children of
+// the bot's span. With clientCerts, builds need a verified client
+// certificate while health checks and metrics stay open.
+func newMux(b PromptBuilder, checks *health.Checker, clientCerts bool, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	var build http.Handler = tracing.Middleware("prompt.serve_build", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleBuild(w, r, b, logger)
+	}))
+	if clientCerts {
+		build = certs.RequireClientCert(build)
+	}
+	mux.Handle("POST "+prompt.BuildPath, metrics.InstrumentHandler(buildDuration, build))
+	mux.Handle("GET /metrics", metrics.Handler())
+	checks.Register(mux)
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(reqctx.HeaderRequestID) != "" {
+			logger.InfoContext(r.Context(), "ping")
+		}
+		w.Write([]byte("ok"))
+	})
+	return reqctx.Middleware(mux)
+}
+
+// handleBuild decodes a BuildRequest, renders the prompt and writes a
+// BuildResponse.
+func handleBuild(w http.ResponseWriter, r *http.Request, b PromptBuilder, logger *slog.Logger) {
+	var req prompt.Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBuildBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	res, err := b.Build(r.Context(), req)
+	if errors.Is(err, prompt.ErrEmptyQuestion) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "build prompt", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(prompt.BuildResponse{Prompt: res.Prompt, Version: res.Version, Category: res.Category}); err != nil {
+		logger.ErrorContext(r.Context(), "write response", "err", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/certs"
+	"legalbot/internal/config"
+	"legalbot/internal/health"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	b, err := prompt.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newMux(b, health.New(), false, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBuildEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	body := `{"userText":"Не вернули залог за квартиру","laws":["ГК РФ, ст. 381"],"date":"2024-05-01T00:00:00Z"}`
+	resp, err := http.Post(srv.URL+prompt.BuildPath, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	var out prompt.BuildResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Date: 2024-05-01", "ГК РФ, ст. 381", "Не вернули залог за квартиру"} {
+		if !strings.Contains(out.Prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, out.Prompt)
+		}
+	}
+}
+
+func TestBuildEndpointEmptyQuestion(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+prompt.BuildPath, "application/json", strings.NewReader(`{"userText":""}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestBuildEndpointBadJSON(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+prompt.BuildPath, "application/json", strings.NewReader(`{`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+prompt.BuildPath, "application/json", strings.NewReader(`{`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `prompt_build_duration_seconds_count{status="400"}`) {
+		t.Fatalf("build request not in metrics:\n%s", body)
+	}
+}
+
+func TestBuildEndpointMethod(t *testing.T) {
+	srv := newTestServer(t)
+	resp, err := http.Get(srv.URL + prompt.BuildPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	srv := newTestServer(t)
+	c := prompt.NewClient(srv.URL)
+	got, err := c.Build(context.Background(), prompt.Request{UserText: "вопрос"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "golden-v1" || !strings.Contains(got.Prompt, "USER_QUESTION:\nвопрос") {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+}
+
+// failingBuilder fails every build so the handler logs an error.
+type failingBuilder struct{}
+
+func (failingBuilder) Build(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+	return prompt.Result{}, errors.New("template broken")
+}
+
+func TestRequestIDPropagatesFromClient(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(reqctx.NewLogHandler(slog.NewTextHandler(&logs, nil)))
+	srv := httptest.NewServer(newMux(failingBuilder{}, health.New(), false, logger))
+	defer srv.Close()
+
+	ctx := reqctx.Start(context.Background())
+	tc, _ := reqctx.Trace(ctx)
+	if _, err := prompt.NewClient(srv.URL).Build(ctx, prompt.Request{UserText: "q"}); err == nil {
+		t.Fatal("expected error")
+	}
+	line := logs.String()
+	if !strings.Contains(line, "request_id="+reqctx.RequestID(ctx)) || !strings.Contains(line, "trace_id="+tc.TraceIDString()) {
+		t.Fatalf("server log lacks the client's IDs: %s", line)
+	}
+}
+
+func TestReadyzReportsDraining(t *testing.T) {
+	checks := health.New()
+	srv := httptest.NewServer(newMux(failingBuilder{}, checks, false, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		draining bool
+		path     string
+		want     int
+	}{
+		{false, "/healthz", http.StatusOK},
+		{false, "/readyz", http.StatusOK},
+		{true, "/readyz", http.StatusServiceUnavailable},
+		{true, "/healthz", http.StatusOK},
+	} {
+		if tc.draining {
+			checks.SetDraining()
+		}
+		resp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Fatalf("%s (draining %v) = %d, want %d", tc.path, tc.draining, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+// writeCert issues a certificate for cn and returns the mtls settings of a
+// service using it.
+func writeCert(t *testing.T, ca *certs.CA, dir, cn string) config.MTLS {
+	t.Helper()
+	certPEM, keyPEM, err := ca.Issue(cn, []string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := config.MTLS{
+		CertFile: filepath.Join(dir, cn+".pem"),
+		KeyFile:  filepath.Join(dir, cn+"-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	for file, data := range map[string][]byte{m.CertFile: certPEM, m.KeyFile: keyPEM, m.CAFile: ca.CertPEM()} {
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestBuildEndpointMutualTLS(t *testing.T) {
+	ca, err := certs.NewCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server, err := certs.FromConfig(writeCert(t, ca, dir, "prompt"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := certs.FromConfig(writeCert(t, ca, dir, "bot"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := prompt.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(newMux(b, health.New(), true, logger))
+	srv.Listener = tls.NewListener(srv.Listener, server.ServerConfig())
+	srv.Start()
+	defer srv.Close()
+	url := "https://" + srv.Listener.Addr().String()
+
+	req := prompt.Request{UserText: "Не вернули залог за квартиру"}
+	client := prompt.NewClient(url, prompt.WithHTTPClient(bot.HTTPClient(5*time.Second)), prompt.WithLogger(logger))
+	if _, err := client.Build(context.Background(), req); err != nil {
+		t.Fatalf("build with the bot's certificate: %v", err)
+	}
+
+	// Without a client certificate builds are refused but health answers.
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: certs.ClientConfig(nil, bot.CAs)}}
+	if _, err := prompt.NewClient(url, prompt.WithHTTPClient(anon), prompt.WithLogger(logger)).Build(context.Background(), req); err == nil {
+		t.Fatal("build without a client certificate passed")
+	}
+	resp, err := anon.Get(url + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz without a client certificate: %d", resp.StatusCode)
+	}
+}
+
+func TestWatchTemplatesStopsWithContext(t *testing.T) {
+	b, err := prompt.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchTemplates(ctx, b, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchTemplates did not return after cancel")
+	}
+}
@@ -1,25 +1,197 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"legalbot/internal/certs"
+	"legalbot/internal/classify"
+	"legalbot/internal/config"
+	"legalbot/internal/health"
+	"legalbot/internal/laws"
+	"legalbot/internal/openrouter"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/secrets"
+	"legalbot/internal/tracing"
+	"legalbot/internal/vector"
 )
 
 func main() {
-	addr := flag.String("listen", ":8090", "listen address")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "TOML configuration file; environment variables override it")
+	probe := flag.String("probe", "", "request this URL and exit 0 on a 2xx answer, for container healthchecks")
 	flag.Parse()
-
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	if *probe != "" {
+		os.Exit(health.Probe(*probe))
+	}
+	logger := slog.New(reqctx.NewLogHandler(slog.NewTextHandler(os.Stdout, nil)))
 	slog.SetDefault(logger)
-	logger.Info("starting prompt service", "addr", *addr)
-	if err := http.ListenAndServe(*addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if reqID := r.Header.Get("X-Request-ID"); reqID != "" {
-			logger.Info("ping", "request_id", reqID)
+	cfg, err := config.Load(*configPath, os.Getenv)
+	var keys *secrets.Watcher
+	if err == nil {
+		keys, err = secrets.Open(context.Background(), cfg, logger)
+	}
+	if err == nil {
+		err = cfg.Validate(config.PromptBinary)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if tracer := tracing.FromConfig(cfg.Tracing, "prompt", tracing.WithLogger(logger)); tracer != nil {
+		tracing.SetDefault(tracer)
+		defer tracer.Shutdown(context.Background())
+		logger.Info("tracing enabled", "endpoint", tracer.Endpoint, "sample_ratio", tracer.SampleRatio)
+	}
+	pc := cfg.Prompt
+	classifierOpts := []func(*classify.Classifier){classify.WithLogger(logger)}
+	if pc.ClassifyLLM {
+		llm := openrouter.New(cfg.OpenRouter)
+		keys.OnChange(secrets.OpenRouterKey, llm.SetAPIKey)
+		classifierOpts = append(classifierOpts, classify.WithLLM(llm))
+	}
+	opts := []func(*prompt.Builder){
+		prompt.WithDir(pc.TemplatesDir),
+		prompt.WithClassifier(classify.New(classifierOpts...)),
+	}
+	if pc.LawsDir != "" {
+		articles, err := laws.LoadDir(pc.LawsDir)
+		if err != nil {
+			logger.Error("load laws", "err", err)
+			os.Exit(1)
+		}
+		index := laws.NewIndex(articles)
+		logger.Info("law corpus indexed", "dir", pc.LawsDir, "articles", len(articles))
+		var retriever prompt.Retriever = index
+		if pc.Vectors != "" {
+			hybrid, err := newHybrid(index, pc, cfg.OpenRouter, keys, logger)
+			if err != nil {
+				logger.Error("load law embeddings", "err", err)
+				os.Exit(1)
+			}
+			retriever = hybrid
+		}
+		opts = append(opts, prompt.WithRetriever(retriever, pc.LawsK))
+	}
+	builder, err := prompt.New(opts...)
+	if err != nil {
+		logger.Error("load templates", "err", err)
+		os.Exit(1)
+	}
+	logger.Info("prompt experiment loaded", "experiment", builder.Experiment().Name)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if pc.TemplatesDir != "" && pc.Reload > 0 {
+		go watchTemplates(ctx, builder, pc.Reload, logger)
+	}
+	go keys.Run(ctx)
+	mtls, err := certs.FromConfig(cfg.MTLS, logger)
+	if err != nil {
+		logger.Error("load certificates", "err", err)
+		os.Exit(1)
+	}
+	checks := health.New()
+	srv := &http.Server{Addr: pc.Listen, Handler: newMux(builder, checks, mtls != nil, logger)}
+	serve := srv.ListenAndServe
+	if mtls != nil {
+		srv.TLSConfig = mtls.ServerConfig()
+		serve = func() error { return srv.ListenAndServeTLS("", "") }
+	}
+	logger.Info("starting prompt service", "addr", pc.Listen, "mtls", mtls != nil)
+	go func() {
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server error", "err", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+
+	// Builds in progress finish before the process exits.
+	stop()
+	logger.Info("shutting down", "timeout", pc.ShutdownTimeout)
+	checks.SetDraining()
+	sctx, cancel := context.WithTimeout(context.Background(), pc.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		logger.Error("stop server", "err", err)
+	}
+	logger.Info("prompt service stopped")
+}
+
+// watchTemplates periodically reloads templates so versions can be added or
+// rolled back by editing files in the templates directory. It returns when
+// ctx is done.
+func watchTemplates(ctx context.Context, b *prompt.Builder, every time.Duration, logger *slog.Logger) {
+	current := b.Experiment()
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := b.Reload(); err != nil {
+			logger.Error("reload templates", "err", err)
+			continue
+		}
+		if exp := b.Experiment(); !sameExperiment(current, exp) {
+			logger.Info("prompt experiment changed", "experiment", exp.Name, "variants", exp.Variants)
+			current = exp
+		}
+	}
+}
+
+func sameExperiment(a, b prompt.Experiment) bool {
+	if a.Name != b.Name || len(a.Variants) != len(b.Variants) {
+		return false
+	}
+	for i := range a.Variants {
+		if a.Variants[i] != b.Variants[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newHybrid loads article embeddings from the vectors file, embeds articles
+// missing from it or changed since via OpenRouter and saves the file back
+// before serving.
+func newHybrid(index *laws.Index, pc config.Prompt, or config.OpenRouter, keys *secrets.Watcher, logger *slog.Logger) (*laws.Hybrid, error) {
+	path := pc.Vectors
+	store, err := vector.LoadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		store, err = vector.New(pc.VectorIndex)
+	case err == nil && store.Kind() != pc.VectorIndex:
+		err = fmt.Errorf("%s holds a %s index but prompt.vector_index is %s; delete the file to rebuild it", path, store.Kind(), pc.VectorIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := openrouter.New(or)
+	keys.OnChange(secrets.OpenRouterKey, client.SetAPIKey)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	synced, added, err := laws.EmbedMissing(ctx, index.Articles(), store, client, or.EmbeddingModel, 32)
+	if err != nil {
+		return nil, err
+	}
+	if added > 0 || synced != store {
+		store = synced
+		if err := vector.SaveFile(path, store); err != nil {
+			return nil, err
 		}
-		w.Write([]byte("ok"))
-	})); err != nil {
-		logger.Error("server error", "err", err)
 	}
+	logger.Info("law embeddings ready", "path", path, "vectors", store.Len(), "added", added)
+	return laws.NewHybrid(index, store, client, laws.WithAlpha(pc.HybridAlpha), laws.WithLogger(logger)), nil
 }
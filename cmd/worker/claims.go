@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"legalbot/internal/claim"
+	"legalbot/internal/health"
+	"legalbot/internal/metrics"
+	"legalbot/internal/slo"
+	"legalbot/internal/tracing"
+)
+
+var (
+	claimsTotal = metrics.NewCounter("worker_claims_total",
+		"Queued claims handled by outcome.", "outcome")
+	claimDuration = metrics.NewHistogram("worker_claim_duration_seconds",
+		"Time from the bot receiving the update to sending the answer by outcome. The SLA is 10s for 95% of answers.",
+		metrics.LatencyBuckets, "outcome")
+)
+
+// claimSLO tracks the claim objectives in process for /debug/slo.
+var claimSLO = slo.New(slo.Default)
+
+// ClaimProcessor answers a task, e.g. *claim.Processor.
+type ClaimProcessor interface {
+	Process(ctx context.Context, t claim.Task) (string, error)
+}
+
+// answer answers one task taken off the queue and records its outcome.
+// Its span continues the trace the bot published the task in.
+func answer(ctx context.Context, p ClaimProcessor, t claim.Task) {
+	ctx, span := tracing.StartRequest(ctx, "worker.claim")
+	span.SetInt("claim_id", t.ClaimID)
+	outcome, err := p.Process(ctx, t)
+	span.SetAttr("outcome", outcome)
+	span.EndError(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "send answer", "claim_id", t.ClaimID, "err", err)
+	}
+	observeClaim(outcome, t.ReceivedAt)
+}
+
+// observeClaim records a claim whose update the bot received at start.
+// Duplicate deliveries do not count towards the SLOs.
+func observeClaim(outcome string, start time.Time) {
+	elapsed := time.Since(start)
+	claimsTotal.Inc(outcome)
+	claimDuration.Observe(elapsed.Seconds(), outcome)
+	switch outcome {
+	case claim.OutcomeDelivered:
+		claimSLO.Record(elapsed, false)
+	case claim.OutcomePromptError, claim.OutcomeModelError, claim.OutcomeDBError, claim.OutcomeSendError:
+		claimSLO.Record(elapsed, true)
+	}
+}
+
+// newOpsMux serves /metrics, /debug/slo, /healthz and /readyz.
+func newOpsMux(checks *health.Checker) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /debug/slo", claimSLO.Handler())
+	checks.Register(mux)
+	return mux
+}
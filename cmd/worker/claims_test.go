@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"legalbot/internal/amqp/amqptest"
+	"legalbot/internal/claim"
+	"legalbot/internal/db"
+	"legalbot/internal/pii"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
+)
+
+type sentMessage struct {
+	chatID, thread int64
+	text           string
+}
+
+type fakeTelegram struct{ sent chan sentMessage }
+
+func (f *fakeTelegram) SendMessage(ctx context.Context, chatID int64, text string) error {
+	f.sent <- sentMessage{chatID, telegram.ThreadID(ctx), text}
+	return nil
+}
+
+func (f *fakeTelegram) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	return f.SendMessage(ctx, chatID, text)
+}
+
+func (f *fakeTelegram) SendFormatted(ctx context.Context, chatID int64, fm telegram.Formatted, markup telegram.ReplyMarkup) error {
+	return f.SendMessage(ctx, chatID, fm.Text)
+}
+
+type fakeModel struct{ prompt chan string }
+
+func (f *fakeModel) ChatCompletion(ctx context.Context, prompt string) (string, error) {
+	f.prompt <- prompt
+	return "answer", nil
+}
+
+type fakeRepo struct{}
+
+func (fakeRepo) TransitionClaim(ctx context.Context, id int64, from, to db.ClaimState, reason string) error {
+	return nil
+}
+
+func (fakeRepo) SetClaimResult(ctx context.Context, id, resultID int64) error { return nil }
+
+func (fakeRepo) SaveResult(ctx context.Context, chatID, userID int64, data string, meta db.ResultMeta) (int64, error) {
+	return 1, nil
+}
+
+func TestWorkerAnswersQueuedClaim(t *testing.T) {
+	built := make(chan prompt.Request, 1)
+	promptSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != prompt.BuildPath {
+			http.NotFound(w, r)
+			return
+		}
+		var req prompt.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		built <- req
+		json.NewEncoder(w).Encode(prompt.BuildResponse{Prompt: "golden:" + req.UserText, Version: "v1", Category: "consumer"})
+	}))
+	defer promptSrv.Close()
+	broker := amqptest.NewServer(t)
+
+	tg := &fakeTelegram{sent: make(chan sentMessage, 1)}
+	model := &fakeModel{prompt: make(chan string, 1)}
+	p := &claim.Processor{
+		Telegram: tg,
+		Prompt:   prompt.NewClient(promptSrv.URL, prompt.WithLogger(nil)),
+		Model:    model,
+		Repo:     fakeRepo{},
+		Redactor: pii.New(pii.Redact),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	consumer := claim.NewConsumer(broker.URL, nil, 1)
+	consumer.Logger = nil
+	go consumer.Run(ctx, func(ctx context.Context, t claim.Task) { answer(ctx, p, t) })
+
+	before := claimsTotal.Value(claim.OutcomeDelivered)
+	pub := claim.NewPublisher(broker.URL, nil)
+	defer pub.Close()
+	task := claim.Task{ChatID: -100500, UserID: 5, ThreadID: 11, Text: "Продавец не возвращает деньги", ReceivedAt: time.Now()}
+	if err := pub.Publish(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case req := <-built:
+		if req.ChatID != task.ChatID || req.UserText != task.Text {
+			t.Fatalf("prompt built for %+v", req)
+		}
+	case <-timeout:
+		t.Fatal("prompt service not called")
+	}
+	select {
+	case got := <-model.prompt:
+		if got != "golden:"+task.Text {
+			t.Fatalf("model called with %q", got)
+		}
+	case <-timeout:
+		t.Fatal("model not called")
+	}
+	select {
+	case m := <-tg.sent:
+		if m != (sentMessage{task.ChatID, 11, "answer"}) {
+			t.Fatalf("sent %+v", m)
+		}
+	case <-timeout:
+		t.Fatal("answer not sent")
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for claimsTotal.Value(claim.OutcomeDelivered) != before+1 {
+		if time.Now().After(deadline) {
+			t.Fatal("claim not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
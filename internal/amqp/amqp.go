@@ -0,0 +1,577 @@
+// Package amqp is a minimal AMQP 0-9-1 client for RabbitMQ. It covers what
+// the claim queue needs and nothing more: one channel per connection,
+// durable queues on the default exchange, persistent messages published
+// with publisher confirms, and consumers that acknowledge every message.
+package amqp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"legalbot/internal/amqp/wire"
+)
+
+// Table holds message headers.
+type Table = wire.Table
+
+// ErrClosed is returned for operations on a connection after Close.
+var ErrClosed = errors.New("amqp: connection closed")
+
+// Message is a message to publish or a delivered one.
+type Message struct {
+	ContentType string
+	// Type names the kind of message, e.g. "claim.create".
+	Type    string
+	Headers Table
+	Body    []byte
+}
+
+// Delivery is a message taken from a queue. It must be acknowledged with
+// Ack or Reject.
+type Delivery struct {
+	Message
+	Redelivered bool
+
+	tag  uint64
+	conn *Conn
+}
+
+// Ack tells the broker the message was handled.
+func (d Delivery) Ack() error {
+	args := &wire.Buffer{}
+	args.LongLong(d.tag)
+	args.Bits(false)
+	return d.conn.send(wire.MethodFrame(channel, wire.BasicAck, args))
+}
+
+// Reject returns the message to the broker, which queues it again if
+// requeue is set and drops it otherwise.
+func (d Delivery) Reject(requeue bool) error {
+	args := &wire.Buffer{}
+	args.LongLong(d.tag)
+	args.Bits(requeue)
+	return d.conn.send(wire.MethodFrame(channel, wire.BasicReject, args))
+}
+
+// channel is the single channel every connection opens.
+const channel = 1
+
+// maxFrame is the largest frame the client asks for.
+const maxFrame = 128 << 10
+
+// Conn is a connection to the broker with one channel in confirm mode.
+// Its methods may be called concurrently.
+type Conn struct {
+	nc       net.Conn
+	frameMax uint32
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// rpc serialises synchronous methods; replies carries their answers.
+	rpc     sync.Mutex
+	replies chan wire.Frame
+
+	mu         sync.Mutex
+	published  uint64
+	confirms   map[uint64]chan bool
+	deliveries chan Delivery
+	// stopped is set once read returns and deliveries is closed.
+	stopped bool
+
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+// Dial connects to the broker at an amqp:// or amqps:// URL. tlsConfig is
+// used for amqps and may be nil to use the system roots.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "amqp" && u.Scheme != "amqps") {
+		// The URL holds credentials, so it is not echoed.
+		return nil, errors.New("amqp: invalid URL")
+	}
+	user, pass := "guest", "guest"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	vhost := strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		vhost = "/"
+	}
+	port := u.Port()
+	if port == "" {
+		port = "5672"
+		if u.Scheme == "amqps" {
+			port = "5671"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("amqp: dial: %w", err)
+	}
+	if u.Scheme == "amqps" {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		nc = tls.Client(nc, cfg)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	nc.SetDeadline(deadline)
+	c := &Conn{
+		nc:       nc,
+		w:        bufio.NewWriter(nc),
+		replies:  make(chan wire.Frame, 1),
+		confirms: map[uint64]chan bool{},
+		done:     make(chan struct{}),
+	}
+	r := bufio.NewReader(nc)
+	heartbeat, err := c.handshake(r, user, pass, vhost)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	go c.read(r, heartbeat)
+	if heartbeat > 0 {
+		go c.beat(heartbeat)
+	}
+	if _, err := c.call(wire.ChannelOpen, wire.ChannelOpenOk, func(b *wire.Buffer) { b.ShortStr("") }); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if _, err := c.call(wire.ConfirmSelect, wire.ConfirmSelectOk, func(b *wire.Buffer) { b.Bits(false) }); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake opens the connection and returns the heartbeat interval agreed
+// with the broker.
+func (c *Conn) handshake(r *bufio.Reader, user, pass, vhost string) (time.Duration, error) {
+	c.w.Write(wire.Protocol)
+	if err := c.w.Flush(); err != nil {
+		return 0, fmt.Errorf("amqp: handshake: %w", err)
+	}
+	args, err := c.expect(r, wire.ConnectionStart)
+	if err != nil {
+		return 0, err
+	}
+	args.Octet()
+	args.Octet()
+	args.Table()
+	if mechs := args.LongStr(); !strings.Contains(" "+mechs+" ", " PLAIN ") {
+		return 0, fmt.Errorf("amqp: broker does not offer PLAIN authentication (%s)", mechs)
+	}
+	startOk := &wire.Buffer{}
+	startOk.Table(Table{"product": "legalbot", "capabilities": Table{"publisher_confirms": true}})
+	startOk.ShortStr("PLAIN")
+	startOk.LongStr("\x00" + user + "\x00" + pass)
+	startOk.ShortStr("en_US")
+	if err := c.write(wire.MethodFrame(0, wire.ConnectionStartOk, startOk)); err != nil {
+		return 0, err
+	}
+
+	args, err = c.expect(r, wire.ConnectionTune)
+	if err != nil {
+		return 0, err
+	}
+	channelMax, frameMax, heartbeat := args.Short(), args.Long(), args.Short()
+	if frameMax == 0 || frameMax > maxFrame {
+		frameMax = maxFrame
+	}
+	c.frameMax = frameMax
+	tuneOk := &wire.Buffer{}
+	tuneOk.Short(channelMax)
+	tuneOk.Long(frameMax)
+	tuneOk.Short(heartbeat)
+	open := &wire.Buffer{}
+	open.ShortStr(vhost)
+	open.ShortStr("")
+	open.Bits(false)
+	if err := c.write(wire.MethodFrame(0, wire.ConnectionTuneOk, tuneOk), wire.MethodFrame(0, wire.ConnectionOpen, open)); err != nil {
+		return 0, err
+	}
+	if _, err := c.expect(r, wire.ConnectionOpenOk); err != nil {
+		return 0, err
+	}
+	return time.Duration(heartbeat) * time.Second, nil
+}
+
+// expect reads the next frame during the handshake and requires it to be
+// the method want. A broker refusing the connection, e.g. for bad
+// credentials, answers with connection.close instead.
+func (c *Conn) expect(r *bufio.Reader, want wire.MethodID) (*wire.Reader, error) {
+	f, err := wire.ReadFrame(r, maxFrame)
+	if err != nil {
+		return nil, fmt.Errorf("amqp: handshake: %w", err)
+	}
+	if f.Type != wire.FrameMethod {
+		return nil, fmt.Errorf("amqp: handshake: unexpected frame type %d", f.Type)
+	}
+	id, args := f.Method()
+	if id == wire.ConnectionClose {
+		return nil, closeError("connection", args)
+	}
+	if id != want {
+		return nil, fmt.Errorf("amqp: handshake: got method %v, want %v", id, want)
+	}
+	return args, nil
+}
+
+// closeError describes a close method sent by the broker.
+func closeError(what string, args *wire.Reader) error {
+	code, text := args.Short(), args.ShortStr()
+	return fmt.Errorf("amqp: %s closed by broker: %d %s", what, code, text)
+}
+
+// write sends frames together and flushes them.
+func (c *Conn) write(frames ...wire.Frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for _, f := range frames {
+		wire.WriteFrame(c.w, f)
+	}
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("amqp: write: %w", err)
+	}
+	return nil
+}
+
+// send writes frames on an open connection, failing it on write errors.
+func (c *Conn) send(frames ...wire.Frame) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	if err := c.write(frames...); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// call sends a synchronous method on the channel and waits for its reply.
+func (c *Conn) call(id, reply wire.MethodID, args func(*wire.Buffer)) (*wire.Reader, error) {
+	c.rpc.Lock()
+	defer c.rpc.Unlock()
+	b := &wire.Buffer{}
+	args(b)
+	if err := c.send(wire.MethodFrame(channel, id, b)); err != nil {
+		return nil, err
+	}
+	select {
+	case f := <-c.replies:
+		got, r := f.Method()
+		if got != reply {
+			err := fmt.Errorf("amqp: got method %v in reply to %v", got, id)
+			c.fail(err)
+			return nil, err
+		}
+		return r, nil
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// read handles incoming frames until the connection fails. Missing two
+// heartbeats in a row is taken as a dead connection.
+func (c *Conn) read(r *bufio.Reader, heartbeat time.Duration) {
+	var (
+		pending *Delivery
+		size    uint64
+	)
+	for {
+		if heartbeat > 0 {
+			c.nc.SetReadDeadline(time.Now().Add(3 * heartbeat))
+		}
+		f, err := wire.ReadFrame(r, c.frameMax)
+		if err != nil {
+			c.fail(fmt.Errorf("amqp: read: %w", err))
+			break
+		}
+		switch f.Type {
+		case wire.FrameHeartbeat:
+		case wire.FrameMethod:
+			if err := c.method(f, &pending); err != nil {
+				c.fail(err)
+			}
+		case wire.FrameHeader:
+			if pending == nil {
+				break
+			}
+			var p wire.Properties
+			if size, p, err = wire.ParseHeader(f); err != nil {
+				c.fail(err)
+				break
+			}
+			pending.ContentType, pending.Type, pending.Headers = p.ContentType, p.Type, p.Headers
+			if size == 0 {
+				c.deliver(*pending)
+				pending = nil
+			}
+		case wire.FrameBody:
+			if pending == nil {
+				break
+			}
+			pending.Body = append(pending.Body, f.Payload...)
+			if uint64(len(pending.Body)) >= size {
+				c.deliver(*pending)
+				pending = nil
+			}
+		}
+		if c.Err() != nil {
+			break
+		}
+	}
+	c.mu.Lock()
+	c.stopped = true
+	if c.deliveries != nil {
+		close(c.deliveries)
+	}
+	c.mu.Unlock()
+}
+
+// method handles a method frame received after the handshake.
+func (c *Conn) method(f wire.Frame, pending **Delivery) error {
+	id, args := f.Method()
+	switch id {
+	case wire.ConnectionClose:
+		c.write(wire.MethodFrame(0, wire.ConnectionCloseOk, nil))
+		return closeError("connection", args)
+	case wire.ConnectionCloseOk:
+		return ErrClosed
+	case wire.ChannelClose:
+		c.write(wire.MethodFrame(channel, wire.ChannelCloseOk, nil))
+		return closeError("channel", args)
+	case wire.BasicDeliver:
+		args.ShortStr() // consumer tag
+		tag := args.LongLong()
+		redelivered := args.Bits(1)[0]
+		*pending = &Delivery{Redelivered: redelivered, tag: tag, conn: c}
+		return args.Err()
+	case wire.BasicAck, wire.BasicNack:
+		tag, multiple := args.LongLong(), args.Bits(1)[0]
+		c.confirm(tag, multiple, id == wire.BasicAck)
+		return nil
+	}
+	if f.Channel == 0 {
+		// connection.blocked and unblocked are informational.
+		return nil
+	}
+	select {
+	case c.replies <- f:
+	default:
+	}
+	return nil
+}
+
+// deliver hands a complete message to the consumer. The channel holds the
+// prefetch count, which the broker never exceeds, so this does not block.
+func (c *Conn) deliver(d Delivery) {
+	c.mu.Lock()
+	ch := c.deliveries
+	c.mu.Unlock()
+	if ch != nil {
+		ch <- d
+	}
+}
+
+// confirm resolves the publishes the broker acknowledged or refused.
+func (c *Conn) confirm(tag uint64, multiple, ack bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seq, ch := range c.confirms {
+		if seq == tag || (multiple && seq < tag) {
+			ch <- ack
+			delete(c.confirms, seq)
+		}
+	}
+}
+
+// beat sends heartbeats at half the agreed interval.
+func (c *Conn) beat(interval time.Duration) {
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			c.send(wire.Frame{Type: wire.FrameHeartbeat})
+		}
+	}
+}
+
+// fail closes the connection with err; later calls keep the first error.
+func (c *Conn) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+		c.nc.Close()
+	})
+}
+
+// Done is closed when the connection fails or is closed.
+func (c *Conn) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection is done, or nil while it is open.
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the connection, waiting briefly for the broker to agree.
+func (c *Conn) Close() error {
+	args := &wire.Buffer{}
+	args.Short(200)
+	args.ShortStr("bye")
+	args.Short(0)
+	args.Short(0)
+	if err := c.send(wire.MethodFrame(0, wire.ConnectionClose, args)); err == nil {
+		select {
+		case <-c.done:
+		case <-time.After(time.Second):
+		}
+	}
+	c.fail(ErrClosed)
+	return nil
+}
+
+// DeclareQueue creates a durable queue unless it exists.
+func (c *Conn) DeclareQueue(name string) error {
+	_, err := c.call(wire.QueueDeclare, wire.QueueDeclareOk, func(b *wire.Buffer) {
+		b.Short(0)
+		b.ShortStr(name)
+		b.Bits(false, true, false, false, false) // passive, durable, exclusive, auto-delete, no-wait
+		b.Table(nil)
+	})
+	return err
+}
+
+// Publish sends a persistent message to queue through the default
+// exchange and waits until the broker has taken responsibility for it.
+func (c *Conn) Publish(ctx context.Context, queue string, m Message) error {
+	args := &wire.Buffer{}
+	args.Short(0)
+	args.ShortStr("")
+	args.ShortStr(queue)
+	args.Bits(false, false) // mandatory, immediate
+	frames := []wire.Frame{
+		wire.MethodFrame(channel, wire.BasicPublish, args),
+		wire.HeaderFrame(channel, uint64(len(m.Body)), wire.Properties{
+			ContentType:  m.ContentType,
+			Headers:      m.Headers,
+			DeliveryMode: 2,
+			Type:         m.Type,
+		}),
+	}
+	for body, max := m.Body, int(c.frameMax)-8; len(body) > 0; {
+		n := min(len(body), max)
+		frames = append(frames, wire.Frame{Type: wire.FrameBody, Channel: channel, Payload: body[:n]})
+		body = body[n:]
+	}
+	// The broker numbers messages in the order they arrive, so the
+	// sequence number is taken under the write lock.
+	ack := make(chan bool, 1)
+	c.wmu.Lock()
+	c.mu.Lock()
+	c.published++
+	seq := c.published
+	c.confirms[seq] = ack
+	c.mu.Unlock()
+	err := func() error {
+		for _, f := range frames {
+			wire.WriteFrame(c.w, f)
+		}
+		return c.w.Flush()
+	}()
+	c.wmu.Unlock()
+	if err != nil {
+		c.forget(seq)
+		c.fail(fmt.Errorf("amqp: write: %w", err))
+		return c.err
+	}
+
+	select {
+	case ok := <-ack:
+		if !ok {
+			return errors.New("amqp: broker refused the message")
+		}
+		return nil
+	case <-c.done:
+		c.forget(seq)
+		return c.err
+	case <-ctx.Done():
+		c.forget(seq)
+		return ctx.Err()
+	}
+}
+
+func (c *Conn) forget(seq uint64) {
+	c.mu.Lock()
+	delete(c.confirms, seq)
+	c.mu.Unlock()
+}
+
+// Consume starts delivering messages from queue, at most prefetch of them
+// unacknowledged at a time. The channel is closed when the connection is
+// done. A connection has at most one consumer.
+func (c *Conn) Consume(queue string, prefetch int) (<-chan Delivery, error) {
+	prefetch = max(prefetch, 1)
+	if _, err := c.call(wire.BasicQos, wire.BasicQosOk, func(b *wire.Buffer) {
+		b.Long(0)
+		b.Short(uint16(prefetch))
+		b.Bits(false)
+	}); err != nil {
+		return nil, err
+	}
+	ch := make(chan Delivery, prefetch)
+	c.mu.Lock()
+	switch {
+	case c.stopped:
+		c.mu.Unlock()
+		return nil, c.err
+	case c.deliveries != nil:
+		c.mu.Unlock()
+		return nil, errors.New("amqp: connection already has a consumer")
+	}
+	c.deliveries = ch
+	c.mu.Unlock()
+	if _, err := c.call(wire.BasicConsume, wire.BasicConsumeOk, func(b *wire.Buffer) {
+		b.Short(0)
+		b.ShortStr(queue)
+		b.ShortStr("")
+		b.Bits(false, false, false, false) // no-local, no-ack, exclusive, no-wait
+		b.Table(nil)
+	}); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
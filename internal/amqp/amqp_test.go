@@ -0,0 +1,168 @@
+package amqp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/amqp/amqptest"
+)
+
+func dial(t *testing.T, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func next(t *testing.T, ch <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-ch:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	return Delivery{}
+}
+
+func TestPublishConsume(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	pub, sub := dial(t, srv.URL), dial(t, srv.URL)
+	if err := pub.DeclareQueue("tasks"); err != nil {
+		t.Fatal(err)
+	}
+	// Larger than the broker's frame size, so the body is split.
+	body := bytes.Repeat([]byte("x"), 3*4096)
+	want := Message{
+		ContentType: "application/json",
+		Type:        "claim.create",
+		Headers:     Table{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "attempt": int32(2)},
+		Body:        body,
+	}
+	if err := pub.Publish(context.Background(), "tasks", want); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := sub.Consume("tasks", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := next(t, ch)
+	if d.ContentType != want.ContentType || d.Type != want.Type || !bytes.Equal(d.Body, body) {
+		t.Fatalf("got %q %q %d bytes", d.ContentType, d.Type, len(d.Body))
+	}
+	if d.Headers["traceparent"] != want.Headers["traceparent"] || d.Headers["attempt"] != int32(2) {
+		t.Fatalf("headers = %v", d.Headers)
+	}
+	if d.Redelivered {
+		t.Fatal("first delivery marked redelivered")
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRejectRequeues(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	c := dial(t, srv.URL)
+	if err := c.DeclareQueue("tasks"); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := c.Consume("tasks", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(context.Background(), "tasks", Message{Body: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := next(t, ch).Reject(true); err != nil {
+		t.Fatal(err)
+	}
+	d := next(t, ch)
+	if !d.Redelivered || string(d.Body) != "a" {
+		t.Fatalf("got %+v", d)
+	}
+	if err := d.Reject(false); err != nil {
+		t.Fatal(err)
+	}
+	// The broker handles frames in order, so once this publish is
+	// confirmed the reject has been processed.
+	if err := c.DeclareQueue("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(context.Background(), "other", Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Ready("tasks")); n != 0 {
+		t.Fatalf("%d messages left after reject", n)
+	}
+}
+
+func TestUnackedRedeliveredAfterClose(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	c := dial(t, srv.URL)
+	if err := c.DeclareQueue("tasks"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(context.Background(), "tasks", Message{Body: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := c.Consume("tasks", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, ch)
+	srv.CloseConnections()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not done after the broker dropped it")
+	}
+	if c.Err() == nil {
+		t.Fatal("no error after the broker dropped the connection")
+	}
+	for range ch {
+	}
+
+	ch, err = dial(t, srv.URL).Consume("tasks", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := next(t, ch); !d.Redelivered {
+		t.Fatal("redelivery not marked")
+	}
+}
+
+func TestDialBadCredentials(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	url := strings.Replace(srv.URL, "guest:guest", "guest:wrong", 1)
+	_, err := Dial(context.Background(), url, nil)
+	if err == nil || !strings.Contains(err.Error(), "ACCESS_REFUSED") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	c := dial(t, srv.URL)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(context.Background(), "tasks", Message{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := c.Consume("tasks", 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+// Package amqptest runs an in-memory AMQP 0-9-1 broker for tests, in the
+// manner of net/http/httptest. It speaks the part of the protocol the amqp
+// package uses: queues on the default exchange, publisher confirms and
+// consumers with a prefetch count. Unacknowledged messages are queued again
+// when their connection closes, as RabbitMQ does.
+package amqptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"legalbot/internal/amqp/wire"
+)
+
+// Message is a message held by the broker.
+type Message struct {
+	Properties  wire.Properties
+	Body        []byte
+	Redelivered bool
+}
+
+// Server is a broker listening on a local port. Clients authenticate as
+// guest/guest.
+type Server struct {
+	// URL is the amqp:// URL of the broker, with credentials.
+	URL string
+
+	ln    net.Listener
+	mu    sync.Mutex
+	queue map[string]*queue
+	conns map[*conn]bool
+	wg    sync.WaitGroup
+}
+
+type queue struct {
+	ready     []Message
+	consumers []*conn
+	next      int
+}
+
+// NewServer starts a broker that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		URL:   "amqp://guest:guest@" + ln.Addr().String() + "/",
+		ln:    ln,
+		queue: map[string]*queue{},
+		conns: map[*conn]bool{},
+	}
+	s.wg.Add(1)
+	go s.accept()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{s: s, nc: nc, w: bufio.NewWriter(nc), unacked: map[uint64]unacked{}}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.drop(c)
+		}()
+	}
+}
+
+// Close stops the broker and closes every connection.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+}
+
+// CloseConnections drops every client connection without a close
+// handshake, as a broker restart would. Queued messages are kept.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+}
+
+// Ready returns the messages waiting in a queue, oldest first.
+func (s *Server) Ready(name string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q := s.queue[name]; q != nil {
+		return append([]Message(nil), q.ready...)
+	}
+	return nil
+}
+
+// Publish puts a message on a queue as if a client had published it.
+func (s *Server) Publish(name string, m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.declare(name)
+	q.ready = append(q.ready, m)
+	s.dispatch(q)
+}
+
+func (s *Server) declare(name string) *queue {
+	q := s.queue[name]
+	if q == nil {
+		q = &queue{}
+		s.queue[name] = q
+	}
+	return q
+}
+
+// dispatch hands ready messages to consumers with room under their
+// prefetch count, in turn. The caller holds s.mu.
+func (s *Server) dispatch(q *queue) {
+	for len(q.ready) > 0 {
+		var to *conn
+		for i := range q.consumers {
+			c := q.consumers[(q.next+i)%len(q.consumers)]
+			if len(c.unacked) < c.prefetch || c.prefetch == 0 {
+				to = c
+				q.next = (q.next + i + 1) % len(q.consumers)
+				break
+			}
+		}
+		if to == nil {
+			return
+		}
+		m := q.ready[0]
+		q.ready = q.ready[1:]
+		to.tag++
+		to.unacked[to.tag] = unacked{queue: q, msg: m}
+		to.deliver(to.tag, m)
+	}
+}
+
+// drop forgets a closed connection and queues its unacknowledged messages
+// again.
+func (s *Server) drop(c *conn) {
+	c.nc.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+	for _, q := range s.queue {
+		for i, other := range q.consumers {
+			if other == c {
+				q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+				q.next = 0
+				break
+			}
+		}
+	}
+	for tag, u := range c.unacked {
+		u.msg.Redelivered = true
+		u.queue.ready = append([]Message{u.msg}, u.queue.ready...)
+		delete(c.unacked, tag)
+	}
+	for _, q := range s.queue {
+		s.dispatch(q)
+	}
+}
+
+type unacked struct {
+	queue *queue
+	msg   Message
+}
+
+// conn is one client connection with its single channel.
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// Guarded by s.mu.
+	prefetch int
+	tag      uint64
+	unacked  map[uint64]unacked
+
+	confirm   bool
+	published uint64
+}
+
+func (c *conn) write(frames ...wire.Frame) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for _, f := range frames {
+		wire.WriteFrame(c.w, f)
+	}
+	c.w.Flush()
+}
+
+func (c *conn) method(ch uint16, id wire.MethodID, args func(*wire.Buffer)) {
+	b := &wire.Buffer{}
+	if args != nil {
+		args(b)
+	}
+	c.write(wire.MethodFrame(ch, id, b))
+}
+
+func (c *conn) deliver(tag uint64, m Message) {
+	args := &wire.Buffer{}
+	args.ShortStr("ctag")
+	args.LongLong(tag)
+	args.Bits(m.Redelivered)
+	args.ShortStr("")
+	args.ShortStr("")
+	frames := []wire.Frame{
+		wire.MethodFrame(1, wire.BasicDeliver, args),
+		wire.HeaderFrame(1, uint64(len(m.Body)), m.Properties),
+	}
+	for body := m.Body; len(body) > 0; {
+		n := min(len(body), wire.FrameMin-8)
+		frames = append(frames, wire.Frame{Type: wire.FrameBody, Channel: 1, Payload: body[:n]})
+		body = body[n:]
+	}
+	c.write(frames...)
+}
+
+func (c *conn) serve() {
+	r := bufio.NewReader(c.nc)
+	header := make([]byte, len(wire.Protocol))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, wire.Protocol) {
+		c.nc.Write(wire.Protocol)
+		return
+	}
+	if !c.handshake(r) {
+		return
+	}
+	var (
+		publishTo string
+		pending   *Message
+		size      uint64
+	)
+	for {
+		f, err := wire.ReadFrame(r, wire.FrameMin)
+		if err != nil {
+			return
+		}
+		switch f.Type {
+		case wire.FrameMethod:
+			id, args := f.Method()
+			switch id {
+			case wire.ConnectionClose:
+				c.method(0, wire.ConnectionCloseOk, nil)
+				return
+			case wire.ChannelOpen:
+				c.method(1, wire.ChannelOpenOk, func(b *wire.Buffer) { b.LongStr("") })
+			case wire.ChannelClose:
+				c.method(1, wire.ChannelCloseOk, nil)
+			case wire.ConfirmSelect:
+				c.confirm = true
+				c.method(1, wire.ConfirmSelectOk, nil)
+			case wire.QueueDeclare:
+				args.Short()
+				name := args.ShortStr()
+				c.s.mu.Lock()
+				q := c.s.declare(name)
+				ready, consumers := len(q.ready), len(q.consumers)
+				c.s.mu.Unlock()
+				c.method(1, wire.QueueDeclareOk, func(b *wire.Buffer) {
+					b.ShortStr(name)
+					b.Long(uint32(ready))
+					b.Long(uint32(consumers))
+				})
+			case wire.BasicQos:
+				args.Long()
+				prefetch := args.Short()
+				c.s.mu.Lock()
+				c.prefetch = int(prefetch)
+				c.s.mu.Unlock()
+				c.method(1, wire.BasicQosOk, nil)
+			case wire.BasicConsume:
+				args.Short()
+				name := args.ShortStr()
+				c.method(1, wire.BasicConsumeOk, func(b *wire.Buffer) { b.ShortStr("ctag") })
+				c.s.mu.Lock()
+				q := c.s.declare(name)
+				q.consumers = append(q.consumers, c)
+				c.s.dispatch(q)
+				c.s.mu.Unlock()
+			case wire.BasicPublish:
+				args.Short()
+				args.ShortStr() // exchange; only the default one is routed
+				publishTo = args.ShortStr()
+				pending = &Message{}
+			case wire.BasicAck, wire.BasicReject:
+				tag := args.LongLong()
+				flag := args.Bits(1)[0]
+				c.s.mu.Lock()
+				u, ok := c.unacked[tag]
+				delete(c.unacked, tag)
+				if ok && id == wire.BasicReject && flag {
+					u.msg.Redelivered = true
+					u.queue.ready = append([]Message{u.msg}, u.queue.ready...)
+				}
+				if ok {
+					c.s.dispatch(u.queue)
+				}
+				c.s.mu.Unlock()
+			default:
+				c.method(0, wire.ConnectionClose, func(b *wire.Buffer) {
+					b.Short(540)
+					b.ShortStr(fmt.Sprintf("NOT_IMPLEMENTED - method %v", id))
+					b.Short(id.Class)
+					b.Short(id.Method)
+				})
+				return
+			}
+		case wire.FrameHeader:
+			if pending == nil {
+				return
+			}
+			size, pending.Properties, err = wire.ParseHeader(f)
+			if err != nil {
+				return
+			}
+			if size == 0 {
+				c.route(publishTo, *pending)
+				pending = nil
+			}
+		case wire.FrameBody:
+			if pending == nil {
+				return
+			}
+			pending.Body = append(pending.Body, f.Payload...)
+			if uint64(len(pending.Body)) >= size {
+				c.route(publishTo, *pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+// route puts a published message on its queue and confirms it.
+func (c *conn) route(to string, m Message) {
+	c.s.mu.Lock()
+	if q := c.s.queue[to]; q != nil {
+		q.ready = append(q.ready, m)
+		c.s.dispatch(q)
+	}
+	c.s.mu.Unlock()
+	if c.confirm {
+		c.published++
+		seq := c.published
+		c.method(1, wire.BasicAck, func(b *wire.Buffer) {
+			b.LongLong(seq)
+			b.Bits(false)
+		})
+	}
+}
+
+// handshake runs the connection negotiation and reports whether the
+// client may go on.
+func (c *conn) handshake(r *bufio.Reader) bool {
+	c.method(0, wire.ConnectionStart, func(b *wire.Buffer) {
+		b.Octet(0)
+		b.Octet(9)
+		b.Table(wire.Table{"product": "amqptest", "capabilities": wire.Table{"publisher_confirms": true, "consumer_priorities": true}})
+		b.LongStr("PLAIN AMQPLAIN")
+		b.LongStr("en_US")
+	})
+	args, ok := expect(r, wire.ConnectionStartOk)
+	if !ok {
+		return false
+	}
+	args.Table()
+	args.ShortStr()
+	if args.LongStr() != "\x00guest\x00guest" {
+		c.method(0, wire.ConnectionClose, func(b *wire.Buffer) {
+			b.Short(403)
+			b.ShortStr("ACCESS_REFUSED - Login was refused")
+			b.Short(0)
+			b.Short(0)
+		})
+		return false
+	}
+	c.method(0, wire.ConnectionTune, func(b *wire.Buffer) {
+		b.Short(2047)
+		b.Long(wire.FrameMin)
+		b.Short(0)
+	})
+	if _, ok := expect(r, wire.ConnectionTuneOk); !ok {
+		return false
+	}
+	if _, ok := expect(r, wire.ConnectionOpen); !ok {
+		return false
+	}
+	c.method(0, wire.ConnectionOpenOk, func(b *wire.Buffer) { b.ShortStr("") })
+	return true
+}
+
+func expect(r *bufio.Reader, want wire.MethodID) (*wire.Reader, bool) {
+	f, err := wire.ReadFrame(r, wire.FrameMin)
+	if err != nil || f.Type != wire.FrameMethod {
+		return nil, false
+	}
+	id, args := f.Method()
+	return args, id == want
+}
@@ -0,0 +1,475 @@
+// Package wire encodes and decodes AMQP 0-9-1 frames and field values. It
+// is shared by the amqp client and the amqptest broker.
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Protocol is the header a client sends before the first frame.
+var Protocol = []byte("AMQP\x00\x00\x09\x01")
+
+// Frame types.
+const (
+	FrameMethod    = 1
+	FrameHeader    = 2
+	FrameBody      = 3
+	FrameHeartbeat = 8
+)
+
+const frameEnd = 0xCE
+
+// FrameMin is the frame size every peer must accept; frames are never
+// negotiated below it.
+const FrameMin = 4096
+
+// Class and method IDs of the methods the client and broker use.
+const (
+	ClassConnection = 10
+	ClassChannel    = 20
+	ClassQueue      = 50
+	ClassBasic      = 60
+	ClassConfirm    = 85
+)
+
+// MethodID names a method by class and method number.
+type MethodID struct{ Class, Method uint16 }
+
+var (
+	ConnectionStart   = MethodID{ClassConnection, 10}
+	ConnectionStartOk = MethodID{ClassConnection, 11}
+	ConnectionTune    = MethodID{ClassConnection, 30}
+	ConnectionTuneOk  = MethodID{ClassConnection, 31}
+	ConnectionOpen    = MethodID{ClassConnection, 40}
+	ConnectionOpenOk  = MethodID{ClassConnection, 41}
+	ConnectionClose   = MethodID{ClassConnection, 50}
+	ConnectionCloseOk = MethodID{ClassConnection, 51}
+	ChannelOpen       = MethodID{ClassChannel, 10}
+	ChannelOpenOk     = MethodID{ClassChannel, 11}
+	ChannelClose      = MethodID{ClassChannel, 40}
+	ChannelCloseOk    = MethodID{ClassChannel, 41}
+	QueueDeclare      = MethodID{ClassQueue, 10}
+	QueueDeclareOk    = MethodID{ClassQueue, 11}
+	BasicQos          = MethodID{ClassBasic, 10}
+	BasicQosOk        = MethodID{ClassBasic, 11}
+	BasicConsume      = MethodID{ClassBasic, 20}
+	BasicConsumeOk    = MethodID{ClassBasic, 21}
+	BasicPublish      = MethodID{ClassBasic, 40}
+	BasicDeliver      = MethodID{ClassBasic, 60}
+	BasicAck          = MethodID{ClassBasic, 80}
+	BasicReject       = MethodID{ClassBasic, 90}
+	BasicNack         = MethodID{ClassBasic, 120}
+	ConfirmSelect     = MethodID{ClassConfirm, 10}
+	ConfirmSelectOk   = MethodID{ClassConfirm, 11}
+)
+
+func (m MethodID) String() string { return fmt.Sprintf("%d.%d", m.Class, m.Method) }
+
+// Frame is one frame as read from or written to the connection.
+type Frame struct {
+	Type    byte
+	Channel uint16
+	Payload []byte
+}
+
+// Method returns the method of a method frame and a reader over its
+// arguments.
+func (f Frame) Method() (MethodID, *Reader) {
+	r := &Reader{b: f.Payload}
+	id := MethodID{r.Short(), r.Short()}
+	return id, r
+}
+
+// ReadFrame reads one frame, refusing payloads over max bytes.
+func ReadFrame(r *bufio.Reader, max uint32) (Frame, error) {
+	var h [7]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return Frame{}, err
+	}
+	size := binary.BigEndian.Uint32(h[3:])
+	if size > max {
+		return Frame{}, fmt.Errorf("amqp: frame of %d bytes exceeds %d", size, max)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return Frame{}, errors.New("amqp: malformed frame")
+	}
+	return Frame{Type: h[0], Channel: binary.BigEndian.Uint16(h[1:]), Payload: payload[:size]}, nil
+}
+
+// WriteFrame writes f without flushing w.
+func WriteFrame(w *bufio.Writer, f Frame) error {
+	var h [7]byte
+	h[0] = f.Type
+	binary.BigEndian.PutUint16(h[1:], f.Channel)
+	binary.BigEndian.PutUint32(h[3:], uint32(len(f.Payload)))
+	w.Write(h[:])
+	w.Write(f.Payload)
+	return w.WriteByte(frameEnd)
+}
+
+// MethodFrame returns a method frame for channel with args already encoded.
+func MethodFrame(channel uint16, id MethodID, args *Buffer) Frame {
+	b := &Buffer{}
+	b.Short(id.Class)
+	b.Short(id.Method)
+	if args != nil {
+		b.b = append(b.b, args.b...)
+	}
+	return Frame{Type: FrameMethod, Channel: channel, Payload: b.b}
+}
+
+// Table is an AMQP field table. Values are string, bool, int32, int64,
+// float64, []byte, time.Time, Table, []any or nil.
+type Table map[string]any
+
+// Properties are the basic content properties the client uses.
+type Properties struct {
+	ContentType  string
+	Headers      Table
+	DeliveryMode uint8
+	MessageID    string
+	Type         string
+}
+
+// Property flag bits of the basic class, in wire order.
+const (
+	flagContentType     = 1 << 15
+	flagContentEncoding = 1 << 14
+	flagHeaders         = 1 << 13
+	flagDeliveryMode    = 1 << 12
+	flagPriority        = 1 << 11
+	flagCorrelationID   = 1 << 10
+	flagReplyTo         = 1 << 9
+	flagExpiration      = 1 << 8
+	flagMessageID       = 1 << 7
+	flagTimestamp       = 1 << 6
+	flagType            = 1 << 5
+	flagUserID          = 1 << 4
+	flagAppID           = 1 << 3
+	flagClusterID       = 1 << 2
+)
+
+// HeaderFrame returns the content header frame of a basic message.
+func HeaderFrame(channel uint16, size uint64, p Properties) Frame {
+	var flags uint16
+	props := &Buffer{}
+	if p.ContentType != "" {
+		flags |= flagContentType
+		props.ShortStr(p.ContentType)
+	}
+	if p.Headers != nil {
+		flags |= flagHeaders
+		props.Table(p.Headers)
+	}
+	if p.DeliveryMode != 0 {
+		flags |= flagDeliveryMode
+		props.Octet(p.DeliveryMode)
+	}
+	if p.MessageID != "" {
+		flags |= flagMessageID
+		props.ShortStr(p.MessageID)
+	}
+	if p.Type != "" {
+		flags |= flagType
+		props.ShortStr(p.Type)
+	}
+	b := &Buffer{}
+	b.Short(ClassBasic)
+	b.Short(0)
+	b.LongLong(size)
+	b.Short(flags)
+	b.b = append(b.b, props.b...)
+	return Frame{Type: FrameHeader, Channel: channel, Payload: b.b}
+}
+
+// ParseHeader decodes a content header frame into the body size and the
+// properties the client uses; the others are skipped.
+func ParseHeader(f Frame) (size uint64, p Properties, err error) {
+	r := &Reader{b: f.Payload}
+	r.Short() // class
+	r.Short() // weight
+	size = r.LongLong()
+	flags := r.Short()
+	if flags&flagContentType != 0 {
+		p.ContentType = r.ShortStr()
+	}
+	if flags&flagContentEncoding != 0 {
+		r.ShortStr()
+	}
+	if flags&flagHeaders != 0 {
+		p.Headers = r.Table()
+	}
+	if flags&flagDeliveryMode != 0 {
+		p.DeliveryMode = r.Octet()
+	}
+	if flags&flagPriority != 0 {
+		r.Octet()
+	}
+	for _, f := range []uint16{flagCorrelationID, flagReplyTo, flagExpiration} {
+		if flags&f != 0 {
+			r.ShortStr()
+		}
+	}
+	if flags&flagMessageID != 0 {
+		p.MessageID = r.ShortStr()
+	}
+	if flags&flagTimestamp != 0 {
+		r.LongLong()
+	}
+	if flags&flagType != 0 {
+		p.Type = r.ShortStr()
+	}
+	for _, f := range []uint16{flagUserID, flagAppID, flagClusterID} {
+		if flags&f != 0 {
+			r.ShortStr()
+		}
+	}
+	return size, p, r.Err()
+}
+
+// Buffer encodes method arguments and field values.
+type Buffer struct {
+	b []byte
+}
+
+// Bytes returns the encoded bytes.
+func (b *Buffer) Bytes() []byte { return b.b }
+
+func (b *Buffer) Octet(v byte)      { b.b = append(b.b, v) }
+func (b *Buffer) Short(v uint16)    { b.b = binary.BigEndian.AppendUint16(b.b, v) }
+func (b *Buffer) Long(v uint32)     { b.b = binary.BigEndian.AppendUint32(b.b, v) }
+func (b *Buffer) LongLong(v uint64) { b.b = binary.BigEndian.AppendUint64(b.b, v) }
+
+// ShortStr appends a string of at most 255 bytes; longer ones are cut.
+func (b *Buffer) ShortStr(s string) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b.Octet(byte(len(s)))
+	b.b = append(b.b, s...)
+}
+
+func (b *Buffer) LongStr(s string) {
+	b.Long(uint32(len(s)))
+	b.b = append(b.b, s...)
+}
+
+// Bits packs consecutive bit arguments into one octet.
+func (b *Buffer) Bits(bits ...bool) {
+	var v byte
+	for i, bit := range bits {
+		if bit {
+			v |= 1 << i
+		}
+	}
+	b.Octet(v)
+}
+
+// Table appends t. Values of types Table does not list are dropped.
+func (b *Buffer) Table(t Table) {
+	fields := &Buffer{}
+	for k, v := range t {
+		mark := len(fields.b)
+		fields.ShortStr(k)
+		if !fields.value(v) {
+			fields.b = fields.b[:mark]
+		}
+	}
+	b.Long(uint32(len(fields.b)))
+	b.b = append(b.b, fields.b...)
+}
+
+// value appends a typed field value and reports whether v has a wire type.
+func (b *Buffer) value(v any) bool {
+	switch v := v.(type) {
+	case string:
+		b.Octet('S')
+		b.LongStr(v)
+	case bool:
+		b.Octet('t')
+		if v {
+			b.Octet(1)
+		} else {
+			b.Octet(0)
+		}
+	case int32:
+		b.Octet('I')
+		b.Long(uint32(v))
+	case int64:
+		b.Octet('l')
+		b.LongLong(uint64(v))
+	case int:
+		b.Octet('l')
+		b.LongLong(uint64(v))
+	case float64:
+		b.Octet('d')
+		b.LongLong(math.Float64bits(v))
+	case []byte:
+		b.Octet('x')
+		b.LongStr(string(v))
+	case time.Time:
+		b.Octet('T')
+		b.LongLong(uint64(v.Unix()))
+	case Table:
+		b.Octet('F')
+		b.Table(v)
+	case []any:
+		b.Octet('A')
+		items := &Buffer{}
+		for _, item := range v {
+			items.value(item)
+		}
+		b.Long(uint32(len(items.b)))
+		b.b = append(b.b, items.b...)
+	case nil:
+		b.Octet('V')
+	default:
+		return false
+	}
+	return true
+}
+
+// Reader decodes method arguments. The first error sticks and later reads
+// return zero values.
+type Reader struct {
+	b   []byte
+	err error
+}
+
+// Err returns the first decoding error.
+func (r *Reader) Err() error { return r.err }
+
+func (r *Reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errors.New("amqp: truncated frame")
+		r.b = nil
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *Reader) Octet() byte {
+	if v := r.take(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (r *Reader) Short() uint16 {
+	if v := r.take(2); v != nil {
+		return binary.BigEndian.Uint16(v)
+	}
+	return 0
+}
+
+func (r *Reader) Long() uint32 {
+	if v := r.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *Reader) LongLong() uint64 {
+	if v := r.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (r *Reader) ShortStr() string { return string(r.take(int(r.Octet()))) }
+func (r *Reader) LongStr() string  { return string(r.take(int(r.Long()))) }
+
+// Bits unpacks n bit arguments from one octet.
+func (r *Reader) Bits(n int) []bool {
+	v := r.Octet()
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = v&(1<<i) != 0
+	}
+	return out
+}
+
+func (r *Reader) Table() Table {
+	data := r.take(int(r.Long()))
+	if r.err != nil {
+		return nil
+	}
+	fields := &Reader{b: data}
+	t := Table{}
+	for len(fields.b) > 0 && fields.err == nil {
+		k := fields.ShortStr()
+		t[k] = fields.value()
+	}
+	if fields.err != nil {
+		r.err = fields.err
+	}
+	return t
+}
+
+func (r *Reader) value() any {
+	switch kind := r.Octet(); kind {
+	case 't':
+		return r.Octet() != 0
+	case 'b':
+		return int32(int8(r.Octet()))
+	case 'B':
+		return int32(r.Octet())
+	case 's':
+		return int32(int16(r.Short()))
+	case 'u':
+		return int32(r.Short())
+	case 'I':
+		return int32(r.Long())
+	case 'i':
+		return int64(r.Long())
+	case 'l', 'L':
+		return int64(r.LongLong())
+	case 'f':
+		return float64(math.Float32frombits(r.Long()))
+	case 'd':
+		return math.Float64frombits(r.LongLong())
+	case 'D':
+		scale := r.Octet()
+		return float64(int32(r.Long())) / math.Pow10(int(scale))
+	case 'S':
+		return r.LongStr()
+	case 'x':
+		return []byte(r.LongStr())
+	case 'T':
+		return time.Unix(int64(r.LongLong()), 0).UTC()
+	case 'F':
+		return r.Table()
+	case 'A':
+		items := &Reader{b: r.take(int(r.Long()))}
+		var out []any
+		for len(items.b) > 0 && items.err == nil {
+			out = append(out, items.value())
+		}
+		if items.err != nil && r.err == nil {
+			r.err = items.err
+		}
+		return out
+	case 'V':
+		return nil
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("amqp: unknown field type %q", kind)
+		}
+		return nil
+	}
+}
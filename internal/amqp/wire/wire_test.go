@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTableRoundTrip(t *testing.T) {
+	in := Table{
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"attempt":     int32(2),
+		"claim":       int64(1 << 40),
+		"score":       0.5,
+		"ok":          true,
+		"raw":         []byte{0, 1},
+		"at":          time.Unix(1714564800, 0).UTC(),
+		"nested":      Table{"list": []any{"a", int32(1), nil}},
+		"dropped":     struct{}{},
+	}
+	b := &Buffer{}
+	b.Table(in)
+	r := &Reader{b: b.Bytes()}
+	out := r.Table()
+	if r.Err() != nil || len(r.b) != 0 {
+		t.Fatalf("err %v, %d bytes left", r.Err(), len(r.b))
+	}
+	delete(in, "dropped")
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %#v", out)
+	}
+}
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	p := Properties{ContentType: "application/json", Headers: Table{"x-request-id": "req-1"}, DeliveryMode: 2, Type: "claim.create"}
+	size, got, err := ParseHeader(HeaderFrame(1, 42, p))
+	if err != nil || size != 42 || !reflect.DeepEqual(got, p) {
+		t.Fatalf("got %d %+v %v", size, got, err)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	args := &Buffer{}
+	args.ShortStr("claim.create")
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	WriteFrame(w, MethodFrame(1, QueueDeclare, args))
+	w.Flush()
+	frame := buf.Bytes()
+
+	f, err := ReadFrame(bufio.NewReader(bytes.NewReader(frame)), FrameMin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, r := f.Method()
+	if f.Channel != 1 || id != QueueDeclare || r.ShortStr() != "claim.create" || r.Err() != nil {
+		t.Fatalf("got %+v %v", f, id)
+	}
+
+	bad := append([]byte(nil), frame...)
+	bad[len(bad)-1] = 0
+	if _, err := ReadFrame(bufio.NewReader(bytes.NewReader(bad)), FrameMin); err == nil {
+		t.Error("frame without its end marker accepted")
+	}
+	if _, err := ReadFrame(bufio.NewReader(bytes.NewReader(frame)), 8); err == nil {
+		t.Error("frame over the negotiated size accepted")
+	}
+	r = &Reader{b: []byte{0, 0, 0, 9, 'k'}}
+	if r.Table(); r.Err() == nil {
+		t.Error("truncated table accepted")
+	}
+}
@@ -0,0 +1,228 @@
+// Package certs configures TLS for the services: TLS 1.3 only, certificates
+// reloaded from disk when they are replaced, and mutual TLS between the
+// services with certificates issued by an internal CA.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/metrics"
+)
+
+var reloads = metrics.NewCounter("tls_certificate_reloads_total",
+	"Certificate reloads from disk by result: ok or error.", "result")
+
+// Reloader serves a certificate and key pair from files, re-reading them
+// when either file changes so renewed certificates are used without a
+// restart. Connections already established keep the old certificate.
+type Reloader struct {
+	CertFile, KeyFile string
+	// CheckInterval is how often the files are checked for changes; the
+	// check happens on a handshake, not in the background.
+	CheckInterval time.Duration
+	Logger        *slog.Logger
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// NewReloader loads the key pair from certFile and keyFile.
+func NewReloader(certFile, keyFile string, opts ...func(*Reloader)) (*Reloader, error) {
+	r := &Reloader{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CheckInterval: 10 * time.Second,
+		Logger:        slog.Default(),
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	mod, err := r.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(mod); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WithCheckInterval sets how often the files are checked for changes.
+func WithCheckInterval(d time.Duration) func(*Reloader) {
+	return func(r *Reloader) { r.CheckInterval = d }
+}
+
+// WithLogger allows setting a custom logger when creating a reloader.
+func WithLogger(l *slog.Logger) func(*Reloader) {
+	return func(r *Reloader) { r.Logger = l }
+}
+
+// Certificate returns the current certificate, reloading it first if the
+// files changed. A pair that fails to load is logged and the previous one
+// kept, so a half-written renewal does not take the service down.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if now.Sub(r.checked) < r.CheckInterval {
+		return r.cert
+	}
+	r.checked = now
+	mod, err := r.modified()
+	if err == nil && mod.Equal(r.modTime) {
+		return r.cert
+	}
+	if err == nil {
+		err = r.load(mod)
+	}
+	if err != nil {
+		reloads.Inc("error")
+		r.Logger.Error("reload certificate", "cert", r.CertFile, "err", err)
+		return r.cert
+	}
+	reloads.Inc("ok")
+	r.Logger.Info("certificate reloaded", "cert", r.CertFile, "not_after", r.cert.Leaf.NotAfter)
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// modified returns the later modification time of the two files.
+func (r *Reloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.CertFile, r.KeyFile} {
+		st, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *Reloader) load(mod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	r.cert, r.modTime = &cert, mod
+	return nil
+}
+
+// ServerConfig returns a TLS 1.3 server configuration presenting r's
+// certificate. With clientCAs, clients that present a certificate must
+// chain to them; wrap handlers in RequireClientCert to insist on one while
+// leaving health checks open.
+func ServerConfig(r *Reloader, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS13,
+		GetCertificate: r.GetCertificate,
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg
+}
+
+// ClientConfig returns a TLS 1.3 client configuration trusting rootCAs and
+// presenting r's certificate when the server asks for one. r may be nil.
+func ClientConfig(r *Reloader, rootCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		RootCAs:    rootCAs,
+	}
+	if r != nil {
+		cfg.GetClientCertificate = r.GetClientCertificate
+	}
+	return cfg
+}
+
+// LoadCAPool reads PEM certificates from file into a pool.
+func LoadCAPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates", file)
+	}
+	return pool, nil
+}
+
+// RequireClientCert answers 403 unless the request came over TLS with a
+// client certificate that was verified against the configured CAs.
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Mutual is a service's certificate and the CAs of its peers, for mutual
+// TLS.
+type Mutual struct {
+	Cert *Reloader
+	CAs  *x509.CertPool
+}
+
+// FromConfig loads the files cfg names, or returns nil when mutual TLS is
+// not configured. A nil logger means slog.Default.
+func FromConfig(cfg config.MTLS, logger *slog.Logger) (*Mutual, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r, err := NewReloader(cfg.CertFile, cfg.KeyFile, WithLogger(logger))
+	if err != nil {
+		return nil, fmt.Errorf("mtls certificate: %w", err)
+	}
+	cas, err := LoadCAPool(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("mtls CA: %w", err)
+	}
+	return &Mutual{Cert: r, CAs: cas}, nil
+}
+
+// ServerConfig returns the server side; see ServerConfig.
+func (m *Mutual) ServerConfig() *tls.Config { return ServerConfig(m.Cert, m.CAs) }
+
+// ClientConfig returns the client side; see ClientConfig.
+func (m *Mutual) ClientConfig() *tls.Config { return ClientConfig(m.Cert, m.CAs) }
+
+// HTTPClient returns a client calling peers over mutual TLS.
+func (m *Mutual) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: m.ClientConfig(), ForceAttemptHTTP2: true},
+	}
+}
@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue writes a key pair for cn signed by ca into dir and returns the
+// file names.
+func issue(t *testing.T, ca *CA, dir, cn string) (certFile, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM, err := ca.Issue(cn, []string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, cn+".pem"), filepath.Join(dir, cn+"-key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func newCA(t *testing.T) *CA {
+	t.Helper()
+	ca, err := NewCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func pool(ca *CA) *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(ca.Cert)
+	return p
+}
+
+func reloader(t *testing.T, certFile, keyFile string, opts ...func(*Reloader)) *Reloader {
+	t.Helper()
+	opts = append([]func(*Reloader){WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	r, err := NewReloader(certFile, keyFile, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// newServer starts a TLS server for the prompt service's layout: the build
+// route requires a client certificate, health does not.
+func newServer(t *testing.T, ca *CA) (url string) {
+	t.Helper()
+	dir := t.TempDir()
+	srvCert, srvKey := issue(t, ca, dir, "prompt")
+	mux := http.NewServeMux()
+	mux.Handle("/build", RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	})))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	// StartTLS would install its own certificate ahead of the reloader.
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener = tls.NewListener(srv.Listener, ServerConfig(reloader(t, srvCert, srvKey), pool(ca)))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return "https://" + srv.Listener.Addr().String()
+}
+
+func get(c *http.Client, url string) (int, string, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), nil
+}
+
+func client(cfg *tls.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newCA(t)
+	url := newServer(t, ca)
+	dir := t.TempDir()
+	botCert, botKey := issue(t, ca, dir, "bot")
+
+	bot := client(ClientConfig(reloader(t, botCert, botKey), pool(ca)))
+	code, body, err := get(bot, url+"/build")
+	if err != nil || code != http.StatusOK || body != "bot" {
+		t.Fatalf("with client certificate: %d %q %v", code, body, err)
+	}
+
+	anon := client(ClientConfig(nil, pool(ca)))
+	if code, _, err := get(anon, url+"/build"); err != nil || code != http.StatusForbidden {
+		t.Fatalf("without client certificate: %d %v, want 403", code, err)
+	}
+	if code, _, err := get(anon, url+"/healthz"); err != nil || code != http.StatusOK {
+		t.Fatalf("health without client certificate: %d %v", code, err)
+	}
+
+	// A certificate from another CA fails the handshake.
+	other := newCA(t)
+	rogueCert, rogueKey := issue(t, other, dir, "rogue")
+	rogue := client(ClientConfig(reloader(t, rogueCert, rogueKey), pool(ca)))
+	if _, _, err := get(rogue, url+"/build"); err == nil {
+		t.Fatal("certificate from another CA accepted")
+	}
+
+	// The client does not trust a server outside its CA either.
+	if _, _, err := get(client(ClientConfig(nil, pool(other))), url+"/healthz"); err == nil {
+		t.Fatal("server certificate from another CA accepted")
+	}
+}
+
+func TestRejectsTLS12(t *testing.T) {
+	ca := newCA(t)
+	url := newServer(t, ca)
+	old := &tls.Config{RootCAs: pool(ca), MaxVersion: tls.VersionTLS12}
+	if _, _, err := get(client(old), url+"/healthz"); err == nil {
+		t.Fatal("TLS 1.2 client accepted")
+	}
+}
+
+func TestReloaderPicksUpRenewal(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := issue(t, ca, dir, "bot")
+	now := time.Unix(1700000000, 0)
+	r := reloader(t, certFile, keyFile, func(r *Reloader) { r.now = func() time.Time { return now } })
+	first := r.Certificate().Leaf.SerialNumber
+
+	issue(t, ca, dir, "bot")
+	// Make sure the modification time moves on coarse file systems.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	if got := r.Certificate().Leaf.SerialNumber; got.Cmp(first) != 0 {
+		t.Fatal("reloaded before the check interval passed")
+	}
+	now = now.Add(r.CheckInterval)
+	renewed := r.Certificate().Leaf.SerialNumber
+	if renewed.Cmp(first) == 0 {
+		t.Fatal("renewed certificate not picked up")
+	}
+
+	// A broken pair keeps the previous certificate.
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	now = now.Add(r.CheckInterval)
+	if got := r.Certificate().Leaf.SerialNumber; got.Cmp(renewed) != 0 {
+		t.Fatal("broken key pair replaced the certificate")
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	keyPEM, err := ca.KeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	os.WriteFile(certFile, ca.CertPEM(), 0o600)
+	os.WriteFile(keyFile, keyPEM, 0o600)
+
+	loaded, err := LoadCA(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := loaded.Issue("worker", []string{"worker"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := LoadCAPool(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "worker", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("issued certificate does not verify against the loaded CA: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package claim answers claims: it builds the prompt, calls the model,
+// stores the result and sends the answer to the user, moving the claim
+// through its lifecycle on the way.
+//
+// The bot accepts a claim and queues it as a Task on RabbitMQ with a
+// Publisher; cmd/worker takes tasks off the queue with a Consumer and hands
+// them to a Processor. Without a queue the bot runs the Processor itself.
+package claim
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"legalbot/internal/db"
+	"legalbot/internal/pii"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
+)
+
+// Task is a claim accepted by the bot, waiting to be answered. IDs are
+// encoded as strings so they survive JSON decoders that read numbers as
+// floats.
+type Task struct {
+	// ClaimID is zero when the claim could not be tracked.
+	ClaimID int64 `json:"claim_id,string"`
+	ChatID  int64 `json:"chat_id,string"`
+	UserID  int64 `json:"user_id,string"`
+	// ThreadID is the forum topic the claim was sent in, if any.
+	ThreadID   int64             `json:"thread_id,string,omitempty"`
+	Text       string            `json:"text"`
+	Evidence   []prompt.Evidence `json:"evidence,omitempty"`
+	ReceivedAt time.Time         `json:"received_at"`
+}
+
+// Outcomes of Process. The bot adds its own for claims it refuses or
+// queues.
+const (
+	OutcomeDelivered   = "delivered"
+	OutcomePromptError = "prompt_error"
+	OutcomeModelError  = "model_error"
+	OutcomeDBError     = "db_error"
+	OutcomeSendError   = "send_error"
+	// OutcomeDuplicate is a task whose claim had already left the queued
+	// state, e.g. one redelivered after a worker died.
+	OutcomeDuplicate = "duplicate"
+)
+
+// TemporaryErrorMsg is sent to the user when a claim cannot be answered.
+const TemporaryErrorMsg = "temporary error, please try again later"
+
+// ActionRate is the callback action of the rating buttons under an answer.
+const ActionRate = "rate"
+
+type Sender interface {
+	SendMessage(ctx context.Context, chatID int64, text string) error
+	SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error
+	SendFormatted(ctx context.Context, chatID int64, f telegram.Formatted, markup telegram.ReplyMarkup) error
+}
+
+type Builder interface {
+	Build(ctx context.Context, req prompt.Request) (prompt.Result, error)
+}
+
+type Model interface {
+	ChatCompletion(ctx context.Context, prompt string) (string, error)
+}
+
+type Tracker interface {
+	TransitionClaim(ctx context.Context, id int64, from, to db.ClaimState, reason string) error
+	SetClaimResult(ctx context.Context, id, resultID int64) error
+}
+
+// Repository stores results and tracks claims.
+type Repository interface {
+	Tracker
+	SaveResult(ctx context.Context, chatID, userID int64, data string, meta db.ResultMeta) (int64, error)
+}
+
+// Processor answers tasks.
+type Processor struct {
+	Telegram Sender
+	Prompt   Builder
+	Model    Model
+	Repo     Repository
+	// Redactor replaces personal data before the text leaves for the
+	// prompt service and restores it in the answer.
+	Redactor *pii.Redactor
+	// Callbacks signs the rating buttons sent under answers. Without it
+	// answers are sent without them.
+	Callbacks *telegram.CallbackCodec
+}
+
+// Process answers t and returns its outcome. Failures are reported to the
+// user; the error is only set when the user could not be told.
+func (p *Processor) Process(ctx context.Context, t Task) (string, error) {
+	chatID := t.ChatID
+	claim := Track(p.Repo, t.ClaimID, db.ClaimQueued)
+	if err := claim.transition(ctx, db.ClaimBuildingPrompt, ""); errors.Is(err, db.ErrInvalidTransition) {
+		slog.WarnContext(ctx, "claim already taken", "claim_id", t.ClaimID)
+		return OutcomeDuplicate, nil
+	}
+	// Personal data is replaced before anything leaves for the prompt
+	// service, which embeds and may classify the text with the model too.
+	redaction := p.Redactor.Session()
+	text := redaction.Redact(t.Text)
+	evidence := make([]prompt.Evidence, len(t.Evidence))
+	for i, e := range t.Evidence {
+		evidence[i] = prompt.Evidence{Name: redaction.Redact(e.Name), Text: redaction.Redact(e.Text)}
+	}
+	if found := redaction.Found(); len(found) > 0 {
+		slog.InfoContext(ctx, "personal data in claim", "mode", p.Redactor.Mode, "found", found)
+	}
+	pr, err := p.Prompt.Build(ctx, prompt.Request{ChatID: chatID, UserText: text, Evidence: evidence})
+	if err != nil {
+		slog.ErrorContext(ctx, "prompt build", "err", err)
+		claim.Fail(ctx, "prompt build: "+err.Error())
+		return OutcomePromptError, p.Telegram.SendMessage(ctx, chatID, TemporaryErrorMsg)
+	}
+	claim.Advance(ctx, db.ClaimCallingModel)
+	resp, err := p.Model.ChatCompletion(ctx, pr.Prompt)
+	if err != nil {
+		slog.ErrorContext(ctx, "openrouter", "err", err)
+		claim.Fail(ctx, "openrouter: "+err.Error())
+		return OutcomeModelError, p.Telegram.SendMessage(ctx, chatID, TemporaryErrorMsg)
+	}
+	claim.Advance(ctx, db.ClaimRenderingDocs)
+	meta := db.ResultMeta{PromptVersion: pr.Version, Category: pr.Category}
+	answer, err := prompt.ParseAnswer(resp)
+	if err == nil {
+		meta.ParseOK = true
+		answer.AdviceMD = redaction.Restore(answer.AdviceMD)
+		answer.ClaimMD = redaction.Restore(answer.ClaimMD)
+		answer.LawsuitMD = redaction.Restore(answer.LawsuitMD)
+		resp = redaction.RestoreJSON(resp)
+	} else {
+		slog.WarnContext(ctx, "model output is not valid JSON", "prompt_version", pr.Version, "err", err)
+		resp = redaction.Restore(resp)
+	}
+	resultID, err := p.Repo.SaveResult(ctx, chatID, t.UserID, resp, meta)
+	if err != nil {
+		slog.ErrorContext(ctx, "db save", "err", err)
+		claim.Fail(ctx, "db save: "+err.Error())
+		return OutcomeDBError, p.Telegram.SendMessage(ctx, chatID, TemporaryErrorMsg)
+	}
+	claim.SetResult(ctx, resultID)
+	var rating telegram.ReplyMarkup
+	if p.Callbacks != nil {
+		if kb, err := RatingKeyboard(p.Callbacks, t.UserID, resultID); err != nil {
+			slog.ErrorContext(ctx, "rating keyboard", "err", err)
+		} else {
+			rating = kb
+		}
+	}
+	if err := SendAnswer(ctx, p.Telegram, chatID, resp, answer, meta.ParseOK, rating); err != nil {
+		claim.Fail(ctx, "telegram: "+err.Error())
+		return OutcomeSendError, err
+	}
+	claim.Advance(ctx, db.ClaimDelivered)
+	return OutcomeDelivered, nil
+}
+
+// SendAnswer sends the advice and the drafted documents as formatted
+// messages, with markup under the last one. Output that is not the expected
+// JSON is sent as is. Texts longer than Telegram allows are split into
+// several messages.
+func SendAnswer(ctx context.Context, tg Sender, chatID int64, raw string, a prompt.Answer, parsed bool, markup telegram.ReplyMarkup) error {
+	if !parsed {
+		parts := telegram.SplitText(raw, telegram.MaxMessageLength)
+		for i, text := range parts {
+			var m telegram.ReplyMarkup
+			if i == len(parts)-1 {
+				m = markup
+			}
+			if err := tg.SendMessageMarkup(ctx, chatID, text, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var msgs []telegram.Formatted
+	for _, md := range []string{a.AdviceMD, a.ClaimMD, a.LawsuitMD} {
+		if md != "" {
+			msgs = append(msgs, telegram.MarkdownMessages(md)...)
+		}
+	}
+	for i, f := range msgs {
+		var m telegram.ReplyMarkup
+		if i == len(msgs)-1 {
+			m = markup
+		}
+		if err := tg.SendFormatted(ctx, chatID, f, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RatingKeyboard returns 1–5 buttons rating the result, bound to the user
+// the answer was for. The ratings feed botctl prompt-report.
+func RatingKeyboard(codec *telegram.CallbackCodec, userID, resultID int64) (telegram.InlineKeyboardMarkup, error) {
+	row := make([]telegram.InlineKeyboardButton, 0, 5)
+	for score := 1; score <= 5; score++ {
+		data, err := codec.Encode(userID, ActionRate, strconv.FormatInt(resultID, 10), strconv.Itoa(score))
+		if err != nil {
+			return telegram.InlineKeyboardMarkup{}, err
+		}
+		row = append(row, telegram.InlineKeyboardButton{Text: strconv.Itoa(score) + " ★", CallbackData: data})
+	}
+	return telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{row}}, nil
+}
+
+// Progress moves one claim through its lifecycle. Tracking errors are
+// logged but never stop the claim from being answered.
+type Progress struct {
+	repo  Tracker
+	id    int64
+	state db.ClaimState
+}
+
+// Track returns the progress of the claim id, now in state. A zero id, for
+// a claim that could not be created, tracks nothing.
+func Track(repo Tracker, id int64, state db.ClaimState) *Progress {
+	return &Progress{repo: repo, id: id, state: state}
+}
+
+// ID returns the claim's ID, or zero if it is not tracked.
+func (p *Progress) ID() int64 { return p.id }
+
+func (p *Progress) transition(ctx context.Context, to db.ClaimState, reason string) error {
+	if p.id == 0 {
+		return nil
+	}
+	if err := p.repo.TransitionClaim(ctx, p.id, p.state, to, reason); err != nil {
+		slog.ErrorContext(ctx, "claim transition", "claim_id", p.id, "to", to, "err", err)
+		return err
+	}
+	p.state = to
+	return nil
+}
+
+// Advance moves the claim to the next state.
+func (p *Progress) Advance(ctx context.Context, to db.ClaimState) {
+	p.transition(ctx, to, "")
+}
+
+// Fail marks the claim failed for reason.
+func (p *Progress) Fail(ctx context.Context, reason string) {
+	p.transition(ctx, db.ClaimFailed, reason)
+}
+
+// SetResult links the claim to its stored result.
+func (p *Progress) SetResult(ctx context.Context, resultID int64) {
+	if p.id == 0 {
+		return
+	}
+	if err := p.repo.SetClaimResult(ctx, p.id, resultID); err != nil {
+		slog.ErrorContext(ctx, "claim result", "claim_id", p.id, "err", err)
+	}
+}
@@ -0,0 +1,169 @@
+package claim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"legalbot/internal/db"
+	"legalbot/internal/pii"
+	"legalbot/internal/prompt"
+	"legalbot/internal/telegram"
+)
+
+type fakeTelegram struct {
+	messages  []string
+	formatted []telegram.Formatted
+	markup    telegram.ReplyMarkup
+	err       error
+}
+
+func (f *fakeTelegram) SendMessage(ctx context.Context, chatID int64, text string) error {
+	f.messages = append(f.messages, text)
+	return f.err
+}
+
+func (f *fakeTelegram) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	f.markup = markup
+	return f.SendMessage(ctx, chatID, text)
+}
+
+func (f *fakeTelegram) SendFormatted(ctx context.Context, chatID int64, fm telegram.Formatted, markup telegram.ReplyMarkup) error {
+	f.formatted = append(f.formatted, fm)
+	f.markup = markup
+	return f.SendMessage(ctx, chatID, fm.Text)
+}
+
+type fakeBuilder struct{ req prompt.Request }
+
+func (f *fakeBuilder) Build(ctx context.Context, req prompt.Request) (prompt.Result, error) {
+	f.req = req
+	return prompt.Result{Prompt: "prompt:" + req.UserText, Version: "v-test"}, nil
+}
+
+type fakeModel struct {
+	prompt string
+	resp   string
+}
+
+func (f *fakeModel) ChatCompletion(ctx context.Context, prompt string) (string, error) {
+	f.prompt = prompt
+	return f.resp, nil
+}
+
+// fakeRepo holds one claim in state.
+type fakeRepo struct {
+	state    db.ClaimState
+	states   []db.ClaimState
+	saved    string
+	resultID int64
+}
+
+func (f *fakeRepo) TransitionClaim(ctx context.Context, id int64, from, to db.ClaimState, reason string) error {
+	if from != f.state {
+		return fmt.Errorf("%w: claim %d is not %s", db.ErrInvalidTransition, id, from)
+	}
+	f.state = to
+	f.states = append(f.states, to)
+	return nil
+}
+
+func (f *fakeRepo) SetClaimResult(ctx context.Context, id, resultID int64) error {
+	f.resultID = resultID
+	return nil
+}
+
+func (f *fakeRepo) SaveResult(ctx context.Context, chatID, userID int64, data string, meta db.ResultMeta) (int64, error) {
+	f.saved = data
+	return 7, nil
+}
+
+func TestProcess(t *testing.T) {
+	tg := &fakeTelegram{}
+	pb := &fakeBuilder{}
+	model := &fakeModel{resp: `{"advice_md":"Совет","claim_md":"Претензия, тел. [PHONE_1]"}`}
+	repo := &fakeRepo{state: db.ClaimQueued}
+	p := &Processor{Telegram: tg, Prompt: pb, Model: model, Repo: repo, Redactor: pii.New(pii.Redact), Callbacks: telegram.NewCallbackCodec([]byte("k"))}
+	task := Task{ClaimID: 3, ChatID: 1, UserID: 2, Text: "звоните +7 912 345-67-89", Evidence: []prompt.Evidence{{Name: "чек.pdf", Text: "+7 912 345-67-89"}}}
+	outcome, err := p.Process(context.Background(), task)
+	if err != nil || outcome != OutcomeDelivered {
+		t.Fatalf("outcome %q, %v", outcome, err)
+	}
+	if strings.Contains(pb.req.UserText, "912") || strings.Contains(pb.req.Evidence[0].Text, "912") {
+		t.Errorf("personal data sent to the prompt service: %+v", pb.req)
+	}
+	if task.Evidence[0].Text != "+7 912 345-67-89" {
+		t.Errorf("task evidence modified: %+v", task.Evidence)
+	}
+	if len(tg.formatted) != 2 || !strings.Contains(tg.messages[1], "+7 912 345-67-89") {
+		t.Errorf("answer %q", tg.messages)
+	}
+	want := []db.ClaimState{db.ClaimBuildingPrompt, db.ClaimCallingModel, db.ClaimRenderingDocs, db.ClaimDelivered}
+	if fmt.Sprint(repo.states) != fmt.Sprint(want) || repo.resultID != 7 {
+		t.Errorf("states %v, result %d", repo.states, repo.resultID)
+	}
+	kb, ok := tg.markup.(telegram.InlineKeyboardMarkup)
+	if !ok || len(kb.InlineKeyboard[0]) != 5 {
+		t.Fatalf("no rating buttons: %#v", tg.markup)
+	}
+	action, args, err := p.Callbacks.Decode(2, kb.InlineKeyboard[0][4].CallbackData)
+	if err != nil || action != ActionRate || fmt.Sprint(args) != "[7 5]" {
+		t.Errorf("rating button %q %v %v", action, args, err)
+	}
+}
+
+func TestProcessSkipsTakenClaim(t *testing.T) {
+	tg := &fakeTelegram{}
+	model := &fakeModel{resp: "ok"}
+	repo := &fakeRepo{state: db.ClaimDelivered}
+	p := &Processor{Telegram: tg, Prompt: &fakeBuilder{}, Model: model, Repo: repo, Redactor: pii.New(pii.Redact)}
+	outcome, err := p.Process(context.Background(), Task{ClaimID: 3, ChatID: 1, Text: "hi"})
+	if err != nil || outcome != OutcomeDuplicate {
+		t.Fatalf("outcome %q, %v", outcome, err)
+	}
+	if model.prompt != "" || len(tg.messages) != 0 {
+		t.Fatalf("claim answered twice: %q", tg.messages)
+	}
+}
+
+func TestProcessUntrackedClaim(t *testing.T) {
+	tg := &fakeTelegram{err: errors.New("forbidden")}
+	repo := &fakeRepo{}
+	p := &Processor{Telegram: tg, Prompt: &fakeBuilder{}, Model: &fakeModel{resp: "ok"}, Repo: repo, Redactor: pii.New(pii.Off)}
+	outcome, err := p.Process(context.Background(), Task{ChatID: 1, Text: "hi"})
+	if outcome != OutcomeSendError || err == nil {
+		t.Fatalf("outcome %q, %v", outcome, err)
+	}
+	if len(repo.states) != 0 || tg.markup != nil {
+		t.Fatalf("untracked claim: states %v, markup %#v", repo.states, tg.markup)
+	}
+}
+
+func TestSendAnswerSplitsLongText(t *testing.T) {
+	long := strings.Repeat("Слово ", 1500)
+	kb := telegram.InlineKeyboardMarkup{}
+	tg := &fakeTelegram{}
+	a := prompt.Answer{AdviceMD: "**Совет**\n\n" + long, ClaimMD: "c"}
+	if err := SendAnswer(context.Background(), tg, 1, "", a, true, kb); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.formatted) != 5 || tg.messages[4] != "c" || tg.markup == nil {
+		t.Fatalf("unexpected messages %d %q", len(tg.formatted), tg.messages[len(tg.messages)-1])
+	}
+	for _, m := range tg.messages {
+		if n := utf8.RuneCountInString(m); n > telegram.MaxMessageLength {
+			t.Errorf("message of %d characters", n)
+		}
+	}
+
+	tg = &fakeTelegram{}
+	if err := SendAnswer(context.Background(), tg, 1, long, prompt.Answer{}, false, kb); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.messages) != 3 || tg.markup == nil {
+		t.Fatalf("raw output not split: %d messages", len(tg.messages))
+	}
+}
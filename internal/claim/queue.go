@@ -0,0 +1,217 @@
+package claim
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"legalbot/internal/amqp"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/telegram"
+	"legalbot/internal/tracing"
+)
+
+// Queue is the durable queue tasks wait in, and TaskType the type of their
+// messages.
+const (
+	Queue    = "claim.create"
+	TaskType = "claim.create"
+)
+
+// Publisher queues tasks for the worker. It connects on first use and again
+// after the connection is lost.
+type Publisher struct {
+	url string
+	tls *tls.Config
+
+	mu   sync.Mutex
+	conn *amqp.Conn
+}
+
+// NewPublisher returns a publisher to the broker at an AMQP URL. tlsConfig
+// is used for amqps URLs and may be nil.
+func NewPublisher(url string, tlsConfig *tls.Config) *Publisher {
+	return &Publisher{url: url, tls: tlsConfig}
+}
+
+// Publish queues t and returns once the broker has stored it.
+func (p *Publisher) Publish(ctx context.Context, t Task) (err error) {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encode task: %w", err)
+	}
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(ctx, "claim.publish", tracing.Client)
+	defer func() { span.EndError(err) }()
+	span.SetInt("claim_id", t.ClaimID)
+	// The request ID and trace context travel in the message headers so
+	// the worker's logs and spans continue the bot's.
+	ids := reqctx.MapCarrier{}
+	reqctx.Inject(ctx, ids)
+	headers := amqp.Table{}
+	for k, v := range ids {
+		headers[k] = v
+	}
+	return conn.Publish(ctx, Queue, amqp.Message{ContentType: "application/json", Type: TaskType, Headers: headers, Body: body})
+}
+
+func (p *Publisher) connect(ctx context.Context) (*amqp.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil && p.conn.Err() == nil {
+		return p.conn, nil
+	}
+	conn, err := amqp.Dial(ctx, p.url, p.tls)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.DeclareQueue(Queue); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+// Close closes the connection to the broker.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// Consumer takes tasks off the queue. Lost connections are dialed again
+// with a backoff.
+type Consumer struct {
+	URL string
+	// TLS is used for amqps URLs and may be nil.
+	TLS *tls.Config
+	// Concurrency is how many tasks are handled at once.
+	Concurrency int
+	// Logger reports connection and message problems; nil disables it.
+	Logger *slog.Logger
+}
+
+// NewConsumer returns a consumer handling concurrency tasks at once from
+// the broker at an AMQP URL.
+func NewConsumer(url string, tlsConfig *tls.Config, concurrency int) *Consumer {
+	return &Consumer{URL: url, TLS: tlsConfig, Concurrency: concurrency, Logger: slog.Default()}
+}
+
+func (c *Consumer) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if c.Logger != nil {
+		c.Logger.Log(ctx, level, msg, args...)
+	}
+}
+
+// Maximum wait between attempts to reach the broker.
+const maxBackoff = 30 * time.Second
+
+// Run hands tasks to handle until ctx is done, then waits for the tasks in
+// progress. handle runs with a context that is not canceled with ctx, in
+// the forum topic the claim came from and with the request ID and trace
+// context the task was published with. Each task is acknowledged once
+// handle returns, so a task whose worker dies is delivered again; messages
+// that are not tasks are dropped.
+func (c *Consumer) Run(ctx context.Context, handle func(context.Context, Task)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		conn, deliveries, err := c.dial(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.log(ctx, slog.LevelError, "connect to the task queue", "err", err, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxBackoff)
+			continue
+		}
+		backoff = time.Second
+		err = c.consume(ctx, conn, deliveries, handle)
+		conn.Close()
+		if err != nil && ctx.Err() == nil {
+			c.log(ctx, slog.LevelError, "task queue connection lost", "err", err)
+		}
+	}
+}
+
+func (c *Consumer) dial(ctx context.Context) (*amqp.Conn, <-chan amqp.Delivery, error) {
+	conn, err := amqp.Dial(ctx, c.URL, c.TLS)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.DeclareQueue(Queue); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	deliveries, err := conn.Consume(Queue, c.Concurrency)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, deliveries, nil
+}
+
+// consume handles deliveries until ctx is done or the connection is lost.
+// The broker sends at most Concurrency unacknowledged tasks, which bounds
+// the goroutines.
+func (c *Consumer) consume(ctx context.Context, conn *amqp.Conn, deliveries <-chan amqp.Delivery, handle func(context.Context, Task)) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return conn.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.handle(context.WithoutCancel(ctx), d, handle)
+			}()
+		}
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, d amqp.Delivery, handle func(context.Context, Task)) {
+	var t Task
+	if d.Type != TaskType {
+		c.log(ctx, slog.LevelWarn, "dropping message of unknown type", "type", d.Type)
+		d.Reject(false)
+		return
+	}
+	if err := json.Unmarshal(d.Body, &t); err != nil {
+		c.log(ctx, slog.LevelError, "dropping malformed task", "err", err)
+		d.Reject(false)
+		return
+	}
+	ids := reqctx.MapCarrier{}
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			ids[k] = s
+		}
+	}
+	ctx = reqctx.Extract(ctx, ids)
+	if t.ThreadID != 0 {
+		ctx = telegram.WithThread(ctx, t.ThreadID)
+	}
+	handle(ctx, t)
+	if err := d.Ack(); err != nil {
+		c.log(ctx, slog.LevelWarn, "ack task", "claim_id", t.ClaimID, "err", err)
+	}
+}
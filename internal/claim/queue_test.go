@@ -0,0 +1,155 @@
+package claim
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"legalbot/internal/amqp/amqptest"
+	"legalbot/internal/amqp/wire"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/telegram"
+)
+
+type handled struct {
+	ctx    context.Context
+	task   Task
+	thread int64
+}
+
+// consume runs a consumer against srv until the test ends and returns the
+// tasks it handles.
+func consume(t *testing.T, srv *amqptest.Server) <-chan handled {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewConsumer(srv.URL, nil, 2)
+	c.Logger = nil
+	got := make(chan handled, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx, func(ctx context.Context, task Task) {
+			got <- handled{ctx, task, telegram.ThreadID(ctx)}
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return got
+}
+
+func next(t *testing.T, got <-chan handled) handled {
+	t.Helper()
+	select {
+	case h := <-got:
+		return h
+	case <-time.After(5 * time.Second):
+		t.Fatal("no task handled")
+	}
+	return handled{}
+}
+
+func TestPublishConsume(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	pub := NewPublisher(srv.URL, nil)
+	defer pub.Close()
+	want := Task{
+		ClaimID:    1 << 60,
+		ChatID:     -1001234567890,
+		UserID:     5,
+		ThreadID:   11,
+		Text:       "Продавец не возвращает деньги",
+		Evidence:   []prompt.Evidence{{Name: "чек.pdf", Text: "Итого 1000"}},
+		ReceivedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := pub.Publish(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	msgs := srv.Ready(Queue)
+	if len(msgs) != 1 || msgs[0].Properties.Type != TaskType || msgs[0].Properties.DeliveryMode != 2 {
+		t.Fatalf("queued %+v", msgs)
+	}
+
+	h := next(t, consume(t, srv))
+	if fmt.Sprint(h.task) != fmt.Sprint(want) || h.thread != 11 {
+		t.Fatalf("handled %+v in thread %d", h.task, h.thread)
+	}
+}
+
+func TestTaskCarriesRequestContext(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	pub := NewPublisher(srv.URL, nil)
+	defer pub.Close()
+	tc, _ := reqctx.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := reqctx.WithTrace(reqctx.WithRequestID(context.Background(), "req-1"), tc)
+	if err := pub.Publish(ctx, Task{ClaimID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := next(t, consume(t, srv))
+	if id := reqctx.RequestID(h.ctx); id != "req-1" {
+		t.Fatalf("request ID %q", id)
+	}
+	got, _ := reqctx.Trace(h.ctx)
+	if got.TraceID != tc.TraceID || got.ParentID != tc.SpanID || got.SpanID == tc.SpanID {
+		t.Fatalf("trace not continued as a child span: %s", got)
+	}
+}
+
+func TestConsumerDropsForeignMessages(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	got := consume(t, srv)
+	srv.Publish(Queue, amqptest.Message{Properties: wire.Properties{Type: "claim.delete"}, Body: []byte("{}")})
+	srv.Publish(Queue, amqptest.Message{Properties: wire.Properties{Type: TaskType}, Body: []byte("not json")})
+	srv.Publish(Queue, amqptest.Message{Properties: wire.Properties{Type: TaskType}, Body: []byte(`{"claim_id":"2","chat_id":"1"}`)})
+	if h := next(t, got); h.task.ClaimID != 2 {
+		t.Fatalf("handled %+v", h.task)
+	}
+	select {
+	case h := <-got:
+		t.Fatalf("foreign message handled: %+v", h.task)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(srv.Ready(Queue)); n != 0 {
+		t.Fatalf("%d messages left in the queue", n)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := amqptest.NewServer(t)
+	got := consume(t, srv)
+	pub := NewPublisher(srv.URL, nil)
+	defer pub.Close()
+	if err := pub.Publish(context.Background(), Task{ClaimID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	next(t, got)
+
+	srv.CloseConnections()
+	// The publisher notices the lost connection on its next use; the
+	// consumer redials on its own.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := pub.Publish(context.Background(), Task{ClaimID: 2})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Task 1 is delivered again if the connection was lost before its ack.
+	for {
+		h := next(t, got)
+		if h.task.ClaimID == 2 {
+			break
+		}
+		if h.task.ClaimID != 1 {
+			t.Fatalf("handled %+v", h.task)
+		}
+	}
+}
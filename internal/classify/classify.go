@@ -0,0 +1,189 @@
+// Package classify routes a user's legal question to a domain so the prompt
+// builder can pick domain-specific instructions and document templates.
+package classify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"legalbot/internal/laws"
+)
+
+// Category is a legal domain.
+type Category string
+
+const (
+	Consumer Category = "consumer"
+	Labour   Category = "labour"
+	Housing  Category = "housing"
+	Traffic  Category = "traffic"
+	Debt     Category = "debt"
+	General  Category = "general"
+)
+
+// Categories lists the domains in a stable order, General last.
+var Categories = []Category{Consumer, Labour, Housing, Traffic, Debt, General}
+
+// Sources of a classification.
+const (
+	SourceRules = "rules"
+	SourceLLM   = "llm"
+)
+
+// keywords are word forms typical for each domain; they are stemmed at start
+// so any inflection matches.
+var keywords = map[Category][]string{
+	Consumer: {"товар", "магазин", "продавец", "продавца", "покупка", "купил", "гарантия", "гарантийный", "брак",
+		"недостаток", "потребитель", "доставка", "маркетплейс", "чек", "возврат", "обмен", "исполнитель"},
+	Labour: {"работодатель", "зарплата", "заработная", "увольнение", "уволили", "отпуск", "трудовой", "премия",
+		"больничный", "сокращение", "оклад", "работник", "трудоустройство", "расчет"},
+	Housing: {"квартира", "жкх", "коммунальные", "управляющая", "тсж", "аренда", "арендодатель", "наниматель",
+		"сосед", "протечка", "затопили", "капремонт", "отопление", "жилье", "жилищная", "дом"},
+	Traffic: {"штраф", "гибдд", "дпс", "пдд", "камера", "автомобиль", "машина", "водитель", "эвакуатор", "парковка",
+		"протокол", "осаго", "дтп", "постановление", "скорость"},
+	Debt: {"долг", "кредит", "коллектор", "коллекторы", "займ", "мфо", "банк", "пристав", "приставы", "расписка",
+		"задолженность", "просрочка", "взыскание", "кредитор", "должник"},
+}
+
+var stems = func() map[string][]Category {
+	m := map[string][]Category{}
+	for _, c := range Categories {
+		seen := map[string]bool{}
+		for _, w := range keywords[c] {
+			for _, s := range laws.Tokenize(w) {
+				if !seen[s] {
+					seen[s] = true
+					m[s] = append(m[s], c)
+				}
+			}
+		}
+	}
+	return m
+}()
+
+// Completer asks a language model, e.g. *openrouter.Client.
+type Completer interface {
+	ChatCompletion(ctx context.Context, prompt string) (string, error)
+}
+
+// Result is a classification outcome.
+type Result struct {
+	Category Category
+	// Score is the keyword score of the chosen category; zero for LLM results.
+	Score  float64
+	Source string
+}
+
+// Classifier scores questions against domain keywords and asks an LLM when
+// the keywords are inconclusive.
+type Classifier struct {
+	llm       Completer
+	minScore  float64
+	minMargin float64
+	Logger    *slog.Logger
+}
+
+// New returns a rule-based classifier.
+func New(opts ...func(*Classifier)) *Classifier {
+	c := &Classifier{minScore: 1, minMargin: 1, Logger: slog.Default()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithLLM enables the LLM fallback for inconclusive questions.
+func WithLLM(l Completer) func(*Classifier) {
+	return func(c *Classifier) { c.llm = l }
+}
+
+// WithThresholds sets the minimum keyword score and the minimum lead over the
+// runner-up needed to trust the rules.
+func WithThresholds(minScore, minMargin float64) func(*Classifier) {
+	return func(c *Classifier) {
+		c.minScore = minScore
+		c.minMargin = minMargin
+	}
+}
+
+// WithLogger sets a custom logger when creating a classifier.
+func WithLogger(l *slog.Logger) func(*Classifier) {
+	return func(c *Classifier) { c.Logger = l }
+}
+
+// Scores returns the keyword score of every domain for text.
+func Scores(text string) map[Category]float64 {
+	scores := map[Category]float64{}
+	for _, t := range laws.Tokenize(text) {
+		for _, c := range stems[t] {
+			scores[c]++
+		}
+	}
+	return scores
+}
+
+// Classify picks the domain of text. It never fails: if the LLM fallback
+// errors the best keyword guess, or General, is returned.
+func (c *Classifier) Classify(ctx context.Context, text string) (Result, error) {
+	scores := Scores(text)
+	best, bestScore, second := General, 0.0, 0.0
+	for _, cat := range Categories {
+		s := scores[cat]
+		switch {
+		case s > bestScore:
+			best, bestScore, second = cat, s, bestScore
+		case s > second:
+			second = s
+		}
+	}
+	if bestScore >= c.minScore && bestScore-second >= c.minMargin {
+		return Result{Category: best, Score: bestScore, Source: SourceRules}, nil
+	}
+	if c.llm != nil {
+		cat, err := c.askLLM(ctx, text)
+		if err == nil {
+			return Result{Category: cat, Source: SourceLLM}, nil
+		}
+		if c.Logger != nil {
+			c.Logger.WarnContext(ctx, "llm classification failed", "err", err)
+		}
+	}
+	if bestScore == 0 || bestScore == second {
+		return Result{Category: General, Source: SourceRules}, nil
+	}
+	return Result{Category: best, Score: bestScore, Source: SourceRules}, nil
+}
+
+const llmPrompt = `Classify the legal issue below into exactly one category.
+Categories: consumer (purchases, services, refunds), labour (employment, salary, dismissal),
+housing (rent, utilities, management companies, neighbours), traffic (traffic police fines, accidents, parking),
+debt (loans, collectors, bailiffs), general (anything else).
+Answer with the category name only.
+
+Issue:
+%s`
+
+func (c *Classifier) askLLM(ctx context.Context, text string) (Category, error) {
+	resp, err := c.llm.ChatCompletion(ctx, fmt.Sprintf(llmPrompt, text))
+	if err != nil {
+		return "", err
+	}
+	return parseCategory(resp)
+}
+
+// parseCategory returns the category mentioned first in a model reply.
+func parseCategory(resp string) (Category, error) {
+	lower := strings.ToLower(resp)
+	found, at := Category(""), len(lower)
+	for _, cat := range Categories {
+		if i := strings.Index(lower, string(cat)); i >= 0 && i < at {
+			found, at = cat, i
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("classify: no category in reply %q", resp)
+	}
+	return found, nil
+}
@@ -0,0 +1,101 @@
+package classify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+type mockLLM struct {
+	prompt string
+	resp   string
+	err    error
+}
+
+func (m *mockLLM) ChatCompletion(ctx context.Context, prompt string) (string, error) {
+	m.prompt = prompt
+	return m.resp, m.err
+}
+
+func quiet() func(*Classifier) {
+	return WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestClassifyRules(t *testing.T) {
+	cases := map[string]Category{
+		"Магазин отказывается вернуть деньги за бракованный товар":            Consumer,
+		"Работодатель не выплатил зарплату при увольнении":                    Labour,
+		"Управляющая компания не делает перерасчет за отопление в квартире":   Housing,
+		"Пришел штраф ГИБДД с камеры, но машину я продал":                     Traffic,
+		"Коллекторы звонят по чужому кредиту, требуют погасить задолженность": Debt,
+		"Хочу составить завещание":                                            General,
+	}
+	c := New(quiet())
+	for text, want := range cases {
+		got, err := c.Classify(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Category != want || got.Source != SourceRules {
+			t.Errorf("Classify(%q) = %+v, want %s", text, got, want)
+		}
+	}
+}
+
+func TestClassifyLLMFallback(t *testing.T) {
+	llm := &mockLLM{resp: "Category: housing."}
+	c := New(WithLLM(llm), quiet())
+	got, err := c.Classify(context.Background(), "Хочу составить завещание")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != Housing || got.Source != SourceLLM {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if llm.prompt == "" {
+		t.Fatal("llm not called")
+	}
+}
+
+func TestClassifyConfidentSkipsLLM(t *testing.T) {
+	llm := &mockLLM{resp: "debt"}
+	c := New(WithLLM(llm), quiet())
+	got, err := c.Classify(context.Background(), "Работодатель задержал зарплату и отпускные")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != Labour || llm.prompt != "" {
+		t.Fatalf("llm should not be asked: %+v", got)
+	}
+}
+
+func TestClassifyLLMErrorUsesRules(t *testing.T) {
+	c := New(WithLLM(&mockLLM{err: errors.New("down")}), WithThresholds(5, 1), quiet())
+	got, err := c.Classify(context.Background(), "Продавец не принимает товар")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != Consumer || got.Source != SourceRules {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestClassifyLLMUnknownReply(t *testing.T) {
+	c := New(WithLLM(&mockLLM{resp: "I cannot help"}), quiet())
+	got, err := c.Classify(context.Background(), "Хочу составить завещание")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != General {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestParseCategoryFirstMention(t *testing.T) {
+	got, err := parseCategory("labour, not consumer")
+	if err != nil || got != Labour {
+		t.Fatalf("unexpected %v %v", got, err)
+	}
+}
@@ -0,0 +1,518 @@
+// Package config holds the settings of every LegalBot binary in typed
+// structs. Load starts from Default, applies a TOML file and then
+// environment variables, and reports every malformed value at once;
+// Validate then checks that a binary has what it needs to start.
+//
+// Each field names its file key in a toml tag and its environment variable
+// in an env tag. Secrets are of type Secret, which never prints its value.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of all binaries; each reads its sections.
+type Config struct {
+	Telegram   Telegram   `toml:"telegram"`
+	Bot        Bot        `toml:"bot"`
+	Prompt     Prompt     `toml:"prompt"`
+	Worker     Worker     `toml:"worker"`
+	OpenRouter OpenRouter `toml:"openrouter"`
+	DB         DB         `toml:"db"`
+	Tracing    Tracing    `toml:"tracing"`
+	Secrets    Secrets    `toml:"secrets"`
+	MTLS       MTLS       `toml:"mtls"`
+	PII        PII        `toml:"pii"`
+}
+
+// Telegram configures the Bot API client and the webhook.
+type Telegram struct {
+	Token Secret `toml:"token" env:"TELEGRAM_TOKEN"`
+	// WebhookSecret is the secret_token Telegram sends with each update.
+	WebhookSecret Secret `toml:"webhook_secret" env:"TELEGRAM_SECRET_TOKEN"`
+	// CallbackSecret signs inline button data; WebhookSecret is used when
+	// it is empty.
+	CallbackSecret Secret `toml:"callback_secret" env:"CALLBACK_SECRET"`
+	APIURL         string `toml:"api_url" env:"TELEGRAM_API_URL"`
+	// WebhookURL is the public URL botctl set-webhook registers.
+	WebhookURL string `toml:"webhook_url" env:"WEBHOOK_URL"`
+}
+
+// CallbackKey returns the key signing inline button data, or nil when
+// neither secret is set.
+func (t Telegram) CallbackKey() []byte {
+	switch {
+	case t.CallbackSecret != "":
+		return []byte(t.CallbackSecret)
+	case t.WebhookSecret != "":
+		return []byte(t.WebhookSecret)
+	}
+	return nil
+}
+
+// Bot configures cmd/bot.
+type Bot struct {
+	Listen          string        `toml:"listen" env:"BOT_LISTEN"`
+	MetricsListen   string        `toml:"metrics_listen" env:"METRICS_LISTEN"`
+	Mode            string        `toml:"mode" env:"BOT_MODE"`
+	PollTimeout     time.Duration `toml:"poll_timeout" env:"BOT_POLL_TIMEOUT"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" env:"BOT_SHUTDOWN_TIMEOUT"`
+	PromptURL       string        `toml:"prompt_url" env:"PROMPT_URL"`
+	DocsBaseURL     string        `toml:"docs_base_url" env:"DOCS_BASE_URL"`
+	// QueueURL is the AMQP URL claims are queued at for the worker.
+	// Without it the bot answers claims itself.
+	QueueURL Secret `toml:"queue_url" env:"AMQP_URL"`
+	// RateLimit claims per user are allowed every RateWindow.
+	RateLimit  int           `toml:"rate_limit" env:"BOT_RATE_LIMIT"`
+	RateWindow time.Duration `toml:"rate_window" env:"BOT_RATE_WINDOW"`
+	// TLSCertFile and TLSKeyFile make the webhook serve HTTPS; the files
+	// are re-read when they are replaced.
+	TLSCertFile string `toml:"tls_cert_file" env:"BOT_TLS_CERT_FILE"`
+	TLSKeyFile  string `toml:"tls_key_file" env:"BOT_TLS_KEY_FILE"`
+	// WebhookAllowlist rejects webhook requests from addresses outside
+	// WebhookAllowedCIDRs, by default the ranges Telegram sends from.
+	WebhookAllowlist    bool     `toml:"webhook_allowlist" env:"BOT_WEBHOOK_ALLOWLIST"`
+	WebhookAllowedCIDRs []string `toml:"webhook_allowed_cidrs" env:"BOT_WEBHOOK_ALLOWED_CIDRS"`
+	// TrustedProxies are the networks whose X-Forwarded-For header is
+	// believed when finding the client address.
+	TrustedProxies []string `toml:"trusted_proxies" env:"BOT_TRUSTED_PROXIES"`
+	// WebhookMaxBody is the largest update body accepted, in bytes.
+	WebhookMaxBody int `toml:"webhook_max_body" env:"BOT_WEBHOOK_MAX_BODY"`
+	// WebhookFailureLimit requests with a wrong secret token are allowed
+	// per address every WebhookFailureWindow; the address is then refused.
+	WebhookFailureLimit  int           `toml:"webhook_failure_limit" env:"BOT_WEBHOOK_FAILURE_LIMIT"`
+	WebhookFailureWindow time.Duration `toml:"webhook_failure_window" env:"BOT_WEBHOOK_FAILURE_WINDOW"`
+}
+
+// TelegramCIDRs are the networks Telegram delivers webhooks from, as
+// published in the Bot API documentation.
+var TelegramCIDRs = []string{"149.154.160.0/20", "91.108.4.0/22"}
+
+// AllowedNetworks returns WebhookAllowedCIDRs parsed.
+func (b Bot) AllowedNetworks() ([]netip.Prefix, error) {
+	return parseNetworks(b.WebhookAllowedCIDRs)
+}
+
+// ProxyNetworks returns TrustedProxies parsed.
+func (b Bot) ProxyNetworks() ([]netip.Prefix, error) {
+	return parseNetworks(b.TrustedProxies)
+}
+
+// parseNetworks parses CIDRs; a bare address stands for itself alone.
+func parseNetworks(l []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, s := range l {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR or an IP address", s)
+		}
+		out = append(out, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return out, nil
+}
+
+// Prompt configures cmd/prompt.
+type Prompt struct {
+	Listen       string        `toml:"listen" env:"PROMPT_LISTEN"`
+	TemplatesDir string        `toml:"templates_dir" env:"PROMPT_TEMPLATES_DIR"`
+	Reload       time.Duration `toml:"reload" env:"PROMPT_RELOAD"`
+	LawsDir      string        `toml:"laws_dir" env:"LAWS_DIR"`
+	LawsK        int           `toml:"laws_k" env:"LAWS_K"`
+	// Vectors is the article embeddings file; it enables hybrid retrieval.
+	Vectors         string        `toml:"vectors" env:"LAWS_VECTORS"`
+	VectorIndex     string        `toml:"vector_index" env:"LAWS_VECTOR_INDEX"`
+	HybridAlpha     float64       `toml:"hybrid_alpha" env:"LAWS_HYBRID_ALPHA"`
+	ClassifyLLM     bool          `toml:"classify_llm" env:"PROMPT_CLASSIFY_LLM"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" env:"PROMPT_SHUTDOWN_TIMEOUT"`
+}
+
+// Worker configures cmd/worker.
+type Worker struct {
+	// QueueURL is the AMQP URL; it holds the broker credentials.
+	QueueURL      Secret        `toml:"queue_url" env:"AMQP_URL"`
+	MetricsListen string        `toml:"metrics_listen" env:"WORKER_METRICS_LISTEN"`
+	DrainTimeout  time.Duration `toml:"drain_timeout" env:"WORKER_DRAIN_TIMEOUT"`
+	PromptURL     string        `toml:"prompt_url" env:"PROMPT_URL"`
+	// Concurrency claims are answered at once.
+	Concurrency int `toml:"concurrency" env:"WORKER_CONCURRENCY"`
+}
+
+// OpenRouter configures the model API client.
+type OpenRouter struct {
+	APIKey             Secret        `toml:"api_key" env:"OPENROUTER_API_KEY"`
+	Endpoint           string        `toml:"endpoint" env:"OPENROUTER_ENDPOINT"`
+	Model              string        `toml:"model" env:"OPENROUTER_MODEL"`
+	EmbeddingsEndpoint string        `toml:"embeddings_endpoint" env:"OPENROUTER_EMBEDDINGS_ENDPOINT"`
+	EmbeddingModel     string        `toml:"embedding_model" env:"OPENROUTER_EMBEDDING_MODEL"`
+	Timeout            time.Duration `toml:"timeout" env:"OPENROUTER_TIMEOUT"`
+}
+
+// DB configures the Postgres pool.
+type DB struct {
+	DSN             Secret        `toml:"dsn" env:"POSTGRES_DSN"`
+	MaxConns        int           `toml:"max_conns" env:"POSTGRES_MAX_CONNS"`
+	AcquireTimeout  time.Duration `toml:"acquire_timeout" env:"POSTGRES_ACQUIRE_TIMEOUT"`
+	MaxConnIdleTime time.Duration `toml:"max_conn_idle_time" env:"POSTGRES_MAX_CONN_IDLE_TIME"`
+	MaxConnLifetime time.Duration `toml:"max_conn_lifetime" env:"POSTGRES_MAX_CONN_LIFETIME"`
+}
+
+// Tracing configures span export. The variables are the standard
+// OpenTelemetry ones.
+type Tracing struct {
+	// Endpoint is the collector base URL; empty turns tracing off.
+	Endpoint string `toml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// TracesEndpoint is the full traces URL and overrides Endpoint.
+	TracesEndpoint string `toml:"traces_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	// ServiceName overrides the binary's name as service.name.
+	ServiceName string  `toml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `toml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+// Secrets selects where the Telegram token, the webhook secret, the
+// OpenRouter key and the DSN are read from; values found there override
+// the other sections. See internal/secrets.
+type Secrets struct {
+	// Provider is env, file or vault.
+	Provider string `toml:"provider" env:"SECRETS_PROVIDER"`
+	// Dir holds one file per secret for the file provider.
+	Dir string `toml:"dir" env:"SECRETS_DIR"`
+	// Refresh is how often secrets are re-read to pick up rotations.
+	Refresh    time.Duration `toml:"refresh" env:"SECRETS_REFRESH"`
+	VaultAddr  string        `toml:"vault_addr" env:"VAULT_ADDR"`
+	VaultMount string        `toml:"vault_mount" env:"VAULT_KV_MOUNT"`
+	VaultPath  string        `toml:"vault_path" env:"VAULT_SECRET_PATH"`
+	// VaultToken authenticates unless an AppRole is set.
+	VaultToken        Secret `toml:"vault_token" env:"VAULT_TOKEN"`
+	VaultRoleID       string `toml:"vault_role_id" env:"VAULT_ROLE_ID"`
+	VaultSecretID     Secret `toml:"vault_secret_id" env:"VAULT_SECRET_ID"`
+	VaultAppRoleMount string `toml:"vault_approle_mount" env:"VAULT_APPROLE_MOUNT"`
+}
+
+// MTLS configures mutual TLS between the services with certificates of an
+// internal CA, e.g. from botctl dev-certs. All three files are set or
+// none; see internal/certs.
+type MTLS struct {
+	// CertFile and KeyFile are the service's certificate, presented as a
+	// server and as a client.
+	CertFile string `toml:"cert_file" env:"MTLS_CERT_FILE"`
+	KeyFile  string `toml:"key_file" env:"MTLS_KEY_FILE"`
+	// CAFile holds the CA certificates peers must chain to.
+	CAFile string `toml:"ca_file" env:"MTLS_CA_FILE"`
+}
+
+// Enabled reports whether mutual TLS is configured.
+func (m MTLS) Enabled() bool {
+	return m.CertFile != "" || m.KeyFile != "" || m.CAFile != ""
+}
+
+// PII configures how the bot treats personal data in claims before they
+// are sent to the model; see internal/pii.
+type PII struct {
+	// Mode is off, detect (count only), redact (placeholders, restored in
+	// the answer) or mask (placeholders kept in the answer).
+	Mode string `toml:"mode" env:"PII_MODE"`
+	// Kinds lists the data to look for, from PIIKinds.
+	Kinds []string `toml:"kinds" env:"PII_KINDS"`
+}
+
+// PIIModes and PIIKinds are the values PII accepts.
+var (
+	PIIModes = []string{"off", "detect", "redact", "mask"}
+	PIIKinds = []string{"passport", "card", "snils", "inn", "phone", "address"}
+)
+
+// TracesURL returns where spans are posted, or "" when tracing is off.
+func (t Tracing) TracesURL() string {
+	if t.TracesEndpoint != "" {
+		return t.TracesEndpoint
+	}
+	if t.Endpoint != "" {
+		return strings.TrimSuffix(t.Endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// Service returns the service name spans are reported under.
+func (t Tracing) Service(binary string) string {
+	if t.ServiceName != "" {
+		return t.ServiceName
+	}
+	return binary
+}
+
+// Default returns the settings used where neither the file nor the
+// environment sets a value.
+func Default() *Config {
+	return &Config{
+		Telegram: Telegram{APIURL: "https://api.telegram.org"},
+		Bot: Bot{
+			Listen:               ":8080",
+			MetricsListen:        ":9100",
+			Mode:                 "webhook",
+			PollTimeout:          30 * time.Second,
+			ShutdownTimeout:      25 * time.Second,
+			PromptURL:            "http://prompt:8090",
+			DocsBaseURL:          "https://example.com/docs",
+			RateLimit:            10,
+			RateWindow:           time.Minute,
+			WebhookAllowedCIDRs:  append([]string(nil), TelegramCIDRs...),
+			WebhookMaxBody:       256 << 10,
+			WebhookFailureLimit:  10,
+			WebhookFailureWindow: time.Minute,
+		},
+		Prompt: Prompt{
+			Listen:          ":8090",
+			Reload:          30 * time.Second,
+			LawsK:           3,
+			VectorIndex:     "flat",
+			HybridAlpha:     0.5,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Worker: Worker{
+			MetricsListen: ":9100",
+			DrainTimeout:  25 * time.Second,
+			PromptURL:     "http://prompt:8090",
+			Concurrency:   4,
+		},
+		OpenRouter: OpenRouter{
+			Endpoint:           "https://openrouter.ai/v1/chat/completions",
+			Model:              "openai/gpt-4o-mini",
+			EmbeddingsEndpoint: "https://openrouter.ai/api/v1/embeddings",
+			EmbeddingModel:     "openai/text-embedding-3-small",
+			Timeout:            15 * time.Second,
+		},
+		DB: DB{
+			MaxConns:        4,
+			AcquireTimeout:  5 * time.Second,
+			MaxConnIdleTime: 5 * time.Minute,
+			MaxConnLifetime: time.Hour,
+		},
+		Tracing: Tracing{SampleRatio: 1},
+		PII: PII{
+			Mode:  "redact",
+			Kinds: append([]string(nil), PIIKinds...),
+		},
+		Secrets: Secrets{
+			Provider:          "env",
+			Dir:               "/run/secrets",
+			Refresh:           time.Minute,
+			VaultMount:        "secret",
+			VaultPath:         "legalbot",
+			VaultAppRoleMount: "approle",
+		},
+	}
+}
+
+// Load returns the defaults overridden by the TOML file at path, if path
+// is not empty, and then by the variables getenv returns, e.g. os.Getenv.
+// Every unknown key and malformed value is reported in one error.
+func Load(path string, getenv func(string) string) (*Config, error) {
+	c := Default()
+	var errs []error
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		entries, err := parseTOML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, e := range entries {
+			if err := c.setFile(e); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %w", path, e.line, err))
+			}
+		}
+	}
+	for _, f := range fields(c) {
+		v := getenv(f.env)
+		if v == "" {
+			continue
+		}
+		if err := setString(f.value, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// field is one setting, found by reflection over Config.
+type field struct {
+	section, key, env string
+	value             reflect.Value
+}
+
+func (f field) path() string { return f.section + "." + f.key }
+
+// fields returns the settings of c in declaration order.
+func fields(c *Config) []field {
+	var out []field
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		section := cv.Type().Field(i).Tag.Get("toml")
+		sv := cv.Field(i)
+		for j := 0; j < sv.NumField(); j++ {
+			sf := sv.Type().Field(j)
+			out = append(out, field{section: section, key: sf.Tag.Get("toml"), env: sf.Tag.Get("env"), value: sv.Field(j)})
+		}
+	}
+	return out
+}
+
+func (c *Config) setFile(e entry) error {
+	for _, f := range fields(c) {
+		if f.section == e.table && f.key == e.key {
+			if s, ok := e.value.(string); ok && f.value.Type() == secretType && s == redacted {
+				return fmt.Errorf("%s: holds the placeholder of printed configuration, not a value", f.path())
+			}
+			if err := setValue(f.value, e.value); err != nil {
+				return fmt.Errorf("%s: %w", f.path(), err)
+			}
+			return nil
+		}
+	}
+	if e.table == "" {
+		return fmt.Errorf("key %q outside a [section]", e.key)
+	}
+	return fmt.Errorf("unknown key %s.%s", e.table, e.key)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	secretType   = reflect.TypeOf(Secret(""))
+)
+
+// setValue stores a parsed TOML value. Durations are written as strings,
+// e.g. "30s".
+func setValue(v reflect.Value, x any) error {
+	if s, ok := x.(string); ok && (v.Type() == durationType || v.Kind() == reflect.String) {
+		return setString(v, s)
+	}
+	switch v.Kind() {
+	case reflect.Int:
+		if n, ok := x.(int64); ok {
+			v.SetInt(n)
+			return nil
+		}
+		return fmt.Errorf("want an integer, got %s", tomlType(x))
+	case reflect.Float64:
+		switch n := x.(type) {
+		case float64:
+			v.SetFloat(n)
+			return nil
+		case int64:
+			v.SetFloat(float64(n))
+			return nil
+		}
+		return fmt.Errorf("want a number, got %s", tomlType(x))
+	case reflect.Bool:
+		if b, ok := x.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+		return fmt.Errorf("want true or false, got %s", tomlType(x))
+	case reflect.Slice:
+		if l, ok := x.([]string); ok {
+			v.Set(reflect.ValueOf(l))
+			return nil
+		}
+		return fmt.Errorf("want an array of strings, got %s", tomlType(x))
+	}
+	if v.Type() == durationType {
+		return fmt.Errorf("want a duration string such as \"30s\", got %s", tomlType(x))
+	}
+	return fmt.Errorf("want a string, got %s", tomlType(x))
+}
+
+// setString stores a value given as text, as environment variables are.
+// Lists are comma separated.
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var l []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				l = append(l, p)
+			}
+		}
+		v.Set(reflect.ValueOf(l))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+func tomlType(x any) string {
+	switch x.(type) {
+	case string:
+		return "a string"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a float"
+	case bool:
+		return "a boolean"
+	case []string:
+		return "an array"
+	}
+	return fmt.Sprintf("%T", x)
+}
+
+// Secret is a setting that must not appear in logs or printed
+// configuration. Convert it with string() where the value is needed.
+type Secret string
+
+// String returns "[redacted]" for a set secret and "" otherwise.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+const redacted = "[redacted]"
+
+// GoString keeps %#v from printing the value.
+func (s Secret) GoString() string { return strconv.Quote(s.String()) }
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Write prints c as a TOML file that Load accepts, with each key's
+// environment variable in a comment. Secrets that are set print as
+// "[redacted]", so the output is safe to paste into tickets.
+func Write(w io.Writer, c *Config) error {
+	bw := bufio.NewWriter(w)
+	section := ""
+	for _, f := range fields(c) {
+		if f.section != section {
+			if section != "" {
+				bw.WriteString("\n")
+			}
+			section = f.section
+			fmt.Fprintf(bw, "[%s]\n", section)
+		}
+		fmt.Fprintf(bw, "%s = %s # %s\n", f.key, formatValue(f.value), f.env)
+	}
+	return bw.Flush()
+}
+
+func formatValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case Secret:
+		return strconv.Quote(x.String())
+	case time.Duration:
+		return strconv.Quote(x.String())
+	case string:
+		return strconv.Quote(x)
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		s := strconv.FormatFloat(x, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case bool:
+		return strconv.FormatBool(x)
+	case []string:
+		q := make([]string, len(x))
+		for i, s := range x {
+			q[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(q, ", ") + "]"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(v.Interface()))
+}
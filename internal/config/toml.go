@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// entry is one key = value line of a TOML file.
+type entry struct {
+	table, key string
+	value      any // string, int64, float64, bool or []string
+	line       int
+}
+
+// parseTOML reads the subset of TOML configuration files need: [table]
+// headers, bare keys, basic and literal strings, integers, floats,
+// booleans, single-line arrays of strings and # comments.
+func parseTOML(src string) ([]entry, error) {
+	var (
+		out   []entry
+		table string
+		seen  = map[string]int{}
+	)
+	for i, line := range strings.Split(src, "\n") {
+		n := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %q", n, line)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if !bareKey(table) {
+				return nil, fmt.Errorf("line %d: unsupported table name %q", n, table)
+			}
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if !bareKey(key) {
+			return nil, fmt.Errorf("line %d: unsupported key %q", n, key)
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		full := table + "." + key
+		if prev, dup := seen[full]; dup {
+			return nil, fmt.Errorf("line %d: %s already set on line %d", n, full, prev)
+		}
+		seen[full] = n
+		out = append(out, entry{table: table, key: key, value: value, line: n})
+	}
+	return out, nil
+}
+
+// stripComment removes a # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func bareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s[0] == '"' || s[0] == '\'':
+		v, rest, err := parseString(s)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return v, nil
+	case s[0] == '[':
+		return parseArray(s)
+	}
+	num := strings.ReplaceAll(s, "_", "")
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %q; strings must be quoted", s)
+}
+
+// parseString reads a quoted string at the start of s and returns the rest.
+func parseString(s string) (string, string, error) {
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], strings.TrimSpace(s[end+2:]), nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, strings.TrimSpace(s[i+1:]), nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func parseArray(s string) ([]string, error) {
+	rest := strings.TrimSpace(s[1:])
+	out := []string{}
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected %q after array", rest[1:])
+			}
+			return out, nil
+		}
+		if rest == "" || rest[0] != '"' && rest[0] != '\'' {
+			return nil, fmt.Errorf("arrays must hold strings on one line")
+		}
+		v, r, err := parseString(rest)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		rest = r
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Binary names a program whose requirements Validate checks.
+type Binary string
+
+const (
+	BotBinary    Binary = "bot"
+	PromptBinary Binary = "prompt"
+	WorkerBinary Binary = "worker"
+)
+
+// maxUpdateBody is the largest webhook body the bot decodes at all.
+const maxUpdateBody = 1 << 20
+
+// Validate checks the sections b reads and reports every problem at once.
+func (c *Config) Validate(b Binary) error {
+	var errs []error
+	switch b {
+	case BotBinary:
+		errs = append(errs, c.Secrets.Validate())
+		errs = append(errs, c.Telegram.validate(c.Bot.Mode == "webhook"))
+		errs = append(errs, c.Bot.validate())
+		errs = append(errs, c.OpenRouter.validate(true))
+		errs = append(errs, c.DB.Validate())
+		errs = append(errs, c.PII.validate())
+		if c.MTLS.Enabled() {
+			p := problems{section: "bot"}
+			p.url("prompt_url", c.Bot.PromptURL, false, "https")
+			errs = append(errs, p.err())
+		}
+	case PromptBinary:
+		errs = append(errs, c.Secrets.Validate())
+		errs = append(errs, c.Prompt.validate())
+		errs = append(errs, c.OpenRouter.validate(c.Prompt.ClassifyLLM || c.Prompt.Vectors != ""))
+	case WorkerBinary:
+		errs = append(errs, c.Secrets.Validate())
+		errs = append(errs, c.Telegram.validate(false))
+		errs = append(errs, c.Worker.validate())
+		errs = append(errs, c.OpenRouter.validate(true))
+		errs = append(errs, c.DB.Validate())
+		errs = append(errs, c.PII.validate())
+		if c.MTLS.Enabled() {
+			p := problems{section: "worker"}
+			p.url("prompt_url", c.Worker.PromptURL, false, "https")
+			errs = append(errs, p.err())
+		}
+	default:
+		return fmt.Errorf("unknown binary %q", b)
+	}
+	errs = append(errs, c.Tracing.validate())
+	errs = append(errs, c.MTLS.validate())
+	return errors.Join(errs...)
+}
+
+// problems collects the errors of one section, named by their keys.
+type problems struct {
+	section string
+	errs    []error
+}
+
+// add records a problem with key, naming the variable that sets it.
+func (p *problems) add(key, format string, args ...any) {
+	path := p.section + "." + key
+	if env := envNames[path]; env != "" {
+		path += " (" + env + ")"
+	}
+	p.errs = append(p.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// envNames maps section.key to the key's environment variable.
+var envNames = func() map[string]string {
+	m := map[string]string{}
+	for _, f := range fields(Default()) {
+		m[f.path()] = f.env
+	}
+	return m
+}()
+
+func (p *problems) required(key string, set bool) {
+	if !set {
+		p.add(key, "required")
+	}
+}
+
+func (p *problems) listen(key, addr string, optional bool) {
+	if addr == "" && optional {
+		return
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		p.add(key, "%q is not a host:port listen address", addr)
+	}
+}
+
+func (p *problems) url(key, u string, optional bool, schemes ...string) {
+	if u == "" && optional {
+		return
+	}
+	parsed, err := url.Parse(u)
+	if err == nil && parsed.Host != "" {
+		for _, s := range schemes {
+			if parsed.Scheme == s {
+				return
+			}
+		}
+	}
+	// URLs may hold credentials, so they are not echoed.
+	p.add(key, "not an absolute %s URL", strings.Join(schemes, " or "))
+}
+
+func (p *problems) positive(key string, ok bool) {
+	if !ok {
+		p.add(key, "must be positive")
+	}
+}
+
+// pair reports a file set without its counterpart, e.g. a certificate
+// without its key.
+func (p *problems) pair(key, v, otherKey, other string) {
+	switch {
+	case v != "" && other == "":
+		p.add(otherKey, "required with %s", key)
+	case v == "" && other != "":
+		p.add(key, "required with %s", otherKey)
+	}
+}
+
+func (p *problems) err() error { return errors.Join(p.errs...) }
+
+func (t Telegram) validate(webhook bool) error {
+	p := problems{section: "telegram"}
+	p.required("token", t.Token != "")
+	if webhook {
+		// Without it anyone who learns the URL can post updates.
+		p.required("webhook_secret", t.WebhookSecret != "")
+	}
+	p.url("api_url", t.APIURL, false, "http", "https")
+	return p.err()
+}
+
+func (b Bot) validate() error {
+	p := problems{section: "bot"}
+	if b.Mode != "webhook" && b.Mode != "polling" {
+		p.add("mode", "%q is not webhook or polling", b.Mode)
+	}
+	if b.Mode == "webhook" {
+		p.listen("listen", b.Listen, false)
+	}
+	p.listen("metrics_listen", b.MetricsListen, true)
+	p.positive("poll_timeout", b.PollTimeout > 0)
+	p.positive("shutdown_timeout", b.ShutdownTimeout > 0)
+	p.url("prompt_url", b.PromptURL, false, "http", "https")
+	p.url("docs_base_url", b.DocsBaseURL, false, "http", "https")
+	p.url("queue_url", string(b.QueueURL), true, "amqp", "amqps")
+	p.positive("rate_limit", b.RateLimit > 0)
+	p.positive("rate_window", b.RateWindow > 0)
+	p.pair("tls_cert_file", b.TLSCertFile, "tls_key_file", b.TLSKeyFile)
+	if _, err := b.AllowedNetworks(); err != nil {
+		p.add("webhook_allowed_cidrs", "%v", err)
+	}
+	if b.WebhookAllowlist && len(b.WebhookAllowedCIDRs) == 0 {
+		p.add("webhook_allowed_cidrs", "required with webhook_allowlist")
+	}
+	if _, err := b.ProxyNetworks(); err != nil {
+		p.add("trusted_proxies", "%v", err)
+	}
+	if b.WebhookMaxBody <= 0 || b.WebhookMaxBody > maxUpdateBody {
+		p.add("webhook_max_body", "must be between 1 and %d", maxUpdateBody)
+	}
+	p.positive("webhook_failure_limit", b.WebhookFailureLimit > 0)
+	p.positive("webhook_failure_window", b.WebhookFailureWindow > 0)
+	return p.err()
+}
+
+func (pr Prompt) validate() error {
+	p := problems{section: "prompt"}
+	p.listen("listen", pr.Listen, false)
+	if pr.Reload < 0 {
+		p.add("reload", "must not be negative")
+	}
+	p.positive("laws_k", pr.LawsK > 0)
+	if pr.Vectors != "" && pr.LawsDir == "" {
+		p.add("vectors", "needs laws_dir")
+	}
+	if pr.VectorIndex != "flat" && pr.VectorIndex != "hnsw" {
+		p.add("vector_index", "%q is not flat or hnsw", pr.VectorIndex)
+	}
+	if pr.HybridAlpha < 0 || pr.HybridAlpha > 1 {
+		p.add("hybrid_alpha", "%v is not between 0 and 1", pr.HybridAlpha)
+	}
+	p.positive("shutdown_timeout", pr.ShutdownTimeout > 0)
+	return p.err()
+}
+
+func (w Worker) validate() error {
+	p := problems{section: "worker"}
+	p.required("queue_url", w.QueueURL != "")
+	if w.QueueURL != "" {
+		p.url("queue_url", string(w.QueueURL), false, "amqp", "amqps")
+	}
+	p.listen("metrics_listen", w.MetricsListen, true)
+	p.positive("drain_timeout", w.DrainTimeout > 0)
+	p.url("prompt_url", w.PromptURL, false, "http", "https")
+	p.positive("concurrency", w.Concurrency > 0)
+	return p.err()
+}
+
+// validate checks the client settings; the key is only required where the
+// model is called.
+func (o OpenRouter) validate(needKey bool) error {
+	p := problems{section: "openrouter"}
+	if needKey {
+		p.required("api_key", o.APIKey != "")
+	}
+	p.url("endpoint", o.Endpoint, false, "http", "https")
+	p.required("model", o.Model != "")
+	p.url("embeddings_endpoint", o.EmbeddingsEndpoint, false, "http", "https")
+	p.required("embedding_model", o.EmbeddingModel != "")
+	p.positive("timeout", o.Timeout > 0)
+	return p.err()
+}
+
+// Validate checks the pool settings, for commands that only need the
+// database.
+func (d DB) Validate() error {
+	p := problems{section: "db"}
+	p.required("dsn", d.DSN != "")
+	p.positive("max_conns", d.MaxConns > 0)
+	p.positive("acquire_timeout", d.AcquireTimeout > 0)
+	p.positive("max_conn_idle_time", d.MaxConnIdleTime > 0)
+	p.positive("max_conn_lifetime", d.MaxConnLifetime > 0)
+	return p.err()
+}
+
+func (t Tracing) validate() error {
+	p := problems{section: "tracing"}
+	p.url("endpoint", t.Endpoint, true, "http", "https")
+	p.url("traces_endpoint", t.TracesEndpoint, true, "http", "https")
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		p.add("sample_ratio", "%v is not between 0 and 1", t.SampleRatio)
+	}
+	return p.err()
+}
+
+// Validate checks that the selected provider can be used, for callers that
+// read secrets before validating the rest.
+func (s Secrets) Validate() error {
+	p := problems{section: "secrets"}
+	switch s.Provider {
+	case "env":
+	case "file":
+		p.required("dir", s.Dir != "")
+	case "vault":
+		p.url("vault_addr", s.VaultAddr, false, "http", "https")
+		p.required("vault_mount", s.VaultMount != "")
+		p.required("vault_path", s.VaultPath != "")
+		switch {
+		case s.VaultRoleID != "":
+			p.required("vault_secret_id", s.VaultSecretID != "")
+			p.required("vault_approle_mount", s.VaultAppRoleMount != "")
+		case s.VaultToken == "":
+			p.add("vault_token", "required unless vault_role_id is set")
+		}
+	default:
+		p.add("provider", "%q is not env, file or vault", s.Provider)
+	}
+	p.positive("refresh", s.Refresh > 0)
+	return p.err()
+}
+
+func (m MTLS) validate() error {
+	p := problems{section: "mtls"}
+	if m.Enabled() {
+		p.required("cert_file", m.CertFile != "")
+		p.required("key_file", m.KeyFile != "")
+		p.required("ca_file", m.CAFile != "")
+	}
+	return p.err()
+}
+
+func (pi PII) validate() error {
+	p := problems{section: "pii"}
+	if !slices.Contains(PIIModes, pi.Mode) {
+		p.add("mode", "%q is not %s", pi.Mode, strings.Join(PIIModes, ", "))
+	}
+	for _, k := range pi.Kinds {
+		if !slices.Contains(PIIKinds, k) {
+			p.add("kinds", "unknown kind %q; known are %s", k, strings.Join(PIIKinds, ", "))
+		}
+	}
+	if pi.Mode != "off" && len(pi.Kinds) == 0 {
+		p.add("kinds", "required unless mode is off")
+	}
+	return p.err()
+}
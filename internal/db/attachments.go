@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Attachment is a file a user sent as evidence for a claim. The file itself
+// stays with Telegram and can be downloaded again by FileID; only the
+// extracted text is stored.
+type Attachment struct {
+	ID           int64
+	ClaimID      int64
+	FileID       string
+	FileUniqueID string
+	FileName     string
+	MimeType     string
+	Size         int64
+	Text         string
+	CreatedAt    time.Time
+}
+
+// SaveAttachment links an attachment to its claim and returns its ID.
+func (r *Repository) SaveAttachment(ctx context.Context, a Attachment) (_ int64, err error) {
+	done := observeQuery(ctx, "save_attachment")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `INSERT INTO claim_attachments (claim_id, file_id, file_unique_id, file_name, mime_type, size, text)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		a.ClaimID, a.FileID, a.FileUniqueID, a.FileName, a.MimeType, a.Size, a.Text)
+	if err != nil {
+		return 0, fmt.Errorf("save attachment: %w", err)
+	}
+	defer rows.Close()
+	var id int64
+	if rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("scan attachment id: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "attachment saved", "claim_id", a.ClaimID, "mime_type", a.MimeType, "size", a.Size)
+	}
+	return id, nil
+}
+
+// ClaimAttachments returns the attachments of a claim in the order they were
+// sent.
+func (r *Repository) ClaimAttachments(ctx context.Context, claimID int64) (_ []Attachment, err error) {
+	done := observeQuery(ctx, "claim_attachments")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT id, claim_id, file_id, file_unique_id, file_name, mime_type, size, text, created_at
+FROM claim_attachments WHERE claim_id=$1 ORDER BY id`, claimID)
+	if err != nil {
+		return nil, fmt.Errorf("claim attachments: %w", err)
+	}
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.ClaimID, &a.FileID, &a.FileUniqueID, &a.FileName, &a.MimeType, &a.Size, &a.Text, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepository_Attachments(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	claimID, err := repo.CreateClaim(ctx, 31, 31, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []Attachment{
+		{ClaimID: claimID, FileID: "F1", FileUniqueID: "U1", FileName: "contract.pdf", MimeType: "application/pdf", Size: 2048, Text: "Договор"},
+		{ClaimID: claimID, FileID: "F2", FileUniqueID: "U2", MimeType: "image/jpeg", Size: 4096},
+	} {
+		if id, err := repo.SaveAttachment(ctx, a); err != nil || id == 0 {
+			t.Fatalf("save attachment: %d %v", id, err)
+		}
+	}
+	got, err := repo.ClaimAttachments(ctx, claimID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].FileName != "contract.pdf" || got[0].Text != "Договор" || got[1].MimeType != "image/jpeg" {
+		t.Fatalf("unexpected attachments %+v", got)
+	}
+
+	// Deleting the chat history removes the claim and its attachments.
+	if err := repo.DeleteHistory(ctx, 31); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.ClaimAttachments(ctx, claimID); err != nil || len(got) != 0 {
+		t.Fatalf("attachments survived history deletion: %+v %v", got, err)
+	}
+}
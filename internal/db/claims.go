@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ClaimState is a step of the claim lifecycle.
+type ClaimState string
+
+const (
+	ClaimQueued         ClaimState = "queued"
+	ClaimBuildingPrompt ClaimState = "building_prompt"
+	ClaimCallingModel   ClaimState = "calling_model"
+	ClaimRenderingDocs  ClaimState = "rendering_docs"
+	ClaimDelivered      ClaimState = "delivered"
+	ClaimFailed         ClaimState = "failed"
+)
+
+// claimNext lists the forward transitions; any unfinished state may also
+// move to ClaimFailed.
+var claimNext = map[ClaimState]ClaimState{
+	ClaimQueued:         ClaimBuildingPrompt,
+	ClaimBuildingPrompt: ClaimCallingModel,
+	ClaimCallingModel:   ClaimRenderingDocs,
+	ClaimRenderingDocs:  ClaimDelivered,
+}
+
+// Terminal reports whether no further transitions are possible.
+func (s ClaimState) Terminal() bool {
+	return s == ClaimDelivered || s == ClaimFailed
+}
+
+// CanTransition reports whether a claim may move from s to next.
+func (s ClaimState) CanTransition(next ClaimState) bool {
+	if next == ClaimFailed {
+		return !s.Terminal()
+	}
+	return claimNext[s] == next
+}
+
+// ErrInvalidTransition is returned when a claim is not in the expected state.
+var ErrInvalidTransition = errors.New("invalid claim transition")
+
+// Claim is a user's request tracked through the processing pipeline.
+type Claim struct {
+	ID         int64
+	ChatID     int64
+	UserID     int64
+	State      ClaimState
+	Error      string
+	ReceivedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Elapsed returns how long the claim took from receipt to its final state, or
+// has been running so far.
+func (c Claim) Elapsed(now time.Time) time.Duration {
+	start := c.ReceivedAt
+	if start.IsZero() {
+		start = c.CreatedAt
+	}
+	if c.FinishedAt != nil {
+		return c.FinishedAt.Sub(start)
+	}
+	return now.Sub(start)
+}
+
+// CreateClaim records a new queued claim filed by a user in a chat and
+// returns its ID. receivedAt is when the update carrying the claim arrived.
+func (r *Repository) CreateClaim(ctx context.Context, chatID, userID int64, receivedAt time.Time) (_ int64, err error) {
+	done := observeQuery(ctx, "create_claim")
+	defer func() { done(err) }()
+	var id int64
+	err = r.conn().QueryRow(ctx, `WITH c AS (
+	INSERT INTO claims (chat_id, user_id, received_at) VALUES ($1, $2, $3) RETURNING id, state, created_at
+)
+INSERT INTO claim_events (claim_id, state, at) SELECT id, state, created_at FROM c RETURNING claim_id`, chatID, userID, receivedAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("create claim: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "claim created", "chat_id", chatID, "user_id", userID, "claim_id", id)
+	}
+	return id, nil
+}
+
+// TransitionClaim moves a claim from one state to the next. The update only
+// applies if the claim is still in from, so concurrent workers cannot both
+// advance it; otherwise ErrInvalidTransition is returned. reason is stored
+// for failures.
+func (r *Repository) TransitionClaim(ctx context.Context, id int64, from, to ClaimState, reason string) (err error) {
+	done := observeQuery(ctx, "transition_claim")
+	defer func() { done(err) }()
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	rows, err := r.conn().Query(ctx, `WITH u AS (
+	UPDATE claims SET state=$3, error=$4, updated_at=now(),
+		finished_at = CASE WHEN $3 IN ('delivered', 'failed') THEN now() ELSE NULL END
+	WHERE id=$1 AND state=$2
+	RETURNING id, state, error, updated_at
+)
+INSERT INTO claim_events (claim_id, state, error, at) SELECT id, state, error, updated_at FROM u RETURNING claim_id`,
+		id, string(from), string(to), reason)
+	if err != nil {
+		return fmt.Errorf("transition claim: %w", err)
+	}
+	defer rows.Close()
+	ok := rows.Next()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("transition claim: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: claim %d is not %s", ErrInvalidTransition, id, from)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "claim transition", "claim_id", id, "from", from, "to", to)
+	}
+	return nil
+}
+
+// SetClaimResult links the stored result to a claim.
+func (r *Repository) SetClaimResult(ctx context.Context, id, resultID int64) (err error) {
+	done := observeQuery(ctx, "set_claim_result")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `UPDATE claims SET result_id=$2 WHERE id=$1`, id, resultID)
+	if err != nil {
+		return fmt.Errorf("set claim result: %w", err)
+	}
+	return nil
+}
+
+// ChatClaims returns the latest claims a user filed in a chat, newest first.
+func (r *Repository) ChatClaims(ctx context.Context, chatID, userID int64, limit int) (_ []Claim, err error) {
+	done := observeQuery(ctx, "chat_claims")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT id, chat_id, user_id, state, error, received_at, created_at, updated_at, finished_at
+FROM claims WHERE chat_id=$1 AND user_id=$2 ORDER BY created_at DESC LIMIT $3`, chatID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("chat claims: %w", err)
+	}
+	defer rows.Close()
+	var res []Claim
+	for rows.Next() {
+		var c Claim
+		var state string
+		if err := rows.Scan(&c.ID, &c.ChatID, &c.UserID, &state, &c.Error, &c.ReceivedAt, &c.CreatedAt, &c.UpdatedAt, &c.FinishedAt); err != nil {
+			return nil, fmt.Errorf("scan claim: %w", err)
+		}
+		c.State = ClaimState(state)
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return res, nil
+}
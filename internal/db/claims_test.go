@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClaimState_CanTransition(t *testing.T) {
+	cases := []struct {
+		from, to ClaimState
+		ok       bool
+	}{
+		{ClaimQueued, ClaimBuildingPrompt, true},
+		{ClaimBuildingPrompt, ClaimCallingModel, true},
+		{ClaimCallingModel, ClaimRenderingDocs, true},
+		{ClaimRenderingDocs, ClaimDelivered, true},
+		{ClaimCallingModel, ClaimFailed, true},
+		{ClaimQueued, ClaimCallingModel, false},
+		{ClaimDelivered, ClaimFailed, false},
+		{ClaimFailed, ClaimQueued, false},
+	}
+	for _, c := range cases {
+		if got := c.from.CanTransition(c.to); got != c.ok {
+			t.Errorf("%s -> %s = %v, want %v", c.from, c.to, got, c.ok)
+		}
+	}
+}
+
+func TestClaim_Elapsed(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	if d := (Claim{CreatedAt: start, FinishedAt: &end}).Elapsed(start.Add(time.Hour)); d != time.Minute {
+		t.Errorf("finished claim elapsed %v", d)
+	}
+	if d := (Claim{CreatedAt: start}).Elapsed(start.Add(time.Hour)); d != time.Hour {
+		t.Errorf("running claim elapsed %v", d)
+	}
+	received := start.Add(-3 * time.Second)
+	if d := (Claim{ReceivedAt: received, CreatedAt: start, FinishedAt: &end}).Elapsed(end); d != time.Minute+3*time.Second {
+		t.Errorf("elapsed does not count from receipt: %v", d)
+	}
+}
+
+func TestRepository_TransitionClaim_RejectsSkippedState(t *testing.T) {
+	repo := &Repository{}
+	err := repo.TransitionClaim(context.Background(), 1, ClaimQueued, ClaimDelivered, "")
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+}
+
+func TestRepository_ClaimLifecycle(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	received := time.Now().Add(-2 * time.Second).Truncate(time.Microsecond)
+	id, err := repo.CreateClaim(ctx, 11, 11, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []ClaimState{ClaimQueued, ClaimBuildingPrompt, ClaimCallingModel, ClaimRenderingDocs, ClaimDelivered}
+	for i := 1; i < len(steps); i++ {
+		if err := repo.TransitionClaim(ctx, id, steps[i-1], steps[i], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.TransitionClaim(ctx, id, ClaimRenderingDocs, ClaimFailed, "late"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("stale transition applied: %v", err)
+	}
+	resID, err := repo.SaveResult(ctx, 11, 11, "answer", ResultMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetClaimResult(ctx, id, resID); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := repo.CreateClaim(ctx, 11, 11, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.TransitionClaim(ctx, failed, ClaimQueued, ClaimFailed, "prompt build: boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := repo.ChatClaims(ctx, 11, 11, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 2 || claims[0].ID != failed || claims[1].ID != id {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if claims[0].State != ClaimFailed || claims[0].Error != "prompt build: boom" || claims[0].FinishedAt == nil {
+		t.Fatalf("unexpected failed claim %+v", claims[0])
+	}
+	if claims[1].State != ClaimDelivered || claims[1].FinishedAt == nil || !claims[1].ReceivedAt.Equal(received) {
+		t.Fatalf("unexpected delivered claim %+v", claims[1])
+	}
+
+	if err := repo.DeleteHistory(ctx, 11); err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := repo.ChatClaims(ctx, 11, 11, 10); err != nil || len(claims) != 0 {
+		t.Fatalf("claims not deleted: %+v %v", claims, err)
+	}
+}
+
+func TestRepository_TransitionClaim_Concurrent(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+	id, err := repo.CreateClaim(ctx, 12, 12, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	won := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.TransitionClaim(ctx, id, ClaimQueued, ClaimBuildingPrompt, ""); err == nil {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("expected exactly one transition, got %d", won)
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Consent is a user's latest decision on the data policy. Decisions are
+// stored under the user's private chat ID, which equals the user ID.
+type Consent struct {
+	Version   string
+	Accepted  bool
+	DecidedAt time.Time
+}
+
+// Valid reports whether the user accepted the given policy version.
+func (c Consent) Valid(version string) bool {
+	return c.Accepted && c.Version == version
+}
+
+// SetConsent records that a user accepted or declined a policy version,
+// replacing any earlier decision.
+func (r *Repository) SetConsent(ctx context.Context, userID int64, version string, accepted bool) (err error) {
+	done := observeQuery(ctx, "set_consent")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `INSERT INTO chat_consents (chat_id, policy_version, accepted, decided_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (chat_id) DO UPDATE SET policy_version=EXCLUDED.policy_version, accepted=EXCLUDED.accepted, decided_at=EXCLUDED.decided_at`,
+		userID, version, accepted)
+	if err != nil {
+		return fmt.Errorf("set consent: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "consent recorded", "user_id", userID, "policy_version", version, "accepted", accepted)
+	}
+	return nil
+}
+
+// Consent returns the user's latest decision. A user who never decided gets
+// the zero Consent.
+func (r *Repository) Consent(ctx context.Context, userID int64) (_ Consent, err error) {
+	done := observeQuery(ctx, "consent")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT policy_version, accepted, decided_at FROM chat_consents WHERE chat_id=$1`, userID)
+	if err != nil {
+		return Consent{}, fmt.Errorf("consent: %w", err)
+	}
+	defer rows.Close()
+	var c Consent
+	if rows.Next() {
+		if err := rows.Scan(&c.Version, &c.Accepted, &c.DecidedAt); err != nil {
+			return Consent{}, fmt.Errorf("scan consent: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Consent{}, fmt.Errorf("rows: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConsent_Valid(t *testing.T) {
+	if (Consent{}).Valid("1") {
+		t.Error("zero consent should not be valid")
+	}
+	if (Consent{Version: "1", Accepted: false}).Valid("1") {
+		t.Error("declined consent should not be valid")
+	}
+	if (Consent{Version: "1", Accepted: true}).Valid("2") {
+		t.Error("consent to an older policy should not be valid")
+	}
+	if !(Consent{Version: "2", Accepted: true}).Valid("2") {
+		t.Error("expected valid consent")
+	}
+}
+
+func TestRepository_Consent(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	c, err := repo.Consent(ctx, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != (Consent{}) {
+		t.Fatalf("expected zero consent, got %+v", c)
+	}
+	if err := repo.SetConsent(ctx, 21, "1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetConsent(ctx, 21, "2", false); err != nil {
+		t.Fatal(err)
+	}
+	c, err = repo.Consent(ctx, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != "2" || c.Accepted || c.DecidedAt.IsZero() {
+		t.Fatalf("unexpected consent %+v", c)
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// GroupAccess is who may file claims in a group chat.
+type GroupAccess struct {
+	// Restricted limits claims to the group's admins and allowed members.
+	Restricted bool
+	// Allowed is the number of members admins allowed to file claims.
+	Allowed int
+}
+
+// GroupAccess returns the claim settings of a group. Groups nobody
+// configured are unrestricted.
+func (r *Repository) GroupAccess(ctx context.Context, chatID int64) (_ GroupAccess, err error) {
+	done := observeQuery(ctx, "group_access")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT
+    coalesce((SELECT restricted FROM group_settings WHERE chat_id=$1), false),
+    (SELECT count(*) FROM group_claimants WHERE chat_id=$1)`, chatID)
+	if err != nil {
+		return GroupAccess{}, fmt.Errorf("group access: %w", err)
+	}
+	defer rows.Close()
+	var a GroupAccess
+	if rows.Next() {
+		if err := rows.Scan(&a.Restricted, &a.Allowed); err != nil {
+			return GroupAccess{}, fmt.Errorf("scan group access: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return GroupAccess{}, fmt.Errorf("rows: %w", err)
+	}
+	return a, nil
+}
+
+// SetGroupRestricted turns the claim restriction of a group on or off.
+func (r *Repository) SetGroupRestricted(ctx context.Context, chatID int64, restricted bool, by int64) (err error) {
+	done := observeQuery(ctx, "set_group_restricted")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `INSERT INTO group_settings (chat_id, restricted, updated_by, updated_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (chat_id) DO UPDATE SET restricted=EXCLUDED.restricted, updated_by=EXCLUDED.updated_by, updated_at=EXCLUDED.updated_at`,
+		chatID, restricted, by)
+	if err != nil {
+		return fmt.Errorf("set group restricted: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "group access changed", "chat_id", chatID, "restricted", restricted, "by", by)
+	}
+	return nil
+}
+
+// AllowClaimant lets a member file claims in a restricted group.
+func (r *Repository) AllowClaimant(ctx context.Context, chatID, userID, by int64) (err error) {
+	done := observeQuery(ctx, "allow_claimant")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `INSERT INTO group_claimants (chat_id, user_id, added_by) VALUES ($1, $2, $3)
+ON CONFLICT (chat_id, user_id) DO NOTHING`, chatID, userID, by)
+	if err != nil {
+		return fmt.Errorf("allow claimant: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "group claimant allowed", "chat_id", chatID, "user_id", userID, "by", by)
+	}
+	return nil
+}
+
+// RemoveClaimant withdraws a member's permission to file claims.
+func (r *Repository) RemoveClaimant(ctx context.Context, chatID, userID int64) (err error) {
+	done := observeQuery(ctx, "remove_claimant")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `DELETE FROM group_claimants WHERE chat_id=$1 AND user_id=$2`, chatID, userID)
+	if err != nil {
+		return fmt.Errorf("remove claimant: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "group claimant removed", "chat_id", chatID, "user_id", userID)
+	}
+	return nil
+}
+
+// IsClaimant reports whether admins allowed a member to file claims.
+func (r *Repository) IsClaimant(ctx context.Context, chatID, userID int64) (_ bool, err error) {
+	done := observeQuery(ctx, "is_claimant")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT 1 FROM group_claimants WHERE chat_id=$1 AND user_id=$2`, chatID, userID)
+	if err != nil {
+		return false, fmt.Errorf("is claimant: %w", err)
+	}
+	defer rows.Close()
+	ok := rows.Next()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("is claimant: %w", err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepository_GroupAccess(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+	const group = -100123
+
+	a, err := repo.GroupAccess(ctx, group)
+	if err != nil || a.Restricted || a.Allowed != 0 {
+		t.Fatalf("new group: %+v %v", a, err)
+	}
+	if err := repo.SetGroupRestricted(ctx, group, true, 1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.AllowClaimant(ctx, group, 7, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := repo.IsClaimant(ctx, group, 7); err != nil || !ok {
+		t.Fatalf("member not allowed: %v", err)
+	}
+	if ok, _ := repo.IsClaimant(ctx, group, 8); ok {
+		t.Fatal("unknown member allowed")
+	}
+	if a, err := repo.GroupAccess(ctx, group); err != nil || !a.Restricted || a.Allowed != 1 {
+		t.Fatalf("restricted group: %+v %v", a, err)
+	}
+	if err := repo.RemoveClaimant(ctx, group, 7); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.IsClaimant(ctx, group, 7); ok {
+		t.Fatal("removed member still allowed")
+	}
+}
+
+func TestRepository_GroupHistoryIsPerUser(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+	const group = -100456
+
+	for _, user := range []int64{41, 42} {
+		if _, err := repo.CreateClaim(ctx, group, user, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.CreateClaim(ctx, 41, 41, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := repo.ChatClaims(ctx, group, 41, 10)
+	if err != nil || len(claims) != 1 || claims[0].UserID != 41 || claims[0].ChatID != group {
+		t.Fatalf("unexpected group claims %+v %v", claims, err)
+	}
+
+	// Deleting removes the user's claims everywhere but not other members'.
+	if err := repo.DeleteHistory(ctx, 41); err != nil {
+		t.Fatal(err)
+	}
+	if claims, _ := repo.ChatClaims(ctx, 41, 41, 10); len(claims) != 0 {
+		t.Fatalf("private claims kept: %+v", claims)
+	}
+	if claims, _ := repo.ChatClaims(ctx, group, 41, 10); len(claims) != 0 {
+		t.Fatalf("group claims kept: %+v", claims)
+	}
+	if claims, _ := repo.ChatClaims(ctx, group, 42, 10); len(claims) != 1 {
+		t.Fatalf("other member's claims deleted: %+v", claims)
+	}
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"legalbot/internal/metrics"
+	"legalbot/internal/tracing"
+)
+
+var queryDuration = metrics.NewHistogram("db_query_duration_seconds",
+	"Duration of repository queries by operation.", metrics.QueryBuckets, "op")
+
+// observeQuery times a query and records it as a span. Call the returned
+// function deferred at the top of a repository method with its named error
+// result, so failed queries end their span with the error:
+//
+//	done := observeQuery(ctx, "create_claim")
+//	defer func() { done(err) }()
+func observeQuery(ctx context.Context, op string) func(err error) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "db."+op, tracing.Client)
+	span.SetAttr("db.operation", op)
+	return func(err error) {
+		queryDuration.Observe(metrics.Since(start), op)
+		span.EndError(err)
+	}
+}
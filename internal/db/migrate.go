@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migrate applies the embedded schema migrations in file name order. Every
+// migration is written to be idempotent, so Migrate is safe to run on each
+// deploy.
+func (r *Repository) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sql, err := migrationsFS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if _, err := r.conn().Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("migrate %s: %w", name, err)
+		}
+		if r.Logger != nil {
+			r.Logger.InfoContext(ctx, "migration applied", "name", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS bot_results (
+    id         bigserial PRIMARY KEY,
+    chat_id    bigint      NOT NULL,
+    data       text        NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS bot_results_chat_id_created_at_idx
+    ON bot_results (chat_id, created_at DESC);
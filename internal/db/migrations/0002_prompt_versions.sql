@@ -0,0 +1,7 @@
+ALTER TABLE bot_results
+    ADD COLUMN IF NOT EXISTS prompt_version text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS parse_ok boolean,
+    ADD COLUMN IF NOT EXISTS rating smallint CHECK (rating BETWEEN 1 AND 5);
+
+CREATE INDEX IF NOT EXISTS bot_results_prompt_version_idx
+    ON bot_results (prompt_version);
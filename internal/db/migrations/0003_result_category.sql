@@ -0,0 +1,5 @@
+ALTER TABLE bot_results
+    ADD COLUMN IF NOT EXISTS category text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS bot_results_category_idx
+    ON bot_results (category);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS claims (
+    id          bigserial PRIMARY KEY,
+    chat_id     bigint      NOT NULL,
+    state       text        NOT NULL DEFAULT 'queued',
+    error       text        NOT NULL DEFAULT '',
+    result_id   bigint      REFERENCES bot_results (id) ON DELETE SET NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS claims_chat_id_created_at_idx
+    ON claims (chat_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS claim_events (
+    claim_id bigint      NOT NULL REFERENCES claims (id) ON DELETE CASCADE,
+    state    text        NOT NULL,
+    error    text        NOT NULL DEFAULT '',
+    at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS claim_events_claim_id_idx
+    ON claim_events (claim_id, at);
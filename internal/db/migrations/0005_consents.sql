@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS chat_consents (
+    chat_id        bigint PRIMARY KEY,
+    policy_version text        NOT NULL,
+    accepted       boolean     NOT NULL,
+    decided_at     timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS processed_updates (
+    update_id    bigint PRIMARY KEY,
+    processed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS processed_updates_processed_at_idx ON processed_updates (processed_at);
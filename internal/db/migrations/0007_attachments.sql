@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS claim_attachments (
+    id             bigserial PRIMARY KEY,
+    claim_id       bigint      NOT NULL REFERENCES claims (id) ON DELETE CASCADE,
+    file_id        text        NOT NULL,
+    file_unique_id text        NOT NULL,
+    file_name      text        NOT NULL DEFAULT '',
+    mime_type      text        NOT NULL,
+    size           bigint      NOT NULL,
+    text           text        NOT NULL DEFAULT '',
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS claim_attachments_claim_id_idx
+    ON claim_attachments (claim_id);
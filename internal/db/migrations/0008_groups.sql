@@ -0,0 +1,29 @@
+-- Claims and results belong to the user who asked, which in group chats is
+-- not the chat. Private chat IDs equal user IDs, so existing rows are theirs.
+ALTER TABLE claims ADD COLUMN IF NOT EXISTS user_id bigint;
+UPDATE claims SET user_id = chat_id WHERE user_id IS NULL;
+ALTER TABLE claims ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS claims_user_id_idx ON claims (user_id);
+
+ALTER TABLE bot_results ADD COLUMN IF NOT EXISTS user_id bigint;
+UPDATE bot_results SET user_id = chat_id WHERE user_id IS NULL;
+ALTER TABLE bot_results ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS bot_results_user_id_idx ON bot_results (user_id);
+
+-- Group admins can restrict claims to admins and members they allowed.
+CREATE TABLE IF NOT EXISTS group_settings (
+    chat_id    bigint PRIMARY KEY,
+    restricted boolean     NOT NULL DEFAULT false,
+    updated_by bigint      NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS group_claimants (
+    chat_id  bigint      NOT NULL,
+    user_id  bigint      NOT NULL,
+    added_by bigint      NOT NULL,
+    added_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
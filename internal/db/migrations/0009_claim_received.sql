@@ -0,0 +1,7 @@
+-- received_at is when the bot received the update a claim came from, so the
+-- time to answer covers queueing before the claim was created. Older claims
+-- were created on receipt.
+ALTER TABLE claims ADD COLUMN IF NOT EXISTS received_at timestamptz;
+UPDATE claims SET received_at = created_at WHERE received_at IS NULL;
+ALTER TABLE claims ALTER COLUMN received_at SET DEFAULT now();
+ALTER TABLE claims ALTER COLUMN received_at SET NOT NULL;
@@ -4,37 +4,66 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"legalbot/internal/config"
 )
 
 // Repository provides access to Postgres.
 type Repository struct {
+	poolMu sync.RWMutex
 	pool   *pgxpool.Pool
 	Logger *slog.Logger
 }
 
-// New creates a new repository using DSN from POSTGRES_DSN.
-func New(ctx context.Context) (*Repository, error) {
-	dsn := os.Getenv("POSTGRES_DSN")
-	if dsn == "" {
-		return nil, fmt.Errorf("POSTGRES_DSN is not set")
-	}
-	cfg, err := pgxpool.ParseConfig(dsn)
+// New creates a new repository with a pool configured by cfg.
+func New(ctx context.Context, cfg config.DB) (*Repository, error) {
+	pool, err := newPool(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	cfg.MaxConns = 4
-	cfg.AcquireTimeout = 5 * time.Second
-	cfg.MaxConnIdleTime = 5 * time.Minute
-	cfg.MaxConnLifetime = time.Hour
-	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	return &Repository{pool: pool, Logger: slog.Default()}, nil
+}
+
+func newPool(ctx context.Context, cfg config.DB) (*pgxpool.Pool, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("database DSN is not set")
+	}
+	pc, err := pgxpool.ParseConfig(string(cfg.DSN))
 	if err != nil {
 		return nil, err
 	}
-	return &Repository{pool: pool, Logger: slog.Default()}, nil
+	pc.MaxConns = int32(cfg.MaxConns)
+	pc.AcquireTimeout = cfg.AcquireTimeout
+	pc.MaxConnIdleTime = cfg.MaxConnIdleTime
+	pc.MaxConnLifetime = cfg.MaxConnLifetime
+	return pgxpool.NewWithConfig(ctx, pc)
+}
+
+// Reconnect replaces the pool with one configured by cfg, e.g. after the
+// database credentials were rotated. Queries already running finish on the
+// old pool, which is closed once they have.
+func (r *Repository) Reconnect(ctx context.Context, cfg config.DB) error {
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("reconnect: %w", err)
+	}
+	r.poolMu.Lock()
+	old := r.pool
+	r.pool = pool
+	r.poolMu.Unlock()
+	go old.Close()
+	return nil
+}
+
+// conn returns the current pool.
+func (r *Repository) conn() *pgxpool.Pool {
+	r.poolMu.RLock()
+	defer r.poolMu.RUnlock()
+	return r.pool
 }
 
 // WithLogger allows setting a custom logger when creating a repository.
@@ -44,7 +73,18 @@ func WithLogger(l *slog.Logger) func(*Repository) {
 
 // Close closes underlying pool.
 func (r *Repository) Close() {
-	r.pool.Close()
+	r.conn().Close()
+}
+
+// Ping checks that a connection can be acquired and used, for readiness
+// checks.
+func (r *Repository) Ping(ctx context.Context) (err error) {
+	done := observeQuery(ctx, "ping")
+	defer func() { done(err) }()
+	if _, err := r.conn().Exec(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
 }
 
 // Result represents a saved bot result.
@@ -55,49 +95,86 @@ type Result struct {
 	CreatedAt time.Time
 }
 
-// SaveResult inserts bot result and returns its ID.
-func (r *Repository) SaveResult(ctx context.Context, chatID int64, data string) (int64, error) {
+// ResultMeta describes how a result was produced.
+type ResultMeta struct {
+	// PromptVersion is the template version the prompt was rendered with.
+	PromptVersion string
+	// Category is the legal domain the question was classified into.
+	Category string
+	// ParseOK reports whether the model output decoded as the requested JSON.
+	ParseOK bool
+}
+
+// SaveResult inserts the result of a user's question asked in a chat and
+// returns its ID.
+func (r *Repository) SaveResult(ctx context.Context, chatID, userID int64, data string, meta ResultMeta) (_ int64, err error) {
+	done := observeQuery(ctx, "save_result")
+	defer func() { done(err) }()
 	var id int64
-	err := r.pool.QueryRow(ctx, `INSERT INTO bot_results (chat_id, data) VALUES ($1, $2) RETURNING id`, chatID, data).Scan(&id)
+	err = r.conn().QueryRow(ctx, `INSERT INTO bot_results (chat_id, data, user_id, prompt_version, parse_ok, category) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		chatID, data, userID, meta.PromptVersion, meta.ParseOK, meta.Category).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("save result: %w", err)
 	}
 	if r.Logger != nil {
-		r.Logger.Info("result saved", "chat_id", chatID)
+		r.Logger.InfoContext(ctx, "result saved", "chat_id", chatID, "user_id", userID, "prompt_version", meta.PromptVersion, "category", meta.Category)
 	}
 	return id, nil
 }
 
+// RateResult stores a 1–5 user rating for a result owned by the chat.
+func (r *Repository) RateResult(ctx context.Context, id, chatID int64, rating int) (err error) {
+	done := observeQuery(ctx, "rate_result")
+	defer func() { done(err) }()
+	if rating < 1 || rating > 5 {
+		return fmt.Errorf("rate result: rating %d out of range", rating)
+	}
+	_, err = r.conn().Exec(ctx, `UPDATE bot_results SET rating=$3 WHERE id=$1 AND chat_id=$2`, id, chatID, rating)
+	if err != nil {
+		return fmt.Errorf("rate result: %w", err)
+	}
+	if r.Logger != nil {
+		r.Logger.InfoContext(ctx, "result rated", "id", id, "rating", rating)
+	}
+	return nil
+}
+
 // GetResult retrieves result by ID.
-func (r *Repository) GetResult(ctx context.Context, id int64) (*Result, error) {
+func (r *Repository) GetResult(ctx context.Context, id int64) (_ *Result, err error) {
+	done := observeQuery(ctx, "get_result")
+	defer func() { done(err) }()
 	var res Result
-	err := r.pool.QueryRow(ctx, `SELECT id, chat_id, data, created_at FROM bot_results WHERE id=$1`, id).Scan(
+	err = r.conn().QueryRow(ctx, `SELECT id, chat_id, data, created_at FROM bot_results WHERE id=$1`, id).Scan(
 		&res.ID, &res.ChatID, &res.Data, &res.CreatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get result: %w", err)
 	}
 	if r.Logger != nil {
-		r.Logger.Info("result retrieved", "chat_id", res.ChatID)
+		r.Logger.InfoContext(ctx, "result retrieved", "chat_id", res.ChatID)
 	}
 	return &res, nil
 }
 
 // DeleteResult removes a result and returns an error if any.
-func (r *Repository) DeleteResult(ctx context.Context, id int64) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM bot_results WHERE id=$1`, id)
+func (r *Repository) DeleteResult(ctx context.Context, id int64) (err error) {
+	done := observeQuery(ctx, "delete_result")
+	defer func() { done(err) }()
+	_, err = r.conn().Exec(ctx, `DELETE FROM bot_results WHERE id=$1`, id)
 	if err != nil {
 		return fmt.Errorf("delete result: %w", err)
 	}
 	if r.Logger != nil {
-		r.Logger.Info("result deleted", "id", id)
+		r.Logger.InfoContext(ctx, "result deleted", "id", id)
 	}
 	return nil
 }
 
 // RecentResults returns last N results for a chat ordered from newest to oldest.
-func (r *Repository) RecentResults(ctx context.Context, chatID int64, limit int) ([]Result, error) {
-	rows, err := r.pool.Query(ctx, `SELECT id, chat_id, data, created_at FROM bot_results WHERE chat_id=$1 ORDER BY created_at DESC LIMIT $2`, chatID, limit)
+func (r *Repository) RecentResults(ctx context.Context, chatID int64, limit int) (_ []Result, err error) {
+	done := observeQuery(ctx, "recent_results")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT id, chat_id, data, created_at FROM bot_results WHERE chat_id=$1 ORDER BY created_at DESC LIMIT $2`, chatID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("recent results: %w", err)
 	}
@@ -114,19 +191,33 @@ func (r *Repository) RecentResults(ctx context.Context, chatID int64, limit int)
 		return nil, fmt.Errorf("rows: %w", err)
 	}
 	if r.Logger != nil {
-		r.Logger.Info("recent results fetched", "chat_id", chatID, "count", len(res))
+		r.Logger.InfoContext(ctx, "recent results fetched", "chat_id", chatID, "count", len(res))
 	}
 	return res, nil
 }
 
-// DeleteHistory removes all results for a chat.
-func (r *Repository) DeleteHistory(ctx context.Context, chatID int64) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM bot_results WHERE chat_id=$1`, chatID)
+// DeleteHistory removes all results and claims of a user, in their private
+// chat and in every group. A private chat's ID is its user's ID. Both are
+// deleted in one transaction so a failure cannot leave half the history.
+func (r *Repository) DeleteHistory(ctx context.Context, userID int64) (err error) {
+	done := observeQuery(ctx, "delete_history")
+	defer func() { done(err) }()
+	tx, err := r.conn().Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("delete history: begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM claims WHERE user_id=$1 OR chat_id=$1`, userID); err != nil {
+		return fmt.Errorf("delete claims: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM bot_results WHERE user_id=$1 OR chat_id=$1`, userID); err != nil {
 		return fmt.Errorf("delete history: %w", err)
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("delete history: commit: %w", err)
+	}
 	if r.Logger != nil {
-		r.Logger.Info("chat history deleted", "chat_id", chatID)
+		r.Logger.InfoContext(ctx, "user history deleted", "user_id", userID)
 	}
 	return nil
 }
@@ -2,16 +2,22 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
+	"net/http"
+	"net/http/httptest"
 	"os/exec"
+	"sync"
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"legalbot/internal/config"
+	"legalbot/internal/tracing"
 )
 
 func TestRepository_SaveAndGet(t *testing.T) {
@@ -42,9 +48,10 @@ func TestRepository_SaveAndGet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	os.Setenv("POSTGRES_DSN", fmt.Sprintf("postgres://postgres:pass@%s:%s/postgres?sslmode=disable", host, port.Port()))
+	cfg := config.Default().DB
+	cfg.DSN = config.Secret(fmt.Sprintf("postgres://postgres:pass@%s:%s/postgres?sslmode=disable", host, port.Port()))
 
-	repo, err := New(ctx)
+	repo, err := New(ctx, cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -54,7 +61,7 @@ func TestRepository_SaveAndGet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := repo.SaveResult(ctx, 123, "hi")
+	id, err := repo.SaveResult(ctx, 123, 123, "hi", ResultMeta{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,7 +77,7 @@ func TestRepository_SaveAndGet(t *testing.T) {
 func TestRepository_SaveAndGet_Memory(t *testing.T) {
 	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
 	repo := &Repository{pool: pool}
-	id, err := repo.SaveResult(context.Background(), 1, "data")
+	id, err := repo.SaveResult(context.Background(), 1, 1, "data", ResultMeta{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,9 +118,10 @@ func TestRepository_Delete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	os.Setenv("POSTGRES_DSN", fmt.Sprintf("postgres://postgres:pass@%s:%s/postgres?sslmode=disable", host, port.Port()))
+	cfg := config.Default().DB
+	cfg.DSN = config.Secret(fmt.Sprintf("postgres://postgres:pass@%s:%s/postgres?sslmode=disable", host, port.Port()))
 
-	repo, err := New(ctx)
+	repo, err := New(ctx, cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -123,7 +131,7 @@ func TestRepository_Delete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := repo.SaveResult(ctx, 1, "foo")
+	id, err := repo.SaveResult(ctx, 1, 1, "foo", ResultMeta{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -138,7 +146,7 @@ func TestRepository_Delete(t *testing.T) {
 func TestRepository_Delete_Memory(t *testing.T) {
 	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
 	repo := &Repository{pool: pool}
-	id, err := repo.SaveResult(context.Background(), 2, "foo")
+	id, err := repo.SaveResult(context.Background(), 2, 2, "foo", ResultMeta{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -154,7 +162,7 @@ func TestRepository_RecentResults_Memory(t *testing.T) {
 	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
 	repo := &Repository{pool: pool}
 	for i := 0; i < 3; i++ {
-		if _, err := repo.SaveResult(context.Background(), 5, fmt.Sprintf("r%v", i)); err != nil {
+		if _, err := repo.SaveResult(context.Background(), 5, 5, fmt.Sprintf("r%v", i), ResultMeta{}); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -173,7 +181,7 @@ func TestRepository_RecentResults_Memory(t *testing.T) {
 func TestRepository_DeleteHistory_Memory(t *testing.T) {
 	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
 	repo := &Repository{pool: pool}
-	if _, err := repo.SaveResult(context.Background(), 7, "x"); err != nil {
+	if _, err := repo.SaveResult(context.Background(), 7, 7, "x", ResultMeta{}); err != nil {
 		t.Fatal(err)
 	}
 	if err := repo.DeleteHistory(context.Background(), 7); err != nil {
@@ -188,6 +196,71 @@ func TestRepository_DeleteHistory_Memory(t *testing.T) {
 	}
 }
 
+func TestRepository_QueryDuration_Memory(t *testing.T) {
+	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
+	repo := &Repository{pool: pool}
+	before := queryDuration.Count("save_result")
+	if _, err := repo.SaveResult(context.Background(), 9, 9, "x", ResultMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryDuration.Count("save_result"); got != before+1 {
+		t.Fatalf("observations = %d, want %d", got, before+1)
+	}
+}
+
+func TestRepository_QuerySpanRecordsError_Memory(t *testing.T) {
+	type exportedSpan struct {
+		Name   string `json:"name"`
+		Status struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	var mu sync.Mutex
+	status := map[string]int{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					status[s.Name] = s.Status.Code
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+	tracer := tracing.New(collector.URL, "db")
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(nil)
+
+	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
+	repo := &Repository{pool: pool}
+	if _, err := repo.SaveResult(context.Background(), 9, 9, "x", ResultMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetResult(context.Background(), 12345); err == nil {
+		t.Fatal("expected error for missing result")
+	}
+	tracer.Shutdown(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if code, ok := status["db.save_result"]; !ok || code != 0 {
+		t.Errorf("db.save_result status = %d (exported %v), want unset", code, ok)
+	}
+	if code := status["db.get_result"]; code != 2 {
+		t.Errorf("db.get_result status = %d, want error", code)
+	}
+}
+
 func TestRepository_WithLogger(t *testing.T) {
 	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
 	repo := &Repository{pool: pool}
@@ -200,8 +273,33 @@ func TestRepository_WithLogger(t *testing.T) {
 }
 
 func TestRepository_New_Error(t *testing.T) {
-	os.Unsetenv("POSTGRES_DSN")
-	if _, err := New(context.Background()); err == nil {
+	if _, err := New(context.Background(), config.Default().DB); err == nil {
 		t.Fatal("expected error")
 	}
 }
+
+func TestRepository_Reconnect_Memory(t *testing.T) {
+	cfg := config.Default().DB
+	cfg.DSN = "postgres://bot:old@db/legalbot"
+	repo, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := repo.conn()
+	if err := repo.Reconnect(context.Background(), config.Default().DB); err == nil {
+		t.Fatal("reconnected without a DSN")
+	}
+	if repo.conn() != old {
+		t.Fatal("failed reconnect replaced the pool")
+	}
+	cfg.DSN = "postgres://bot:new@db/legalbot"
+	if err := repo.Reconnect(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if repo.conn() == old {
+		t.Fatal("pool not replaced")
+	}
+	if _, err := repo.SaveResult(context.Background(), 1, 1, "x", ResultMeta{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// VersionStats aggregates results produced by one prompt template version.
+type VersionStats struct {
+	Version       string
+	Results       int64
+	Rated         int64
+	AvgRating     float64
+	ParseFailures int64
+}
+
+// ParseFailureRate returns the share of results whose output was not valid JSON.
+func (s VersionStats) ParseFailureRate() float64 {
+	if s.Results == 0 {
+		return 0
+	}
+	return float64(s.ParseFailures) / float64(s.Results)
+}
+
+// PromptVersionReport compares user ratings and JSON parse failures across
+// prompt template versions.
+func (r *Repository) PromptVersionReport(ctx context.Context) (_ []VersionStats, err error) {
+	done := observeQuery(ctx, "prompt_version_report")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `SELECT prompt_version, count(*), count(rating), coalesce(avg(rating), 0)::float8, count(*) FILTER (WHERE parse_ok = false)
+FROM bot_results GROUP BY prompt_version ORDER BY prompt_version`)
+	if err != nil {
+		return nil, fmt.Errorf("prompt version report: %w", err)
+	}
+	defer rows.Close()
+	var res []VersionStats
+	for rows.Next() {
+		var s VersionStats
+		if err := rows.Scan(&s.Version, &s.Results, &s.Rated, &s.AvgRating, &s.ParseFailures); err != nil {
+			return nil, fmt.Errorf("scan version stats: %w", err)
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return res, nil
+}
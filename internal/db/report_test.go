@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	tc "github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"legalbot/internal/config"
+)
+
+// newPostgresRepo starts a Postgres container, applies migrations and returns
+// a repository connected to it. The test is skipped when docker is missing.
+func newPostgresRepo(t *testing.T) *Repository {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker not installed")
+	}
+	ctx := context.Background()
+	container, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
+		ContainerRequest: tc.ContainerRequest{
+			Image:        "postgres:16",
+			Env:          map[string]string{"POSTGRES_PASSWORD": "pass"},
+			ExposedPorts: []string{"5432/tcp"},
+			WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { container.Terminate(ctx) })
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().DB
+	cfg.DSN = config.Secret(fmt.Sprintf("postgres://postgres:pass@%s:%s/postgres?sslmode=disable", host, port.Port()))
+
+	repo, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(repo.Close)
+	if err := repo.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestRepository_PromptVersionReport(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	id1, err := repo.SaveResult(ctx, 1, 1, "a", ResultMeta{PromptVersion: "golden-v1", ParseOK: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveResult(ctx, 2, 2, "b", ResultMeta{PromptVersion: "golden-v1", ParseOK: false}); err != nil {
+		t.Fatal(err)
+	}
+	id3, err := repo.SaveResult(ctx, 3, 3, "c", ResultMeta{PromptVersion: "golden-v2", ParseOK: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RateResult(ctx, id1, 1, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RateResult(ctx, id3, 3, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.PromptVersionReport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 versions, got %+v", stats)
+	}
+	v1 := stats[0]
+	if v1.Version != "golden-v1" || v1.Results != 2 || v1.Rated != 1 || v1.AvgRating != 4 || v1.ParseFailures != 1 {
+		t.Fatalf("unexpected stats %+v", v1)
+	}
+	if v1.ParseFailureRate() != 0.5 {
+		t.Fatalf("unexpected failure rate %v", v1.ParseFailureRate())
+	}
+}
+
+func TestRepository_RateResult_OutOfRange(t *testing.T) {
+	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
+	repo := &Repository{pool: pool}
+	if err := repo.RateResult(context.Background(), 1, 1, 6); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRepository_Migrate_Memory(t *testing.T) {
+	pool, _ := pgxpool.NewWithConfig(context.Background(), &pgxpool.Config{})
+	repo := &Repository{pool: pool}
+	if err := repo.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersionStats_ParseFailureRateEmpty(t *testing.T) {
+	if r := (VersionStats{}).ParseFailureRate(); r != 0 {
+		t.Fatalf("expected 0, got %v", r)
+	}
+}
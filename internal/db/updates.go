@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MarkUpdate records a Telegram update_id as processed. It reports false if
+// the update was recorded before, i.e. Telegram redelivered it.
+func (r *Repository) MarkUpdate(ctx context.Context, updateID int64) (_ bool, err error) {
+	done := observeQuery(ctx, "mark_update")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `INSERT INTO processed_updates (update_id) VALUES ($1)
+ON CONFLICT (update_id) DO NOTHING RETURNING update_id`, updateID)
+	if err != nil {
+		return false, fmt.Errorf("mark update: %w", err)
+	}
+	defer rows.Close()
+	first := rows.Next()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("mark update: %w", err)
+	}
+	return first, nil
+}
+
+// PruneUpdates forgets update_ids processed more than ttl ago and returns how
+// many were removed. Telegram gives up redelivering after 24 hours.
+func (r *Repository) PruneUpdates(ctx context.Context, ttl time.Duration) (_ int64, err error) {
+	done := observeQuery(ctx, "prune_updates")
+	defer func() { done(err) }()
+	rows, err := r.conn().Query(ctx, `WITH pruned AS (
+    DELETE FROM processed_updates WHERE processed_at < $1 RETURNING 1
+)
+SELECT count(*) FROM pruned`, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("prune updates: %w", err)
+	}
+	defer rows.Close()
+	var n int64
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, fmt.Errorf("scan pruned updates: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows: %w", err)
+	}
+	if r.Logger != nil && n > 0 {
+		r.Logger.InfoContext(ctx, "processed updates pruned", "count", n)
+	}
+	return n, nil
+}
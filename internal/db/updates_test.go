@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRepository_MarkUpdate(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	first, err := repo.MarkUpdate(ctx, 1001)
+	if err != nil || !first {
+		t.Fatalf("first delivery: %v %v", first, err)
+	}
+	first, err = repo.MarkUpdate(ctx, 1001)
+	if err != nil || first {
+		t.Fatalf("redelivery: %v %v", first, err)
+	}
+
+	// Concurrent redeliveries are recorded exactly once.
+	var wg sync.WaitGroup
+	var firsts atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := repo.MarkUpdate(ctx, 1002); err == nil && ok {
+				firsts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if firsts.Load() != 1 {
+		t.Fatalf("update marked first %d times", firsts.Load())
+	}
+}
+
+func TestRepository_PruneUpdates(t *testing.T) {
+	repo := newPostgresRepo(t)
+	ctx := context.Background()
+
+	for _, id := range []int64{1, 2} {
+		if _, err := repo.MarkUpdate(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.pool.Exec(ctx, `UPDATE processed_updates SET processed_at = now() - interval '3 days' WHERE update_id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	n, err := repo.PruneUpdates(ctx, 48*time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("pruned %d: %v", n, err)
+	}
+	if first, _ := repo.MarkUpdate(ctx, 1); !first {
+		t.Fatal("pruned update should be accepted again")
+	}
+	if first, _ := repo.MarkUpdate(ctx, 2); first {
+		t.Fatal("recent update should still be known")
+	}
+}
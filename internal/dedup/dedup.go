@@ -0,0 +1,78 @@
+// Package dedup filters out Telegram updates that were already received.
+//
+// Telegram redelivers a webhook update when the bot answers slowly or with
+// an error. A Filter remembers recent update_ids in memory and records every
+// new one in a Store shared by all replicas, so a redelivered update is
+// recognised even after a restart.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Store durably records update_ids, e.g. *db.Repository.
+type Store interface {
+	// MarkUpdate records updateID and reports whether it was new.
+	MarkUpdate(ctx context.Context, updateID int64) (bool, error)
+}
+
+// Filter decides whether an update is seen for the first time.
+type Filter struct {
+	store Store
+
+	mu    sync.Mutex
+	size  int
+	order *list.List // most recent update_id at the front
+	items map[int64]*list.Element
+}
+
+// New returns a filter remembering up to size update_ids in memory in front
+// of store. A nil store keeps only the in-memory window.
+func New(store Store, size int) *Filter {
+	return &Filter{store: store, size: size, order: list.New(), items: map[int64]*list.Element{}}
+}
+
+// First reports whether updateID has not been seen before. If the store
+// fails the in-memory answer is returned together with the error, so the
+// caller may choose to process the update rather than drop it.
+func (f *Filter) First(ctx context.Context, updateID int64) (bool, error) {
+	if !f.remember(updateID) {
+		return false, nil
+	}
+	if f.store == nil {
+		return true, nil
+	}
+	first, err := f.store.MarkUpdate(ctx, updateID)
+	if err != nil {
+		return true, err
+	}
+	return first, nil
+}
+
+// remember adds updateID to the in-memory window and reports whether it was
+// missing. The id is added before the store is asked, so a redelivery
+// arriving while the first delivery is still being recorded is caught too.
+func (f *Filter) remember(updateID int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e, ok := f.items[updateID]; ok {
+		f.order.MoveToFront(e)
+		return false
+	}
+	f.items[updateID] = f.order.PushFront(updateID)
+	if f.order.Len() > f.size {
+		oldest := f.order.Back()
+		f.order.Remove(oldest)
+		delete(f.items, oldest.Value.(int64))
+	}
+	return true
+}
+
+// Len returns the number of update_ids held in memory.
+func (f *Filter) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.order.Len()
+}
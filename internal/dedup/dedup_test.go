@@ -0,0 +1,101 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type fakeStore struct {
+	mu    sync.Mutex
+	seen  map[int64]bool
+	calls int
+	err   error
+}
+
+func (s *fakeStore) MarkUpdate(ctx context.Context, updateID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return false, s.err
+	}
+	if s.seen[updateID] {
+		return false, nil
+	}
+	s.seen[updateID] = true
+	return true, nil
+}
+
+func TestFilterFirst(t *testing.T) {
+	store := &fakeStore{seen: map[int64]bool{}}
+	f := New(store, 10)
+	ctx := context.Background()
+	if ok, err := f.First(ctx, 1); !ok || err != nil {
+		t.Fatalf("first delivery: %v %v", ok, err)
+	}
+	if ok, _ := f.First(ctx, 1); ok {
+		t.Fatal("redelivery accepted")
+	}
+	if store.calls != 1 {
+		t.Fatalf("redelivery should be answered from memory, store called %d times", store.calls)
+	}
+}
+
+func TestFilterStoreSurvivesRestart(t *testing.T) {
+	store := &fakeStore{seen: map[int64]bool{}}
+	ctx := context.Background()
+	New(store, 10).First(ctx, 5)
+	// A new process starts with an empty memory window.
+	if ok, _ := New(store, 10).First(ctx, 5); ok {
+		t.Fatal("update recorded before the restart was accepted")
+	}
+}
+
+func TestFilterEviction(t *testing.T) {
+	f := New(nil, 2)
+	ctx := context.Background()
+	for _, id := range []int64{1, 2, 1, 3} {
+		f.First(ctx, id)
+	}
+	// 1 was refreshed by its redelivery, so 2 is the oldest and evicted.
+	if f.Len() != 2 {
+		t.Fatalf("unexpected size %d", f.Len())
+	}
+	if ok, _ := f.First(ctx, 1); ok {
+		t.Fatal("recent update evicted")
+	}
+	if ok, _ := f.First(ctx, 2); !ok {
+		t.Fatal("oldest update should have been evicted")
+	}
+}
+
+func TestFilterStoreError(t *testing.T) {
+	boom := errors.New("db down")
+	f := New(&fakeStore{err: boom}, 10)
+	ok, err := f.First(context.Background(), 1)
+	if !errors.Is(err, boom) || !ok {
+		t.Fatalf("expected in-memory answer with error, got %v %v", ok, err)
+	}
+}
+
+func TestFilterConcurrent(t *testing.T) {
+	f := New(&fakeStore{seen: map[int64]bool{}}, 100)
+	var firsts atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := f.First(context.Background(), 42); ok {
+				firsts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if firsts.Load() != 1 {
+		t.Fatalf("update accepted %d times", firsts.Load())
+	}
+}
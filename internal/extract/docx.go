@@ -0,0 +1,99 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	docxBody = "word/document.xml"
+	wordNS   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	// maxDocxXML bounds the uncompressed document body to defuse zip bombs.
+	maxDocxXML = 32 << 20
+)
+
+func isDOCX(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == docxBody {
+			return true
+		}
+	}
+	return false
+}
+
+// docxText returns the paragraphs of the main document part. Headers,
+// footers and comments are skipped.
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	var body *zip.File
+	for _, f := range zr.File {
+		if f.Name == docxBody {
+			body = f
+		}
+	}
+	if body == nil {
+		return "", fmt.Errorf("docx: %s missing", docxBody)
+	}
+	if body.UncompressedSize64 > maxDocxXML {
+		return "", fmt.Errorf("docx: %s is %d bytes", docxBody, body.UncompressedSize64)
+	}
+	rc, err := body.Open()
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	defer rc.Close()
+
+	var b strings.Builder
+	dec := xml.NewDecoder(io.LimitReader(rc, maxDocxXML))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,117 @@
+// Package extract pulls plain text out of files users attach to a claim.
+//
+// Only formats that can be read with the standard library are supported:
+// PDF (text layer only, no OCR), DOCX and plain text in UTF-8 or
+// Windows-1251. The file type is detected from the contents rather than
+// trusted from the client.
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Detected content types.
+const (
+	PDF  = "application/pdf"
+	DOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	TXT  = "text/plain"
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+)
+
+// ErrUnsupported is returned for content text cannot be extracted from.
+var ErrUnsupported = errors.New("extract: unsupported file type")
+
+// ErrNoText is returned when a supported file contains no readable text,
+// e.g. a scanned PDF without a text layer.
+var ErrNoText = errors.New("extract: no text found")
+
+// Detect returns the content type of data, one of the constants above, or
+// "application/octet-stream" for anything else.
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return PDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		if isDOCX(data) {
+			return DOCX
+		}
+	case isText(data):
+		return TXT
+	}
+	switch ct := http.DetectContentType(data); ct {
+	case JPEG, PNG:
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Text extracts the text of data, whose type is detected with Detect.
+// Whitespace is normalised: runs of blanks collapse to one space and at most
+// one empty line separates paragraphs.
+func Text(data []byte) (string, error) {
+	var (
+		text string
+		err  error
+	)
+	switch ct := Detect(data); ct {
+	case PDF:
+		text, err = pdfText(data)
+	case DOCX:
+		text, err = docxText(data)
+	case TXT:
+		text = plainText(data)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, ct)
+	}
+	if err != nil {
+		return "", err
+	}
+	text = normalize(text)
+	if text == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+// isText reports whether data looks like text: no NUL bytes or control
+// characters other than whitespace in its first kilobytes.
+func isText(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	head := data[:min(len(data), 4096)]
+	for _, b := range head {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+func normalize(s string) string {
+	var b strings.Builder
+	blank := 0
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+		if line == "" {
+			blank++
+			continue
+		}
+		if b.Len() > 0 {
+			if blank > 0 {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteByte('\n')
+			}
+		}
+		blank = 0
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF assembles a PDF from numbered object bodies. The xref table is
+// omitted: the extractor does not need it.
+func buildPDF(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, o := range objs {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(s string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func buildDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestPDFSimple(t *testing.T) {
+	content := "BT /F1 12 Tf 72 720 Td (Contract No. 5) Tj 0 -14 Td [(Seller)-250(agrees)] TJ " +
+		"0 -14 Td (to \\(re\\)pay) Tj ET"
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 4 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		stream("", content),
+	)
+	got, err := Text(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Contract No. 5\nSeller agrees\nto (re)pay"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPDFCompressedCyrillic(t *testing.T) {
+	// Codes 1-3 map to "Дог" through an array, 4 to "о" and 5 to "вор" in
+	// one entry, 6-7 to "аб" by range.
+	cmap := `/CIDInit /ProcSet findresource begin 12 dict begin begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0004> <043E> <0005> <0432043E0440> endbfchar
+2 beginbfrange <0001> <0003> [<0414> <043E> <0433>] <0006> <0007> <0430> endbfrange
+endcmap CMapName currentdict /CMap defineresource pop end end`
+	font := "<< /Type /Font /Subtype /Type0 /ToUnicode 8 0 R >> "
+	header := fmt.Sprintf("6 0 7 %d ", len(font))
+	objStm := header + font + "<< /Font << /C0 6 0 R >> >>"
+	first := len(header)
+	content := "BT /C0 11 Tf 1 0 0 1 50 700 Tm <0001> Tj <0002000300040005> Tj ET\n" +
+		"BT /C0 11 Tf 1 0 0 1 50 680 Tm [<0001>-300<0004>] TJ (\\000\\006\\000\\007) Tj ET"
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources 7 0 R /Contents [4 0 R 5 0 R] >>",
+		stream("/Filter /FlateDecode", deflate(content[:strings.Index(content, "\n")])),
+		stream("/Filter [/FlateDecode]", deflate(content[strings.Index(content, "\n")+1:])),
+		"null",
+		"null",
+		stream("/Filter /FlateDecode", deflate(cmap)),
+		stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", first), deflate(objStm)),
+	)
+	// Objects 6 and 7 are only defined inside the object stream.
+	pdf = bytes.Replace(pdf, []byte("6 0 obj\nnull\nendobj\n"), nil, 1)
+	pdf = bytes.Replace(pdf, []byte("7 0 obj\nnull\nendobj\n"), nil, 1)
+
+	got, err := Text(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Договор\nД оаб"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPDFWithoutText(t *testing.T) {
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		stream("", "q 595 0 0 842 0 0 cm /Im0 Do Q BI /W 1 /H 1 /BPC 8 /CS /G ID \x00(\xff EI Q"),
+	)
+	if _, err := Text(pdf); !errors.Is(err, ErrNoText) {
+		t.Fatalf("expected ErrNoText, got %v", err)
+	}
+}
+
+func TestDOCX(t *testing.T) {
+	doc := buildDOCX(t, `<w:p><w:r><w:t>Договор</w:t></w:r><w:r><w:t xml:space="preserve"> купли-продажи</w:t></w:r></w:p>`+
+		`<w:p/><w:p><w:r><w:t>Цена:</w:t><w:tab/><w:t>1000 ₽</w:t><w:br/><w:t>Срок: 10 дней</w:t></w:r></w:p>`)
+	if ct := Detect(doc); ct != DOCX {
+		t.Fatalf("detected %q", ct)
+	}
+	got, err := Text(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Договор купли-продажи\n\nЦена: 1000 ₽\nСрок: 10 дней"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	cases := map[string][]byte{
+		"utf-8": []byte("\xef\xbb\xbfЧек №15\r\nИтого:   500 руб.\r\n"),
+		// "Чек №15\nИтого: 500 руб." in Windows-1251.
+		"cp1251": []byte("\xd7\xe5\xea \xb915\n\xc8\xf2\xee\xe3\xee: 500 \xf0\xf3\xe1."),
+	}
+	for name, data := range cases {
+		got, err := Text(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := "Чек №15\nИтого: 500 руб."; got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	var zipOnly bytes.Buffer
+	zw := zip.NewWriter(&zipOnly)
+	zw.Create("a.txt")
+	zw.Close()
+	cases := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("%PDF-1.4\n"), PDF},
+		{[]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), JPEG},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), PNG},
+		{[]byte("hello"), TXT},
+		{zipOnly.Bytes(), "application/octet-stream"},
+		{[]byte("MZ\x90\x00\x03"), "application/octet-stream"},
+		{nil, "application/octet-stream"},
+	}
+	for _, c := range cases {
+		if got := Detect(c.data); got != c.want {
+			t.Errorf("Detect(%q) = %q, want %q", c.data, got, c.want)
+		}
+	}
+	if _, err := Text([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for images, got %v", err)
+	}
+}
+
+func FuzzText(f *testing.F) {
+	f.Add(buildPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [3 0 R] >>",
+		"<< /Type /Page /Contents 4 0 R >>", stream("", "BT (a) Tj [(b) -300 <0063>] TJ ET")))
+	f.Add([]byte("%PDF-1.5\n1 0 obj << /Type /ObjStm /N 1 /First 4 >> stream\n2 0 << >>\nendstream endobj"))
+	f.Add([]byte("%PDF-1.1\n1 0 obj << /Length 99999 >> stream\n(((\\"))
+	f.Add([]byte("PK\x03\x04"))
+	f.Add([]byte("text \xd7\xe5\xea"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Text(data)
+	})
+}
@@ -0,0 +1,855 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxInflated bounds the decompressed size of all streams of one PDF.
+const maxInflated = 16 << 20
+
+var (
+	pdfObjRe  = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfRootRe = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfRefRe  = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfPageRe = regexp.MustCompile(`/Type\s*/Page\b`)
+	// A reference at the start of a value, e.g. "/Contents 4 0 R".
+	pdfLeadingRefRe = regexp.MustCompile(`^\d+\s+\d+\s+R`)
+	// A direct stream length; indirect ones ("/Length 5 0 R") are not used.
+	pdfLengthRe = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfFontRe   = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+)
+
+// pdfObj is an indirect object: its dictionary or value as raw text and the
+// still encoded stream data, if any.
+type pdfObj struct {
+	dict   string
+	stream []byte
+}
+
+type pdfDoc struct {
+	objs     map[int]*pdfObj
+	cmaps    map[int]*cmap
+	inflated int
+}
+
+// pdfFont decodes the strings shown with one font.
+type pdfFont struct {
+	cmap *cmap
+	// cid fonts use multi-byte codes that are meaningless without a cmap.
+	cid bool
+}
+
+// pdfText extracts the text layer of a PDF page by page. It understands
+// uncompressed and Flate streams, object streams and ToUnicode maps, which
+// covers documents exported by office suites. Scanned pages have no text.
+func pdfText(data []byte) (string, error) {
+	doc := &pdfDoc{objs: map[int]*pdfObj{}, cmaps: map[int]*cmap{}}
+	doc.parse(data)
+	if len(doc.objs) == 0 {
+		return "", fmt.Errorf("pdf: no objects found")
+	}
+	var pages []string
+	for _, p := range doc.pages(data) {
+		fonts := doc.fonts(p)
+		var content []byte
+		for _, n := range doc.refs(doc.value(doc.objs[p].dict, "Contents")) {
+			content = append(content, doc.streamData(n)...)
+			content = append(content, '\n')
+		}
+		pages = append(pages, showText(content, fonts))
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// parse collects all objects. Later definitions replace earlier ones, as
+// incremental updates append new versions at the end of the file.
+func (d *pdfDoc) parse(data []byte) {
+	pos := 0
+	for pos < len(data) {
+		loc := pdfObjRe.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[1]
+		obj, end := parseObject(data, start)
+		d.objs[num] = obj
+		pos = end
+	}
+	// Objects compressed into object streams, PDF 1.5 and later.
+	for _, n := range sortedKeys(d.objs) {
+		o := d.objs[n]
+		if o.stream == nil || !strings.Contains(o.dict, "/ObjStm") {
+			continue
+		}
+		d.parseObjStm(o)
+	}
+}
+
+// parseObject reads the object body starting at start and returns it with
+// the offset after it.
+func parseObject(data []byte, start int) (*pdfObj, int) {
+	end := bytes.Index(data[start:], []byte("endobj"))
+	if end < 0 {
+		end = len(data) - start
+	}
+	body := data[start : start+end]
+	s := bytes.Index(body, []byte("stream"))
+	if s < 0 || bytes.HasSuffix(body[:s], []byte("end")) {
+		return &pdfObj{dict: string(body)}, start + end + len("endobj")
+	}
+	obj := &pdfObj{dict: string(body[:s])}
+	ds := start + s + len("stream")
+	if bytes.HasPrefix(data[ds:], []byte("\r\n")) {
+		ds += 2
+	} else if ds < len(data) && (data[ds] == '\n' || data[ds] == '\r') {
+		ds++
+	}
+	// The stream may contain "endobj", so its end is found from /Length or
+	// the endstream keyword rather than the search above.
+	de := -1
+	if m := pdfLengthRe.FindStringSubmatch(obj.dict); m != nil && m[2] == "" {
+		if n, err := strconv.Atoi(m[1]); err == nil && ds+n <= len(data) &&
+			bytes.HasPrefix(bytes.TrimLeft(data[ds+n:], " \r\n"), []byte("endstream")) {
+			de = ds + n
+		}
+	}
+	if de < 0 {
+		i := bytes.Index(data[ds:], []byte("endstream"))
+		if i < 0 {
+			return obj, len(data)
+		}
+		de = ds + i
+	}
+	obj.stream = data[ds:de]
+	next := de
+	if i := bytes.Index(data[de:], []byte("endobj")); i >= 0 {
+		next = de + i + len("endobj")
+	}
+	return obj, next
+}
+
+func (d *pdfDoc) parseObjStm(o *pdfObj) {
+	data := d.decode(o)
+	n, _ := strconv.Atoi(d.value(o.dict, "N"))
+	first, _ := strconv.Atoi(d.value(o.dict, "First"))
+	if first <= 0 || first > len(data) {
+		return
+	}
+	header := strings.Fields(string(data[:first]))
+	type entry struct{ num, off int }
+	var entries []entry
+	for i := 0; i+1 < len(header) && len(entries) < n; i += 2 {
+		num, err1 := strconv.Atoi(header[i])
+		off, err2 := strconv.Atoi(header[i+1])
+		if err1 != nil || err2 != nil || first+off > len(data) {
+			return
+		}
+		entries = append(entries, entry{num, first + off})
+	}
+	for i, e := range entries {
+		end := len(data)
+		if i+1 < len(entries) && entries[i+1].off >= e.off {
+			end = entries[i+1].off
+		}
+		if _, ok := d.objs[e.num]; !ok {
+			d.objs[e.num] = &pdfObj{dict: string(data[e.off:end])}
+		}
+	}
+}
+
+// decode returns the decoded stream of o. Streams with filters other than
+// Flate (images, mostly) yield nil.
+func (d *pdfDoc) decode(o *pdfObj) []byte {
+	if o == nil || o.stream == nil {
+		return nil
+	}
+	limit := maxInflated - d.inflated
+	if limit <= 0 {
+		return nil
+	}
+	filter := d.value(o.dict, "Filter")
+	switch strings.Trim(filter, "[] \r\n") {
+	case "":
+		d.inflated += len(o.stream)
+		return o.stream
+	case "/FlateDecode", "/Fl":
+	default:
+		return nil
+	}
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(o.stream)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(o.stream))
+	}
+	// Truncated or slightly corrupt streams still yield what was inflated.
+	out, _ := io.ReadAll(io.LimitReader(r, int64(limit)))
+	d.inflated += len(out)
+	return out
+}
+
+func (d *pdfDoc) streamData(n int) []byte {
+	return d.decode(d.objs[n])
+}
+
+// resolve follows an indirect reference to the referenced object's text.
+func (d *pdfDoc) resolve(v string) string {
+	for i := 0; i < 8; i++ {
+		m := pdfRefRe.FindStringSubmatch(v)
+		if m == nil || strings.TrimSpace(v) != m[0] {
+			return v
+		}
+		n, _ := strconv.Atoi(m[1])
+		o := d.objs[n]
+		if o == nil {
+			return ""
+		}
+		v = strings.TrimSpace(o.dict)
+	}
+	return v
+}
+
+// value returns the raw value of /key in dict, e.g. "<< ... >>", "[ ... ]",
+// "5 0 R" or "/Name".
+func (d *pdfDoc) value(dict, key string) string {
+	k := "/" + key
+	i := 0
+	for {
+		j := strings.Index(dict[i:], k)
+		if j < 0 {
+			return ""
+		}
+		i += j + len(k)
+		if i == len(dict) || isDelim(dict[i]) {
+			break
+		}
+	}
+	rest := strings.TrimLeft(dict[i:], " \t\r\n")
+	switch {
+	case strings.HasPrefix(rest, "<<"):
+		return balanced(rest, "<<", ">>")
+	case strings.HasPrefix(rest, "["):
+		return balanced(rest, "[", "]")
+	}
+	if m := pdfLeadingRefRe.FindString(rest); m != "" {
+		return m
+	}
+	end := 0
+	if strings.HasPrefix(rest, "/") {
+		end = 1
+	}
+	for end < len(rest) && !isDelim(rest[end]) {
+		end++
+	}
+	return rest[:end]
+}
+
+// balanced returns the prefix of s up to the delimiter closing its first one.
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return s[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+// refs returns the object numbers referenced by v, resolving v itself when
+// it is a reference to an array.
+func (d *pdfDoc) refs(v string) []int {
+	if !strings.HasPrefix(strings.TrimSpace(v), "[") {
+		if r := d.resolve(v); strings.HasPrefix(r, "[") {
+			v = r
+		}
+	}
+	var out []int
+	for _, m := range pdfRefRe.FindAllStringSubmatch(v, -1) {
+		n, _ := strconv.Atoi(m[1])
+		out = append(out, n)
+	}
+	return out
+}
+
+// pages returns the page objects in document order.
+func (d *pdfDoc) pages(data []byte) []int {
+	var out []int
+	if roots := pdfRootRe.FindAllSubmatch(data, -1); len(roots) > 0 {
+		root, _ := strconv.Atoi(string(roots[len(roots)-1][1]))
+		if cat := d.objs[root]; cat != nil {
+			seen := map[int]bool{}
+			var walk func(n int)
+			walk = func(n int) {
+				o := d.objs[n]
+				if o == nil || seen[n] {
+					return
+				}
+				seen[n] = true
+				if kids := d.value(o.dict, "Kids"); kids != "" {
+					for _, k := range d.refs(kids) {
+						walk(k)
+					}
+					return
+				}
+				if pdfPageRe.MatchString(o.dict) {
+					out = append(out, n)
+				}
+			}
+			for _, n := range d.refs(d.value(cat.dict, "Pages")) {
+				walk(n)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, n := range sortedKeys(d.objs) {
+		if pdfPageRe.MatchString(d.objs[n].dict) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// fonts returns the fonts of a page keyed by resource name, following
+// resources inherited from parent page tree nodes.
+func (d *pdfDoc) fonts(page int) map[string]*pdfFont {
+	var res string
+	for n, i := page, 0; i < 32; i++ {
+		o := d.objs[n]
+		if o == nil {
+			break
+		}
+		if res = d.resolve(d.value(o.dict, "Resources")); res != "" {
+			break
+		}
+		parent := d.refs(d.value(o.dict, "Parent"))
+		if len(parent) == 0 {
+			break
+		}
+		n = parent[0]
+	}
+	fonts := map[string]*pdfFont{}
+	dict := d.resolve(d.value(res, "Font"))
+	for _, m := range pdfFontRe.FindAllStringSubmatch(dict, -1) {
+		n, _ := strconv.Atoi(m[2])
+		o := d.objs[n]
+		if o == nil {
+			continue
+		}
+		f := &pdfFont{cid: strings.Contains(o.dict, "/Type0")}
+		if tu := d.refs(d.value(o.dict, "ToUnicode")); len(tu) > 0 {
+			cm, ok := d.cmaps[tu[0]]
+			if !ok {
+				cm = parseCMap(d.streamData(tu[0]))
+				d.cmaps[tu[0]] = cm
+			}
+			f.cmap = cm
+		}
+		fonts[m[1]] = f
+	}
+	return fonts
+}
+
+func sortedKeys(m map[int]*pdfObj) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// cmap maps character codes to Unicode text, as found in ToUnicode streams.
+type cmap struct {
+	width int
+	m     map[uint32]string
+}
+
+// maxCMapCodes bounds the codes one ToUnicode map defines.
+const maxCMapCodes = 1 << 16
+
+func parseCMap(data []byte) *cmap {
+	c := &cmap{width: 1, m: map[uint32]string{}}
+	lx := &lexer{data: data}
+	var operands []token
+	for {
+		t, ok := lx.next()
+		if !ok {
+			break
+		}
+		if t.kind != tokOp {
+			operands = append(operands, t)
+			continue
+		}
+		switch t.op {
+		case "endcodespacerange":
+			if len(operands) > 0 && len(operands[0].str) > 0 {
+				c.width = len(operands[0].str)
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				c.m[code(operands[i].str)] = utf16BE(operands[i+1].str)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, hi := code(operands[i].str), code(operands[i+1].str)
+				if hi < lo || int(hi-lo) >= maxCMapCodes-len(c.m) {
+					continue
+				}
+				dst := operands[i+2]
+				for j := uint32(0); j <= hi-lo; j++ {
+					if dst.kind == tokArray {
+						if int(j) < len(dst.arr) {
+							c.m[lo+j] = utf16BE(dst.arr[j].str)
+						}
+						continue
+					}
+					c.m[lo+j] = utf16BE(incLast(dst.str, j))
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if len(c.m) == 0 {
+		return nil
+	}
+	return c
+}
+
+func code(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+// incLast adds n to the last byte pair of a UTF-16BE string.
+func incLast(b []byte, n uint32) []byte {
+	out := append([]byte(nil), b...)
+	if len(out) < 2 {
+		return out
+	}
+	v := uint32(out[len(out)-2])<<8 | uint32(out[len(out)-1]) + n
+	out[len(out)-2], out[len(out)-1] = byte(v>>8), byte(v)
+	return out
+}
+
+func utf16BE(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decode turns a shown string into text using the font's encoding.
+func (f *pdfFont) decode(s []byte) string {
+	if f != nil && f.cmap != nil {
+		var b strings.Builder
+		w := f.cmap.width
+		for i := 0; i+w <= len(s); i += w {
+			b.WriteString(f.cmap.m[code(s[i:i+w])])
+		}
+		return b.String()
+	}
+	if f != nil && f.cid {
+		return ""
+	}
+	if bytes.HasPrefix(s, []byte{0xFE, 0xFF}) {
+		return utf16BE(s[2:])
+	}
+	// Simple fonts without a map: assume a Latin encoding.
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// showText runs the text operators of a content stream and returns the
+// text in drawing order, starting a new line when the baseline moves.
+func showText(content []byte, fonts map[string]*pdfFont) string {
+	var (
+		out      strings.Builder
+		operands []token
+		font     *pdfFont
+		y        float64
+		leading  float64
+		lineY    float64
+		started  bool
+		moved    bool
+	)
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if started && y != lineY {
+			out.WriteByte('\n')
+		} else if started && moved && !strings.HasSuffix(out.String(), " ") && !strings.HasPrefix(s, " ") {
+			out.WriteByte(' ')
+		}
+		out.WriteString(s)
+		started, moved, lineY = true, false, y
+	}
+	num := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		return operands[i].num
+	}
+	lx := &lexer{data: content}
+	for {
+		t, ok := lx.next()
+		if !ok {
+			break
+		}
+		if t.kind != tokOp {
+			operands = append(operands, t)
+			continue
+		}
+		n := len(operands)
+		switch t.op {
+		case "BT":
+			y = 0
+			moved = true
+		case "Tf":
+			if n >= 2 {
+				font = fonts[operands[n-2].name]
+			}
+		case "TL":
+			leading = num(n - 1)
+		case "Td", "TD":
+			y += num(n - 1)
+			if t.op == "TD" {
+				leading = -num(n - 1)
+			}
+			moved = true
+		case "Tm":
+			y = num(n - 1)
+			moved = true
+		case "T*":
+			y -= leading
+			moved = true
+		case "Tj":
+			if n >= 1 {
+				write(font.decode(operands[n-1].str))
+			}
+		case "'", "\"":
+			y -= leading
+			if y == lineY {
+				// Leading was never set: still a new line.
+				y--
+			}
+			if n >= 1 {
+				write(font.decode(operands[n-1].str))
+			}
+		case "TJ":
+			if n >= 1 {
+				for _, e := range operands[n-1].arr {
+					switch e.kind {
+					case tokString:
+						write(font.decode(e.str))
+					case tokNumber:
+						// Large negative kerning separates words.
+						if e.num < -180 {
+							moved = true
+						}
+					}
+				}
+			}
+		case "BI":
+			lx.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return out.String()
+}
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokName
+	tokString
+	tokArray
+	tokDict
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	num  float64
+	name string
+	str  []byte
+	arr  []token
+	op   string
+}
+
+// lexer tokenizes content streams and CMaps.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+// maxArrayDepth bounds nesting of arrays in malformed input.
+const maxArrayDepth = 32
+
+func (l *lexer) next() (token, bool) {
+	return l.token(0)
+}
+
+func (l *lexer) token(depth int) (token, bool) {
+	var c byte
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return token{}, false
+		}
+		c = l.data[l.pos]
+		// Stray closing delimiters carry no meaning here.
+		if strings.IndexByte("]>){}", c) < 0 {
+			break
+		}
+		l.pos++
+	}
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokName, name: string(l.data[start:l.pos])}, true
+	case c == '(':
+		return token{kind: tokString, str: l.literal()}, true
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.skipDict()
+			return token{kind: tokDict}, true
+		}
+		return token{kind: tokString, str: l.hex()}, true
+	case c == '[':
+		l.pos++
+		t := token{kind: tokArray}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return t, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return t, true
+			}
+			if depth >= maxArrayDepth {
+				l.pos++
+				continue
+			}
+			e, ok := l.token(depth + 1)
+			if !ok {
+				return t, true
+			}
+			t.arr = append(t.arr, e)
+		}
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.data) && !isDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		f, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+		if err != nil {
+			return token{kind: tokOp, op: string(l.data[start:l.pos])}, true
+		}
+		return token{kind: tokNumber, num: f}, true
+	default:
+		start := l.pos
+		for l.pos < len(l.data) && !isDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		if l.pos == start {
+			l.pos++
+		}
+		return token{kind: tokOp, op: string(l.data[start:l.pos])}, true
+	}
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '/', '(', ')', '<', '>', '[', ']', '{', '}', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0:
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// literal reads a (string) with nested parentheses and escapes.
+func (l *lexer) literal() []byte {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hex reads a <hex string>. A missing final digit is taken as zero.
+func (l *lexer) hex() []byte {
+	l.pos++
+	var out []byte
+	var hi byte
+	half := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		var v byte
+		switch {
+		case c == '>':
+			if half {
+				out = append(out, hi<<4)
+			}
+			return out
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	return out
+}
+
+func (l *lexer) skipDict() {
+	depth := 0
+	for l.pos < len(l.data) {
+		switch {
+		case bytes.HasPrefix(l.data[l.pos:], []byte("<<")):
+			depth++
+			l.pos += 2
+		case bytes.HasPrefix(l.data[l.pos:], []byte(">>")):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return
+			}
+		case l.data[l.pos] == '(':
+			l.literal()
+		default:
+			l.pos++
+		}
+	}
+}
+
+// skipInlineImage skips the binary data of a BI ... ID ... EI image.
+func (l *lexer) skipInlineImage() {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 2
+	for l.pos < len(l.data) {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += j + 2
+		before := l.data[l.pos-3]
+		if (before == ' ' || before == '\n' || before == '\r') && (l.pos >= len(l.data) || isDelim(l.data[l.pos])) {
+			return
+		}
+	}
+}
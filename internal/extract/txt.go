@@ -0,0 +1,42 @@
+package extract
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// plainText decodes a text file. Files that are not valid UTF-8 are assumed
+// to be Windows-1251, which Russian Windows editors still default to.
+func plainText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return strings.ReplaceAll(string(data), "\r\n", "\n")
+	}
+	return strings.ReplaceAll(decodeCP1251(data), "\r\n", "\n")
+}
+
+// cp1251High maps bytes 0x80-0xBF of Windows-1251. Bytes 0xC0-0xFF are
+// А-я in order.
+var cp1251High = [64]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', '\ufffd', '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	'\u00a0', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '\u00ad', '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+func decodeCP1251(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) * 2)
+	for _, c := range data {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c < 0xC0:
+			b.WriteRune(cp1251High[c-0x80])
+		default:
+			b.WriteRune('А' + rune(c-0xC0))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,198 @@
+// Package health serves the liveness and readiness endpoints of the
+// services and probes them from container healthchecks.
+//
+// /healthz answers 200 while the process is serving at all. /readyz runs
+// the registered dependency checks and answers 503 when one fails or once
+// the service has started to shut down, so load balancers and compose stop
+// sending it work before it stops accepting it.
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks of a service.
+type Checker struct {
+	// Timeout bounds each run of the checks.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	names    []string
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// New creates a checker without checks; it is ready until SetDraining.
+func New(opts ...func(*Checker)) *Checker {
+	c := &Checker{Timeout: 2 * time.Second, checks: map[string]Check{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithTimeout sets how long the checks may take together.
+func WithTimeout(d time.Duration) func(*Checker) {
+	return func(c *Checker) { c.Timeout = d }
+}
+
+// Add registers a readiness check under name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+		sort.Strings(c.names)
+	}
+	c.checks[name] = check
+}
+
+// SetDraining makes the service report not ready from now on. Call it when
+// shutdown starts.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Status is the body of a /readyz response.
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Ready runs the checks concurrently and reports whether all passed.
+func (c *Checker) Ready(ctx context.Context) (Status, bool) {
+	if c.draining.Load() {
+		return Status{Status: "draining"}, false
+	}
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, n := range names {
+		checks[i] = c.checks[n]
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	st := Status{Status: "ready", Checks: map[string]string{}}
+	ok := true
+	for i, n := range names {
+		st.Checks[n] = "ok"
+		if errs[i] != nil {
+			st.Checks[n] = errs[i].Error()
+			st.Status = "unavailable"
+			ok = false
+		}
+	}
+	return st, ok
+}
+
+// Register adds GET /healthz and GET /readyz to mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		st, ok := c.Ready(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+}
+
+// HTTPCheck passes when GET url answers 2xx, e.g. another service's
+// /healthz.
+func HTTPCheck(client *http.Client, url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("new request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// DialCheck passes when a TCP connection to addr can be opened, e.g. to a
+// message broker the service has no client for.
+func DialCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// TLSDialCheck passes when a TLS handshake with addr succeeds under cfg,
+// e.g. with a broker that requires client certificates.
+func TLSDialCheck(addr string, cfg *tls.Config) Check {
+	return func(ctx context.Context) error {
+		d := tls.Dialer{Config: cfg}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Probe requests url and returns the exit status for a container
+// healthcheck: 0 on 2xx, 1 otherwise. Images without a shell or curl run
+// the service binary itself:
+//
+//	test: ["CMD", "/bot", "-probe", "http://localhost:9100/readyz"]
+//
+// Like Kubernetes HTTPS probes, https URLs are requested without verifying
+// the certificate: the probe checks that the service answers, and a
+// service serving mutual TLS would not trust the probe anyway.
+func Probe(url string) int {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	if err := HTTPCheck(client, url)(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func readyz(t *testing.T, c *Checker) (int, Status) {
+	t.Helper()
+	mux := http.NewServeMux()
+	c.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var st Status
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w.Code, st
+}
+
+func TestReadyz(t *testing.T) {
+	c := New()
+	c.Add("db", func(ctx context.Context) error { return nil })
+	if code, st := readyz(t, c); code != http.StatusOK || st.Status != "ready" || st.Checks["db"] != "ok" {
+		t.Fatalf("readyz = %d %+v", code, st)
+	}
+
+	c.Add("prompt", func(ctx context.Context) error { return errors.New("connection refused") })
+	code, st := readyz(t, c)
+	if code != http.StatusServiceUnavailable || st.Status != "unavailable" {
+		t.Fatalf("readyz with a failing check = %d %+v", code, st)
+	}
+	if st.Checks["db"] != "ok" || st.Checks["prompt"] != "connection refused" {
+		t.Fatalf("checks %+v", st.Checks)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	c := New()
+	c.SetDraining()
+	if code, st := readyz(t, c); code != http.StatusServiceUnavailable || st.Status != "draining" {
+		t.Fatalf("readyz while draining = %d %+v", code, st)
+	}
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("healthz while draining = %d, want 200", w.Code)
+	}
+}
+
+func TestReadyzTimeout(t *testing.T) {
+	c := New(WithTimeout(20 * time.Millisecond))
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	start := time.Now()
+	if code, _ := readyz(t, c); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz with a hanging check = %d", code)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("hanging check not bounded by the timeout")
+	}
+}
+
+func TestHTTPCheckAndProbe(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	check := HTTPCheck(srv.Client(), srv.URL+"/healthz")
+	if err := check(context.Background()); err != nil || Probe(srv.URL) != 0 {
+		t.Fatalf("check = %v, probe = %d; want success", err, Probe(srv.URL))
+	}
+	status = http.StatusServiceUnavailable
+	if err := check(context.Background()); err == nil || Probe(srv.URL) != 1 {
+		t.Fatal("503 passed")
+	}
+}
+
+func TestProbeHTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if Probe(srv.URL) != 0 {
+		t.Fatal("probe of an https service with its own certificate failed")
+	}
+}
+
+func TestTLSDialCheck(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	trusted := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	if err := TLSDialCheck(addr, trusted)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := TLSDialCheck(addr, &tls.Config{})(context.Background()); err == nil {
+		t.Fatal("handshake with an untrusted certificate passed")
+	}
+}
+
+func TestDialCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err := DialCheck(addr)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if err := DialCheck(addr)(context.Background()); err == nil {
+		t.Fatal("dial to a closed port passed")
+	}
+}
@@ -1,5 +1,12 @@
 package help
 
+// PolicyVersion is the current version of DATA_POLICY.md. Bump it together
+// with the "Version:" line of the policy to ask every user for consent again.
+const PolicyVersion = "4"
+
+// PolicyURL links to the data policy users consent to.
+const PolicyURL = "https://github.com/owner/legalbot/blob/main/DATA_POLICY.md"
+
 // messages holds help text in different languages.
 var messages = map[string]string{
 	"en": `Available commands:
@@ -7,8 +14,10 @@ var messages = map[string]string{
 /help - show this message
 /claim - submit a claim
 /status - check status
+/recent - links to your recent documents
 /delete - delete your history
 /lang - switch language
+/access - who may file claims (groups)
 
 Data policy: https://github.com/owner/legalbot/blob/main/DATA_POLICY.md`,
 	"ru": `Доступные команды:
@@ -16,8 +25,10 @@ Data policy: https://github.com/owner/legalbot/blob/main/DATA_POLICY.md`,
 /help - показать это сообщение
 /claim - подать обращение
 /status - проверить статус
+/recent - ссылки на последние документы
 /delete - удалить историю
 /lang - сменить язык
+/access - кто может подавать обращения (группы)
 
 Политика данных: https://github.com/owner/legalbot/blob/main/DATA_POLICY.md`,
 }
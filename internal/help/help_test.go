@@ -1,6 +1,7 @@
 package help
 
 import (
+	"os"
 	"strings"
 	"testing"
 )
@@ -25,3 +26,13 @@ func TestMessageDefault(t *testing.T) {
 		t.Errorf("fallback not used: %q", msg)
 	}
 }
+
+func TestPolicyVersionMatchesDocument(t *testing.T) {
+	b, err := os.ReadFile("../../DATA_POLICY.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\nVersion: "+PolicyVersion+"\n") {
+		t.Fatalf("DATA_POLICY.md does not declare version %s", PolicyVersion)
+	}
+}
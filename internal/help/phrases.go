@@ -0,0 +1,114 @@
+package help
+
+import (
+	"fmt"
+	"time"
+)
+
+// phrases holds short localized strings used in bot replies.
+var phrases = map[string]map[string]string{
+	"en": {
+		"start.welcome":         "Hello! I help people understand their rights and prepare claims and lawsuits under Russian law.",
+		"start.ready":           "Describe your problem with /claim and I will prepare an answer.",
+		"consent.request":       "Your questions may contain personal data. Please read the data policy and accept it to continue:\n%s",
+		"consent.updated":       "Our data policy has changed. Please review it and accept the new version to continue:\n%s",
+		"consent.accept":        "Accept",
+		"consent.decline":       "Decline",
+		"consent.accepted":      "Thank you! Describe your problem with /claim and I will prepare an answer.",
+		"consent.declined":      "Without your consent I cannot process legal questions. You can accept at any time with /start, and /delete erases your history.",
+		"status.none":           "You have no claims yet. Send /claim to submit one.",
+		"status.active":         "In progress:",
+		"status.recent":         "Recent:",
+		"state.queued":          "queued",
+		"state.building_prompt": "preparing the request",
+		"state.calling_model":   "waiting for the answer",
+		"state.rendering_docs":  "preparing documents",
+		"state.delivered":       "delivered",
+		"state.failed":          "failed",
+		"duration.hours":        "%d h %d min",
+		"duration.minutes":      "%d min %d s",
+		"duration.seconds":      "%d s",
+		"upload.received":       "Received %s. Describe your situation and I will take the file into account, or send more files first.",
+		"upload.no_text":        "Received %s, but I could not read any text in it. Please describe what it shows in your message.",
+		"upload.too_large":      "The file is too large. Please send files up to %d MB.",
+		"upload.unsupported":    "I can read PDF, DOCX and TXT documents and JPEG or PNG photos. Please send the file in one of these formats.",
+		"upload.too_many":       "You have already attached %d files. Describe your situation to submit the claim.",
+		"rating.thanks":         "Thank you for your rating!",
+		"group.only":            "This command only works in group chats.",
+		"private.only":          "This command only works in a private chat with me.",
+		"group.admins_only":     "Only group admins can change who may file claims.",
+		"group.restricted":      "In this group only admins and members they allowed can file claims. Ask an admin, or message me privately.",
+		"access.everyone":       "Every member of this group can file claims.",
+		"access.admins":         "Only admins and %d allowed members can file claims in this group.",
+		"access.reply":          "Reply to a member's message with /access allow or /access deny.",
+		"access.allowed":        "%s can now file claims in this group.",
+		"access.denied":         "%s can no longer file claims in this group unless they are an admin.",
+		"access.usage":          "Usage: /access [everyone|admins|allow|deny]",
+	},
+	"ru": {
+		"start.welcome":         "Здравствуйте! Я помогаю разобраться в своих правах и подготовить претензию или иск по российскому праву.",
+		"start.ready":           "Опишите проблему с помощью /claim, и я подготовлю ответ.",
+		"consent.request":       "Ваши вопросы могут содержать персональные данные. Пожалуйста, ознакомьтесь с политикой обработки данных и примите её, чтобы продолжить:\n%s",
+		"consent.updated":       "Политика обработки данных изменилась. Пожалуйста, ознакомьтесь с ней и примите новую редакцию, чтобы продолжить:\n%s",
+		"consent.accept":        "Принимаю",
+		"consent.decline":       "Отказаться",
+		"consent.accepted":      "Спасибо! Опишите проблему с помощью /claim, и я подготовлю ответ.",
+		"consent.declined":      "Без вашего согласия я не могу обрабатывать юридические вопросы. Принять политику можно в любой момент командой /start, а /delete удалит вашу историю.",
+		"status.none":           "У вас пока нет обращений. Отправьте /claim, чтобы подать обращение.",
+		"status.active":         "В работе:",
+		"status.recent":         "Недавние:",
+		"state.queued":          "в очереди",
+		"state.building_prompt": "готовим запрос",
+		"state.calling_model":   "ждём ответ",
+		"state.rendering_docs":  "готовим документы",
+		"state.delivered":       "доставлено",
+		"state.failed":          "ошибка",
+		"duration.hours":        "%d ч %d мин",
+		"duration.minutes":      "%d мин %d с",
+		"duration.seconds":      "%d с",
+		"upload.received":       "Файл %s получен. Опишите ситуацию, и я учту его в ответе, или сначала отправьте ещё файлы.",
+		"upload.no_text":        "Файл %s получен, но прочитать в нём текст не удалось. Пожалуйста, опишите в сообщении, что на нём.",
+		"upload.too_large":      "Файл слишком большой. Отправляйте файлы размером до %d МБ.",
+		"upload.unsupported":    "Я читаю документы PDF, DOCX и TXT и фотографии JPEG или PNG. Пожалуйста, отправьте файл в одном из этих форматов.",
+		"upload.too_many":       "Вы уже приложили %d файлов. Опишите ситуацию, чтобы отправить обращение.",
+		"rating.thanks":         "Спасибо за оценку!",
+		"group.only":            "Эта команда работает только в групповых чатах.",
+		"private.only":          "Эта команда работает только в личном чате со мной.",
+		"group.admins_only":     "Менять, кто может подавать обращения, могут только администраторы группы.",
+		"group.restricted":      "В этой группе обращения могут подавать только администраторы и участники, которым они это разрешили. Обратитесь к администратору или напишите мне в личные сообщения.",
+		"access.everyone":       "Все участники группы могут подавать обращения.",
+		"access.admins":         "В этой группе обращения могут подавать только администраторы и %d участников с разрешением.",
+		"access.reply":          "Ответьте на сообщение участника командой /access allow или /access deny.",
+		"access.allowed":        "%s теперь может подавать обращения в этой группе.",
+		"access.denied":         "%s больше не может подавать обращения в этой группе, если не является администратором.",
+		"access.usage":          "Использование: /access [everyone|admins|allow|deny]",
+	},
+}
+
+// Phrase returns the string for key in the requested language, falling back
+// to English and then to the key itself.
+func Phrase(lang, key string) string {
+	if s, ok := phrases[lang][key]; ok {
+		return s
+	}
+	if s, ok := phrases["en"][key]; ok {
+		return s
+	}
+	return key
+}
+
+// Duration formats d for humans, rounded to whole seconds.
+func Duration(lang string, d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	if s < 0 {
+		s = 0
+	}
+	switch {
+	case s >= 3600:
+		return fmt.Sprintf(Phrase(lang, "duration.hours"), s/3600, s%3600/60)
+	case s >= 60:
+		return fmt.Sprintf(Phrase(lang, "duration.minutes"), s/60, s%60)
+	default:
+		return fmt.Sprintf(Phrase(lang, "duration.seconds"), s)
+	}
+}
@@ -0,0 +1,44 @@
+package help
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhraseFallback(t *testing.T) {
+	if got := Phrase("ru", "state.delivered"); got != "доставлено" {
+		t.Errorf("unexpected ru phrase %q", got)
+	}
+	if got := Phrase("de", "state.delivered"); got != "delivered" {
+		t.Errorf("expected English fallback, got %q", got)
+	}
+	if got := Phrase("en", "no.such.key"); got != "no.such.key" {
+		t.Errorf("expected key fallback, got %q", got)
+	}
+}
+
+func TestPhraseKeysTranslated(t *testing.T) {
+	for key := range phrases["en"] {
+		if _, ok := phrases["ru"][key]; !ok {
+			t.Errorf("missing ru translation for %q", key)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		lang string
+		d    time.Duration
+		want string
+	}{
+		{"en", 1400 * time.Millisecond, "1 s"},
+		{"en", 75 * time.Second, "1 min 15 s"},
+		{"ru", 2*time.Hour + 5*time.Minute, "2 ч 5 мин"},
+		{"en", -time.Second, "0 s"},
+	}
+	for _, c := range cases {
+		if got := Duration(c.lang, c.d); got != c.want {
+			t.Errorf("Duration(%s, %v) = %q, want %q", c.lang, c.d, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package laws loads a local corpus of Russian statutes and retrieves the
+// articles most relevant to a user's question.
+package laws
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Article is a single article of a statute.
+type Article struct {
+	Law    string
+	Number string
+	Title  string
+	Text   string
+}
+
+// ID returns a stable identifier such as "ГК РФ/395".
+func (a Article) ID() string {
+	return a.Law + "/" + a.Number
+}
+
+// maxExcerptRunes caps the article text placed into a prompt.
+const maxExcerptRunes = 1500
+
+// Excerpt formats the article for the prompt, truncating long texts.
+func (a Article) Excerpt() string {
+	head := fmt.Sprintf("%s, ст. %s", a.Law, a.Number)
+	if a.Title != "" {
+		head += ". " + a.Title
+	}
+	text := []rune(a.Text)
+	if len(text) > maxExcerptRunes {
+		text = append(text[:maxExcerptRunes], '…')
+	}
+	if len(text) == 0 {
+		return head
+	}
+	return head + "\n" + string(text)
+}
+
+var articleHeading = regexp.MustCompile(`^Статья\s+(\d+(?:\.\d+)*)\.?\s*(.*)$`)
+
+// Parse reads one statute. The first non-empty line is the law's short name;
+// each article starts with a line like "Статья 18. Title" and runs until the
+// next heading.
+func Parse(r io.Reader) ([]Article, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var (
+		law      string
+		articles []Article
+		cur      *Article
+		body     []string
+	)
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.TrimSpace(strings.Join(body, "\n"))
+			articles = append(articles, *cur)
+		}
+		cur, body = nil, nil
+	}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if law == "" {
+			law = line
+			continue
+		}
+		if m := articleHeading.FindStringSubmatch(line); m != nil {
+			flush()
+			cur = &Article{Law: law, Number: m[1], Title: m[2]}
+			continue
+		}
+		if cur != nil {
+			body = append(body, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if law == "" {
+		return nil, fmt.Errorf("empty statute")
+	}
+	return articles, nil
+}
+
+// LoadDir parses every *.txt file in dir.
+func LoadDir(dir string) ([]Article, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var all []Article
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", name, err)
+		}
+		articles, err := Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		all = append(all, articles...)
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no articles found in %s", dir)
+	}
+	return all, nil
+}
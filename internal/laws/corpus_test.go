@@ -0,0 +1,66 @@
+package laws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `ГК РФ
+
+Статья 15. Возмещение убытков
+Лицо, право которого нарушено,
+может требовать возмещения убытков.
+Статья 395.1 Проценты
+Текст.
+`
+	got, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 articles, got %+v", got)
+	}
+	if got[0].Law != "ГК РФ" || got[0].Number != "15" || got[0].Title != "Возмещение убытков" {
+		t.Fatalf("unexpected article %+v", got[0])
+	}
+	if got[0].Text != "Лицо, право которого нарушено,\nможет требовать возмещения убытков." {
+		t.Fatalf("unexpected text %q", got[0].Text)
+	}
+	if got[1].Number != "395.1" || got[1].Title != "Проценты" || got[1].ID() != "ГК РФ/395.1" {
+		t.Fatalf("unexpected article %+v", got[1])
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	if _, err := Parse(strings.NewReader("")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	got, err := LoadDir("testdata/corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 10 {
+		t.Fatalf("expected 10 articles, got %d", len(got))
+	}
+}
+
+func TestLoadDirEmpty(t *testing.T) {
+	if _, err := LoadDir(t.TempDir()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestExcerptTruncates(t *testing.T) {
+	a := Article{Law: "ГК РФ", Number: "1", Title: "Т", Text: strings.Repeat("я", maxExcerptRunes+10)}
+	ex := a.Excerpt()
+	if !strings.HasPrefix(ex, "ГК РФ, ст. 1. Т\n") || !strings.HasSuffix(ex, "…") {
+		t.Fatalf("unexpected excerpt %q", ex[:40])
+	}
+	if n := len([]rune(ex)); n != len([]rune("ГК РФ, ст. 1. Т\n"))+maxExcerptRunes+1 {
+		t.Fatalf("unexpected excerpt length %d", n)
+	}
+}
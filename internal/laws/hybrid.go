@@ -0,0 +1,224 @@
+package laws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"legalbot/internal/vector"
+)
+
+// Embedder turns texts into vectors, e.g. *openrouter.Client.
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+// VectorKey is the store ID of the embedding of a made by model: the
+// article ID and a hash of the model and the embedded text, so a vector is
+// not reused once either changes.
+func VectorKey(a Article, model string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + a.Excerpt()))
+	return a.ID() + "#" + hex.EncodeToString(sum[:8])
+}
+
+// articleID returns the article ID of a VectorKey.
+func articleID(key string) string {
+	if i := strings.LastIndexByte(key, '#'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// EmbedMissing makes store hold the embeddings by model of exactly articles,
+// keyed by VectorKey, embedding batch texts per request. Vectors of articles
+// whose text or model changed or that left the corpus cannot be removed from
+// an index, so then the current vectors are copied into a new index of the
+// same kind. It returns the store to use and how many articles were embedded.
+func EmbedMissing(ctx context.Context, articles []Article, store vector.Store, emb Embedder, model string, batch int) (vector.Store, int, error) {
+	if batch <= 0 {
+		batch = 32
+	}
+	keys := make([]string, len(articles))
+	current := 0
+	for i, a := range articles {
+		keys[i] = VectorKey(a, model)
+		if store.Has(keys[i]) {
+			current++
+		}
+	}
+	if current != store.Len() {
+		fresh, err := vector.New(store.Kind())
+		if err != nil {
+			return store, 0, err
+		}
+		for _, k := range keys {
+			if v, ok := store.Vector(k); ok {
+				if err := fresh.Add(k, v); err != nil {
+					return store, 0, fmt.Errorf("copy %s: %w", k, err)
+				}
+			}
+		}
+		store = fresh
+	}
+	var todo []int
+	for i, k := range keys {
+		if !store.Has(k) {
+			todo = append(todo, i)
+		}
+	}
+	added := 0
+	for start := 0; start < len(todo); start += batch {
+		chunk := todo[start:min(start+batch, len(todo))]
+		texts := make([]string, len(chunk))
+		for i, j := range chunk {
+			texts[i] = articles[j].Excerpt()
+		}
+		vecs, err := emb.Embed(ctx, texts)
+		if err != nil {
+			return store, added, fmt.Errorf("embed articles: %w", err)
+		}
+		for i, j := range chunk {
+			if err := store.Add(keys[j], vecs[i]); err != nil {
+				return store, added, fmt.Errorf("store %s: %w", articles[j].ID(), err)
+			}
+			added++
+		}
+	}
+	return store, added, nil
+}
+
+// Hybrid ranks articles by a weighted sum of min-max normalised BM25 and
+// embedding similarity scores, so paraphrased questions still find articles
+// that share no words with them. If the query cannot be embedded it falls
+// back to BM25 alone.
+type Hybrid struct {
+	index  *Index
+	store  vector.Store
+	emb    Embedder
+	alpha  float64
+	byID   map[string]Article
+	Logger *slog.Logger
+}
+
+// NewHybrid combines a BM25 index with a vector store holding embeddings of
+// the same articles, keyed by VectorKey.
+func NewHybrid(ix *Index, store vector.Store, emb Embedder, opts ...func(*Hybrid)) *Hybrid {
+	h := &Hybrid{
+		index:  ix,
+		store:  store,
+		emb:    emb,
+		alpha:  0.5,
+		byID:   make(map[string]Article, ix.Len()),
+		Logger: slog.Default(),
+	}
+	for _, a := range ix.Articles() {
+		h.byID[a.ID()] = a
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// WithAlpha sets the weight of the vector score; BM25 gets 1-alpha.
+func WithAlpha(a float64) func(*Hybrid) {
+	return func(h *Hybrid) { h.alpha = a }
+}
+
+// WithLogger sets a custom logger when creating a hybrid ranker.
+func WithLogger(l *slog.Logger) func(*Hybrid) {
+	return func(h *Hybrid) { h.Logger = l }
+}
+
+// candidatesPerHit is how many candidates each ranker contributes per
+// requested result before merging.
+const candidatesPerHit = 4
+
+// Search returns up to k articles ranked by the combined score.
+func (h *Hybrid) Search(ctx context.Context, query string, k int) []Hit {
+	if k <= 0 {
+		return nil
+	}
+	pool := max(k*candidatesPerHit, 20)
+	keyword := h.index.Search(query, pool)
+
+	vecs, err := h.emb.Embed(ctx, []string{query})
+	if err != nil || len(vecs) != 1 {
+		if h.Logger != nil {
+			h.Logger.WarnContext(ctx, "query embedding failed, using bm25 only", "err", err)
+		}
+		if len(keyword) > k {
+			keyword = keyword[:k]
+		}
+		return keyword
+	}
+	semantic := h.store.Search(vecs[0], pool)
+
+	scores := map[string]float64{}
+	bm := make([]float64, len(keyword))
+	for i, hit := range keyword {
+		bm[i] = hit.Score
+	}
+	for i, s := range minMax(bm) {
+		scores[keyword[i].Article.ID()] += (1 - h.alpha) * s
+	}
+	sim := make([]float64, len(semantic))
+	for i, m := range semantic {
+		sim[i] = float64(m.Score)
+	}
+	for i, s := range minMax(sim) {
+		id := articleID(semantic[i].ID)
+		if _, ok := h.byID[id]; ok {
+			scores[id] += h.alpha * s
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{Article: h.byID[id], Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Article.ID() < hits[j].Article.ID()
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// Retrieve returns prompt excerpts of the k best matching articles.
+func (h *Hybrid) Retrieve(ctx context.Context, query string, k int) ([]string, error) {
+	hits := h.Search(ctx, query, k)
+	out := make([]string, len(hits))
+	for i, hit := range hits {
+		out[i] = hit.Article.Excerpt()
+	}
+	return out, nil
+}
+
+// minMax scales scores to [0, 1]. A single or constant score maps to 1.
+func minMax(xs []float64) []float64 {
+	out := make([]float64, len(xs))
+	if len(xs) == 0 {
+		return out
+	}
+	lo, hi := xs[0], xs[0]
+	for _, x := range xs {
+		lo, hi = min(lo, x), max(hi, x)
+	}
+	for i, x := range xs {
+		if hi == lo {
+			out[i] = 1
+		} else {
+			out[i] = (x - lo) / (hi - lo)
+		}
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package laws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"legalbot/internal/vector"
+)
+
+// conceptEmbedder maps texts onto hand-picked concepts so tests can check
+// paraphrase matching without a real model.
+type conceptEmbedder struct {
+	calls int
+	err   error
+}
+
+var concepts = [][]string{
+	{"заработн", "получк", "жалован"},
+	{"товар", "покупк", "магазин"},
+	{"долг", "денежн", "займ"},
+}
+
+func (e *conceptEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	out := make([][]float32, len(inputs))
+	for i, in := range inputs {
+		v := make([]float32, len(concepts)+1)
+		v[len(concepts)] = 0.01
+		lower := strings.ToLower(in)
+		for d, words := range concepts {
+			for _, w := range words {
+				v[d] += float32(strings.Count(lower, w))
+			}
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func newTestHybrid(t *testing.T, emb Embedder) *Hybrid {
+	t.Helper()
+	ix := loadTestIndex(t)
+	store, n, err := EmbedMissing(context.Background(), ix.Articles(), vector.NewFlat(), emb, "test-model", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != ix.Len() {
+		t.Fatalf("embedded %d of %d articles", n, ix.Len())
+	}
+	return NewHybrid(ix, store, emb, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+}
+
+func TestEmbedMissingSkipsStored(t *testing.T) {
+	ix := loadTestIndex(t)
+	emb := &conceptEmbedder{}
+	store, _, err := EmbedMissing(context.Background(), ix.Articles()[:3], vector.NewFlat(), emb, "m", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, n, err := EmbedMissing(context.Background(), ix.Articles(), store, emb, "m", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != store || n != ix.Len()-3 || store.Len() != ix.Len() {
+		t.Fatalf("added %d, store has %d", n, store.Len())
+	}
+}
+
+func TestEmbedMissingDropsStaleVectors(t *testing.T) {
+	ix := loadTestIndex(t)
+	articles := ix.Articles()
+	emb := &conceptEmbedder{}
+	store, _, err := EmbedMissing(context.Background(), articles, vector.NewHNSW(), emb, "m", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An amended article is embedded again and its old vector dropped.
+	amended := append([]Article(nil), articles...)
+	amended[0].Text += " (в ред. изменений)"
+	next, n, err := EmbedMissing(context.Background(), amended, store, emb, "m", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || next == store || next.Len() != len(articles) || next.Kind() != vector.KindHNSW {
+		t.Fatalf("added %d, store has %d %s vectors", n, next.Len(), next.Kind())
+	}
+	if next.Has(VectorKey(articles[0], "m")) || !next.Has(VectorKey(amended[0], "m")) {
+		t.Fatal("stale vector kept")
+	}
+
+	// Another model makes every vector stale.
+	next, n, err = EmbedMissing(context.Background(), amended, next, emb, "other", 0)
+	if err != nil || n != len(articles) || next.Len() != len(articles) {
+		t.Fatalf("after a model change added %d, store has %d: %v", n, next.Len(), err)
+	}
+
+	// Articles that left the corpus are dropped without embedding.
+	next, n, err = EmbedMissing(context.Background(), amended[1:], next, emb, "other", 0)
+	if err != nil || n != 0 || next.Len() != len(articles)-1 {
+		t.Fatalf("after a removal added %d, store has %d: %v", n, next.Len(), err)
+	}
+}
+
+func TestHybridFindsParaphrase(t *testing.T) {
+	h := newTestHybrid(t, &conceptEmbedder{})
+	query := "Мне третий месяц не дают получку"
+	if hits := h.index.Search(query, 3); len(hits) != 0 {
+		t.Fatalf("bm25 should not match the paraphrase, got %+v", hits)
+	}
+	hits := h.Search(context.Background(), query, 2)
+	if len(hits) == 0 || hits[0].Article.Law != "Трудовой кодекс РФ" {
+		t.Fatalf("expected labour code article first, got %+v", hits)
+	}
+}
+
+func TestHybridKeepsKeywordMatches(t *testing.T) {
+	h := newTestHybrid(t, &conceptEmbedder{})
+	hits := h.Search(context.Background(), "неустойка за просрочку требований потребителя о возврате за товар", 1)
+	if len(hits) != 1 || hits[0].Article.ID() != "Закон о защите прав потребителей/23" {
+		t.Fatalf("unexpected hits %+v", hits)
+	}
+}
+
+func TestHybridFallsBackToBM25(t *testing.T) {
+	emb := &conceptEmbedder{}
+	h := newTestHybrid(t, emb)
+	emb.err = errors.New("openrouter down")
+	query := "проценты на сумму долга"
+	got := h.Search(context.Background(), query, 2)
+	want := h.index.Search(query, 2)
+	if len(got) != len(want) || got[0].Article.ID() != want[0].Article.ID() {
+		t.Fatalf("expected bm25 results %+v, got %+v", want, got)
+	}
+	excerpts, err := h.Retrieve(context.Background(), query, 1)
+	if err != nil || len(excerpts) != 1 {
+		t.Fatalf("unexpected retrieve result %v %v", excerpts, err)
+	}
+}
+
+func TestEmbedMissingError(t *testing.T) {
+	ix := loadTestIndex(t)
+	_, _, err := EmbedMissing(context.Background(), ix.Articles(), vector.NewFlat(), &conceptEmbedder{err: errors.New("quota")}, "m", 0)
+	if err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	got := minMax([]float64{2, 4, 3})
+	if got[0] != 0 || got[1] != 1 || got[2] != 0.5 {
+		t.Fatalf("unexpected %v", got)
+	}
+	if got := minMax([]float64{5}); got[0] != 1 {
+		t.Fatalf("unexpected %v", got)
+	}
+}
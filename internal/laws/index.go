@@ -0,0 +1,146 @@
+package laws
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// stopwords are frequent Russian words that carry no legal meaning.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`а без более бы был была были было быть в вам вас весь во вот все всего всех вы
+		где да даже для до его ее ей ему если есть еще же за и из или им их к как какой когда кто ли либо
+		меня мне мой мы на над не него нее ней нет ни них но ну о об однако он она они оно от по под при
+		с со так также такой там то тогда того тоже только том ты у уже чем что чтобы эта эти это этого этой этом я`) {
+		stopwords[w] = true
+	}
+}
+
+// Tokenize lower-cases text, splits it into words, drops stopwords and stems
+// the rest. Numbers are kept so article numbers can be searched for.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if stopwords[w] {
+			continue
+		}
+		out = append(out, Stem(w))
+	}
+	return out
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// Index is a BM25 inverted index over articles.
+type Index struct {
+	articles []Article
+	postings map[string][]posting
+	lengths  []int
+	avgLen   float64
+}
+
+// Hit is a scored search result.
+type Hit struct {
+	Article Article
+	Score   float64
+}
+
+// NewIndex indexes the title and text of each article.
+func NewIndex(articles []Article) *Index {
+	ix := &Index{
+		articles: articles,
+		postings: map[string][]posting{},
+		lengths:  make([]int, len(articles)),
+	}
+	total := 0
+	for i, a := range articles {
+		tokens := Tokenize(a.Title + "\n" + a.Text)
+		ix.lengths[i] = len(tokens)
+		total += len(tokens)
+		tf := map[string]int{}
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t, n := range tf {
+			ix.postings[t] = append(ix.postings[t], posting{doc: i, tf: n})
+		}
+	}
+	if len(articles) > 0 {
+		ix.avgLen = float64(total) / float64(len(articles))
+	}
+	return ix
+}
+
+// Len returns the number of indexed articles.
+func (ix *Index) Len() int { return len(ix.articles) }
+
+// Articles returns the indexed articles in corpus order.
+func (ix *Index) Articles() []Article { return ix.articles }
+
+// Search returns up to k articles ranked by BM25 score. Articles that share no
+// terms with the query are not returned.
+func (ix *Index) Search(query string, k int) []Hit {
+	if k <= 0 || len(ix.articles) == 0 {
+		return nil
+	}
+	n := float64(len(ix.articles))
+	scores := map[int]float64{}
+	seen := map[string]bool{}
+	for _, t := range Tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		plist := ix.postings[t]
+		if len(plist) == 0 {
+			continue
+		}
+		df := float64(len(plist))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range plist {
+			tf := float64(p.tf)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(ix.lengths[p.doc])/ix.avgLen)
+			scores[p.doc] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+	hits := make([]Hit, 0, len(scores))
+	for doc, s := range scores {
+		hits = append(hits, Hit{Article: ix.articles[doc], Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Article.ID() < hits[j].Article.ID()
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// Retrieve returns prompt excerpts of the k best matching articles.
+func (ix *Index) Retrieve(ctx context.Context, query string, k int) ([]string, error) {
+	hits := ix.Search(query, k)
+	out := make([]string, len(hits))
+	for i, h := range hits {
+		out[i] = h.Article.Excerpt()
+	}
+	return out, nil
+}
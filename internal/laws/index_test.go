@@ -0,0 +1,78 @@
+package laws
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func loadTestIndex(t *testing.T) *Index {
+	t.Helper()
+	articles, err := LoadDir("testdata/corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewIndex(articles)
+}
+
+func TestSearch(t *testing.T) {
+	ix := loadTestIndex(t)
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"В товаре обнаружены недостатки, хочу отказаться от договора и вернуть деньги", "Закон о защите прав потребителей/18"},
+		{"Работодатель задерживает зарплату, положена ли компенсация за задержку?", "Трудовой кодекс РФ/236"},
+		{"Какую неустойку платит продавец за просрочку?", "Закон о защите прав потребителей/23"},
+		{"Не выплатили расчет в день увольнения", "Трудовой кодекс РФ/140"},
+	}
+	for _, c := range cases {
+		hits := ix.Search(c.query, 3)
+		if len(hits) == 0 {
+			t.Errorf("no hits for %q", c.query)
+			continue
+		}
+		if got := hits[0].Article.ID(); got != c.want {
+			t.Errorf("top hit for %q = %s, want %s", c.query, got, c.want)
+		}
+	}
+}
+
+func TestSearchNoMatch(t *testing.T) {
+	ix := loadTestIndex(t)
+	if hits := ix.Search("weather forecast", 3); len(hits) != 0 {
+		t.Fatalf("expected no hits, got %+v", hits)
+	}
+	if hits := ix.Search("зарплата", 0); hits != nil {
+		t.Fatalf("expected nil for k=0")
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	ix := loadTestIndex(t)
+	hits := ix.Search("товар потребитель продавец зарплата работодатель", 2)
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(hits))
+	}
+	if hits[0].Score < hits[1].Score {
+		t.Fatalf("hits not sorted by score")
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	ix := loadTestIndex(t)
+	got, err := ix.Retrieve(context.Background(), "проценты по ключевой ставке за долг", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "ГК РФ, ст. 395. ") {
+		t.Fatalf("unexpected excerpts %q", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(Tokenize("Статья 395: проценты, и ДОЛГИ"), " ")
+	if got != "стат 395 процент долг" {
+		t.Fatalf("unexpected tokens %q", got)
+	}
+}
@@ -0,0 +1,201 @@
+package laws
+
+import "sort"
+
+// Russian Snowball stemmer, see
+// https://snowballstem.org/algorithms/russian/stemmer.html.
+// Words are processed as runes; every ending is removed only when it lies in
+// the RV region.
+
+func isVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	}
+	return false
+}
+
+// endingSet is a list of endings sorted from longest to shortest so the first
+// match is the longest one, as Snowball's among() requires.
+type endingSet [][]rune
+
+func newEndingSet(endings ...string) endingSet {
+	s := make(endingSet, len(endings))
+	for i, e := range endings {
+		s[i] = []rune(e)
+	}
+	sort.SliceStable(s, func(i, j int) bool { return len(s[i]) > len(s[j]) })
+	return s
+}
+
+// match returns the longest ending of w that starts at or after min, or nil.
+func (s endingSet) match(w []rune, min int) []rune {
+	for _, e := range s {
+		if len(w)-len(e) < min {
+			continue
+		}
+		if hasSuffix(w, e) {
+			return e
+		}
+	}
+	return nil
+}
+
+func hasSuffix(w, e []rune) bool {
+	if len(e) > len(w) {
+		return false
+	}
+	off := len(w) - len(e)
+	for i, r := range e {
+		if w[off+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// groupedEndings holds endings that need a preceding а/я (first) and
+// endings removed unconditionally (second).
+type groupedEndings struct {
+	all    endingSet
+	first  map[string]bool
+	second map[string]bool
+}
+
+func newGroupedEndings(first, second []string) groupedEndings {
+	g := groupedEndings{first: map[string]bool{}, second: map[string]bool{}}
+	for _, e := range first {
+		g.first[e] = true
+	}
+	for _, e := range second {
+		g.second[e] = true
+	}
+	g.all = newEndingSet(append(append([]string{}, first...), second...)...)
+	return g
+}
+
+// strip removes the longest ending from the group and reports whether it did.
+// First-group endings stay only if preceded by а or я inside RV.
+func (g groupedEndings) strip(w []rune, rv int) ([]rune, bool) {
+	e := g.all.match(w, rv)
+	if e == nil {
+		return w, false
+	}
+	n := len(w) - len(e)
+	if g.second[string(e)] {
+		return w[:n], true
+	}
+	if n-1 >= rv && (w[n-1] == 'а' || w[n-1] == 'я') {
+		return w[:n], true
+	}
+	return w, false
+}
+
+var (
+	perfectiveGerund = newGroupedEndings(
+		[]string{"в", "вши", "вшись"},
+		[]string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"},
+	)
+	participle = newGroupedEndings(
+		[]string{"ем", "нн", "вш", "ющ", "щ"},
+		[]string{"ивш", "ывш", "ующ"},
+	)
+	verb = newGroupedEndings(
+		[]string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"},
+		[]string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+			"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю"},
+	)
+	adjective = newEndingSet("ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+		"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею")
+	reflexive = newEndingSet("ся", "сь")
+	noun      = newEndingSet("а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой",
+		"ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я")
+	superlative   = newEndingSet("ейш", "ейше")
+	derivational  = newEndingSet("ост", "ость")
+	softSign      = []rune("ь")
+	doubleN       = []rune("нн")
+	singleI       = []rune("и")
+	yoReplacement = map[rune]rune{'ё': 'е'}
+)
+
+// regions returns the start of RV and R2.
+func regions(w []rune) (rv, r2 int) {
+	rv = len(w)
+	for i, r := range w {
+		if isVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r1 := len(w)
+	for i := 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	r2 = len(w)
+	for i := r1 + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	return rv, r2
+}
+
+// Stem returns the Snowball stem of a lower-case Russian word. Words without
+// Cyrillic vowels are returned unchanged.
+func Stem(word string) string {
+	w := []rune(word)
+	for i, r := range w {
+		if rep, ok := yoReplacement[r]; ok {
+			w[i] = rep
+		}
+	}
+	rv, r2 := regions(w)
+	if rv >= len(w) {
+		return string(w)
+	}
+
+	// Step 1.
+	if s, ok := perfectiveGerund.strip(w, rv); ok {
+		w = s
+	} else {
+		if e := reflexive.match(w, rv); e != nil {
+			w = w[:len(w)-len(e)]
+		}
+		if e := adjective.match(w, rv); e != nil {
+			w = w[:len(w)-len(e)]
+			w, _ = participle.strip(w, rv)
+		} else if s, ok := verb.strip(w, rv); ok {
+			w = s
+		} else if e := noun.match(w, rv); e != nil {
+			w = w[:len(w)-len(e)]
+		}
+	}
+
+	// Step 2.
+	if len(w)-1 >= rv && hasSuffix(w, singleI) {
+		w = w[:len(w)-1]
+	}
+
+	// Step 3.
+	if e := derivational.match(w, max(rv, r2)); e != nil {
+		w = w[:len(w)-len(e)]
+	}
+
+	// Step 4.
+	switch {
+	case superlative.match(w, rv) != nil:
+		w = w[:len(w)-len(superlative.match(w, rv))]
+		if len(w)-2 >= rv && hasSuffix(w, doubleN) {
+			w = w[:len(w)-1]
+		}
+	case len(w)-2 >= rv && hasSuffix(w, doubleN):
+		w = w[:len(w)-1]
+	case len(w)-1 >= rv && hasSuffix(w, softSign):
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
@@ -0,0 +1,44 @@
+package laws
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	cases := map[string]string{
+		"вагоне":       "вагон",
+		"вагонов":      "вагон",
+		"важная":       "важн",
+		"важнейшие":    "важн",
+		"вазы":         "ваз",
+		"вашей":        "ваш",
+		"ведь":         "вед",
+		"ведение":      "веден",
+		"делать":       "дела",
+		"потребителя":  "потребител",
+		"потребителей": "потребител",
+		"зарплату":     "зарплат",
+		"ёлка":         "елк",
+		"395":          "395",
+		"refund":       "refund",
+	}
+	for in, want := range cases {
+		if got := Stem(in); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStemInflectionsMatch(t *testing.T) {
+	groups := [][]string{
+		{"неустойка", "неустойки", "неустойку", "неустойкой"},
+		{"работодатель", "работодателя", "работодателем"},
+		{"увольнение", "увольнения", "увольнении"},
+	}
+	for _, g := range groups {
+		want := Stem(g[0])
+		for _, w := range g[1:] {
+			if got := Stem(w); got != want {
+				t.Errorf("Stem(%q) = %q, want %q like %q", w, got, want, g[0])
+			}
+		}
+	}
+}
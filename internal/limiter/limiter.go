@@ -3,8 +3,13 @@ package limiter
 import (
 	"sync"
 	"time"
+
+	"legalbot/internal/metrics"
 )
 
+var requests = metrics.NewCounter("limiter_requests_total",
+	"Rate limiter decisions by result: allowed or rejected.", "result")
+
 type RateLimiter struct {
 	mu     sync.Mutex
 	limit  int
@@ -50,5 +55,10 @@ func (rl *RateLimiter) allow(t time.Time, user int64) bool {
 }
 
 func (rl *RateLimiter) Allow(user int64) bool {
-	return rl.allow(rl.now(), user)
+	if !rl.allow(rl.now(), user) {
+		requests.Inc("rejected")
+		return false
+	}
+	requests.Inc("allowed")
+	return true
 }
@@ -13,9 +13,13 @@ func TestRateLimiter(t *testing.T) {
 			t.Fatalf("unexpected deny at %d", i)
 		}
 	}
+	rejected := requests.Value("rejected")
 	if rl.Allow(1) {
 		t.Fatalf("expected deny after limit")
 	}
+	if requests.Value("rejected") != rejected+1 {
+		t.Fatalf("rejection not counted")
+	}
 	now = now.Add(time.Minute)
 	if !rl.Allow(1) {
 		t.Fatalf("expected allow after window")
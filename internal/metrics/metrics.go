@@ -0,0 +1,457 @@
+// Package metrics records counters, gauges and histograms and writes them in
+// the Prometheus text exposition format.
+//
+// Metrics are declared once, usually as package variables next to the code
+// they measure, and registered with Default unless a Registry is given:
+//
+//	var sent = metrics.NewCounter("telegram_messages_sent_total", "Messages sent.", "status")
+//
+//	sent.Inc("ok")
+//
+// Label values are passed in the order the label names were declared.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are histogram bounds in seconds for request and answer
+// latencies. 0.4 and 10 are bounds, so the share of webhook responses within
+// the 400 ms target and of answers within the 10 s SLA can be read from the
+// le="0.4" and le="10" buckets without interpolation.
+var LatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.2, 0.4, 0.8, 1.5, 3, 5, 10, 15, 30, 60}
+
+// QueryBuckets are histogram bounds in seconds for database queries. They end
+// at the 400 ms webhook target a single query should never approach.
+var QueryBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.4}
+
+// Registry holds metrics and writes them out.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// metric is one named metric family.
+type metric interface {
+	write(w *bufio.Writer, name string)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// Default is the registry the package-level constructors register with. It
+// includes process metrics.
+var Default = NewRegistry()
+
+var startTime = time.Now()
+
+func init() {
+	Default.NewGaugeFunc("process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", func() float64 {
+		return float64(startTime.UnixNano()) / 1e9
+	})
+	Default.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+}
+
+func (r *Registry) register(name string, m metric) {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo writes all metrics in the text exposition format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for i, m := range metrics {
+		m.write(bw, names[i])
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry's metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// NewCounter registers a counter with Default.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a gauge with Default.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers a gauge computed on every scrape with Default.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewHistogram registers a histogram with Default.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Since returns the seconds elapsed since t, for Observe.
+func Since(t time.Time) float64 {
+	return time.Since(t).Seconds()
+}
+
+// family keeps the series of one metric by their label values.
+type family[T any] struct {
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newFamily[T any](help string, labels []string) family[T] {
+	for _, l := range labels {
+		if !validName(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+	return family[T]{help: help, labels: labels, series: map[string]*T{}, values: map[string][]string{}}
+}
+
+// get returns the series for the label values, creating it with init.
+func (f *family[T]) get(values []string, init func() *T) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(values), f.labels))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = init()
+		f.series[key] = s
+		f.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// each calls fn for every series in label order.
+func (f *family[T]) each(fn func(labels string, s *T)) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	series := make([]*T, len(keys))
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		series[i] = f.series[k]
+		labels[i] = formatLabels(f.labels, f.values[k])
+	}
+	f.mu.Unlock()
+	for i := range keys {
+		fn(labels[i], series[i])
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+// Counter is a value that only goes up, e.g. requests served.
+type Counter struct {
+	f family[value]
+}
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(d float64) {
+	v.mu.Lock()
+	v.v += d
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+func newValue() *value { return &value{} }
+
+// NewCounter registers a counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{f: newFamily[value](help, labels)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds d, which must not be negative, to the series.
+func (c *Counter) Add(d float64, labelValues ...string) {
+	if d < 0 {
+		panic("metrics: counter decreased")
+	}
+	c.f.get(labelValues, newValue).add(d)
+}
+
+// Value returns the current value of the series.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.f.get(labelValues, newValue).get()
+}
+
+func (c *Counter) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, c.f.help, "counter")
+	c.f.each(func(labels string, v *value) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v.get()))
+	})
+}
+
+// Gauge is a value that goes up and down, e.g. messages waiting to be sent.
+type Gauge struct {
+	f family[value]
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{f: newFamily[value](help, labels)}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the series to x.
+func (g *Gauge) Set(x float64, labelValues ...string) {
+	g.f.get(labelValues, newValue).set(x)
+}
+
+// Add adds d, which may be negative, to the series.
+func (g *Gauge) Add(d float64, labelValues ...string) {
+	g.f.get(labelValues, newValue).add(d)
+}
+
+// Value returns the current value of the series.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.f.get(labelValues, newValue).get()
+}
+
+func (g *Gauge) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, g.f.help, "gauge")
+	g.f.each(func(labels string, v *value) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v.get()))
+	})
+}
+
+type gaugeFunc struct {
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn on every
+// scrape, e.g. the length of a queue.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &gaugeFunc{help: help, fn: fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.fn()))
+}
+
+// Histogram counts observations, e.g. request durations, in buckets.
+type Histogram struct {
+	f       family[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted. The +Inf bucket is added automatically.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	h := &Histogram{f: newFamily[histogram](help, labels), buckets: append([]float64(nil), buckets...)}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.f.get(labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets)+1)}
+	})
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.mu.Lock()
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// Count returns the number of observations in the series.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	s := h.f.get(labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets)+1)}
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, h.f.help, "histogram")
+	h.f.each(func(labels string, s *histogram) {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		var cum uint64
+		for i, c := range counts {
+			cum += c
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", le), cum)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+	})
+}
+
+// formatLabels renders {name="value",...}, or nothing without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel appends one label to formatted labels.
+func withLabel(labels, name, value string) string {
+	l := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// validName reports whether s matches [a-zA-Z_][a-zA-Z0-9_]*. Colons are
+// reserved for recording rules.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("claims_total", "Claims handled.", "outcome")
+	c.Inc("answered")
+	c.Inc("answered")
+	c.Add(3, "failed")
+	want := `# HELP claims_total Claims handled.
+# TYPE claims_total counter
+claims_total{outcome="answered"} 2
+claims_total{outcome="failed"} 3
+`
+	if got := scrape(t, r); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+	if c.Value("answered") != 2 {
+		t.Fatalf("unexpected value %v", c.Value("answered"))
+	}
+}
+
+func TestGauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("inflight", "Requests in flight.")
+	g.Add(2)
+	g.Add(-1)
+	r.NewGaugeFunc("queue_depth", "Messages waiting.", func() float64 { return 7 })
+	want := `# HELP inflight Requests in flight.
+# TYPE inflight gauge
+inflight 1
+# HELP queue_depth Messages waiting.
+# TYPE queue_depth gauge
+queue_depth 7
+`
+	if got := scrape(t, r); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.4, 10}, "model")
+	for _, v := range []float64{0.1, 0.4, 3, 12} {
+		h.Observe(v, "m")
+	}
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{model="m",le="0.4"} 2
+latency_seconds_bucket{model="m",le="10"} 3
+latency_seconds_bucket{model="m",le="+Inf"} 4
+latency_seconds_sum{model="m"} 15.5
+latency_seconds_count{model="m"} 4
+`
+	if got := scrape(t, r); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLatencyBucketsIncludeTargets(t *testing.T) {
+	for _, target := range []float64{0.4, 10} {
+		found := false
+		for _, b := range LatencyBuckets {
+			found = found || b == target
+		}
+		if !found {
+			t.Errorf("LatencyBuckets miss %v", target)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("errors_total", "Errors by \\ cause\nand more.", "cause")
+	c.Inc("quote \" backslash \\ newline \n")
+	got := scrape(t, r)
+	for _, want := range []string{
+		`# HELP errors_total Errors by \\ cause\nand more.`,
+		`errors_total{cause="quote \" backslash \\ newline \n"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestPanics(t *testing.T) {
+	cases := map[string]func(r *Registry){
+		"bad name":        func(r *Registry) { r.NewCounter("bad-name", "") },
+		"bad label":       func(r *Registry) { r.NewCounter("x", "", "le") },
+		"duplicate":       func(r *Registry) { r.NewCounter("x", ""); r.NewGauge("x", "") },
+		"label mismatch":  func(r *Registry) { r.NewCounter("x", "", "a").Inc() },
+		"unsorted bucket": func(r *Registry) { r.NewHistogram("x", "", []float64{1, 0.5}) },
+		"negative add":    func(r *Registry) { r.NewCounter("x", "").Add(-1) },
+	}
+	for name, fn := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			fn(NewRegistry())
+		}()
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("n_total", "", "k")
+	h := r.NewHistogram("d_seconds", "", LatencyBuckets)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc("a")
+				h.Observe(0.3)
+				scrape(t, r)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Value("a") != 800 {
+		t.Fatalf("lost updates: %v", c.Value("a"))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "# TYPE go_goroutines gauge") {
+		t.Fatalf("process metrics missing:\n%s", body)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("http_seconds", "", LatencyBuckets, "status")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			http.Error(w, "bad", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	srv := InstrumentHandler(h, next)
+	for _, path := range []string{"/", "/", "/bad"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+	}
+	if h.Count("200") != 2 || h.Count("400") != 1 {
+		t.Fatalf("got %d ok and %d bad requests", h.Count("200"), h.Count("400"))
+	}
+}
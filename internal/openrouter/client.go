@@ -3,37 +3,60 @@ package openrouter
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"os"
+	"sync"
 	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/reqctx"
+	"legalbot/internal/tracing"
 )
 
 // Client calls the OpenRouter API.
 type Client struct {
+	// APIKey is sent as the Authorization header; use SetAPIKey once the
+	// client is in use.
 	APIKey   string
 	Endpoint string
-	HTTP     *http.Client
-	Logger   *slog.Logger
+	// Model answers ChatCompletion requests, e.g. "openai/gpt-4o-mini".
+	Model              string
+	EmbeddingsEndpoint string
+	EmbeddingModel     string
+	HTTP               *http.Client
+	Logger             *slog.Logger
+
+	keyMu sync.RWMutex
 }
 
-// New creates a new OpenRouter client using the provided API key. Timeout can be
-// customized via the OPENROUTER_TIMEOUT environment variable (e.g. "20s").
-// Default timeout is 15 seconds.
-func New(apiKey string) *Client {
-	timeout := 15 * time.Second
-	if v := os.Getenv("OPENROUTER_TIMEOUT"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			timeout = d
-		}
-	}
-	endpoint := defaultEndpoint
-	if v := os.Getenv("OPENROUTER_ENDPOINT"); v != "" {
-		endpoint = v
+// New creates a new OpenRouter client from cfg.
+func New(cfg config.OpenRouter) *Client {
+	return &Client{
+		APIKey:             string(cfg.APIKey),
+		Endpoint:           cfg.Endpoint,
+		Model:              cfg.Model,
+		EmbeddingsEndpoint: cfg.EmbeddingsEndpoint,
+		EmbeddingModel:     cfg.EmbeddingModel,
+		HTTP:               &http.Client{Timeout: cfg.Timeout},
+		Logger:             slog.Default(),
 	}
-	return &Client{APIKey: apiKey, Endpoint: endpoint, HTTP: &http.Client{Timeout: timeout}, Logger: slog.Default()}
+}
+
+// SetAPIKey replaces the API key, e.g. after it was rotated. Requests in
+// flight keep the old one.
+func (c *Client) SetAPIKey(key string) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	c.APIKey = key
+}
+
+func (c *Client) apiKey() string {
+	c.keyMu.RLock()
+	defer c.keyMu.RUnlock()
+	return c.APIKey
 }
 
 // WithTimeout allows customizing HTTP client timeout when creating a new
@@ -47,44 +70,79 @@ func WithEndpoint(u string) func(*Client) {
 	return func(c *Client) { c.Endpoint = u }
 }
 
+// WithModel sets the model used by ChatCompletion.
+func WithModel(m string) func(*Client) {
+	return func(c *Client) { c.Model = m }
+}
+
 // WithLogger allows setting a custom logger when creating a new client.
 func WithLogger(l *slog.Logger) func(*Client) {
 	return func(c *Client) { c.Logger = l }
 }
 
-// NewWithOptions creates a new client and applies given options.
+// NewWithOptions creates a client with the default settings and the given
+// API key and applies given options.
 func NewWithOptions(apiKey string, opts ...func(*Client)) *Client {
-	c := New(apiKey)
+	cfg := config.Default().OpenRouter
+	cfg.APIKey = config.Secret(apiKey)
+	c := New(cfg)
 	for _, opt := range opts {
 		opt(c)
 	}
 	return c
 }
 
-var defaultEndpoint = "https://openrouter.ai/v1/chat/completions"
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// ChatCompletion sends prompt as a user message to the configured model and
+// returns the content of the first choice of the reply.
+func (c *Client) ChatCompletion(ctx context.Context, prompt string) (_ string, err error) {
+	model := c.Model
+	ctx, span := tracing.Start(ctx, "openrouter.chat", tracing.Client)
+	defer func() { span.EndError(err) }()
+	span.SetAttr("model", model)
 
-// ChatCompletion sends a prompt and returns the response.
-func (c *Client) ChatCompletion(ctx context.Context, prompt string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewBufferString(prompt))
+	payload, err := json.Marshal(chatRequest{Model: model, Messages: []chatMessage{{Role: "user", Content: prompt}}})
+	if err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(payload))
 	if err != nil {
 		return "", fmt.Errorf("new request: %w", err)
 	}
-	req.Header.Set("Authorization", c.APIKey)
+	req.Header.Set("Authorization", c.apiKey())
 	req.Header.Set("Content-Type", "application/json")
+	reqctx.Inject(ctx, reqctx.HeaderCarrier(req.Header))
 
 	if c.Logger != nil {
-		if reqID, _ := ctx.Value("request_id").(string); reqID != "" {
-			c.Logger.Info("openrouter request", "request_id", reqID)
-		}
+		c.Logger.InfoContext(ctx, "openrouter request", "model", model)
 	}
 
+	start := time.Now()
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
+		observe("chat", model, 0, start)
 		return "", fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	observe("chat", model, resp.StatusCode, start)
+	span.SetInt("http.response.status_code", int64(resp.StatusCode))
 	if err != nil {
 		return "", fmt.Errorf("read body: %w", err)
 	}
@@ -93,11 +151,17 @@ func (c *Client) ChatCompletion(ctx context.Context, prompt string) (string, err
 		return "", fmt.Errorf("openrouter: status %d: %s", resp.StatusCode, string(body))
 	}
 
+	var r chatResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if len(r.Choices) == 0 {
+		return "", fmt.Errorf("openrouter: no choices in response")
+	}
+
 	if c.Logger != nil {
-		if reqID, _ := ctx.Value("request_id").(string); reqID != "" {
-			c.Logger.Info("openrouter response", "request_id", reqID)
-		}
+		c.Logger.InfoContext(ctx, "openrouter response", "model", model, "duration", time.Since(start))
 	}
 
-	return string(body), nil
+	return r.Choices[0].Message.Content, nil
 }
@@ -2,15 +2,24 @@ package openrouter
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/prompt"
+	"legalbot/internal/reqctx"
 )
 
+// completion is a chat completions response as OpenRouter returns it.
+const completion = `{"id":"gen-1","object":"chat.completion","created":1760000000,"model":"openai/gpt-4o-mini",
+"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"answer"}}],
+"usage":{"prompt_tokens":12,"completion_tokens":1,"total_tokens":13}}`
+
 func TestChatCompletionSuccess(t *testing.T) {
-	wantBody := "{\"ok\":true}"
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Authorization") != "Bearer test" {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -19,19 +28,31 @@ func TestChatCompletionSuccess(t *testing.T) {
 		if r.Method != http.MethodPost {
 			t.Errorf("expected POST, got %s", r.Method)
 		}
-		w.Write([]byte(wantBody))
+		w.Write([]byte(completion))
 	}))
 	defer srv.Close()
 
 	c := NewWithOptions("Bearer test", WithEndpoint(srv.URL))
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	body, err := c.ChatCompletion(ctx, "{}")
+	content, err := c.ChatCompletion(ctx, "{}")
 	if err != nil {
 		t.Fatalf("ChatCompletion returned error: %v", err)
 	}
-	if body != wantBody {
-		t.Fatalf("unexpected body: %s", body)
+	if content != "answer" {
+		t.Fatalf("unexpected content: %s", content)
+	}
+}
+
+func TestChatCompletionBadResponse(t *testing.T) {
+	for _, body := range []string{`{"choices":[]}`, `not json`} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		if _, err := NewWithOptions("key", WithEndpoint(srv.URL)).ChatCompletion(context.Background(), "q"); err == nil {
+			t.Errorf("expected error for response %s", body)
+		}
+		srv.Close()
 	}
 }
 
@@ -49,3 +70,73 @@ func TestChatCompletionError(t *testing.T) {
 		t.Fatalf("expected error containing 'boom', got %v", err)
 	}
 }
+
+func TestChatCompletionPropagatesRequestID(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte(completion))
+	}))
+	defer srv.Close()
+
+	ctx := reqctx.Start(context.Background())
+	tc, _ := reqctx.Trace(ctx)
+	if _, err := NewWithOptions("key", WithEndpoint(srv.URL)).ChatCompletion(ctx, "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Request-ID") != reqctx.RequestID(ctx) || got.Get("traceparent") != tc.String() {
+		t.Fatalf("unexpected headers %v", got)
+	}
+}
+
+func TestChatCompletionRecordsLatency(t *testing.T) {
+	b, err := prompt.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build(context.Background(), prompt.Request{ChatID: 1, UserText: "Магазин не возвращает деньги за сломанный телефон"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("key", WithEndpoint(srv.URL), WithModel("test/model"))
+	before := requestDuration.Count("chat", "test/model", "429")
+	c.ChatCompletion(context.Background(), p.Prompt)
+	if got := requestDuration.Count("chat", "test/model", "429"); got != before+1 {
+		t.Fatalf("observations = %d, want %d", got, before+1)
+	}
+	if got.Model != "test/model" || len(got.Messages) != 1 || got.Messages[0].Role != "user" || got.Messages[0].Content != p.Prompt {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	srv.Close()
+	model := config.Default().OpenRouter.Model
+	before = requestDuration.Count("chat", model, "error")
+	NewWithOptions("key", WithEndpoint(srv.URL)).ChatCompletion(context.Background(), p.Prompt)
+	if got := requestDuration.Count("chat", model, "error"); got != before+1 {
+		t.Fatalf("failed request not recorded under the default model %q", model)
+	}
+}
+
+func TestSetAPIKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("old", WithEndpoint(srv.URL))
+	c.ChatCompletion(context.Background(), "{}")
+	c.SetAPIKey("new")
+	c.ChatCompletion(context.Background(), "{}")
+	if len(keys) != 2 || keys[0] != "old" || keys[1] != "new" {
+		t.Fatalf("keys sent %q", keys)
+	}
+}
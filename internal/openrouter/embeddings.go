@@ -0,0 +1,96 @@
+package openrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"legalbot/internal/reqctx"
+	"legalbot/internal/tracing"
+)
+
+// WithEmbeddingsEndpoint allows customizing the embeddings endpoint when
+// creating a new client.
+func WithEmbeddingsEndpoint(u string) func(*Client) {
+	return func(c *Client) { c.EmbeddingsEndpoint = u }
+}
+
+// WithEmbeddingModel sets the model used by Embed.
+func WithEmbeddingModel(m string) func(*Client) {
+	return func(c *Client) { c.EmbeddingModel = m }
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns one embedding per input using the OpenAI-compatible
+// /embeddings endpoint. Results are in input order.
+func (c *Client) Embed(ctx context.Context, inputs []string) (_ [][]float32, err error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	ctx, span := tracing.Start(ctx, "openrouter.embeddings", tracing.Client)
+	defer func() { span.EndError(err) }()
+	span.SetAttr("model", c.EmbeddingModel)
+	span.SetInt("inputs", int64(len(inputs)))
+	payload, err := json.Marshal(embeddingsRequest{Model: c.EmbeddingModel, Input: inputs})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.EmbeddingsEndpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Authorization", c.apiKey())
+	req.Header.Set("Content-Type", "application/json")
+	reqctx.Inject(ctx, reqctx.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		observe("embeddings", c.EmbeddingModel, 0, start)
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	observe("embeddings", c.EmbeddingModel, resp.StatusCode, start)
+	span.SetInt("http.response.status_code", int64(resp.StatusCode))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("openrouter: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var r embeddingsResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(r.Data) != len(inputs) {
+		return nil, fmt.Errorf("openrouter: got %d embeddings for %d inputs", len(r.Data), len(inputs))
+	}
+	sort.Slice(r.Data, func(i, j int) bool { return r.Data[i].Index < r.Data[j].Index })
+	out := make([][]float32, len(r.Data))
+	for i, d := range r.Data {
+		out[i] = d.Embedding
+	}
+	if c.Logger != nil {
+		c.Logger.InfoContext(ctx, "openrouter embeddings", "model", c.EmbeddingModel, "inputs", len(inputs))
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbedSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if req.Model != "test-model" || len(req.Input) != 2 || req.Input[1] != "b" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		// Out of order on purpose: the client must sort by index.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("Bearer test", WithEmbeddingsEndpoint(srv.URL), WithEmbeddingModel("test-model"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := c.Embed(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0][0] != 1 || got[1][1] != 1 {
+		t.Fatalf("unexpected embeddings %v", got)
+	}
+}
+
+func TestEmbedError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("key", WithEmbeddingsEndpoint(srv.URL))
+	_, err := c.Embed(context.Background(), []string{"a"})
+	if err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Fatalf("expected error containing quota, got %v", err)
+	}
+}
+
+func TestEmbedCountMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("key", WithEmbeddingsEndpoint(srv.URL))
+	if _, err := c.Embed(context.Background(), []string{"a"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEmbedEmpty(t *testing.T) {
+	c := NewWithOptions("key", WithEmbeddingsEndpoint("http://127.0.0.1:0"))
+	got, err := c.Embed(context.Background(), nil)
+	if err != nil || got != nil {
+		t.Fatalf("expected no call for empty input, got %v %v", got, err)
+	}
+}
@@ -0,0 +1,25 @@
+package openrouter
+
+import (
+	"strconv"
+	"time"
+
+	"legalbot/internal/metrics"
+)
+
+var requestDuration = metrics.NewHistogram("openrouter_request_duration_seconds",
+	"Duration of OpenRouter requests by endpoint, model and HTTP status (\"error\" when no response arrived).",
+	metrics.LatencyBuckets, "endpoint", "model", "status")
+
+// observe records a request that started at start. status is 0 when the
+// request failed before a response arrived.
+func observe(endpoint, model string, status int, start time.Time) {
+	s := "error"
+	if status != 0 {
+		s = strconv.Itoa(status)
+	}
+	if model == "" {
+		model = "unknown"
+	}
+	requestDuration.Observe(metrics.Since(start), endpoint, model, s)
+}
@@ -0,0 +1,60 @@
+package pii
+
+// luhn reports whether a card number of 13 to 19 digits has a valid Luhn
+// check digit.
+func luhn(d string) bool {
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(d); i++ {
+		n := int(d[len(d)-1-i] - '0')
+		if i%2 == 1 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// inn reports whether d is an INN with valid check digits: 10 digits for
+// organisations, 12 for individuals.
+func inn(d string) bool {
+	switch len(d) {
+	case 10:
+		return innDigit(d, []int{2, 4, 10, 3, 5, 9, 4, 6, 8}) == d[9]
+	case 12:
+		return innDigit(d, []int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == d[10] &&
+			innDigit(d, []int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == d[11]
+	}
+	return false
+}
+
+// innDigit returns the check digit for the digits of d weighted by w.
+func innDigit(d string, w []int) byte {
+	sum := 0
+	for i, k := range w {
+		sum += int(d[i]-'0') * k
+	}
+	return byte(sum%11%10) + '0'
+}
+
+// snils reports whether the 11 digits of d are a SNILS with a valid check
+// number. Check numbers are only issued above 001-001-998.
+func snils(d string) bool {
+	if len(d) != 11 || d[:9] <= "001001998" {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(d[i]-'0') * (9 - i)
+	}
+	check := sum % 101
+	if check == 100 {
+		check = 0
+	}
+	return check == int(d[9]-'0')*10+int(d[10]-'0')
+}
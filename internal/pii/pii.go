@@ -0,0 +1,281 @@
+// Package pii finds personal data in claim text — Russian passport, SNILS
+// and INN numbers, payment cards, phone numbers and street addresses — and
+// replaces it with placeholders before the text is sent to a third-party
+// model. A Session remembers what each placeholder stands for so the
+// originals can be put back into the generated documents.
+//
+// Numbers with check digits (cards, INN, SNILS) are only taken when the
+// check digits match, so order numbers and amounts are left alone.
+package pii
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"legalbot/internal/config"
+	"legalbot/internal/metrics"
+)
+
+var detected = metrics.NewCounter("pii_detected_total",
+	"Personal data found in text sent to the model, by kind.", "kind")
+
+// Kind is a type of personal data. The names are those of config.PIIKinds.
+type Kind string
+
+const (
+	Passport Kind = "passport"
+	Card     Kind = "card"
+	SNILS    Kind = "snils"
+	INN      Kind = "inn"
+	Phone    Kind = "phone"
+	Address  Kind = "address"
+)
+
+// Mode says what a Redactor does with what it finds.
+type Mode string
+
+const (
+	// Off leaves text untouched.
+	Off Mode = "off"
+	// Detect counts what is found but sends it as is.
+	Detect Mode = "detect"
+	// Redact replaces what is found and restores it in answers.
+	Redact Mode = "redact"
+	// Mask replaces what is found and leaves the placeholders in answers,
+	// so stored results hold no personal data either.
+	Mask Mode = "mask"
+)
+
+// detector finds one kind of data. The span of group 1 of re, or of the
+// whole match when re has no group, is the match, so patterns can require
+// a keyword before it. A match must not continue a number, and for word
+// detectors not a word either; valid, if set, rejects candidates whose
+// check digits do not match.
+type detector struct {
+	kind  Kind
+	re    *regexp.Regexp
+	word  bool
+	valid func(digits string) bool
+}
+
+// detectors are tried in order; a match overlapping an earlier one is
+// dropped, so the kinds with the most specific patterns come first.
+var detectors = []detector{
+	// Series and number after a keyword, in any spacing, or on their own
+	// in the usual "45 06 123456" layout.
+	{kind: Passport, re: regexp.MustCompile(`(?i)(?:паспорт\S*|сери[яи])[\s:,]*(?:сери[яи]\s*)?(\d{2}\s?\d{2}\s*(?:№|номер|no\.?)?\s*\d{6})`)},
+	{kind: Passport, re: regexp.MustCompile(`\d{2} \d{2} (?:№\s?)?\d{6}`)},
+	{kind: Card, re: regexp.MustCompile(`\d{4}(?:[ -]\d{4}){3}|\d{13,19}`), valid: luhn},
+	{kind: SNILS, re: regexp.MustCompile(`\d{3}[- ]?\d{3}[- ]?\d{3}[- ]?\d{2}`), valid: snils},
+	{kind: INN, re: regexp.MustCompile(`\d{12}|\d{10}`), valid: inn},
+	{kind: Phone, re: regexp.MustCompile(`(?:\+7|8)[\s-]?\(?\d{3}\)?[\s-]?\d{3}[\s-]?\d{2}[\s-]?\d{2}`)},
+	// A street, its name and a house number, with the building and flat
+	// when given: "ул. Ленина, д. 5, корп. 2, кв. 17".
+	{kind: Address, word: true, re: regexp.MustCompile(`(?i)(?:ул\.|улица|пр-т|пр\.|проспект|пер\.|переулок|ш\.|шоссе|наб\.|набережная|б-р|бульвар|пл\.|площадь|мкр\.?|микрорайон)\s*["«]?[\p{L}\d][\p{L}\d .«»"-]*?,?\s*(?:д\.|дом)\s*\d+\p{L}?(?:\s*,?\s*(?:корп\.|корпус|к\.|стр\.|строение)\s*\d+)?(?:\s*,?\s*(?:кв\.|квартира|оф\.|офис)\s*\d+)?`)},
+}
+
+// Match is personal data found in a text.
+type Match struct {
+	Kind       Kind
+	Start, End int // byte offsets
+	Value      string
+}
+
+// Redactor finds the configured kinds of personal data.
+type Redactor struct {
+	Mode  Mode
+	kinds map[Kind]bool
+}
+
+// New creates a redactor in mode for kinds; no kinds means all.
+func New(mode Mode, kinds ...Kind) *Redactor {
+	r := &Redactor{Mode: mode, kinds: map[Kind]bool{}}
+	for _, k := range kinds {
+		r.kinds[k] = true
+	}
+	if len(kinds) == 0 {
+		for _, d := range detectors {
+			r.kinds[d.kind] = true
+		}
+	}
+	return r
+}
+
+// FromConfig creates the redactor cfg describes.
+func FromConfig(cfg config.PII) *Redactor {
+	kinds := make([]Kind, len(cfg.Kinds))
+	for i, k := range cfg.Kinds {
+		kinds[i] = Kind(k)
+	}
+	return New(Mode(cfg.Mode), kinds...)
+}
+
+// Find returns the personal data in text in order of position.
+func (r *Redactor) Find(text string) []Match {
+	var out []Match
+	for _, d := range detectors {
+		if !r.kinds[d.kind] {
+			continue
+		}
+		for _, loc := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			if len(loc) > 2 {
+				loc = loc[2:]
+			}
+			m := Match{Kind: d.kind, Start: loc[0], End: loc[1], Value: text[loc[0]:loc[1]]}
+			if !bounded(text, m, d.word) || d.valid != nil && !d.valid(digits(m.Value)) || overlaps(out, m) {
+				continue
+			}
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// bounded reports whether m stands on its own in text rather than being
+// part of a longer number, or of a longer word for word matches.
+func bounded(text string, m Match, word bool) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:m.Start])
+	after, _ := utf8.DecodeRuneInString(text[m.End:])
+	if unicode.IsDigit(before) || before == '+' || unicode.IsDigit(after) {
+		return false
+	}
+	return !word || !unicode.IsLetter(before)
+}
+
+func overlaps(ms []Match, m Match) bool {
+	for _, o := range ms {
+		if m.Start < o.End && o.Start < m.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Session replaces personal data in the texts of one claim. The same value
+// gets the same placeholder each time it appears, also in another layout,
+// e.g. "+7 999 123-45-67" and "89991234567".
+type Session struct {
+	r        *Redactor
+	byKey    map[string]string // kind and normalised value to placeholder
+	original map[string]string // placeholder to the value first seen
+	counts   map[Kind]int
+}
+
+// Session starts a session for one claim.
+func (r *Redactor) Session() *Session {
+	return &Session{r: r, byKey: map[string]string{}, original: map[string]string{}, counts: map[Kind]int{}}
+}
+
+// Redact returns text with personal data replaced by placeholders such as
+// [PHONE_1]. In Detect mode it only counts what it finds, and in Off mode
+// it does nothing.
+func (s *Session) Redact(text string) string {
+	if s.r.Mode == Off || text == "" {
+		return text
+	}
+	matches := s.r.Find(text)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		detected.Inc(string(m.Kind))
+		s.counts[m.Kind]++
+		if s.r.Mode == Detect {
+			continue
+		}
+		b.WriteString(text[last:m.Start])
+		b.WriteString(s.placeholder(m))
+		last = m.End
+	}
+	if s.r.Mode == Detect {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (s *Session) placeholder(m Match) string {
+	key := string(m.Kind) + ":" + normalise(m)
+	if p, ok := s.byKey[key]; ok {
+		return p
+	}
+	n := 1
+	for _, p := range s.byKey {
+		if strings.HasPrefix(p, "["+strings.ToUpper(string(m.Kind))+"_") {
+			n++
+		}
+	}
+	p := "[" + strings.ToUpper(string(m.Kind)) + "_" + strconv.Itoa(n) + "]"
+	s.byKey[key] = p
+	s.original[p] = m.Value
+	return p
+}
+
+// normalise returns what makes two matches the same value: the digits of
+// numbers, with a phone's trunk prefix dropped, and the lower-cased words
+// of addresses.
+func normalise(m Match) string {
+	switch m.Kind {
+	case Address:
+		return strings.Join(strings.Fields(strings.ToLower(m.Value)), " ")
+	case Phone:
+		d := digits(m.Value)
+		return d[len(d)-10:]
+	}
+	return digits(m.Value)
+}
+
+// placeholders matches placeholders, also when a model dropped the
+// brackets.
+var placeholders = regexp.MustCompile(`\[?\b(?:PASSPORT|CARD|SNILS|INN|PHONE|ADDRESS)_\d+\b\]?`)
+
+// Restore returns text with the placeholders of this session replaced by
+// the originals. In Mask mode the placeholders are kept.
+func (s *Session) Restore(text string) string {
+	return s.restore(text, func(v string) string { return v })
+}
+
+// RestoreJSON is Restore for JSON text: originals are escaped as the
+// content of a JSON string.
+func (s *Session) RestoreJSON(text string) string {
+	return s.restore(text, func(v string) string {
+		q, _ := json.Marshal(v)
+		return string(q[1 : len(q)-1])
+	})
+}
+
+func (s *Session) restore(text string, escape func(string) string) string {
+	if s.r.Mode != Redact || len(s.original) == 0 {
+		return text
+	}
+	return placeholders.ReplaceAllStringFunc(text, func(p string) string {
+		key := "[" + strings.Trim(p, "[]") + "]"
+		if v, ok := s.original[key]; ok {
+			return escape(v)
+		}
+		return p
+	})
+}
+
+// Found returns how many matches of each kind Redact saw.
+func (s *Session) Found() map[Kind]int {
+	return s.counts
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+
+	"legalbot/internal/config"
+)
+
+func TestChecksums(t *testing.T) {
+	for _, tc := range []struct {
+		valid  func(string) bool
+		digits string
+		want   bool
+	}{
+		{luhn, "4111111111111111", true},
+		{luhn, "4111111111111112", false},
+		{luhn, "5500000000000004", true},
+		{luhn, "123456789012", false}, // too short
+		{inn, "7707083893", true},
+		{inn, "7707083894", false},
+		{inn, "500100732259", true},
+		{inn, "500100732250", false},
+		{inn, "77070838931", false},
+		{snils, "11223344595", true},
+		{snils, "11223344596", false},
+		{snils, "00100199800", false}, // below the checked range
+	} {
+		if got := tc.valid(tc.digits); got != tc.want {
+			t.Errorf("%s: %v, want %v", tc.digits, got, tc.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	r := New(Redact)
+	for _, tc := range []struct {
+		text string
+		kind Kind
+		want string
+	}{
+		{"мой паспорт серия 45 06 № 123456 выдан", Passport, "45 06 № 123456"},
+		{"паспорта 4506123456", Passport, "4506123456"},
+		{"документ 45 06 123456", Passport, "45 06 123456"},
+		{"карта 4111 1111 1111 1111.", Card, "4111 1111 1111 1111"},
+		{"карта 4111-1111-1111-1111", Card, "4111-1111-1111-1111"},
+		{"СНИЛС 112-233-445 95", SNILS, "112-233-445 95"},
+		{"ИНН 7707083893", INN, "7707083893"},
+		{"ИНН 500100732259", INN, "500100732259"},
+		{"звоните +7 (999) 123-45-67", Phone, "+7 (999) 123-45-67"},
+		{"звоните 8-999-123-45-67", Phone, "8-999-123-45-67"},
+		{"живу: ул. Ленина, д. 5, корп. 2, кв. 17, Москва", Address, "ул. Ленина, д. 5, корп. 2, кв. 17"},
+		{"проспект Мира дом 12а", Address, "проспект Мира дом 12а"},
+	} {
+		got := r.Find(tc.text)
+		if len(got) != 1 || got[0].Kind != tc.kind || got[0].Value != tc.want {
+			t.Errorf("%q: %+v, want %s %q", tc.text, got, tc.kind, tc.want)
+		}
+	}
+	// Numbers that fail their check digits or are part of longer ones are
+	// not personal data.
+	for _, text := range []string{
+		"заказ 4111111111111112 на 12000 рублей",
+		"ИНН 7707083894",
+		"счёт 40817810099910004312",
+		"трек 77070838931",
+		"дул. Ленина, д. 5",
+	} {
+		if got := r.Find(text); len(got) != 0 {
+			t.Errorf("%q: found %+v", text, got)
+		}
+	}
+}
+
+func TestRedactAndRestore(t *testing.T) {
+	s := New(Redact).Session()
+	text := "Тел. +7 999 123-45-67, запасной 89991234567, карта 4111 1111 1111 1111."
+	got := s.Redact(text)
+	if want := "Тел. [PHONE_1], запасной [PHONE_1], карта [CARD_1]."; got != want {
+		t.Fatalf("Redact = %q, want %q", got, want)
+	}
+	if ev := s.Redact("по выписке с карты 4111111111111111"); ev != "по выписке с карты [CARD_1]" {
+		t.Fatalf("placeholder not stable across texts: %q", ev)
+	}
+	if n := s.Found(); n[Phone] != 2 || n[Card] != 2 {
+		t.Fatalf("Found = %v", n)
+	}
+	if out := s.Restore("Звонить на [PHONE_1] или PHONE_1, не [PHONE_2]"); out != "Звонить на +7 999 123-45-67 или +7 999 123-45-67, не [PHONE_2]" {
+		t.Fatalf("Restore = %q", out)
+	}
+
+	s = New(Redact).Session()
+	s.Redact(`адрес: ул. "Новая", д. 1`)
+	if out := s.RestoreJSON(`{"claim_md":"[ADDRESS_1]"}`); out != `{"claim_md":"ул. \"Новая\", д. 1"}` {
+		t.Fatalf("RestoreJSON = %s", out)
+	}
+}
+
+func TestModes(t *testing.T) {
+	text := "ИНН 7707083893, тел. 8 999 123 45 67"
+
+	s := New(Off).Session()
+	if s.Redact(text) != text || len(s.Found()) != 0 {
+		t.Fatal("off mode changed or counted text")
+	}
+
+	before := detected.Value(string(INN))
+	s = New(Detect).Session()
+	if s.Redact(text) != text || s.Found()[INN] != 1 || detected.Value(string(INN))-before != 1 {
+		t.Fatalf("detect mode: %v", s.Found())
+	}
+
+	s = New(Mask).Session()
+	if got := s.Redact(text); got != "ИНН [INN_1], тел. [PHONE_1]" {
+		t.Fatalf("mask mode: %q", got)
+	}
+	if got := s.Restore("[INN_1]"); got != "[INN_1]" {
+		t.Fatalf("mask mode restored %q", got)
+	}
+
+	s = New(Redact, Phone).Session()
+	if got := s.Redact(text); !strings.Contains(got, "7707083893") || !strings.Contains(got, "[PHONE_1]") {
+		t.Fatalf("only phones configured: %q", got)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	r := FromConfig(config.Default().PII)
+	if r.Mode != Redact || len(r.kinds) != len(config.PIIKinds) {
+		t.Fatalf("defaults: %+v", r)
+	}
+	for _, k := range config.PIIKinds {
+		if !r.kinds[Kind(k)] {
+			t.Errorf("kind %q has no detector", k)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Answer is the JSON object requested by OUTPUT_FORMAT in the templates.
+type Answer struct {
+	AdviceMD  string `json:"advice_md"`
+	ClaimMD   string `json:"claim_md"`
+	LawsuitMD string `json:"lawsuit_md"`
+}
+
+// ParseAnswer decodes model output into an Answer. Models often wrap JSON in
+// a ```json fence, which is stripped before decoding.
+func ParseAnswer(s string) (Answer, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+	var a Answer
+	if err := json.Unmarshal([]byte(s), &a); err != nil {
+		return Answer{}, fmt.Errorf("decode answer: %w", err)
+	}
+	if strings.TrimSpace(a.AdviceMD) == "" {
+		return Answer{}, errors.New("decode answer: advice_md is empty")
+	}
+	return a, nil
+}
@@ -0,0 +1,31 @@
+package prompt
+
+import "testing"
+
+func TestParseAnswer(t *testing.T) {
+	a, err := ParseAnswer(`{"advice_md":"a","claim_md":"c","lawsuit_md":"l"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AdviceMD != "a" || a.ClaimMD != "c" || a.LawsuitMD != "l" {
+		t.Fatalf("unexpected answer %+v", a)
+	}
+}
+
+func TestParseAnswerFenced(t *testing.T) {
+	a, err := ParseAnswer("```json\n{\"advice_md\":\"a\"}\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AdviceMD != "a" {
+		t.Fatalf("unexpected answer %+v", a)
+	}
+}
+
+func TestParseAnswerInvalid(t *testing.T) {
+	for _, in := range []string{"plain text", `{"claim_md":"c"}`, ""} {
+		if _, err := ParseAnswer(in); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"legalbot/internal/reqctx"
+	"legalbot/internal/tracing"
+)
+
+// BuildPath is the HTTP route of PromptBuilder.Build. It follows the gRPC
+// method naming from prompt.proto so the same path can be served by a gRPC
+// gateway later.
+const BuildPath = "/legalbot.prompt.v1.PromptBuilder/Build"
+
+// BuildResponse is the JSON body returned by the Build endpoint.
+type BuildResponse struct {
+	Prompt   string `json:"prompt"`
+	Version  string `json:"version"`
+	Category string `json:"category"`
+}
+
+// Client calls the prompt service over JSON/HTTP.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	Logger  *slog.Logger
+}
+
+// NewClient creates a client for the prompt service at baseURL.
+func NewClient(baseURL string, opts ...func(*Client)) *Client {
+	c := &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 5 * time.Second},
+		Logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithLogger sets a custom logger when creating a new client.
+func WithLogger(l *slog.Logger) func(*Client) {
+	return func(c *Client) { c.Logger = l }
+}
+
+// WithHTTPClient sets the client used to call the service, e.g. one
+// presenting a certificate for mutual TLS.
+func WithHTTPClient(h *http.Client) func(*Client) {
+	return func(c *Client) { c.HTTP = h }
+}
+
+// Build asks the prompt service to render the golden prompt.
+func (c *Client) Build(ctx context.Context, r Request) (_ Result, err error) {
+	ctx, span := tracing.Start(ctx, "prompt.build", tracing.Client)
+	defer func() { span.EndError(err) }()
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return Result{}, fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+BuildPath, bytes.NewReader(payload))
+	if err != nil {
+		return Result{}, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	reqctx.Inject(ctx, reqctx.HeaderCarrier(req.Header))
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetInt("http.response.status_code", int64(resp.StatusCode))
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return Result{}, fmt.Errorf("prompt: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var out BuildResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return Result{}, fmt.Errorf("decode response: %w", err)
+	}
+	span.SetAttr("prompt.version", out.Version)
+	span.SetAttr("prompt.category", out.Category)
+	if c.Logger != nil {
+		c.Logger.InfoContext(ctx, "prompt built", "version", out.Version, "category", out.Category, "bytes", len(out.Prompt))
+	}
+	return Result{Prompt: out.Prompt, Version: out.Version, Category: out.Category}, nil
+}
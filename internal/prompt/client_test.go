@@ -0,0 +1,52 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientBuild(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != BuildPath {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if req.ChatID != 7 || req.UserText != "hi" || len(req.Laws) != 1 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		w.Write([]byte(`{"prompt":"built","version":"golden-v2"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL + "/")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := c.Build(ctx, Request{ChatID: 7, UserText: "hi", Laws: []string{"art. 1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Prompt != "built" || got.Version != "golden-v2" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestClientBuildError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad question", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	_, err := c.Build(context.Background(), Request{UserText: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "bad question") {
+		t.Fatalf("expected error containing bad question, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"legalbot/internal/classify"
+)
+
+//go:embed templates/*.tmpl templates/experiment.json
+var templateFS embed.FS
+
+// ErrEmptyQuestion is returned when the request has no user text.
+var ErrEmptyQuestion = errors.New("prompt: empty user question")
+
+// Request holds the values substituted into the golden prompt.
+type Request struct {
+	ChatID   int64     `json:"chatId,string"`
+	UserText string    `json:"userText"`
+	Laws     []string  `json:"laws,omitempty"`
+	Date     time.Time `json:"date"`
+	// Category skips classification when set, e.g. "consumer".
+	Category string `json:"category,omitempty"`
+	// Evidence is text extracted from files attached to the claim.
+	Evidence []Evidence `json:"evidence,omitempty"`
+}
+
+// Evidence is the text of one file the user attached.
+type Evidence struct {
+	Name string `json:"name"`
+	Text string `json:"text,omitempty"`
+}
+
+// Attached files are cut so they do not crowd the question and the law
+// excerpts out of the model's context.
+const (
+	maxEvidenceChars = 6000
+	maxEvidenceTotal = 15000
+)
+
+// Result is a rendered prompt together with the template version and issue
+// category used.
+type Result struct {
+	Prompt   string
+	Version  string
+	Category string
+}
+
+// templateData is the view passed to the template.
+type templateData struct {
+	Date     string
+	Laws     []string
+	UserText string
+	Evidence []evidenceData
+}
+
+type evidenceData struct {
+	Name      string
+	Text      string
+	Truncated bool
+}
+
+// Retriever finds law excerpts relevant to a question.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, k int) ([]string, error)
+}
+
+// Classifier picks the legal domain of a question.
+type Classifier interface {
+	Classify(ctx context.Context, text string) (classify.Result, error)
+}
+
+// Builder renders prompts from versioned templates. Templates embedded in the
+// binary can be extended or overridden by a directory on disk, which is
+// re-read by Reload so new versions and rollbacks do not need a deploy.
+type Builder struct {
+	mu       sync.RWMutex
+	versions map[string]*template.Template
+	exp      Experiment
+
+	dir        string
+	now        func() time.Time
+	retriever  Retriever
+	lawsK      int
+	classifier Classifier
+}
+
+// New loads the templates and experiment and returns a builder.
+func New(opts ...func(*Builder)) (*Builder, error) {
+	b := &Builder{now: time.Now}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WithNow overrides the clock used when the request carries no date.
+func WithNow(f func() time.Time) func(*Builder) {
+	return func(b *Builder) { b.now = f }
+}
+
+// WithDir sets a directory with extra *.tmpl versions and an optional
+// experiment.json overriding the embedded one.
+func WithDir(dir string) func(*Builder) {
+	return func(b *Builder) { b.dir = dir }
+}
+
+// WithRetriever fills the Laws slot with the k best excerpts for the user
+// question when the request carries none.
+func WithRetriever(r Retriever, k int) func(*Builder) {
+	return func(b *Builder) {
+		b.retriever = r
+		b.lawsK = k
+	}
+}
+
+// WithClassifier classifies questions without a category so a domain
+// template can be selected.
+func WithClassifier(c Classifier) func(*Builder) {
+	return func(b *Builder) { b.classifier = c }
+}
+
+// Reload re-reads templates and the experiment. On error the previously
+// loaded set stays active.
+func (b *Builder) Reload() error {
+	versions, exp, err := load(b.dir)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.versions = versions
+	b.exp = exp
+	b.mu.Unlock()
+	return nil
+}
+
+// Experiment returns the active experiment.
+func (b *Builder) Experiment() Experiment {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.exp
+}
+
+// Build renders the prompt with the template version assigned to the chat.
+func (b *Builder) Build(ctx context.Context, req Request) (Result, error) {
+	text := strings.TrimSpace(req.UserText)
+	if text == "" {
+		return Result{}, ErrEmptyQuestion
+	}
+	date := req.Date
+	if date.IsZero() {
+		date = b.now()
+	}
+	category := req.Category
+	if category == "" && b.classifier != nil {
+		res, err := b.classifier.Classify(ctx, text)
+		if err != nil {
+			return Result{}, fmt.Errorf("classify: %w", err)
+		}
+		category = string(res.Category)
+	}
+	if category == "" {
+		category = string(classify.General)
+	}
+	laws := req.Laws
+	if len(laws) == 0 && b.retriever != nil {
+		found, err := b.retriever.Retrieve(ctx, text, b.lawsK)
+		if err != nil {
+			return Result{}, fmt.Errorf("retrieve laws: %w", err)
+		}
+		laws = found
+	}
+	data := templateData{
+		Date:     date.Format("2006-01-02"),
+		Laws:     laws,
+		UserText: text,
+		Evidence: evidenceView(req.Evidence),
+	}
+
+	b.mu.RLock()
+	version := b.exp.Assign(req.ChatID, category)
+	tmpl := b.versions[version]
+	b.mu.RUnlock()
+	if tmpl == nil {
+		return Result{}, fmt.Errorf("prompt: unknown template version %q", version)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return Result{}, fmt.Errorf("execute template %s: %w", version, err)
+	}
+	return Result{Prompt: buf.String(), Version: version, Category: category}, nil
+}
+
+// evidenceView truncates attached texts to maxEvidenceChars each and
+// maxEvidenceTotal together. Files past the total budget are still listed so
+// the model knows they exist.
+func evidenceView(files []Evidence) []evidenceData {
+	budget := maxEvidenceTotal
+	var out []evidenceData
+	for _, f := range files {
+		text := strings.TrimSpace(f.Text)
+		n := utf8.RuneCountInString(text)
+		limit := min(maxEvidenceChars, budget)
+		e := evidenceData{Name: f.Name, Text: text}
+		if n > limit {
+			e.Text = truncateText(text, limit)
+			e.Truncated = true
+		}
+		budget -= utf8.RuneCountInString(e.Text)
+		out = append(out, e)
+	}
+	return out
+}
+
+// truncateText cuts s to at most n runes, preferring to end at a paragraph,
+// line, sentence or word boundary in the last fifth of the window.
+func truncateText(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	cut := string(r[:n])
+	floor := len(string(r[:n-n/5]))
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if i := strings.LastIndex(cut, sep); i >= floor {
+			return strings.TrimSpace(cut[:i+len(strings.TrimRight(sep, " "))])
+		}
+	}
+	return cut
+}
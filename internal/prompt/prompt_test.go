@@ -0,0 +1,277 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"legalbot/internal/classify"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Fatalf("prompt mismatch for %s:\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestBuildGolden(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{
+		UserText: "Магазин отказывается вернуть деньги за неисправный телефон.",
+		Laws: []string{
+			"Закон о защите прав потребителей, ст. 18",
+			"Закон о защите прав потребителей, ст. 22",
+		},
+		Date: time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "golden-v1" {
+		t.Fatalf("unexpected version %q", got.Version)
+	}
+	checkGolden(t, "golden_laws", got.Prompt)
+}
+
+func TestBuildGoldenNoLaws(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	b, err := New(WithNow(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "  Работодатель не выплатил зарплату.  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "golden_no_laws", got.Prompt)
+}
+
+type stubRetriever struct {
+	query string
+	k     int
+	laws  []string
+	err   error
+}
+
+func (s *stubRetriever) Retrieve(ctx context.Context, query string, k int) ([]string, error) {
+	s.query, s.k = query, k
+	return s.laws, s.err
+}
+
+func TestBuildRetrievesLaws(t *testing.T) {
+	r := &stubRetriever{laws: []string{"ГК РФ, ст. 395. Ответственность за неисполнение денежного обязательства\nТекст."}}
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	b, err := New(WithNow(func() time.Time { return now }), WithRetriever(r, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "Должник не возвращает деньги"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.query != "Должник не возвращает деньги" || r.k != 2 {
+		t.Fatalf("unexpected retrieval %q %d", r.query, r.k)
+	}
+	checkGolden(t, "golden_retrieved", got.Prompt)
+}
+
+func TestBuildKeepsRequestLaws(t *testing.T) {
+	r := &stubRetriever{}
+	b, err := New(WithRetriever(r, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "q", Laws: []string{"given"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.query != "" || !strings.Contains(got.Prompt, "given") {
+		t.Fatalf("retriever should not be used when laws are given")
+	}
+}
+
+func TestBuildRetrieveError(t *testing.T) {
+	b, err := New(WithRetriever(&stubRetriever{err: errors.New("index")}, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Build(context.Background(), Request{UserText: "q"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+type stubClassifier struct {
+	text string
+	cat  classify.Category
+	err  error
+}
+
+func (s *stubClassifier) Classify(ctx context.Context, text string) (classify.Result, error) {
+	s.text = text
+	return classify.Result{Category: s.cat}, s.err
+}
+
+func TestBuildDomainTemplates(t *testing.T) {
+	date := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	for _, cat := range classify.Categories {
+		if cat == classify.General {
+			continue
+		}
+		b, err := New(WithClassifier(&stubClassifier{cat: cat}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.Build(context.Background(), Request{UserText: "Вопрос пользователя", Date: date})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Category != string(cat) || got.Version != string(cat)+"-v1" {
+			t.Fatalf("unexpected result for %s: %+v", cat, got)
+		}
+		checkGolden(t, string(cat)+"_v1", got.Prompt)
+	}
+}
+
+func TestBuildRealClassifier(t *testing.T) {
+	b, err := New(WithClassifier(classify.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "Работодатель не выплатил зарплату"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != "labour" || got.Version != "labour-v1" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestBuildRequestCategorySkipsClassifier(t *testing.T) {
+	c := &stubClassifier{cat: classify.Debt}
+	b, err := New(WithClassifier(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "q", Category: "housing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.text != "" || got.Version != "housing-v1" {
+		t.Fatalf("classifier should be skipped, got %+v", got)
+	}
+}
+
+func TestBuildWithoutClassifierIsGeneral(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{UserText: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category != "general" || got.Version != "golden-v1" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestBuildEmptyQuestion(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Build(context.Background(), Request{UserText: " \n"}); !errors.Is(err, ErrEmptyQuestion) {
+		t.Fatalf("expected ErrEmptyQuestion, got %v", err)
+	}
+}
+
+func TestBuildEvidence(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build(context.Background(), Request{
+		UserText: "Продавец не возвращает предоплату по договору.",
+		Date:     time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Category: "general",
+		Evidence: []Evidence{
+			{Name: "contract.pdf", Text: "Договор № 5\nПокупатель вносит предоплату 10 000 руб."},
+			{Name: "photo_1.jpg"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "golden_evidence", got.Prompt)
+}
+
+func TestEvidenceLimits(t *testing.T) {
+	para := strings.Repeat("слово ", 99) + "конец.\n\n"
+	files := []Evidence{
+		{Name: "a.pdf", Text: strings.Repeat(para, 20)},
+		{Name: "b.txt", Text: strings.Repeat("x", 7000)},
+		{Name: "c.txt", Text: strings.Repeat("x", 7000)},
+		{Name: "d.txt", Text: "short"},
+	}
+	view := evidenceView(files)
+	if len(view) != 4 {
+		t.Fatalf("files dropped: %+v", view)
+	}
+	total := 0
+	for i, e := range view[:3] {
+		n := len([]rune(e.Text))
+		total += n
+		if !e.Truncated || n > maxEvidenceChars {
+			t.Fatalf("file %d not truncated: %d chars", i, n)
+		}
+	}
+	if !strings.HasSuffix(view[0].Text, "конец.") {
+		t.Fatalf("not cut at a paragraph: %q", view[0].Text[len(view[0].Text)-40:])
+	}
+	if view[3].Text != "" || !view[3].Truncated {
+		t.Fatalf("file past the budget should be listed without text: %+v", view[3])
+	}
+	if total > maxEvidenceTotal {
+		t.Fatalf("total %d exceeds budget", total)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	cases := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"one two three four five", 20, "one two three four"},
+		{"Первое предложение. Второе", 22, "Первое предложение."},
+		{"abcdefghij", 5, "abcde"},
+		{"abc", 0, ""},
+	}
+	for _, c := range cases {
+		if got := truncateText(c.in, c.n); got != c.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", c.in, c.n, got, c.want)
+		}
+	}
+}
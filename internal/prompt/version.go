@@ -0,0 +1,153 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// experimentFile is the name of the experiment config next to the templates.
+const experimentFile = "experiment.json"
+
+// Variant gives a template version a share of traffic.
+type Variant struct {
+	Version string `json:"version"`
+	Weight  int    `json:"weight"`
+}
+
+// Experiment splits chats between template versions. Setting the weight of a
+// version to zero rolls it back: its chats move to the remaining variants.
+// Categories holds domain-specific variants used instead of Variants for
+// questions classified into that domain.
+type Experiment struct {
+	Name       string               `json:"name"`
+	Variants   []Variant            `json:"variants"`
+	Categories map[string][]Variant `json:"categories,omitempty"`
+}
+
+// Assign deterministically picks the template version for a chat and issue
+// category. The same chat always lands on the same version while the
+// experiment is unchanged.
+func (e Experiment) Assign(chatID int64, category string) string {
+	variants := e.Variants
+	if v, ok := e.Categories[category]; ok {
+		variants = v
+	}
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(e.Name + ":" + strconv.FormatInt(chatID, 10)))
+	bucket := int(h.Sum64() % uint64(total))
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v.Version
+		}
+		bucket -= v.Weight
+	}
+	return ""
+}
+
+// validate checks that the experiment only references loaded versions and
+// routes traffic somewhere.
+func (e Experiment) validate(versions map[string]*template.Template) error {
+	if e.Name == "" {
+		return errors.New("experiment: name is empty")
+	}
+	if err := validateVariants(e.Variants, versions); err != nil {
+		return fmt.Errorf("experiment %s: %w", e.Name, err)
+	}
+	for cat, variants := range e.Categories {
+		if err := validateVariants(variants, versions); err != nil {
+			return fmt.Errorf("experiment %s, category %s: %w", e.Name, cat, err)
+		}
+	}
+	return nil
+}
+
+func validateVariants(variants []Variant, versions map[string]*template.Template) error {
+	total := 0
+	for _, v := range variants {
+		if _, ok := versions[v.Version]; !ok {
+			return fmt.Errorf("unknown version %q", v.Version)
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("negative weight for %q", v.Version)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return errors.New("all weights are zero")
+	}
+	return nil
+}
+
+// load reads embedded templates, then templates from dir (if any), and the
+// experiment config, preferring the one in dir.
+func load(dir string) (map[string]*template.Template, Experiment, error) {
+	versions := map[string]*template.Template{}
+	embedded, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		return nil, Experiment{}, err
+	}
+	if err := loadVersions(embedded, versions); err != nil {
+		return nil, Experiment{}, err
+	}
+	expSrc := embedded
+	if dir != "" {
+		disk := os.DirFS(dir)
+		if err := loadVersions(disk, versions); err != nil {
+			return nil, Experiment{}, err
+		}
+		if _, err := fs.Stat(disk, experimentFile); err == nil {
+			expSrc = disk
+		}
+	}
+	raw, err := fs.ReadFile(expSrc, experimentFile)
+	if err != nil {
+		return nil, Experiment{}, fmt.Errorf("read experiment: %w", err)
+	}
+	var exp Experiment
+	if err := json.Unmarshal(raw, &exp); err != nil {
+		return nil, Experiment{}, fmt.Errorf("decode experiment: %w", err)
+	}
+	if err := exp.validate(versions); err != nil {
+		return nil, Experiment{}, err
+	}
+	return versions, exp, nil
+}
+
+// loadVersions parses every *.tmpl file in fsys. The file name without the
+// extension is the version ID.
+func loadVersions(fsys fs.FS, dst map[string]*template.Template) error {
+	names, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("read template %s: %w", name, err)
+		}
+		id := strings.TrimSuffix(path.Base(name), ".tmpl")
+		tmpl, err := template.New(id).Parse(string(raw))
+		if err != nil {
+			return fmt.Errorf("parse template %s: %w", name, err)
+		}
+		dst[id] = tmpl
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssignDeterministic(t *testing.T) {
+	exp := Experiment{Name: "e1", Variants: []Variant{{"a", 50}, {"b", 50}}}
+	for id := int64(0); id < 100; id++ {
+		if exp.Assign(id, "") != exp.Assign(id, "") {
+			t.Fatalf("assignment for %d is not stable", id)
+		}
+	}
+}
+
+func TestAssignSplit(t *testing.T) {
+	exp := Experiment{Name: "e1", Variants: []Variant{{"a", 90}, {"b", 10}}}
+	counts := map[string]int{}
+	for id := int64(0); id < 10000; id++ {
+		counts[exp.Assign(id, "")]++
+	}
+	if counts["a"] < 8500 || counts["a"] > 9500 {
+		t.Fatalf("unexpected split %v", counts)
+	}
+}
+
+func TestAssignZeroWeightRollsBack(t *testing.T) {
+	exp := Experiment{Name: "e1", Variants: []Variant{{"a", 1}, {"b", 0}}}
+	for id := int64(0); id < 100; id++ {
+		if v := exp.Assign(id, ""); v != "a" {
+			t.Fatalf("chat %d assigned to %q", id, v)
+		}
+	}
+}
+
+func TestAssignCategory(t *testing.T) {
+	exp := Experiment{
+		Name:       "e1",
+		Variants:   []Variant{{"golden", 1}},
+		Categories: map[string][]Variant{"labour": {{"labour-v1", 1}}},
+	}
+	if v := exp.Assign(1, "labour"); v != "labour-v1" {
+		t.Fatalf("expected labour template, got %q", v)
+	}
+	if v := exp.Assign(1, "traffic"); v != "golden" {
+		t.Fatalf("expected default variants for unknown category, got %q", v)
+	}
+}
+
+func TestValidateCategoryVariants(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "experiment.json", `{"name":"x","variants":[{"version":"golden-v1","weight":1}],"categories":{"debt":[{"version":"debt-v9","weight":1}]}}`)
+	if _, err := New(WithDir(dir)); err == nil || !strings.Contains(err.Error(), "category debt") {
+		t.Fatalf("expected category error, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderDirVersionsAndReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "golden-v2.tmpl", "V2 {{ .UserText }}")
+	writeFile(t, dir, "experiment.json", `{"name":"v2-only","variants":[{"version":"golden-v2","weight":1}]}`)
+
+	b, err := New(WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.Build(context.Background(), Request{ChatID: 1, UserText: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != "golden-v2" || res.Prompt != "V2 q" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	// Roll back to the embedded version without restarting.
+	writeFile(t, dir, "experiment.json", `{"name":"rollback","variants":[{"version":"golden-v1","weight":1},{"version":"golden-v2","weight":0}]}`)
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	res, err = b.Build(context.Background(), Request{ChatID: 1, UserText: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != "golden-v1" || !strings.HasPrefix(res.Prompt, "SYSTEM:") {
+		t.Fatalf("unexpected result after rollback %+v", res)
+	}
+}
+
+func TestBuilderReloadKeepsPreviousOnError(t *testing.T) {
+	dir := t.TempDir()
+	b, err := New(WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "experiment.json", `{"name":"bad","variants":[{"version":"missing","weight":1}]}`)
+	if err := b.Reload(); err == nil || !strings.Contains(err.Error(), "unknown version") {
+		t.Fatalf("expected unknown version error, got %v", err)
+	}
+	if b.Experiment().Name != "default" {
+		t.Fatalf("experiment replaced after failed reload: %+v", b.Experiment())
+	}
+}
+
+func TestBuilderRejectsBrokenTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "golden-v3.tmpl", "{{ .UserText ")
+	if _, err := New(WithDir(dir)); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
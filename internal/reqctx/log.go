@@ -0,0 +1,37 @@
+package reqctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logHandler adds request_id and trace_id from the record's context.
+type logHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps h so records logged with a context carry its request
+// ID and trace ID, e.g. logger.InfoContext(ctx, "claim created").
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return logHandler{h}
+}
+
+func (h logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		if tc, ok := Trace(ctx); ok {
+			r.AddAttrs(slog.String("trace_id", tc.TraceIDString()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{h.Handler.WithGroup(name)}
+}
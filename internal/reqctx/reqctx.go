@@ -0,0 +1,135 @@
+// Package reqctx carries a request ID and W3C trace context through a
+// context.Context, across HTTP calls and through queued tasks, so one claim
+// can be followed in the logs of every service it touches.
+//
+// Incoming requests get their IDs from Middleware, which accepts
+// X-Request-ID and traceparent headers or generates them. Outbound requests
+// and task headers get them from Inject; the receiving side calls Extract.
+// Loggers wrapped with NewLogHandler add request_id and trace_id to every
+// record logged with a context.
+package reqctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Header names used for propagation.
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+)
+
+type key int
+
+const (
+	requestIDKey key = iota
+	traceKey
+)
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID of ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTrace returns a context carrying the trace context.
+func WithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey, tc)
+}
+
+// Trace returns the trace context of ctx.
+func Trace(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey).(TraceContext)
+	return tc, ok
+}
+
+// Start returns a context for work that did not arrive with IDs, e.g. an
+// update fetched by long polling: a new request ID and a new trace.
+func Start(ctx context.Context) context.Context {
+	return WithTrace(WithRequestID(ctx, NewRequestID()), NewTrace())
+}
+
+// NewRequestID returns a random 16 hex digit request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Carrier is where IDs travel: HTTP headers or the headers of a queued task.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// MapCarrier carries IDs in task headers, e.g. AMQP message headers.
+type MapCarrier map[string]string
+
+func (m MapCarrier) Get(key string) string { return m[key] }
+
+func (m MapCarrier) Set(key, value string) { m[key] = value }
+
+// Inject writes the request ID and trace context of ctx to c. The receiving
+// side continues the trace as a child of the current span.
+func Inject(ctx context.Context, c Carrier) {
+	if id := RequestID(ctx); id != "" {
+		c.Set(HeaderRequestID, id)
+	}
+	if tc, ok := Trace(ctx); ok {
+		c.Set(HeaderTraceparent, tc.String())
+	}
+}
+
+// Extract returns ctx with the request ID and trace context read from c.
+// Missing or malformed values are generated, and the trace continues with
+// a new span, so the result always carries both.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	id := c.Get(HeaderRequestID)
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+	tc, ok := ParseTraceparent(c.Get(HeaderTraceparent))
+	if ok {
+		tc = tc.Child()
+	} else {
+		tc = NewTrace()
+	}
+	return WithTrace(WithRequestID(ctx, id), tc)
+}
+
+// validRequestID accepts up to 64 letters, digits and -_.: so IDs chosen by
+// callers cannot inject anything into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r))
+	}) < 0
+}
+
+// Middleware extracts the IDs of incoming requests into their context and
+// echoes the request ID in the X-Request-ID response header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), HeaderCarrier(r.Header))
+		w.Header().Set(HeaderRequestID, RequestID(ctx))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// HeaderCarrier carries IDs in HTTP headers.
+type HeaderCarrier http.Header
+
+func (h HeaderCarrier) Get(key string) string { return http.Header(h).Get(key) }
+
+func (h HeaderCarrier) Set(key, value string) { http.Header(h).Set(key, value) }
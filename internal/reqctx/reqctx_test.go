@@ -0,0 +1,111 @@
+package reqctx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := ParseTraceparent(parent)
+	if !ok || tc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanIDString() != "00f067aa0ba902b7" || tc.Flags != 1 {
+		t.Fatalf("parsed %+v %v", tc, ok)
+	}
+	if tc.String() != parent {
+		t.Fatalf("formatted %q", tc.String())
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		parent + "-extra",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01" + parent[2:] + "-future"); !ok {
+		t.Error("rejected a later version with extra fields")
+	}
+}
+
+// headers returns a carrier holding the key, value pairs.
+func headers(kv ...string) HeaderCarrier {
+	h := HeaderCarrier{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func TestExtractContinuesTrace(t *testing.T) {
+	ctx := Extract(context.Background(), headers(HeaderRequestID, "req-1", HeaderTraceparent, parent))
+	if RequestID(ctx) != "req-1" {
+		t.Fatalf("request ID %q", RequestID(ctx))
+	}
+	tc, _ := Trace(ctx)
+	if tc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanIDString() == "00f067aa0ba902b7" || hex.EncodeToString(tc.ParentID[:]) != "00f067aa0ba902b7" {
+		t.Fatalf("trace not continued as a child span: %s", tc)
+	}
+
+	out := HeaderCarrier{}
+	Inject(ctx, out)
+	if out.Get(HeaderRequestID) != "req-1" || out.Get(HeaderTraceparent) != tc.String() {
+		t.Fatalf("injected %v", out)
+	}
+}
+
+func TestExtractGeneratesMissingOrBadIDs(t *testing.T) {
+	for _, c := range []HeaderCarrier{headers(), headers(HeaderRequestID, "bad id\n", HeaderTraceparent, "garbage"), headers(HeaderRequestID, strings.Repeat("a", 65))} {
+		ctx := Extract(context.Background(), c)
+		if id := RequestID(ctx); len(id) != 16 || id == c.Get(HeaderRequestID) {
+			t.Errorf("%v: request ID %q", c, id)
+		}
+		if _, ok := Trace(ctx); !ok {
+			t.Errorf("%v: no trace", c)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got context.Context
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context()
+	}))
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(HeaderRequestID, "abc")
+	r.Header.Set(HeaderTraceparent, parent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if RequestID(got) != "abc" || w.Header().Get(HeaderRequestID) != "abc" {
+		t.Fatalf("request ID %q, response header %q", RequestID(got), w.Header().Get(HeaderRequestID))
+	}
+	if tc, _ := Trace(got); tc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace %s", tc)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var b bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&b, nil))).With("service", "bot")
+	ctx := Extract(context.Background(), headers(HeaderRequestID, "req-1", HeaderTraceparent, parent))
+	logger.InfoContext(ctx, "claim created")
+	logger.Info("no context")
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if !strings.Contains(lines[0], "request_id=req-1") || !strings.Contains(lines[0], "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") || !strings.Contains(lines[0], "service=bot") {
+		t.Fatalf("ids missing: %s", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Fatalf("ids on a record without context: %s", lines[1])
+	}
+}
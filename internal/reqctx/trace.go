@@ -0,0 +1,91 @@
+package reqctx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// TraceContext is a W3C trace context: the trace a request belongs to and
+// the span of the service handling it.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// ParentID is the span that started this one, zero for the root of a
+	// trace. It is not propagated; the receiving side learns it from SpanID.
+	ParentID [8]byte
+	// Flags holds the trace flags; bit 0 marks the trace as sampled.
+	Flags byte
+}
+
+// NewTrace starts a sampled trace.
+func NewTrace() TraceContext {
+	var tc TraceContext
+	rand.Read(tc.TraceID[:])
+	rand.Read(tc.SpanID[:])
+	tc.Flags = 1
+	return tc
+}
+
+// Child returns a new span in the same trace whose parent is tc.
+func (tc TraceContext) Child() TraceContext {
+	c := tc
+	c.ParentID = tc.SpanID
+	rand.Read(c.SpanID[:])
+	return c
+}
+
+// TraceIDString returns the trace ID in hex, as logged.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the span ID in hex.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// Sampled reports whether the trace is recorded.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&1 == 1
+}
+
+// String formats tc as a traceparent header value.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceIDString(), tc.SpanIDString(), tc.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Versions other than
+// 00 are accepted as long as they start with the version 00 fields, as the
+// specification requires.
+func ParseTraceparent(s string) (TraceContext, bool) {
+	var tc TraceContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || (len(s) > 55 && s[55] != '-') {
+		return tc, false
+	}
+	version, err := hex.DecodeString(s[:2])
+	if err != nil || version[0] == 0xff || version[0] == 0 && len(s) != 55 {
+		return tc, false
+	}
+	if !lowerHex(s[:2]) || !lowerHex(s[3:35]) || !lowerHex(s[36:52]) || !lowerHex(s[53:55]) {
+		return tc, false
+	}
+	hex.Decode(tc.TraceID[:], []byte(s[3:35]))
+	hex.Decode(tc.SpanID[:], []byte(s[36:52]))
+	var flags [1]byte
+	hex.Decode(flags[:], []byte(s[53:55]))
+	tc.Flags = flags[0]
+	if tc.TraceID == [16]byte{} || tc.SpanID == [8]byte{} {
+		return TraceContext{}, false
+	}
+	return tc, true
+}
+
+func lowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+// Package secrets reads the tokens, keys and the database DSN from where a
+// deployment keeps them: environment variables, files mounted as Docker
+// secrets or a Vault KV v2 engine.
+//
+// A Watcher fills the configuration from a Provider at startup and then
+// re-reads the secrets periodically, calling the registered handlers when a
+// value is rotated so clients pick it up without a restart.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrNotFound is returned by providers that do not hold a secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Names of the secrets the services read. The env provider reads them from
+// the upper-case variable, e.g. TELEGRAM_TOKEN, the file provider from a
+// file of that name and the Vault provider from that key.
+const (
+	TelegramToken = "telegram_token"
+	WebhookSecret = "telegram_secret_token"
+	OpenRouterKey = "openrouter_api_key"
+	PostgresDSN   = "postgres_dsn"
+)
+
+// Provider looks up secrets by name.
+type Provider interface {
+	// Lookup returns the current value of the named secret, or an error
+	// wrapping ErrNotFound when the provider does not hold it.
+	Lookup(ctx context.Context, name string) (string, error)
+}
+
+// Env reads secrets from environment variables through a function such as
+// os.Getenv.
+type Env func(string) string
+
+// Lookup returns the variable named after the upper-cased secret name.
+func (e Env) Lookup(ctx context.Context, name string) (string, error) {
+	v := e(strings.ToUpper(name))
+	if v == "" {
+		return "", fmt.Errorf("%s: %w", strings.ToUpper(name), ErrNotFound)
+	}
+	return v, nil
+}
+
+// Dir reads secrets from files named after them, e.g. the /run/secrets
+// directory Docker and Kubernetes mount secrets into.
+type Dir string
+
+// Lookup returns the content of the file without its trailing newline.
+func (d Dir) Lookup(ctx context.Context, name string) (string, error) {
+	path := filepath.Join(string(d), name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimRight(string(data), "\r\n")
+	if v == "" {
+		return "", fmt.Errorf("%s is empty: %w", path, ErrNotFound)
+	}
+	return v, nil
+}
+
+// Value holds a secret that may be rotated while it is in use.
+type Value struct {
+	v atomic.Pointer[string]
+}
+
+// NewValue returns a Value holding s.
+func NewValue(s string) *Value {
+	v := &Value{}
+	v.Store(s)
+	return v
+}
+
+// Load returns the current value.
+func (v *Value) Load() string {
+	if p := v.v.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// Store replaces the value; it can be passed to Watcher.OnChange.
+func (v *Value) Store(s string) {
+	v.v.Store(&s)
+}
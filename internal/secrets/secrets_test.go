@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"legalbot/internal/config"
+)
+
+func TestEnv(t *testing.T) {
+	p := Env(func(k string) string {
+		return map[string]string{"TELEGRAM_TOKEN": "123:abc"}[k]
+	})
+	if v, err := p.Lookup(context.Background(), TelegramToken); err != nil || v != "123:abc" {
+		t.Fatalf("Lookup = %q, %v", v, err)
+	}
+	if _, err := p.Lookup(context.Background(), PostgresDSN); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unset variable: %v, want ErrNotFound", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, PostgresDSN), []byte("postgres://db/legalbot\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := Dir(dir)
+	if v, err := p.Lookup(context.Background(), PostgresDSN); err != nil || v != "postgres://db/legalbot" {
+		t.Fatalf("Lookup = %q, %v", v, err)
+	}
+	if _, err := p.Lookup(context.Background(), TelegramToken); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing file: %v, want ErrNotFound", err)
+	}
+}
+
+func TestWatcherFillsAndReloads(t *testing.T) {
+	f := newFakeVault(t)
+	f.set(OpenRouterKey, "key-1")
+	cfg := config.Default()
+	cfg.Secrets.Provider = "vault"
+	cfg.Secrets.VaultAddr = f.URL
+	cfg.Secrets.VaultRoleID = "role"
+	cfg.Secrets.VaultSecretID = "s3cret"
+	cfg.DB.DSN = "postgres://from-file/legalbot"
+	ctx := context.Background()
+
+	w, err := Open(ctx, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Telegram.Token != "123:abc" || cfg.OpenRouter.APIKey != "key-1" {
+		t.Fatalf("not filled from vault: %q %q", string(cfg.Telegram.Token), string(cfg.OpenRouter.APIKey))
+	}
+	if cfg.DB.DSN != "postgres://from-file/legalbot" {
+		t.Fatal("secret missing from vault replaced the configured value")
+	}
+
+	key := NewValue(string(cfg.OpenRouter.APIKey))
+	w.OnChange(OpenRouterKey, key.Store)
+	var dsns []string
+	w.OnChange(PostgresDSN, func(v string) { dsns = append(dsns, v) })
+
+	w.Refresh(ctx)
+	if key.Load() != "key-1" || len(dsns) != 0 {
+		t.Fatal("handlers called without a rotation")
+	}
+
+	f.set(OpenRouterKey, "key-2")
+	f.set(PostgresDSN, "postgres://rotated/legalbot")
+	before := rotations.Value(OpenRouterKey)
+	w.Refresh(ctx)
+	if key.Load() != "key-2" {
+		t.Fatalf("key = %q after rotation", key.Load())
+	}
+	if len(dsns) != 1 || dsns[0] != "postgres://rotated/legalbot" {
+		t.Fatalf("DSN handler calls %q", dsns)
+	}
+	if rotations.Value(OpenRouterKey) != before+1 {
+		t.Fatal("rotation not counted")
+	}
+
+	// A failing provider keeps the last values.
+	f.revoke()
+	w.Provider = NewVault(f.URL, "legalbot", WithToken("revoked"))
+	w.Refresh(ctx)
+	if key.Load() != "key-2" {
+		t.Fatal("value lost after a failed refresh")
+	}
+}
+
+func TestOpenRejectsInvalidProvider(t *testing.T) {
+	cfg := config.Default()
+	cfg.Secrets.Provider = "vault"
+	if _, err := Open(context.Background(), cfg, nil); err == nil {
+		t.Fatal("vault without an address accepted")
+	}
+}
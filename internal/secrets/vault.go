@@ -0,0 +1,285 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault reads secrets from one path of a Vault KV version 2 engine. Each
+// secret is a key of that path's data.
+//
+// The Vault token comes from WithToken or an AppRole login. Lookup renews
+// the token once two thirds of its lease have passed; when renewal fails
+// or the lease ends it logs in again if AppRole is configured.
+type Vault struct {
+	// Address is the Vault server, e.g. https://vault:8200.
+	Address string
+	// Mount is where the KV engine is mounted, "secret" by default.
+	Mount string
+	// Path is the secret path below the mount, e.g. "legalbot".
+	Path string
+	// AppRoleMount is where the AppRole auth method is mounted, "approle"
+	// by default.
+	AppRoleMount string
+	HTTP         *http.Client
+	Logger       *slog.Logger
+
+	roleID, secretID string
+	now              func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	leased    bool // the lease below is known
+	renewable bool
+	renewAt   time.Time
+	expires   time.Time // zero for tokens that do not expire
+}
+
+// NewVault creates a provider reading the KV v2 secret at path from the
+// server at addr. Authenticate it with WithToken or WithAppRole.
+func NewVault(addr, path string, opts ...func(*Vault)) *Vault {
+	v := &Vault{
+		Address:      strings.TrimRight(addr, "/"),
+		Mount:        "secret",
+		Path:         strings.Trim(path, "/"),
+		AppRoleMount: "approle",
+		HTTP:         &http.Client{Timeout: 10 * time.Second},
+		Logger:       slog.Default(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// WithToken authenticates with a Vault token.
+func WithToken(token string) func(*Vault) {
+	return func(v *Vault) { v.token = token }
+}
+
+// WithAppRole authenticates by logging in with an AppRole role and secret
+// ID.
+func WithAppRole(roleID, secretID string) func(*Vault) {
+	return func(v *Vault) { v.roleID, v.secretID = roleID, secretID }
+}
+
+// WithMount sets where the KV engine is mounted.
+func WithMount(m string) func(*Vault) {
+	return func(v *Vault) { v.Mount = strings.Trim(m, "/") }
+}
+
+// WithHTTPClient sets the client used to call Vault.
+func WithHTTPClient(c *http.Client) func(*Vault) {
+	return func(v *Vault) { v.HTTP = c }
+}
+
+// WithLogger allows setting a custom logger when creating a provider.
+func WithLogger(l *slog.Logger) func(*Vault) {
+	return func(v *Vault) { v.Logger = l }
+}
+
+// withNow sets the clock, for tests of lease renewal.
+func withNow(f func() time.Time) func(*Vault) {
+	return func(v *Vault) { v.now = f }
+}
+
+// Lookup reads the secret path and returns the key name.
+func (v *Vault) Lookup(ctx context.Context, name string) (string, error) {
+	data, err := v.read(ctx)
+	if err != nil {
+		return "", err
+	}
+	s, ok := data[name].(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("vault %s/%s: key %s: %w", v.Mount, v.Path, name, ErrNotFound)
+	}
+	return s, nil
+}
+
+func (v *Vault) read(ctx context.Context) (map[string]any, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	path := "/v1/" + v.Mount + "/data/" + v.Path
+	for attempt := 0; ; attempt++ {
+		token, err := v.clientToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		status, err := v.call(ctx, http.MethodGet, path, token, nil, &resp)
+		switch {
+		case status == http.StatusForbidden && attempt == 0 && v.roleID != "":
+			// The token was revoked or has expired early; log in again.
+			v.forget(token)
+			continue
+		case status == http.StatusNotFound:
+			return nil, fmt.Errorf("vault %s/%s: %w", v.Mount, v.Path, ErrNotFound)
+		case err != nil:
+			return nil, fmt.Errorf("vault read %s/%s: %w", v.Mount, v.Path, err)
+		}
+		return resp.Data.Data, nil
+	}
+}
+
+// authResponse is the auth block of login and renewal responses.
+type authResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// clientToken returns a token that is valid now, logging in or renewing as
+// needed.
+func (v *Vault) clientToken(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	switch {
+	case v.token == "":
+		return v.login(ctx)
+	case !v.leased:
+		if err := v.lookupSelf(ctx); err != nil {
+			return "", err
+		}
+	case !v.expires.IsZero() && !now.Before(v.renewAt):
+		if v.renewable {
+			err := v.renew(ctx)
+			if err == nil {
+				return v.token, nil
+			}
+			v.Logger.WarnContext(ctx, "vault token renewal failed", "err", err)
+		}
+		if v.roleID != "" {
+			return v.login(ctx)
+		}
+		if !now.Before(v.expires) {
+			return "", fmt.Errorf("vault token expired and cannot be renewed")
+		}
+	}
+	return v.token, nil
+}
+
+// forget drops token so the next call logs in again.
+func (v *Vault) forget(token string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.token == token {
+		v.token, v.leased = "", false
+	}
+}
+
+func (v *Vault) login(ctx context.Context) (string, error) {
+	if v.roleID == "" {
+		return "", fmt.Errorf("vault: no token or AppRole configured")
+	}
+	body, _ := json.Marshal(map[string]string{"role_id": v.roleID, "secret_id": v.secretID})
+	var resp authResponse
+	if _, err := v.call(ctx, http.MethodPost, "/v1/auth/"+v.AppRoleMount+"/login", "", body, &resp); err != nil {
+		return "", fmt.Errorf("vault approle login: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault approle login: no token in response")
+	}
+	v.token = resp.Auth.ClientToken
+	v.setLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	v.Logger.InfoContext(ctx, "vault login", "lease", time.Duration(resp.Auth.LeaseDuration)*time.Second)
+	return v.token, nil
+}
+
+func (v *Vault) lookupSelf(ctx context.Context) error {
+	var resp struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if _, err := v.call(ctx, http.MethodGet, "/v1/auth/token/lookup-self", v.token, nil, &resp); err != nil {
+		return fmt.Errorf("vault token lookup: %w", err)
+	}
+	v.setLease(resp.Data.TTL, resp.Data.Renewable)
+	return nil
+}
+
+func (v *Vault) renew(ctx context.Context) error {
+	var resp authResponse
+	if _, err := v.call(ctx, http.MethodPost, "/v1/auth/token/renew-self", v.token, []byte("{}"), &resp); err != nil {
+		return err
+	}
+	v.setLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	v.Logger.DebugContext(ctx, "vault token renewed", "lease", time.Duration(resp.Auth.LeaseDuration)*time.Second)
+	return nil
+}
+
+// setLease records a lease of ttl seconds; 0 means the token does not
+// expire.
+func (v *Vault) setLease(ttl int64, renewable bool) {
+	v.leased, v.renewable = true, renewable
+	v.expires, v.renewAt = time.Time{}, time.Time{}
+	if ttl > 0 {
+		now := v.now()
+		lease := time.Duration(ttl) * time.Second
+		v.expires = now.Add(lease)
+		v.renewAt = now.Add(lease * 2 / 3)
+	}
+}
+
+// call sends a request to Vault and decodes a 2xx JSON answer into out. It
+// returns the status code, and an error carrying Vault's messages for other
+// codes.
+func (v *Vault) call(ctx context.Context, method, path, token string, body []byte, out any) (int, error) {
+	u, err := url.JoinPath(v.Address, path)
+	if err != nil {
+		return 0, err
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return 0, fmt.Errorf("new request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(data, &e)
+		if len(e.Errors) > 0 {
+			return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.Join(e.Errors, "; "))
+		}
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,204 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the KV v2 read, AppRole login and token endpoints the
+// provider uses.
+type fakeVault struct {
+	URL string
+
+	mu        sync.Mutex
+	data      map[string]any // secret/data/legalbot
+	tokens    map[string]bool
+	ttl       int64 // lease of issued and renewed tokens, in seconds
+	renewable bool
+	logins    int
+	renewals  int
+	failRenew bool
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	f := &fakeVault{
+		data:      map[string]any{TelegramToken: "123:abc"},
+		tokens:    map[string]bool{"root": true},
+		ttl:       60,
+		renewable: true,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	f.URL = srv.URL
+	return f
+}
+
+func (f *fakeVault) set(key string, value any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = value
+}
+
+func (f *fakeVault) counts() (logins, renewals int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins, f.renewals
+}
+
+// revoke invalidates every issued token.
+func (f *fakeVault) revoke() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = map[string]bool{}
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fail := func(code int, msg string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{msg}})
+	}
+	auth := func(token string) map[string]any {
+		return map[string]any{"auth": map[string]any{
+			"client_token": token, "lease_duration": f.ttl, "renewable": f.renewable,
+		}}
+	}
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || body["role_id"] != "role" || body["secret_id"] != "s3cret" {
+			fail(http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		f.logins++
+		token := fmt.Sprintf("approle-%d", f.logins)
+		f.tokens[token] = true
+		json.NewEncoder(w).Encode(auth(token))
+		return
+	}
+	token := r.Header.Get("X-Vault-Token")
+	if !f.tokens[token] {
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"ttl": f.ttl, "renewable": f.renewable}})
+	case "/v1/auth/token/renew-self":
+		if f.failRenew {
+			fail(http.StatusBadRequest, "lease is not renewable")
+			return
+		}
+		f.renewals++
+		json.NewEncoder(w).Encode(auth(token))
+	case "/v1/secret/data/legalbot":
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data": f.data, "metadata": map[string]any{"version": 1},
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestVaultToken(t *testing.T) {
+	f := newFakeVault(t)
+	v := NewVault(f.URL, "legalbot", WithToken("root"))
+	got, err := v.Lookup(context.Background(), TelegramToken)
+	if err != nil || got != "123:abc" {
+		t.Fatalf("Lookup = %q, %v", got, err)
+	}
+	if _, err := v.Lookup(context.Background(), OpenRouterKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing key: %v, want ErrNotFound", err)
+	}
+	if _, err := NewVault(f.URL, "other", WithToken("root")).Lookup(context.Background(), TelegramToken); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing path: %v, want ErrNotFound", err)
+	}
+
+	_, err = NewVault(f.URL, "legalbot", WithToken("stolen")).Lookup(context.Background(), TelegramToken)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("bad token: %v", err)
+	}
+}
+
+func TestVaultAppRoleRenewsAndLogsInAgain(t *testing.T) {
+	f := newFakeVault(t)
+	now := time.Unix(1700000000, 0)
+	v := NewVault(f.URL, "legalbot", WithAppRole("role", "s3cret"), withNow(func() time.Time { return now }))
+	ctx := context.Background()
+
+	if _, err := v.Lookup(ctx, TelegramToken); err != nil {
+		t.Fatal(err)
+	}
+	if logins, _ := f.counts(); logins != 1 {
+		t.Fatalf("logins = %d, want 1", logins)
+	}
+
+	// Within the first two thirds of the lease the token is reused.
+	now = now.Add(30 * time.Second)
+	v.Lookup(ctx, TelegramToken)
+	if logins, renewals := f.counts(); logins != 1 || renewals != 0 {
+		t.Fatalf("logins %d, renewals %d; want the token reused", logins, renewals)
+	}
+
+	now = now.Add(15 * time.Second)
+	if _, err := v.Lookup(ctx, TelegramToken); err != nil {
+		t.Fatal(err)
+	}
+	if logins, renewals := f.counts(); logins != 1 || renewals != 1 {
+		t.Fatalf("logins %d, renewals %d; want one renewal", logins, renewals)
+	}
+
+	// When renewal fails the provider logs in again.
+	f.mu.Lock()
+	f.failRenew = true
+	f.mu.Unlock()
+	now = now.Add(45 * time.Second)
+	if _, err := v.Lookup(ctx, TelegramToken); err != nil {
+		t.Fatal(err)
+	}
+	if logins, _ := f.counts(); logins != 2 {
+		t.Fatalf("logins = %d, want a new login after a failed renewal", logins)
+	}
+
+	// A revoked token is replaced by a new login.
+	f.revoke()
+	if _, err := v.Lookup(ctx, TelegramToken); err != nil {
+		t.Fatalf("after revocation: %v", err)
+	}
+	if logins, _ := f.counts(); logins != 3 {
+		t.Fatalf("logins = %d, want a new login after revocation", logins)
+	}
+}
+
+func TestVaultStaticTokenExpires(t *testing.T) {
+	f := newFakeVault(t)
+	f.renewable = false
+	now := time.Unix(1700000000, 0)
+	v := NewVault(f.URL, "legalbot", WithToken("root"), withNow(func() time.Time { return now }))
+	if _, err := v.Lookup(context.Background(), TelegramToken); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	_, err := v.Lookup(context.Background(), TelegramToken)
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expired token: %v", err)
+	}
+}
+
+func TestVaultBadAppRole(t *testing.T) {
+	f := newFakeVault(t)
+	_, err := NewVault(f.URL, "legalbot", WithAppRole("role", "wrong")).Lookup(context.Background(), TelegramToken)
+	if err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Fatalf("bad secret ID: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/metrics"
+)
+
+var (
+	rotations = metrics.NewCounter("secrets_rotations_total",
+		"Secrets whose value changed on refresh, by name.", "name")
+	refreshErrors = metrics.NewCounter("secrets_refresh_errors_total",
+		"Failed secret lookups on refresh, by name.", "name")
+)
+
+// Watcher keeps the secrets read through it current.
+type Watcher struct {
+	Provider Provider
+	// Interval is how often Run re-reads the secrets.
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	mu       sync.Mutex
+	names    []string
+	values   map[string]string
+	handlers map[string][]func(string)
+}
+
+// NewWatcher creates a watcher reading from p every minute.
+func NewWatcher(p Provider, opts ...func(*Watcher)) *Watcher {
+	w := &Watcher{
+		Provider: p,
+		Interval: time.Minute,
+		Logger:   slog.Default(),
+		values:   map[string]string{},
+		handlers: map[string][]func(string){},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// WithInterval sets how often Run re-reads the secrets.
+func WithInterval(d time.Duration) func(*Watcher) {
+	return func(w *Watcher) { w.Interval = d }
+}
+
+// Get returns the current value of the named secret and watches it from
+// then on, also when the provider does not hold it yet.
+func (w *Watcher) Get(ctx context.Context, name string) (string, error) {
+	v, err := w.Provider.Lookup(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.values[name]; !ok {
+		w.names = append(w.names, name)
+	}
+	w.values[name] = v
+	return v, err
+}
+
+// OnChange registers fn to be called with the new value when the named
+// secret is rotated. Handlers run on the goroutine calling Refresh.
+func (w *Watcher) OnChange(name string, fn func(string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[name] = append(w.handlers[name], fn)
+}
+
+// Refresh re-reads the watched secrets and calls the handlers of those
+// that changed. A secret that cannot be read keeps its last value.
+func (w *Watcher) Refresh(ctx context.Context) {
+	w.mu.Lock()
+	names := append([]string(nil), w.names...)
+	w.mu.Unlock()
+	for _, name := range names {
+		v, err := w.Provider.Lookup(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			refreshErrors.Inc(name)
+			w.Logger.ErrorContext(ctx, "refresh secret", "name", name, "err", err)
+			continue
+		}
+		w.mu.Lock()
+		changed := w.values[name] != v
+		w.values[name] = v
+		handlers := append([]func(string){}, w.handlers[name]...)
+		w.mu.Unlock()
+		if !changed {
+			continue
+		}
+		rotations.Inc(name)
+		w.Logger.InfoContext(ctx, "secret rotated", "name", name)
+		for _, fn := range handlers {
+			fn(v)
+		}
+	}
+}
+
+// Run refreshes the secrets every Interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	t := time.NewTicker(w.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.Refresh(ctx)
+		}
+	}
+}
+
+// Fill replaces the secret settings of cfg with the values the provider
+// holds. Settings it does not hold keep their configured values.
+func (w *Watcher) Fill(ctx context.Context, cfg *config.Config) error {
+	var errs []error
+	for _, s := range []struct {
+		name string
+		dst  *config.Secret
+	}{
+		{TelegramToken, &cfg.Telegram.Token},
+		{WebhookSecret, &cfg.Telegram.WebhookSecret},
+		{OpenRouterKey, &cfg.OpenRouter.APIKey},
+		{PostgresDSN, &cfg.DB.DSN},
+	} {
+		v, err := w.Get(ctx, s.name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			errs = append(errs, fmt.Errorf("secret %s: %w", s.name, err))
+		default:
+			*s.dst = config.Secret(v)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FromConfig returns the provider cfg selects. A nil logger means
+// slog.Default.
+func FromConfig(cfg config.Secrets, logger *slog.Logger) (Provider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	switch cfg.Provider {
+	case "file":
+		return Dir(cfg.Dir), nil
+	case "vault":
+		opts := []func(*Vault){WithMount(cfg.VaultMount), WithLogger(logger)}
+		if cfg.VaultRoleID != "" {
+			opts = append(opts, WithAppRole(cfg.VaultRoleID, string(cfg.VaultSecretID)))
+		} else {
+			opts = append(opts, WithToken(string(cfg.VaultToken)))
+		}
+		v := NewVault(cfg.VaultAddr, cfg.VaultPath, opts...)
+		v.AppRoleMount = cfg.VaultAppRoleMount
+		return v, nil
+	}
+	return Env(os.Getenv), nil
+}
+
+// Open creates a watcher for the provider cfg selects and fills cfg from
+// it. Start Run to pick up rotated secrets.
+func Open(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*Watcher, error) {
+	p, err := FromConfig(cfg.Secrets, logger)
+	if err != nil {
+		return nil, err
+	}
+	w := NewWatcher(p, WithInterval(cfg.Secrets.Refresh))
+	if logger != nil {
+		w.Logger = logger
+	}
+	if err := w.Fill(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
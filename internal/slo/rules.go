@@ -0,0 +1,80 @@
+package slo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// WriteRules writes a Prometheus rules file for cfg. Each objective gets a
+// group recording its error ratio over every alert window and the
+// multi-window burn-rate alerts built on those ratios.
+func WriteRules(w io.Writer, cfg Config) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Code generated by botctl slo-rules. DO NOT EDIT.")
+	fmt.Fprintln(bw, "groups:")
+	for _, o := range cfg.Objectives {
+		fmt.Fprintf(bw, "  - name: slo_%s\n", o.Name)
+		fmt.Fprintln(bw, "    rules:")
+		for _, win := range cfg.Windows() {
+			d := promDuration(win)
+			fmt.Fprintf(bw, "      - record: %s\n", ratioName(o, d))
+			writeExpr(bw, "("+window(o.Bad, d)+")\n/\n("+window(o.Total, d)+")")
+			fmt.Fprintln(bw, "        labels:")
+			fmt.Fprintf(bw, "          slo: %s\n", o.Name)
+		}
+		for _, a := range cfg.Alerts {
+			long, short := promDuration(a.Long), promDuration(a.Short)
+			limit := fmt.Sprintf("(%s * %s)", number(a.BurnRate), number(o.ErrorBudget()))
+			fmt.Fprintf(bw, "      - alert: %sBudgetBurn\n", camel(o.Name))
+			writeExpr(bw, ratioName(o, long)+" > "+limit+"\nand\n"+ratioName(o, short)+" > "+limit)
+			fmt.Fprintf(bw, "        for: %s\n", promDuration(a.For))
+			fmt.Fprintln(bw, "        labels:")
+			fmt.Fprintf(bw, "          severity: %s\n", a.Severity)
+			fmt.Fprintf(bw, "          slo: %s\n", o.Name)
+			fmt.Fprintf(bw, "          long_window: %s\n", long)
+			fmt.Fprintln(bw, "        annotations:")
+			fmt.Fprintf(bw, "          summary: %s\n", strconv.Quote(fmt.Sprintf("%s error budget burning %sx too fast over %s and %s", o.Name, number(a.BurnRate), long, short)))
+			fmt.Fprintf(bw, "          description: %s\n", strconv.Quote(fmt.Sprintf("Objective: %s Target: %s.", o.Description, number(o.Target))))
+		}
+	}
+	return bw.Flush()
+}
+
+// writeExpr writes expr as a literal block so PromQL needs no escaping.
+func writeExpr(w *bufio.Writer, expr string) {
+	fmt.Fprintln(w, "        expr: |-")
+	for _, line := range strings.Split(expr, "\n") {
+		fmt.Fprintf(w, "          %s\n", line)
+	}
+}
+
+// ratioName is the recorded error ratio of o over window d.
+func ratioName(o Objective, d string) string {
+	return "slo:" + o.Name + ":error_ratio_rate" + d
+}
+
+func window(expr, d string) string {
+	return strings.ReplaceAll(expr, "$window", d)
+}
+
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// camel turns claim_latency into ClaimLatency.
+func camel(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		for i, r := range part {
+			if i == 0 {
+				r = unicode.ToUpper(r)
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,141 @@
+// Package slo tracks LegalBot's service level objectives in process and
+// generates the matching Prometheus burn-rate alerts.
+//
+// Both use the same Config, so /debug/slo and the alerts agree on what a good
+// claim is. Config describes objectives with PromQL for Prometheus; the
+// Tracker classifies the claims it records by the objective's Kind.
+package slo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Kind is what an objective measures.
+type Kind int
+
+const (
+	// Availability is the share of processed claims answered without an
+	// error.
+	Availability Kind = iota
+	// Latency is the share of answered claims delivered within Threshold of
+	// receiving their update.
+	Latency
+)
+
+// Objective is one service level objective.
+type Objective struct {
+	// Name identifies the objective in rules and reports, e.g.
+	// "claim_latency".
+	Name        string
+	Description string
+	Kind        Kind
+	// Target is the share of good events, e.g. 0.95.
+	Target float64
+	// Threshold is the slowest good answer of a Latency objective.
+	Threshold time.Duration
+	// Bad and Total are PromQL expressions for the per-second rate of bad
+	// and all events. $window is replaced with the range, e.g. 5m.
+	Bad, Total string
+}
+
+// ErrorBudget is the share of events allowed to be bad.
+func (o Objective) ErrorBudget() float64 {
+	return 1 - o.Target
+}
+
+// Alert is a multi-window burn-rate alert: it fires when the error budget
+// is spent BurnRate times faster than sustainable over both the Long and the
+// Short window. The short window makes the alert stop soon after the
+// problem does.
+type Alert struct {
+	Severity    string
+	Long, Short time.Duration
+	BurnRate    float64
+	// For is how long both conditions must hold before the alert fires.
+	For time.Duration
+}
+
+// Config is a set of objectives and the alerts on each of them.
+type Config struct {
+	Objectives []Objective
+	Alerts     []Alert
+}
+
+// Windows returns the distinct alert windows, shortest first.
+func (c Config) Windows() []time.Duration {
+	var ws []time.Duration
+	for _, a := range c.Alerts {
+		ws = append(ws, a.Short, a.Long)
+	}
+	slices.Sort(ws)
+	return slices.Compact(ws)
+}
+
+// answerThreshold is the SPEC's answer time target.
+const answerThreshold = 10 * time.Second
+
+// failedOutcomes are the claim outcomes caused by the service. Claims
+// refused for length, consent or rate limits are not processed and do not
+// count, nor do claims the bot queued until the worker answers them.
+const failedOutcomes = `prompt_error|model_error|db_error|send_error`
+
+// Claims are answered by the bot, or by the worker when they are queued;
+// the objectives cover both.
+const (
+	claimsTotal   = `__name__=~"bot_claims_total|worker_claims_total"`
+	claimsCount   = `__name__=~"bot_claim_duration_seconds_count|worker_claim_duration_seconds_count"`
+	claimsBuckets = `__name__=~"bot_claim_duration_seconds_bucket|worker_claim_duration_seconds_bucket"`
+)
+
+// Default is the SPEC's objectives on claims: 99% answered without errors
+// and 95% of answers delivered within 10s, with the page and ticket alerts
+// recommended in the Google SRE workbook for a 30-day budget.
+var Default = Config{
+	Objectives: []Objective{
+		{
+			Name:        "claim_availability",
+			Description: "Claims answered without an error.",
+			Kind:        Availability,
+			Target:      0.99,
+			Bad:         `sum(rate({` + claimsTotal + `,outcome=~"` + failedOutcomes + `"}[$window]))`,
+			Total:       `sum(rate({` + claimsTotal + `,outcome=~"delivered|` + failedOutcomes + `"}[$window]))`,
+		},
+		{
+			Name:        "claim_latency",
+			Description: fmt.Sprintf("Answers delivered within %v of receiving the update.", answerThreshold),
+			Kind:        Latency,
+			Target:      0.95,
+			Threshold:   answerThreshold,
+			Bad: `sum(rate({` + claimsCount + `,outcome="delivered"}[$window]))` +
+				` - sum(rate({` + claimsBuckets + `,outcome="delivered",le="` + seconds(answerThreshold) + `"}[$window]))`,
+			Total: `sum(rate({` + claimsCount + `,outcome="delivered"}[$window]))`,
+		},
+	},
+	Alerts: []Alert{
+		{Severity: "page", Long: time.Hour, Short: 5 * time.Minute, BurnRate: 14.4, For: 2 * time.Minute},
+		{Severity: "page", Long: 6 * time.Hour, Short: 30 * time.Minute, BurnRate: 6, For: 15 * time.Minute},
+		{Severity: "ticket", Long: 24 * time.Hour, Short: 2 * time.Hour, BurnRate: 3, For: time.Hour},
+		{Severity: "ticket", Long: 72 * time.Hour, Short: 6 * time.Hour, BurnRate: 1, For: 3 * time.Hour},
+	},
+}
+
+// seconds formats d the way histogram le labels are written.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// promDuration formats d as a Prometheus duration, e.g. 5m, 6h or 3d.
+func promDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
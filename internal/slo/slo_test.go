@@ -0,0 +1,163 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigWindows(t *testing.T) {
+	got := Default.Windows()
+	want := []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour, 72 * time.Hour}
+	if !slices.Equal(got, want) {
+		t.Fatalf("windows = %v, want %v", got, want)
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		5 * time.Minute:  "5m",
+		2 * time.Hour:    "2h",
+		72 * time.Hour:   "3d",
+		90 * time.Second: "90s",
+	}
+	for d, want := range cases {
+		if got := promDuration(d); got != want {
+			t.Errorf("promDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func objective(r Report, name string) ObjectiveReport {
+	for _, o := range r.Objectives {
+		if o.Name == name {
+			return o
+		}
+	}
+	return ObjectiveReport{}
+}
+
+func windowReport(o ObjectiveReport, w string) WindowReport {
+	for _, x := range o.Windows {
+		if x.Window == w {
+			return x
+		}
+	}
+	return WindowReport{}
+}
+
+func TestTrackerRatios(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := New(Default, WithNow(func() time.Time { return now }))
+
+	// Two hours ago: slow answers, outside the 5m and 1h windows.
+	now = now.Add(-2 * time.Hour)
+	for i := 0; i < 10; i++ {
+		tr.Record(20*time.Second, false)
+	}
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 18; i++ {
+		tr.Record(3*time.Second, false)
+	}
+	tr.Record(12*time.Second, false)
+	tr.Record(time.Second, true)
+
+	r := tr.Report()
+	lat := objective(r, "claim_latency")
+	if w := windowReport(lat, "5m"); w.Total != 19 || w.Good != 18 {
+		t.Fatalf("latency 5m = %+v", w)
+	}
+	if w := windowReport(lat, "6h"); w.Total != 29 || w.Good != 18 {
+		t.Fatalf("latency 6h = %+v", w)
+	}
+	avail := objective(r, "claim_availability")
+	if w := windowReport(avail, "5m"); w.Total != 20 || w.Good != 19 || w.Ratio != 0.95 {
+		t.Fatalf("availability 5m = %+v", w)
+	}
+	if w := windowReport(avail, "5m"); w.BurnRate < 4.99 || w.BurnRate > 5.01 {
+		t.Fatalf("burn rate = %v, want 5", w.BurnRate)
+	}
+}
+
+func TestTrackerBurning(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := New(Default, WithNow(func() time.Time { return now }))
+	if r := tr.Report(); len(objective(r, "claim_availability").Burning) != 0 || windowReport(objective(r, "claim_availability"), "1h").Ratio != 1 {
+		t.Fatalf("empty tracker burning: %+v", r)
+	}
+	// Half of the claims fail: 50x the 1% budget trips every alert.
+	for i := 0; i < 10; i++ {
+		tr.Record(time.Second, i%2 == 0)
+	}
+	if got := objective(tr.Report(), "claim_availability").Burning; !slices.Equal(got, []string{"page", "ticket"}) {
+		t.Fatalf("burning = %v", got)
+	}
+	// Answers are fast, so latency is fine.
+	if got := objective(tr.Report(), "claim_latency").Burning; len(got) != 0 {
+		t.Fatalf("latency burning = %v", got)
+	}
+
+	// Ten minutes later the 5m window has recovered while the longer ones
+	// still remember the failures.
+	now = now.Add(10 * time.Minute)
+	tr.Record(time.Second, false)
+	avail := objective(tr.Report(), "claim_availability")
+	if w := windowReport(avail, "5m"); w.Total != 1 || w.BurnRate != 0 {
+		t.Fatalf("5m window = %+v", w)
+	}
+	if w := windowReport(avail, "1h"); w.Total != 11 || w.BurnRate < 14.4 {
+		t.Fatalf("1h window = %+v", w)
+	}
+}
+
+func TestTrackerForgetsOldBuckets(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := New(Default, WithNow(func() time.Time { return now }))
+	tr.Record(time.Second, true)
+	now = now.Add(73 * time.Hour)
+	tr.Record(time.Second, false)
+	if w := windowReport(objective(tr.Report(), "claim_availability"), "3d"); w.Total != 1 || w.Good != 1 {
+		t.Fatalf("old claim still counted: %+v", w)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tr := New(Default)
+	tr.Record(time.Second, false)
+	rec := httptest.NewRecorder()
+	tr.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/slo", nil))
+	var r Report
+	if err := json.NewDecoder(rec.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Objectives) != 2 || windowReport(objective(r, "claim_latency"), "5m").Good != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+}
+
+func TestWriteRules(t *testing.T) {
+	var b strings.Builder
+	if err := WriteRules(&b, Default); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"  - name: slo_claim_latency\n",
+		"      - record: slo:claim_latency:error_ratio_rate3d\n",
+		`le="10"}[5m]`,
+		"      - alert: ClaimLatencyBudgetBurn\n",
+		"          slo:claim_latency:error_ratio_rate1h > (14.4 * 0.05)\n          and\n          slo:claim_latency:error_ratio_rate5m > (14.4 * 0.05)\n",
+		"          slo:claim_availability:error_ratio_rate3d > (1 * 0.01)\n",
+		"          severity: ticket\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rules miss %q", want)
+		}
+	}
+	if strings.Contains(out, "$window") {
+		t.Error("window placeholder left in rules")
+	}
+}
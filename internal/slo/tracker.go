@@ -0,0 +1,163 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// resolution is the width of the Tracker's time buckets. Windows are rounded
+// to it.
+const resolution = time.Minute
+
+// Tracker computes objectives over rolling windows from the claims recorded
+// in this process. It keeps one bucket per minute of the longest window.
+type Tracker struct {
+	cfg     Config
+	windows []time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+// bucket counts events of one minute, per objective.
+type bucket struct {
+	minute      int64
+	good, total []int
+}
+
+// New returns a Tracker for cfg.
+func New(cfg Config, opts ...func(*Tracker)) *Tracker {
+	t := &Tracker{cfg: cfg, windows: cfg.Windows(), now: time.Now}
+	for _, opt := range opts {
+		opt(t)
+	}
+	size := 1
+	if len(t.windows) > 0 {
+		size = int(t.windows[len(t.windows)-1] / resolution)
+	}
+	t.buckets = make([]bucket, size)
+	for i := range t.buckets {
+		t.buckets[i] = bucket{minute: -1, good: make([]int, len(cfg.Objectives)), total: make([]int, len(cfg.Objectives))}
+	}
+	return t
+}
+
+// WithNow sets the clock, for tests.
+func WithNow(f func() time.Time) func(*Tracker) {
+	return func(t *Tracker) { t.now = f }
+}
+
+// Record counts one processed claim that took latency from receipt to its
+// final state. failed claims count against Availability objectives; only
+// answered ones count towards Latency objectives.
+func (t *Tracker) Record(latency time.Duration, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(t.now())
+	for i, o := range t.cfg.Objectives {
+		switch o.Kind {
+		case Availability:
+			b.total[i]++
+			if !failed {
+				b.good[i]++
+			}
+		case Latency:
+			if failed {
+				continue
+			}
+			b.total[i]++
+			if latency <= o.Threshold {
+				b.good[i]++
+			}
+		}
+	}
+}
+
+// bucket returns the bucket of the minute of now, resetting it if it last
+// held an older minute. t.mu must be held.
+func (t *Tracker) bucket(now time.Time) *bucket {
+	m := now.Unix() / int64(resolution/time.Second)
+	b := &t.buckets[m%int64(len(t.buckets))]
+	if b.minute != m {
+		b.minute = m
+		clear(b.good)
+		clear(b.total)
+	}
+	return b
+}
+
+// Report is the state of all objectives.
+type Report struct {
+	Objectives []ObjectiveReport `json:"objectives"`
+}
+
+// ObjectiveReport is the state of one objective over each alert window.
+type ObjectiveReport struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Target      float64        `json:"target"`
+	Windows     []WindowReport `json:"windows"`
+	// Burning lists the severities of alerts whose windows both burn the
+	// error budget too fast.
+	Burning []string `json:"burning"`
+}
+
+// WindowReport is an objective's state over one window. Without events the
+// ratio is 1 and nothing is burning.
+type WindowReport struct {
+	Window   string  `json:"window"`
+	Good     int     `json:"good"`
+	Total    int     `json:"total"`
+	Ratio    float64 `json:"ratio"`
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// Report computes every objective over every alert window.
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now().Unix() / int64(resolution/time.Second)
+	r := Report{Objectives: []ObjectiveReport{}}
+	for i, o := range t.cfg.Objectives {
+		or := ObjectiveReport{Name: o.Name, Description: o.Description, Target: o.Target, Burning: []string{}}
+		burn := map[time.Duration]float64{}
+		for _, w := range t.windows {
+			var good, total int
+			from := now - int64(w/resolution)
+			for _, b := range t.buckets {
+				if b.minute > from && b.minute <= now {
+					good += b.good[i]
+					total += b.total[i]
+				}
+			}
+			wr := WindowReport{Window: promDuration(w), Good: good, Total: total, Ratio: 1}
+			if total > 0 {
+				wr.Ratio = float64(good) / float64(total)
+				wr.BurnRate = (1 - wr.Ratio) / o.ErrorBudget()
+			}
+			burn[w] = wr.BurnRate
+			or.Windows = append(or.Windows, wr)
+		}
+		for _, a := range t.cfg.Alerts {
+			if burn[a.Long] > a.BurnRate && burn[a.Short] > a.BurnRate && !slices.Contains(or.Burning, a.Severity) {
+				or.Burning = append(or.Burning, a.Severity)
+			}
+		}
+		r.Objectives = append(r.Objectives, or)
+	}
+	return r
+}
+
+// Handler serves the Report as JSON.
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(t.Report())
+	})
+}
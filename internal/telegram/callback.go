@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxCallbackData is the size limit Telegram puts on callback_data.
+const MaxCallbackData = 64
+
+var (
+	// ErrCallbackTooLong is returned when encoded data exceeds MaxCallbackData.
+	ErrCallbackTooLong = errors.New("telegram: callback data too long")
+	// ErrCallbackSignature is returned for data that was not produced by the
+	// codec for the same user, e.g. forged by a client.
+	ErrCallbackSignature = errors.New("telegram: invalid callback signature")
+)
+
+// sigLen is the number of HMAC bytes kept; 8 bytes encode to 11 characters.
+const sigLen = 8
+
+// CallbackCodec packs an action and its arguments into compact callback data
+// signed with HMAC-SHA256. The ID of the user the button is meant for is part
+// of the signed message but not of the data, so a button pressed by anyone
+// else, e.g. another member of a group, does not verify.
+//
+// Encoded form: action:arg1:arg2.signature
+type CallbackCodec struct {
+	key []byte
+}
+
+// NewCallbackCodec returns a codec signing with key.
+func NewCallbackCodec(key []byte) *CallbackCodec {
+	return &CallbackCodec{key: key}
+}
+
+func (c *CallbackCodec) sign(userID int64, payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(strconv.FormatInt(userID, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sigLen])
+}
+
+// Encode returns callback data for a button meant for userID. Action and
+// arguments must not contain ':'.
+func (c *CallbackCodec) Encode(userID int64, action string, args ...string) (string, error) {
+	parts := append([]string{action}, args...)
+	for _, p := range parts {
+		if strings.Contains(p, ":") {
+			return "", fmt.Errorf("telegram: callback part %q contains ':'", p)
+		}
+	}
+	payload := strings.Join(parts, ":")
+	data := payload + "." + c.sign(userID, payload)
+	if len(data) > MaxCallbackData {
+		return "", fmt.Errorf("%w: %d bytes", ErrCallbackTooLong, len(data))
+	}
+	return data, nil
+}
+
+// Decode verifies data pressed by userID and splits it into the action
+// and its arguments.
+func (c *CallbackCodec) Decode(userID int64, data string) (action string, args []string, err error) {
+	i := strings.LastIndexByte(data, '.')
+	if i < 0 {
+		return "", nil, ErrCallbackSignature
+	}
+	payload, sig := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(userID, payload))) {
+		return "", nil, ErrCallbackSignature
+	}
+	parts := strings.Split(payload, ":")
+	return parts[0], parts[1:], nil
+}
@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCallbackCodecRoundTrip(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"))
+	data, err := c.Encode(42, "consent", "y", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(data, "consent:y:2.") || len(data) > MaxCallbackData {
+		t.Fatalf("unexpected data %q", data)
+	}
+	action, args, err := c.Decode(42, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != "consent" || len(args) != 2 || args[0] != "y" || args[1] != "2" {
+		t.Fatalf("unexpected decode %s %v", action, args)
+	}
+}
+
+func TestCallbackCodecNoArgs(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"))
+	data, _ := c.Encode(1, "noop")
+	action, args, err := c.Decode(1, data)
+	if err != nil || action != "noop" || len(args) != 0 {
+		t.Fatalf("unexpected decode %s %v %v", action, args, err)
+	}
+}
+
+func TestCallbackCodecRejectsTampering(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"))
+	data, _ := c.Encode(42, "rate", "17", "5")
+	cases := map[string]struct {
+		userID int64
+		data   string
+	}{
+		"other user":    {43, data},
+		"changed arg":   {42, strings.Replace(data, ":5.", ":1.", 1)},
+		"no signature":  {42, "rate:17:5"},
+		"other key":     {42, mustEncode(t, NewCallbackCodec([]byte("other")), 42, "rate", "17", "5")},
+		"empty payload": {42, ""},
+	}
+	for name, tc := range cases {
+		if _, _, err := c.Decode(tc.userID, tc.data); !errors.Is(err, ErrCallbackSignature) {
+			t.Errorf("%s: expected ErrCallbackSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestCallbackCodecLimits(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"))
+	if _, err := c.Encode(1, "a", strings.Repeat("x", 60)); !errors.Is(err, ErrCallbackTooLong) {
+		t.Fatalf("expected ErrCallbackTooLong, got %v", err)
+	}
+	if _, err := c.Encode(1, "a", "b:c"); err == nil {
+		t.Fatal("expected separator error")
+	}
+}
+
+func mustEncode(t *testing.T, c *CallbackCodec, userID int64, action string, args ...string) string {
+	t.Helper()
+	s, err := c.Encode(userID, action, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Chat types as reported in Chat.Type.
+const (
+	ChatPrivate    = "private"
+	ChatGroup      = "group"
+	ChatSupergroup = "supergroup"
+)
+
+// ChatMember is a user's membership in a chat, as returned by getChatMember.
+// Status is one of "creator", "administrator", "member", "restricted",
+// "left" or "kicked".
+type ChatMember struct {
+	Status string `json:"status"`
+	User   User   `json:"user"`
+}
+
+// IsAdmin reports whether the member owns or administers the chat.
+func (m ChatMember) IsAdmin() bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
+
+// GetMe returns the bot's own user, e.g. to recognise commands addressed to
+// it by username.
+func (c *Client) GetMe(ctx context.Context) (User, error) {
+	var u User
+	if err := c.call(ctx, "getMe", url.Values{}, &u); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// GetChatMember returns a user's membership in a chat.
+func (c *Client) GetChatMember(ctx context.Context, chatID, userID int64) (ChatMember, error) {
+	data := url.Values{}
+	data.Set("chat_id", strconv.FormatInt(chatID, 10))
+	data.Set("user_id", strconv.FormatInt(userID, 10))
+	var m ChatMember
+	if err := c.call(ctx, "getChatMember", data, &m); err != nil {
+		return ChatMember{}, err
+	}
+	return m, nil
+}
+
+type threadKey struct{}
+
+// WithThread returns a context whose messages are sent to a forum topic.
+// Messages sent with a zero thread go to the chat's general topic.
+func WithThread(ctx context.Context, threadID int64) context.Context {
+	return context.WithValue(ctx, threadKey{}, threadID)
+}
+
+// ThreadID returns the forum topic set with WithThread, or zero.
+func ThreadID(ctx context.Context) int64 {
+	id, _ := ctx.Value(threadKey{}).(int64)
+	return id
+}
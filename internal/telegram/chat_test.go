@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetMeAndChatMember(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/botTOKEN/getMe":
+			w.Write([]byte(`{"ok":true,"result":{"id":42,"is_bot":true,"first_name":"Legal","username":"LegalBot"}}`))
+		case "/botTOKEN/getChatMember":
+			if r.Form.Get("chat_id") != "-100" || r.Form.Get("user_id") != "7" {
+				t.Errorf("unexpected form %v", r.Form)
+			}
+			w.Write([]byte(`{"ok":true,"result":{"status":"administrator","user":{"id":7,"is_bot":false,"first_name":"Ann"}}}`))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL))
+	me, err := c.GetMe(context.Background())
+	if err != nil || me.ID != 42 || me.Username != "LegalBot" {
+		t.Fatalf("GetMe = %+v, %v", me, err)
+	}
+	m, err := c.GetChatMember(context.Background(), -100, 7)
+	if err != nil || !m.IsAdmin() || m.User.ID != 7 {
+		t.Fatalf("GetChatMember = %+v, %v", m, err)
+	}
+	if (ChatMember{Status: "member"}).IsAdmin() {
+		t.Fatal("member reported as admin")
+	}
+}
+
+func TestSendMessageToThread(t *testing.T) {
+	var threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		threads = append(threads, r.Form.Get("message_thread_id"))
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL))
+	if err := c.SendMessage(WithThread(context.Background(), 15), -100, "in topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendMessage(context.Background(), -100, "general"); err != nil {
+		t.Fatal(err)
+	}
+	if threads[0] != "15" || threads[1] != "" {
+		t.Fatalf("unexpected threads %q", threads)
+	}
+}
+
+func TestDecodeGroupMessage(t *testing.T) {
+	raw := `{"message_id":5,"from":{"id":7,"first_name":"Ann"},"chat":{"id":-100,"type":"supergroup","title":"Firm","is_forum":true},
+"message_thread_id":3,"is_topic_message":true,"text":"/claim@LegalBot hi",
+"reply_to_message":{"message_id":4,"from":{"id":42,"is_bot":true,"first_name":"Legal"},"chat":{"id":-100,"type":"supergroup"}}}`
+	var m Message
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Chat.IsGroup() || !m.Chat.IsForum || m.MessageThreadID != 3 || !m.IsTopicMessage {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	if m.ReplyToMessage == nil || m.ReplyToMessage.From.ID != 42 {
+		t.Fatalf("reply not decoded: %+v", m.ReplyToMessage)
+	}
+	if (Chat{Type: ChatPrivate}).IsGroup() {
+		t.Fatal("private chat reported as group")
+	}
+}
@@ -3,6 +3,7 @@ package telegram
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,19 +11,46 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"legalbot/internal/tracing"
 )
 
 // Client is a minimal Telegram Bot API client.
 type Client struct {
-	Token  string
-	HTTP   *http.Client
-	Logger *slog.Logger
+	// Token is the bot token; use SetToken once the client is in use.
+	Token string
+	// BaseURL is the Bot API server, e.g. a local fake during development.
+	BaseURL string
+	HTTP    *http.Client
+	Logger  *slog.Logger
+
+	tokenMu sync.RWMutex
+}
+
+// New creates a new client of the public Bot API; WithBaseURL sets another
+// server.
+func New(token string, opts ...func(*Client)) *Client {
+	c := &Client{Token: token, BaseURL: apiURL, HTTP: &http.Client{Timeout: 10 * time.Second}, Logger: slog.Default()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// New creates a new client.
-func New(token string) *Client {
-	return &Client{Token: token, HTTP: &http.Client{Timeout: 10 * time.Second}, Logger: slog.Default()}
+// SetToken replaces the bot token, e.g. after it was rotated. Requests in
+// flight keep the old one.
+func (c *Client) SetToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.Token = token
+}
+
+func (c *Client) token() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.Token
 }
 
 // WithLogger sets a custom logger when creating a new client.
@@ -30,57 +58,222 @@ func WithLogger(l *slog.Logger) func(*Client) {
 	return func(c *Client) { c.Logger = l }
 }
 
+// WithBaseURL sets the Bot API server.
+func WithBaseURL(u string) func(*Client) {
+	return func(c *Client) { c.BaseURL = strings.TrimRight(u, "/") }
+}
+
 var apiURL = "https://api.telegram.org"
 
 // SendMessage sends a text message.
 func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) error {
-	u := fmt.Sprintf("%s/bot%s/sendMessage", apiURL, c.Token)
+	return c.SendMessageMarkup(ctx, chatID, text, nil)
+}
+
+// SendMessageMarkup sends a text message with a keyboard attached. A nil
+// markup sends a plain message.
+func (c *Client) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup ReplyMarkup) error {
+	return c.sendMessage(ctx, chatID, text, "", markup)
+}
+
+// SendMessageMode sends text parsed with mode, without a fallback when
+// Telegram rejects its entities.
+func (c *Client) SendMessageMode(ctx context.Context, chatID int64, text string, mode ParseMode, markup ReplyMarkup) error {
+	return c.sendMessage(ctx, chatID, text, mode, markup)
+}
+
+// SendFormatted sends a formatted message. If Telegram rejects its entities
+// the plain text version is sent instead, right away; queue.Queue paces the
+// fallback like any other message.
+func (c *Client) SendFormatted(ctx context.Context, chatID int64, f Formatted, markup ReplyMarkup) error {
+	err := c.sendMessage(ctx, chatID, f.Text, f.ParseMode, markup)
+	if !IsEntityParseError(err) {
+		return err
+	}
+	if c.Logger != nil {
+		c.Logger.WarnContext(ctx, "telegram rejected formatting, sending plain text", "chat_id", chatID, "parse_mode", f.ParseMode, "err", err)
+	}
+	return c.sendMessage(ctx, chatID, f.Plain, "", markup)
+}
+
+func (c *Client) sendMessage(ctx context.Context, chatID int64, text string, mode ParseMode, markup ReplyMarkup) error {
 	data := url.Values{}
 	data.Set("chat_id", strconv.FormatInt(chatID, 10))
 	data.Set("text", text)
+	if thread := ThreadID(ctx); thread != 0 {
+		data.Set("message_thread_id", strconv.FormatInt(thread, 10))
+	}
+	if mode != "" {
+		data.Set("parse_mode", string(mode))
+	}
+	if markup != nil {
+		m, err := json.Marshal(markup)
+		if err != nil {
+			return fmt.Errorf("encode reply markup: %w", err)
+		}
+		data.Set("reply_markup", string(m))
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(data.Encode()))
+	if c.Logger != nil {
+		c.Logger.InfoContext(ctx, "send telegram message", "chat_id", chatID)
+	}
+	if err := c.call(ctx, "sendMessage", data, nil); err != nil {
+		return err
+	}
+	if c.Logger != nil {
+		c.Logger.InfoContext(ctx, "telegram message sent", "chat_id", chatID)
+	}
+	return nil
+}
+
+// AnswerCallbackQuery stops the loading indicator on a pressed inline button.
+// A non-empty text is shown as a notification, or as an alert if showAlert.
+func (c *Client) AnswerCallbackQuery(ctx context.Context, queryID, text string, showAlert bool) error {
+	data := url.Values{}
+	data.Set("callback_query_id", queryID)
+	if text != "" {
+		data.Set("text", text)
+	}
+	if showAlert {
+		data.Set("show_alert", "true")
+	}
+	return c.call(ctx, "answerCallbackQuery", data, nil)
+}
+
+// GetUpdates long-polls for updates with IDs of at least offset, waiting up
+// to timeout for one to arrive.
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	data := url.Values{}
+	data.Set("offset", strconv.FormatInt(offset, 10))
+	data.Set("timeout", strconv.Itoa(int(timeout/time.Second)))
+	allowed, err := json.Marshal(AllowedUpdates)
 	if err != nil {
-		return fmt.Errorf("new request: %w", err)
+		return nil, fmt.Errorf("encode allowed updates: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	data.Set("allowed_updates", string(allowed))
 
-	if c.Logger != nil {
-		c.Logger.Info("send telegram message", "chat_id", chatID)
+	// The request has to outlive the poll timeout.
+	hc := c.HTTP
+	if hc.Timeout != 0 && hc.Timeout < timeout+10*time.Second {
+		cp := *hc
+		cp.Timeout = timeout + 10*time.Second
+		hc = &cp
+	}
+	var updates []Update
+	if err := c.do(ctx, hc, "getUpdates", data, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// DeleteWebhook removes the webhook so updates can be fetched with
+// GetUpdates. Pending updates are kept unless dropPending is set.
+func (c *Client) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	data := url.Values{}
+	if dropPending {
+		data.Set("drop_pending_updates", "true")
+	}
+	return c.call(ctx, "deleteWebhook", data, nil)
+}
+
+// call invokes a Bot API method with form-encoded parameters and decodes
+// its result into out unless out is nil.
+func (c *Client) call(ctx context.Context, method string, data url.Values, out any) error {
+	return c.do(ctx, c.HTTP, method, data, out)
+}
+
+func (c *Client) do(ctx context.Context, hc *http.Client, method string, data url.Values, out any) (err error) {
+	ctx, span := tracing.Start(ctx, "telegram."+method, tracing.Client)
+	defer func() { span.EndError(err) }()
+
+	base := c.BaseURL
+	if base == "" {
+		base = apiURL
+	}
+	u := fmt.Sprintf("%s/bot%s/%s", base, c.token(), method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("new request: %w", stripURL(err))
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := c.HTTP.Do(req)
+	resp, err := hc.Do(req)
 	if err != nil {
-		return fmt.Errorf("send message: %w", err)
+		return fmt.Errorf("%s: %w", method, stripURL(err))
 	}
 	defer resp.Body.Close()
+	span.SetInt("http.response.status_code", int64(resp.StatusCode))
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("read body: %w", err)
 	}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("telegram: status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var r struct {
 		OK          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
 		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+		Result json.RawMessage `json:"result"`
 	}
 	if err := json.Unmarshal(body, &r); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return &APIError{Method: method, Code: resp.StatusCode, Description: string(body)}
+		}
 		return fmt.Errorf("decode response: %w", err)
 	}
-	if !r.OK {
-		if r.Description != "" {
-			return fmt.Errorf("telegram: %s", r.Description)
+	if !r.OK || resp.StatusCode >= http.StatusBadRequest {
+		code := r.ErrorCode
+		if code == 0 {
+			code = resp.StatusCode
 		}
-		return fmt.Errorf("telegram: response not ok")
+		return &APIError{Method: method, Code: code, Description: r.Description, RetryAfter: r.Parameters.RetryAfter}
 	}
+	if out != nil {
+		if err := json.Unmarshal(r.Result, out); err != nil {
+			return fmt.Errorf("decode %s result: %w", method, err)
+		}
+	}
+	return nil
+}
 
-	if c.Logger != nil {
-		c.Logger.Info("telegram message sent", "chat_id", chatID)
+// stripURL drops the request URL from errors of the HTTP client, since it
+// contains the bot token and errors end up in logs and spans.
+func stripURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
 	}
+	return err
+}
 
-	return nil
+// APIError is an error reported by the Bot API.
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+	// RetryAfter is the number of seconds to wait after flood control (429).
+	RetryAfter int
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *APIError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+}
+
+func (e *APIError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("telegram: %s: %d %s", e.Method, e.Code, e.Description)
+	}
+	return fmt.Sprintf("telegram: %s: %d response not ok", e.Method, e.Code)
+}
+
+// IsEntityParseError reports whether Telegram rejected a message because its
+// formatting could not be parsed.
+func IsEntityParseError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(apiErr.Description, "can't parse entities")
 }
@@ -2,6 +2,9 @@ package telegram
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -61,6 +64,21 @@ func TestSendMessageHTTPError(t *testing.T) {
 	}
 }
 
+func TestNetworkErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := New("123:SECRET", WithBaseURL(srv.URL))
+	err := c.SendMessage(context.Background(), 1, "hi")
+	var opErr *net.OpError
+	if err == nil || strings.Contains(err.Error(), "SECRET") || !errors.As(err, &opErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, err = c.DownloadFile(context.Background(), File{FilePath: "documents/a.pdf"}, 10)
+	if err == nil || strings.Contains(err.Error(), "SECRET") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
 func TestSendMessageAPIFailure(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"ok":false,"description":"fail"}`))
@@ -79,3 +97,174 @@ func TestSendMessageAPIFailure(t *testing.T) {
 		t.Fatalf("expected error containing fail, got %v", err)
 	}
 }
+
+func TestSendMessageMarkup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		want := `{"inline_keyboard":[[{"text":"Yes","callback_data":"y"},{"text":"Docs","url":"https://d"}]]}`
+		if got := r.Form.Get("reply_markup"); got != want {
+			t.Errorf("unexpected reply_markup %s", got)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	markup := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{
+		InlineRow(InlineKeyboardButton{Text: "Yes", CallbackData: "y"}, InlineKeyboardButton{Text: "Docs", URL: "https://d"}),
+	}}
+	if err := New("TOKEN").SendMessageMarkup(context.Background(), 1, "hi", markup); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendMessageNoMarkup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if _, ok := r.Form["reply_markup"]; ok {
+			t.Errorf("reply_markup should be omitted")
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	if err := New("TOKEN").SendMessage(context.Background(), 1, "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplyMarkupJSON(t *testing.T) {
+	cases := []struct {
+		m    ReplyMarkup
+		want string
+	}{
+		{ReplyKeyboardMarkup{Keyboard: [][]KeyboardButton{{{Text: "Русский"}, {Text: "English"}}}, ResizeKeyboard: true, OneTimeKeyboard: true},
+			`{"keyboard":[[{"text":"Русский"},{"text":"English"}]],"resize_keyboard":true,"one_time_keyboard":true}`},
+		{ReplyKeyboardRemove{}, `{"remove_keyboard":true}`},
+		{ReplyKeyboardRemove{Selective: true}, `{"remove_keyboard":true,"selective":true}`},
+	}
+	for _, c := range cases {
+		b, err := json.Marshal(c.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.want {
+			t.Errorf("got %s, want %s", b, c.want)
+		}
+	}
+}
+
+func TestAnswerCallbackQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/answerCallbackQuery" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		r.ParseForm()
+		if r.Form.Get("callback_query_id") != "q1" || r.Form.Get("text") != "saved" || r.Form.Get("show_alert") != "true" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	if err := New("TOKEN").AnswerCallbackQuery(context.Background(), "q1", "saved", true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIErrorRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	err := New("TOKEN").SendMessage(context.Background(), 1, "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 429 || apiErr.RetryAfter != 7 || !apiErr.Temporary() {
+		t.Fatalf("unexpected error %#v", err)
+	}
+}
+
+func TestGetUpdates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/getUpdates" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		r.ParseForm()
+		if r.Form.Get("offset") != "42" || r.Form.Get("timeout") != "30" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		w.Write([]byte(`{"ok":true,"result":[
+			{"update_id":42,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"/start"}},
+			{"update_id":43,"callback_query":{"id":"q","from":{"id":7,"first_name":"A"},"data":"x"}}]}`))
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL+"/"))
+	updates, err := c.GetUpdates(context.Background(), 42, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].Message.Text != "/start" || updates[1].CallbackQuery.Data != "x" {
+		t.Fatalf("unexpected updates %+v", updates)
+	}
+	if c.HTTP.Timeout != 10*time.Second {
+		t.Fatalf("client timeout changed to %v", c.HTTP.Timeout)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/botTOKEN/deleteWebhook" || r.Form.Get("drop_pending_updates") != "" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Form)
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	if err := New("TOKEN", WithBaseURL(srv.URL)).DeleteWebhook(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewBaseURL(t *testing.T) {
+	if c := New("T", WithBaseURL("http://localhost:8081/")); c.BaseURL != "http://localhost:8081" {
+		t.Fatalf("unexpected base url %s", c.BaseURL)
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	c := New("OLD", WithBaseURL(srv.URL))
+	c.DeleteWebhook(context.Background(), false)
+	c.SetToken("NEW")
+	c.DeleteWebhook(context.Background(), false)
+	if len(paths) != 2 || paths[0] != "/botOLD/deleteWebhook" || paths[1] != "/botNEW/deleteWebhook" {
+		t.Fatalf("requests %q", paths)
+	}
+}
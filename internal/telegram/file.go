@@ -0,0 +1,82 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"legalbot/internal/tracing"
+)
+
+// MaxDownloadSize is the largest file the Bot API lets bots download.
+const MaxDownloadSize = 20 << 20
+
+// ErrFileTooLarge is returned when a file exceeds the requested size limit.
+var ErrFileTooLarge = errors.New("telegram: file too large")
+
+// File is a file ready to be downloaded, as returned by getFile. FilePath is
+// valid for at least an hour.
+type File struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileSize     int64  `json:"file_size,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
+}
+
+// GetFile asks Telegram to prepare a file for download.
+func (c *Client) GetFile(ctx context.Context, fileID string) (File, error) {
+	data := url.Values{}
+	data.Set("file_id", fileID)
+	var f File
+	if err := c.call(ctx, "getFile", data, &f); err != nil {
+		return File{}, err
+	}
+	if f.FilePath == "" {
+		return File{}, fmt.Errorf("getFile: no file path for %s", fileID)
+	}
+	return f, nil
+}
+
+// DownloadFile fetches the contents of a file returned by GetFile. Files
+// larger than maxBytes are rejected with ErrFileTooLarge without reading
+// them completely.
+func (c *Client) DownloadFile(ctx context.Context, f File, maxBytes int64) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "telegram.download", tracing.Client)
+	defer func() { span.EndError(err) }()
+	if f.FileSize > maxBytes {
+		return nil, fmt.Errorf("download %s: %d bytes: %w", f.FilePath, f.FileSize, ErrFileTooLarge)
+	}
+	base := c.BaseURL
+	if base == "" {
+		base = apiURL
+	}
+	u := fmt.Sprintf("%s/file/bot%s/%s", base, c.token(), strings.TrimLeft(f.FilePath, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", stripURL(err))
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download file: %w", stripURL(err))
+	}
+	defer resp.Body.Close()
+	span.SetInt("http.response.status_code", int64(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{Method: "download", Code: resp.StatusCode}
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("download %s: %d bytes: %w", f.FilePath, resp.ContentLength, ErrFileTooLarge)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("download %s: %w", f.FilePath, ErrFileTooLarge)
+	}
+	return body, nil
+}
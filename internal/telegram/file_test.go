@@ -0,0 +1,82 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetFileAndDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botTOKEN/getFile":
+			r.ParseForm()
+			if r.Form.Get("file_id") != "F1" {
+				t.Errorf("unexpected file_id %q", r.Form.Get("file_id"))
+			}
+			w.Write([]byte(`{"ok":true,"result":{"file_id":"F1","file_unique_id":"U1","file_size":5,"file_path":"documents/file_0.pdf"}}`))
+		case "/file/botTOKEN/documents/file_0.pdf":
+			w.Write([]byte("%PDF-"))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL))
+	f, err := c.GetFile(context.Background(), "F1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FilePath != "documents/file_0.pdf" || f.FileSize != 5 {
+		t.Fatalf("unexpected file %+v", f)
+	}
+	data, err := c.DownloadFile(context.Background(), f, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "%PDF-" {
+		t.Fatalf("unexpected contents %q", data)
+	}
+}
+
+func TestDownloadFileTooLarge(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// No Content-Length: the limit is enforced while reading.
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL))
+	// The declared size is checked before downloading.
+	if _, err := c.DownloadFile(context.Background(), File{FilePath: "a", FileSize: 100}, 10); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatal("oversized file was requested")
+	}
+	if _, err := c.DownloadFile(context.Background(), File{FilePath: "a"}, 10); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+}
+
+func TestMessageAttachments(t *testing.T) {
+	var u Update
+	err := json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":2,"chat":{"id":3,"type":"private"},
+		"caption":"договор","document":{"file_id":"D","file_unique_id":"UD","file_name":"contract.pdf","mime_type":"application/pdf","file_size":1024}}}`), &u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := u.Message.Document
+	if u.Message.Caption != "договор" || d == nil || d.FileName != "contract.pdf" || d.MimeType != "application/pdf" || d.FileSize != 1024 {
+		t.Fatalf("unexpected message %+v", u.Message)
+	}
+}
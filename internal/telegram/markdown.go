@@ -0,0 +1,731 @@
+package telegram
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ParseMode selects how Telegram interprets formatting in a message.
+type ParseMode string
+
+const (
+	ParseModeHTML       ParseMode = "HTML"
+	ParseModeMarkdownV2 ParseMode = "MarkdownV2"
+)
+
+// Formatted is a message body in a parse mode together with the plain text
+// sent instead if Telegram cannot parse the entities.
+type Formatted struct {
+	Text      string
+	ParseMode ParseMode
+	Plain     string
+}
+
+// Markdown converts CommonMark produced by the model into Telegram HTML.
+func Markdown(md string) Formatted {
+	blocks := parseBlocks(md)
+	return Formatted{Text: renderBlocks(blocks, htmlRenderer{}), ParseMode: ParseModeHTML, Plain: renderBlocks(blocks, plainRenderer{})}
+}
+
+// MaxMessageLength is the longest text Telegram accepts in one message,
+// counted in UTF-16 code units after entities are parsed.
+const MaxMessageLength = 4096
+
+// MarkdownMessages converts CommonMark into Telegram HTML messages that each
+// fit in MaxMessageLength. Messages break between blocks; a block longer
+// than the limit is split on its own.
+func MarkdownMessages(md string) []Formatted {
+	return markdownMessages(md, MaxMessageLength)
+}
+
+func markdownMessages(md string, limit int) []Formatted {
+	var msgs []Formatted
+	var group []block
+	size := 0
+	emit := func() {
+		if len(group) > 0 {
+			msgs = append(msgs, Formatted{Text: renderBlocks(group, htmlRenderer{}), ParseMode: ParseModeHTML, Plain: renderBlocks(group, plainRenderer{})})
+			group, size = nil, 0
+		}
+	}
+	for _, bl := range parseBlocks(md) {
+		for _, part := range fitBlock(bl, limit) {
+			// The plain text is never shorter than the parsed entities and
+			// blocks are separated by at most two newlines.
+			n := textLen(renderBlocks([]block{part}, plainRenderer{}))
+			if len(group) > 0 && size+2+n > limit {
+				emit()
+			}
+			if len(group) > 0 {
+				size += 2
+			}
+			group = append(group, part)
+			size += n
+		}
+	}
+	emit()
+	return msgs
+}
+
+// fitBlock splits a block longer than limit. Code blocks are split between
+// lines and stay code; other blocks are split as plain text.
+func fitBlock(bl block, limit int) []block {
+	plain := renderBlocks([]block{bl}, plainRenderer{})
+	if textLen(plain) <= limit {
+		return []block{bl}
+	}
+	var parts []block
+	if bl.kind == blockCode {
+		for _, s := range SplitText(bl.text, limit) {
+			parts = append(parts, block{kind: blockCode, lang: bl.lang, text: s})
+		}
+		return parts
+	}
+	for _, s := range SplitText(plain, limit) {
+		parts = append(parts, block{kind: blockParagraph, inline: []inline{{kind: inlineText, text: s}}})
+	}
+	return parts
+}
+
+// SplitText splits s into parts of at most limit UTF-16 code units. A part
+// ends at its last newline in the second half, else at its last space, else
+// inside a word.
+func SplitText(s string, limit int) []string {
+	var parts []string
+	for textLen(s) > limit {
+		cut := prefixLen(s, limit)
+		if i := strings.LastIndexByte(s[:cut], '\n'); i > cut/2 {
+			parts, s = append(parts, s[:i]), s[i+1:]
+		} else if i := strings.LastIndexByte(s[:cut], ' '); i > 0 {
+			parts, s = append(parts, s[:i]), s[i+1:]
+		} else {
+			parts, s = append(parts, s[:cut]), s[cut:]
+		}
+	}
+	if s != "" || len(parts) == 0 {
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// textLen returns the length of s in UTF-16 code units, the unit Telegram
+// limits messages in.
+func textLen(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// prefixLen returns the byte length of the longest prefix of s within limit
+// UTF-16 code units, but at least one rune.
+func prefixLen(s string, limit int) int {
+	n := 0
+	for i, r := range s {
+		n += utf16.RuneLen(r)
+		if n > limit && i > 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// MarkdownV2 converts CommonMark into Telegram MarkdownV2.
+func MarkdownV2(md string) Formatted {
+	blocks := parseBlocks(md)
+	return Formatted{Text: renderBlocks(blocks, mdv2Renderer{}), ParseMode: ParseModeMarkdownV2, Plain: renderBlocks(blocks, plainRenderer{})}
+}
+
+// mdv2Reserved must be escaped everywhere outside entities in MarkdownV2.
+const mdv2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+// EscapeMarkdownV2 escapes s for use as plain text in a MarkdownV2 message.
+func EscapeMarkdownV2(s string) string {
+	return escapeWith(s, mdv2Reserved)
+}
+
+// EscapeHTML escapes s for use as text in an HTML message.
+func EscapeHTML(s string) string {
+	return htmlText.Replace(s)
+}
+
+var (
+	htmlText = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	htmlAttr = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+func escapeWith(s, chars string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r < utf8.RuneSelf && strings.IndexByte(chars, byte(r)) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockItem
+	blockQuote
+	blockCode
+	blockRule
+)
+
+type block struct {
+	kind   blockKind
+	marker string // list item marker: "•" or "1."
+	indent int
+	lang   string
+	text   string // raw code for blockCode
+	inline []inline
+}
+
+var (
+	headingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	ruleRe    = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	bulletRe  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedRe = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	quoteRe   = regexp.MustCompile(`^ {0,3}>\s?(.*)$`)
+	fenceRe   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	langRe    = regexp.MustCompile(`[^A-Za-z0-9_+#-]`)
+)
+
+func parseBlocks(md string) []block {
+	md = strings.ToValidUTF8(md, "�")
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	lines := strings.Split(md, "\n")
+	var blocks []block
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, block{kind: blockParagraph, inline: parseInline(strings.Join(para, "\n"), 0)})
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			flush()
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, block{kind: blockCode, lang: langRe.ReplaceAllString(m[2], ""), text: strings.Join(code, "\n")})
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if ruleRe.MatchString(line) {
+			flush()
+			blocks = append(blocks, block{kind: blockRule})
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockHeading, inline: parseInline(m[2], 0)})
+			continue
+		}
+		if m := quoteRe.FindStringSubmatch(line); m != nil {
+			flush()
+			quote := []string{m[1]}
+			for i+1 < len(lines) {
+				n := quoteRe.FindStringSubmatch(lines[i+1])
+				if n == nil {
+					break
+				}
+				quote = append(quote, n[1])
+				i++
+			}
+			blocks = append(blocks, block{kind: blockQuote, inline: parseInline(strings.Join(quote, "\n"), 0)})
+			continue
+		}
+		if m := bulletRe.FindStringSubmatch(line); m != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockItem, marker: "•", indent: len(m[1]) / 2, inline: parseInline(m[2], 0)})
+			continue
+		}
+		if m := orderedRe.FindStringSubmatch(line); m != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockItem, marker: m[2] + ".", indent: len(m[1]) / 2, inline: parseInline(m[3], 0)})
+			continue
+		}
+		para = append(para, strings.TrimSpace(line))
+	}
+	flush()
+	return blocks
+}
+
+type inlineKind int
+
+const (
+	inlineText inlineKind = iota
+	inlineBold
+	inlineItalic
+	inlineStrike
+	inlineCode
+	inlineLink
+)
+
+type inline struct {
+	kind     inlineKind
+	text     string
+	url      string
+	children []inline
+}
+
+// maxInlineDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxInlineDepth = 8
+
+// parseInline splits text into spans. Delimiters without a matching closer
+// are kept as literal text.
+func parseInline(s string, depth int) []inline {
+	var out []inline
+	var buf strings.Builder
+	// misses holds, per delimiter, the first opener no closer was found for.
+	// Later openers search a suffix of the same text and cannot find one
+	// either, so text full of unmatched delimiters is parsed in linear time.
+	misses := map[string]int{}
+	flush := func() {
+		if buf.Len() > 0 {
+			out = append(out, inline{kind: inlineText, text: buf.String()})
+			buf.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			buf.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := runLen(s, i, '`')
+			run := s[i : i+n]
+			if _, miss := misses[run]; !miss {
+				if j := closingBackticks(s, i+n, n); j >= 0 {
+					flush()
+					out = append(out, inline{kind: inlineCode, text: trimCode(s[i+n : j])})
+					i = j + n
+					continue
+				}
+				misses[run] = i
+			}
+			buf.WriteString(run)
+			i += n
+			continue
+		case c == '[' && depth < maxInlineDepth:
+			if label, url, end, ok := parseLink(s, i); ok {
+				flush()
+				out = append(out, inline{kind: inlineLink, url: url, children: parseInline(label, depth+1)})
+				i = end
+				continue
+			}
+		case (c == '*' || c == '_' || c == '~') && depth < maxInlineDepth:
+			if n, end, ok := parseEmphasis(s, i, depth, misses); ok {
+				flush()
+				out = append(out, n)
+				i = end
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	flush()
+	return out
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func runLen(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// closingBackticks finds a run of exactly n backticks at or after i.
+func closingBackticks(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		j += i
+		m := runLen(s, j, '`')
+		if m == n {
+			return j
+		}
+		i = j + m
+	}
+	return -1
+}
+
+func trimCode(s string) string {
+	if len(s) >= 2 && s[0] == ' ' && s[len(s)-1] == ' ' && strings.Trim(s, " ") != "" {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Link labels and URLs are only looked for within these many bytes, so
+// text full of brackets is parsed in linear time.
+const (
+	maxLinkLabel = 1000
+	maxLinkURL   = 2048
+)
+
+// parseLink parses [label](url) starting at s[i] == '['.
+func parseLink(s string, i int) (label, url string, end int, ok bool) {
+	depth := 0
+	j := i
+	for ; j < len(s) && j-i <= maxLinkLabel; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s) || depth != 0 || j+1 >= len(s) || s[j+1] != '(' {
+		return "", "", 0, false
+	}
+	label = s[i+1 : j]
+	k := j + 2
+	parens := 1
+	for ; k < len(s) && k-j <= maxLinkURL; k++ {
+		if s[k] == '\\' {
+			k++
+			continue
+		}
+		if s[k] == '(' {
+			parens++
+		} else if s[k] == ')' {
+			parens--
+			if parens == 0 {
+				break
+			}
+		} else if s[k] == '\n' {
+			return "", "", 0, false
+		}
+	}
+	if k >= len(s) || parens != 0 {
+		return "", "", 0, false
+	}
+	fields := strings.Fields(s[j+2 : k])
+	if len(fields) == 0 || label == "" {
+		return "", "", 0, false
+	}
+	return label, strings.Trim(fields[0], "<>"), k + 1, true
+}
+
+// parseEmphasis parses **bold**, __bold__, *italic*, _italic_ and ~~strike~~
+// starting at s[i].
+func parseEmphasis(s string, i, depth int, misses map[string]int) (inline, int, bool) {
+	c := s[i]
+	n := runLen(s, i, c)
+	var kind inlineKind
+	var delim string
+	switch {
+	case c == '~' && n >= 2:
+		kind, delim = inlineStrike, "~~"
+	case c == '~':
+		return inline{}, 0, false
+	case n >= 3:
+		if em, end, ok := parseDelimited(s, i, "***", inlineBold, depth, misses); ok {
+			em.children = []inline{{kind: inlineItalic, children: em.children}}
+			return em, end, true
+		}
+		kind, delim = inlineBold, s[i:i+2]
+	case n == 2:
+		kind, delim = inlineBold, s[i:i+2]
+	default:
+		kind, delim = inlineItalic, s[i:i+1]
+	}
+	return parseDelimited(s, i, delim, kind, depth, misses)
+}
+
+// parseDelimited finds the closer of delim opened at s[i]. Openers that
+// find none are recorded in misses.
+func parseDelimited(s string, i int, delim string, kind inlineKind, depth int, misses map[string]int) (inline, int, bool) {
+	c := delim[0]
+	start := i + len(delim)
+	if start >= len(s) || isSpace(s[start]) {
+		return inline{}, 0, false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return inline{}, 0, false
+	}
+	if _, miss := misses[delim]; miss {
+		return inline{}, 0, false
+	}
+	for j := start + 1; j <= len(s)-len(delim); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			m := runLen(s, j, '`')
+			if k := closingBackticks(s, j+m, m); k >= 0 {
+				j = k + m - 1
+			} else {
+				j += m - 1
+			}
+			continue
+		}
+		if s[j:j+len(delim)] != delim || isSpace(s[j-1]) {
+			continue
+		}
+		if len(delim) == 1 && j+1 < len(s) && s[j+1] == c {
+			// Part of a nested double delimiter.
+			j++
+			continue
+		}
+		if c == '_' && j+len(delim) < len(s) && isWordByte(s[j+len(delim)]) {
+			continue
+		}
+		return inline{kind: kind, children: parseInline(s[start:j], depth+1)}, j + len(delim), true
+	}
+	misses[delim] = i
+	return inline{}, 0, false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// safeURL reports whether a link target may be sent to users.
+func safeURL(u string) bool {
+	lower := strings.ToLower(u)
+	for _, p := range []string{"https://", "http://", "tg://", "mailto:"} {
+		if strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderer writes blocks and spans in one output format.
+type renderer interface {
+	text(b *strings.Builder, s string)
+	open(b *strings.Builder, n inline)
+	close(b *strings.Builder, n inline)
+	code(b *strings.Builder, s string)
+	block(b *strings.Builder, bl block, content string)
+}
+
+func renderBlocks(blocks []block, r renderer) string {
+	var b strings.Builder
+	for i, bl := range blocks {
+		if i > 0 {
+			if bl.kind == blockItem && blocks[i-1].kind == blockItem {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		// Renderers set headings in bold, so bold inside them is flattened.
+		var active uint
+		if bl.kind == blockHeading {
+			active = 1 << inlineBold
+		}
+		var content strings.Builder
+		renderInline(&content, bl.inline, r, active)
+		r.block(&b, bl, content.String())
+	}
+	return b.String()
+}
+
+// renderInline writes spans; active tracks open entity kinds because
+// Telegram rejects an entity nested in one of the same kind.
+func renderInline(b *strings.Builder, spans []inline, r renderer, active uint) {
+	for _, n := range spans {
+		switch n.kind {
+		case inlineText:
+			r.text(b, n.text)
+		case inlineCode:
+			r.code(b, n.text)
+		default:
+			bit := uint(1) << n.kind
+			wrap := active&bit == 0 && (n.kind != inlineLink || safeURL(n.url))
+			if wrap {
+				r.open(b, n)
+			}
+			renderInline(b, n.children, r, active|bit)
+			if wrap {
+				r.close(b, n)
+			}
+		}
+	}
+}
+
+type htmlRenderer struct{}
+
+var htmlTags = map[inlineKind]string{inlineBold: "b", inlineItalic: "i", inlineStrike: "s"}
+
+func (htmlRenderer) text(b *strings.Builder, s string) { b.WriteString(EscapeHTML(s)) }
+
+func (htmlRenderer) code(b *strings.Builder, s string) {
+	b.WriteString("<code>" + EscapeHTML(s) + "</code>")
+}
+
+func (htmlRenderer) open(b *strings.Builder, n inline) {
+	if n.kind == inlineLink {
+		b.WriteString(`<a href="` + htmlAttr.Replace(n.url) + `">`)
+		return
+	}
+	b.WriteString("<" + htmlTags[n.kind] + ">")
+}
+
+func (htmlRenderer) close(b *strings.Builder, n inline) {
+	if n.kind == inlineLink {
+		b.WriteString("</a>")
+		return
+	}
+	b.WriteString("</" + htmlTags[n.kind] + ">")
+}
+
+func (htmlRenderer) block(b *strings.Builder, bl block, content string) {
+	switch bl.kind {
+	case blockHeading:
+		if content != "" {
+			b.WriteString("<b>" + content + "</b>")
+		}
+	case blockItem:
+		b.WriteString(strings.Repeat("  ", bl.indent) + bl.marker + " " + content)
+	case blockQuote:
+		b.WriteString("<blockquote>" + content + "</blockquote>")
+	case blockCode:
+		if bl.lang != "" {
+			b.WriteString(`<pre><code class="language-` + bl.lang + `">` + EscapeHTML(bl.text) + "</code></pre>")
+		} else {
+			b.WriteString("<pre>" + EscapeHTML(bl.text) + "</pre>")
+		}
+	case blockRule:
+		b.WriteString("———")
+	default:
+		b.WriteString(content)
+	}
+}
+
+type mdv2Renderer struct{}
+
+var mdv2Delims = map[inlineKind]string{inlineBold: "*", inlineItalic: "_", inlineStrike: "~"}
+
+func (mdv2Renderer) text(b *strings.Builder, s string) { b.WriteString(EscapeMarkdownV2(s)) }
+
+func (mdv2Renderer) code(b *strings.Builder, s string) {
+	b.WriteString("`" + escapeWith(s, "`\\") + "`")
+}
+
+func (mdv2Renderer) open(b *strings.Builder, n inline) {
+	if n.kind == inlineLink {
+		b.WriteString("[")
+		return
+	}
+	mdv2Delim(b, mdv2Delims[n.kind])
+}
+
+func (mdv2Renderer) close(b *strings.Builder, n inline) {
+	if n.kind == inlineLink {
+		b.WriteString("](" + escapeWith(n.url, ")\\") + ")")
+		return
+	}
+	mdv2Delim(b, mdv2Delims[n.kind])
+}
+
+// mdv2Delim writes an entity delimiter. Two adjacent underscores would be
+// read as underline, so they are separated with \r as the API docs suggest.
+func mdv2Delim(b *strings.Builder, d string) {
+	if d == "_" && endsWithDelim(b.String(), '_') {
+		b.WriteString("\r")
+	}
+	b.WriteString(d)
+}
+
+// endsWithDelim reports whether s ends with an unescaped c.
+func endsWithDelim(s string, c byte) bool {
+	if s == "" || s[len(s)-1] != c {
+		return false
+	}
+	n := 0
+	for i := len(s) - 2; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 0
+}
+
+func (r mdv2Renderer) block(b *strings.Builder, bl block, content string) {
+	switch bl.kind {
+	case blockHeading:
+		if content != "" {
+			b.WriteString("*" + content + "*")
+		}
+	case blockItem:
+		b.WriteString(strings.Repeat("  ", bl.indent) + EscapeMarkdownV2(bl.marker) + " " + content)
+	case blockQuote:
+		b.WriteString(">" + strings.ReplaceAll(content, "\n", "\n>"))
+	case blockCode:
+		b.WriteString("```" + bl.lang + "\n" + escapeWith(bl.text, "`\\") + "\n```")
+	case blockRule:
+		b.WriteString("———")
+	default:
+		b.WriteString(content)
+	}
+}
+
+type plainRenderer struct{}
+
+func (plainRenderer) text(b *strings.Builder, s string) { b.WriteString(s) }
+func (plainRenderer) code(b *strings.Builder, s string) { b.WriteString(s) }
+func (plainRenderer) open(b *strings.Builder, n inline) {}
+
+func (plainRenderer) close(b *strings.Builder, n inline) {
+	if n.kind == inlineLink {
+		b.WriteString(" (" + n.url + ")")
+	}
+}
+
+func (plainRenderer) block(b *strings.Builder, bl block, content string) {
+	switch bl.kind {
+	case blockItem:
+		b.WriteString(strings.Repeat("  ", bl.indent) + bl.marker + " " + content)
+	case blockQuote:
+		b.WriteString("> " + strings.ReplaceAll(content, "\n", "\n> "))
+	case blockCode:
+		b.WriteString(bl.text)
+	case blockRule:
+		b.WriteString("———")
+	default:
+		b.WriteString(content)
+	}
+}
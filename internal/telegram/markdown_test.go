@@ -0,0 +1,424 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestMarkdownHTML(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"**Важно:** срок 10 дней", "<b>Важно:</b> срок 10 дней"},
+		{"*italic* and _also_", "<i>italic</i> and <i>also</i>"},
+		{"~~old~~ new", "<s>old</s> new"},
+		{"use `a<b` here", "use <code>a&lt;b</code> here"},
+		{"see [ст. 18](https://example.com/a?b=1&c=2)", `see <a href="https://example.com/a?b=1&amp;c=2">ст. 18</a>`},
+		{"[click](javascript:alert(1))", "click"},
+		{"# Претензия", "<b>Претензия</b>"},
+		{"## **Претензия**", "<b>Претензия</b>"},
+		{"### *Title* and **bold**", "<b><i>Title</i> and bold</b>"},
+		{"- one\n- **two**\n\n1. first", "• one\n• <b>two</b>\n1. first"},
+		{"> quoted\n> text", "<blockquote>quoted\ntext</blockquote>"},
+		{"```json\n{\"a\": \"<b>\"}\n```", `<pre><code class="language-json">{"a": "&lt;b&gt;"}</code></pre>`},
+		{"snake_case_name and 2 * 3 * 4", "snake_case_name and 2 * 3 * 4"},
+		{"unclosed **bold and <tag> & co", "unclosed **bold and &lt;tag&gt; &amp; co"},
+		{`\*not italic\*`, "*not italic*"},
+		{"***both***", "<b><i>both</i></b>"},
+		{"*outer *inner* text*", "<i>outer *inner</i> text*"},
+		{"line one\nline two\n\n---\n\nnext", "line one\nline two\n\n———\n\nnext"},
+	}
+	for _, c := range cases {
+		got := Markdown(c.in)
+		if got.Text != c.want {
+			t.Errorf("Markdown(%q)\n got %q\nwant %q", c.in, got.Text, c.want)
+		}
+		if got.ParseMode != ParseModeHTML {
+			t.Errorf("unexpected parse mode %q", got.ParseMode)
+		}
+		if err := checkHTML(got.Text); err != nil {
+			t.Errorf("Markdown(%q) produced invalid HTML: %v", c.in, err)
+		}
+	}
+}
+
+func TestMarkdownV2(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"**Важно:** срок 10 дней.", `*Важно:* срок 10 дней\.`},
+		{"1. first (see ст. 18)", `1\. first \(see ст\. 18\)`},
+		{"_a_ _b_", `_a_ _b_`},
+		{"*a*_b_", "_a_\r_b_"},
+		{"[ст. 18](https://x.ru/a_(b))", `[ст\. 18](https://x.ru/a_(b\))`},
+		{"`a\\b`", "`a\\\\b`"},
+		{"> q.", `>q\.`},
+		{"# Title!", `*Title\!*`},
+		{"## **Title**", `*Title*`},
+		{"### *Title* and **bold**", "*_Title_ and bold*"},
+	}
+	for _, c := range cases {
+		got := MarkdownV2(c.in)
+		if got.Text != c.want {
+			t.Errorf("MarkdownV2(%q)\n got %q\nwant %q", c.in, got.Text, c.want)
+		}
+		if err := checkMarkdownV2(got.Text); err != nil {
+			t.Errorf("MarkdownV2(%q) produced invalid markup: %v", c.in, err)
+		}
+	}
+}
+
+func TestMarkdownPlain(t *testing.T) {
+	got := Markdown("## Итог\n**Срок**: [10 дней](https://x.ru) — `ст. 22`").Plain
+	want := "Итог\n\nСрок: 10 дней (https://x.ru) — ст. 22"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownMessages(t *testing.T) {
+	md := "# Title\n\n" + strings.Repeat("word ", 30) + "\n\n- **one**\n- two\n\n```go\n" + strings.Repeat("line\n", 30) + "```"
+	msgs := markdownMessages(md, 60)
+	if len(msgs) < 4 {
+		t.Fatalf("expected several messages, got %d", len(msgs))
+	}
+	var plain []string
+	for _, m := range msgs {
+		if n := textLen(m.Plain); n > 60 {
+			t.Errorf("message of %d units: %q", n, m.Plain)
+		}
+		if err := checkHTML(m.Text); err != nil {
+			t.Errorf("invalid HTML %q: %v", m.Text, err)
+		}
+		plain = append(plain, m.Plain)
+	}
+	if msgs[0].Text != "<b>Title</b>" {
+		t.Errorf("unexpected first message %q", msgs[0].Text)
+	}
+	if !strings.Contains(strings.Join(plain, "\n"), "• one\n• two") {
+		t.Errorf("list split: %q", plain)
+	}
+	if last := msgs[len(msgs)-1].Text; !strings.HasPrefix(last, `<pre><code class="language-go">line`) {
+		t.Errorf("code not kept as code: %q", last)
+	}
+
+	if msgs := MarkdownMessages("**short**"); len(msgs) != 1 || msgs[0] != Markdown("**short**") {
+		t.Errorf("short text split: %+v", msgs)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	cases := []struct {
+		in    string
+		limit int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"", 10, []string{""}},
+		{"aaaa bbbb\ncccc", 10, []string{"aaaa bbbb", "cccc"}},
+		{"aaaa bbbb cccc", 10, []string{"aaaa bbbb", "cccc"}},
+		{"a\nbbbbbbb cc", 10, []string{"a\nbbbbbbb", "cc"}},
+		{"aaaaaaaaaaaa", 5, []string{"aaaaa", "aaaaa", "aa"}},
+		{"ёёё😀😀", 4, []string{"ёёё", "😀😀"}},
+	}
+	for _, c := range cases {
+		got := SplitText(c.in, c.limit)
+		if strings.Join(got, "|") != strings.Join(c.want, "|") || len(got) != len(c.want) {
+			t.Errorf("SplitText(%q, %d) = %q, want %q", c.in, c.limit, got, c.want)
+		}
+	}
+}
+
+func TestMarkdownLargeInput(t *testing.T) {
+	for _, in := range []string{strings.Repeat("*a ", 20000), strings.Repeat("[", 50000), strings.Repeat("`a ", 20000), strings.Repeat("_a ", 20000)} {
+		start := time.Now()
+		msgs := MarkdownMessages(in)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%q... took %v", in[:6], d)
+		}
+		for _, m := range msgs {
+			if textLen(m.Plain) > MaxMessageLength {
+				t.Errorf("%q... produced a message of %d units", in[:6], textLen(m.Plain))
+			}
+		}
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	if got := EscapeMarkdownV2("a_b*c.d!"); got != `a\_b\*c\.d\!` {
+		t.Errorf("unexpected escape %q", got)
+	}
+}
+
+func TestSendFormattedFallback(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		calls = append(calls, r.Form.Get("parse_mode")+"|"+r.Form.Get("text"))
+		if r.Form.Get("parse_mode") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Unexpected end tag at byte offset 3"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	if err := New("TOKEN").SendFormatted(context.Background(), 1, Markdown("**hi**"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "HTML|<b>hi</b>" || calls[1] != "|hi" {
+		t.Fatalf("unexpected calls %q", calls)
+	}
+}
+
+func TestSendMessageModeNoFallback(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Unexpected end tag at byte offset 3"}`))
+	}))
+	defer srv.Close()
+
+	f := Markdown("**hi**")
+	err := New("TOKEN", WithBaseURL(srv.URL)).SendMessageMode(context.Background(), 1, f.Text, f.ParseMode, nil)
+	if !IsEntityParseError(err) || calls != 1 {
+		t.Fatalf("unexpected result %v after %d calls", err, calls)
+	}
+}
+
+func TestSendFormattedOtherError(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer srv.Close()
+
+	old := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = old }()
+
+	err := New("TOKEN").SendFormatted(context.Background(), 1, Markdown("hi"), nil)
+	if err == nil || IsEntityParseError(err) || calls != 1 {
+		t.Fatalf("unexpected result %v after %d calls", err, calls)
+	}
+}
+
+var markdownSeeds = []string{
+	"**bold** *it* _it_ ~~s~~ `code` [l](https://x.ru)",
+	"# h\n- a\n- b\n> q\n```go\nfmt.Println(\"<>\")\n```",
+	"***a** b*", "_a_b_", "*a*_b_", "[a [b](https://c)](https://d)", "\\", "`", "a\\_b",
+	"[x](https://y.ru/a\\)b)", "**_~~`x`~~_**", "\xff\xfe", "1) x\n  - y",
+	"## **h**", "### *h* and **b**", "# ***h***",
+}
+
+func FuzzMarkdownHTML(f *testing.F) {
+	for _, s := range markdownSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		out := Markdown(in)
+		if !utf8.ValidString(out.Text) || !utf8.ValidString(out.Plain) {
+			t.Fatalf("invalid UTF-8 for %q", in)
+		}
+		if err := checkHTML(out.Text); err != nil {
+			t.Fatalf("Markdown(%q) = %q: %v", in, out.Text, err)
+		}
+	})
+}
+
+func FuzzMarkdownV2(f *testing.F) {
+	for _, s := range markdownSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		out := MarkdownV2(in)
+		if !utf8.ValidString(out.Text) {
+			t.Fatalf("invalid UTF-8 for %q", in)
+		}
+		if err := checkMarkdownV2(out.Text); err != nil {
+			t.Fatalf("MarkdownV2(%q) = %q: %v", in, out.Text, err)
+		}
+	})
+}
+
+func FuzzEscapeMarkdownV2(f *testing.F) {
+	for _, s := range markdownSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		if !utf8.ValidString(in) {
+			return
+		}
+		out := EscapeMarkdownV2(in)
+		if err := checkMarkdownV2(out); err != nil {
+			t.Fatalf("EscapeMarkdownV2(%q) = %q: %v", in, out, err)
+		}
+		var b strings.Builder
+		for i := 0; i < len(out); i++ {
+			if out[i] == '\\' {
+				i++
+			}
+			b.WriteByte(out[i])
+		}
+		if b.String() != in {
+			t.Fatalf("escape of %q does not round-trip: %q", in, b.String())
+		}
+	})
+}
+
+// checkHTML verifies that s only uses tags Telegram supports, that they nest
+// properly and that no raw '<', '>' or bare '&' leaks from the input.
+func checkHTML(s string) error {
+	var stack []string
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '>':
+			return fmt.Errorf("raw '>' at %d", i)
+		case '&':
+			ok := false
+			for _, e := range []string{"&amp;", "&lt;", "&gt;", "&quot;"} {
+				if strings.HasPrefix(s[i:], e) {
+					ok = true
+					i += len(e)
+					break
+				}
+			}
+			if !ok {
+				return fmt.Errorf("bare '&' at %d", i)
+			}
+			continue
+		case '<':
+			j := strings.IndexByte(s[i:], '>')
+			if j < 0 {
+				return fmt.Errorf("unterminated tag at %d", i)
+			}
+			tag := s[i+1 : i+j]
+			i += j + 1
+			if strings.HasPrefix(tag, "/") {
+				if len(stack) == 0 || stack[len(stack)-1] != tag[1:] {
+					return fmt.Errorf("unexpected </%s>", tag[1:])
+				}
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			name, attr, _ := strings.Cut(tag, " ")
+			switch name {
+			case "b", "i", "s", "pre", "blockquote":
+				if attr != "" {
+					return fmt.Errorf("unexpected attribute in <%s>", tag)
+				}
+			case "code":
+				if attr != "" && !strings.HasPrefix(attr, `class="language-`) {
+					return fmt.Errorf("unexpected attribute in <%s>", tag)
+				}
+			case "a":
+				if !strings.HasPrefix(attr, `href="`) || strings.Count(attr, `"`) != 2 {
+					return fmt.Errorf("bad link <%s>", tag)
+				}
+			default:
+				return fmt.Errorf("unsupported tag <%s>", tag)
+			}
+			for _, open := range stack {
+				if open == name {
+					return fmt.Errorf("<%s> nested in itself", name)
+				}
+			}
+			stack = append(stack, name)
+			continue
+		}
+		i++
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %v", stack)
+	}
+	return nil
+}
+
+// checkMarkdownV2 verifies that every reserved character is escaped or part
+// of a balanced entity, following the rules of the Bot API documentation.
+func checkMarkdownV2(s string) error {
+	var stack []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(s) || s[i+1] >= utf8.RuneSelf {
+				return fmt.Errorf("dangling backslash at %d", i)
+			}
+			i++
+		case c == '`':
+			fence := "`"
+			if strings.HasPrefix(s[i:], "```") {
+				fence = "```"
+			}
+			j := i + len(fence)
+			for ; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+					continue
+				}
+				if s[j] == '`' {
+					break
+				}
+			}
+			if j >= len(s) || !strings.HasPrefix(s[j:], fence) {
+				return fmt.Errorf("unterminated code at %d", i)
+			}
+			i = j + len(fence) - 1
+		case c == '*' || c == '_' || c == '~':
+			if c == '_' && i+1 < len(s) && s[i+1] == '_' {
+				return fmt.Errorf("ambiguous '__' at %d", i)
+			}
+			if n := len(stack); n > 0 && stack[n-1] == c {
+				stack = stack[:n-1]
+			} else {
+				for _, o := range stack {
+					if o == c {
+						return fmt.Errorf("%q nested in itself at %d", c, i)
+					}
+				}
+				stack = append(stack, c)
+			}
+		case c == '[':
+			stack = append(stack, c)
+		case c == ']':
+			if n := len(stack); n == 0 || stack[n-1] != '[' {
+				return fmt.Errorf("unbalanced ']' at %d", i)
+			}
+			stack = stack[:len(stack)-1]
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return fmt.Errorf("link without url at %d", i)
+			}
+			j := i + 2
+			for ; j < len(s) && s[j] != ')'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated url at %d", i)
+			}
+			i = j
+		case c == '>':
+			if i > 0 && s[i-1] != '\n' {
+				return fmt.Errorf("unescaped '>' at %d", i)
+			}
+		case strings.IndexByte("()#+-=|{}.!", c) >= 0:
+			return fmt.Errorf("unescaped %q at %d", c, i)
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q", stack)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package telegram
+
+import "encoding/json"
+
+// ReplyMarkup is an additional interface attached to a message:
+// InlineKeyboardMarkup, ReplyKeyboardMarkup or ReplyKeyboardRemove.
+type ReplyMarkup interface {
+	replyMarkup()
+}
+
+// InlineKeyboardMarkup shows buttons right below a message.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// InlineKeyboardButton is one button of an inline keyboard. Exactly one of
+// CallbackData and URL should be set.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// InlineRow is a convenience for building a single keyboard row.
+func InlineRow(buttons ...InlineKeyboardButton) []InlineKeyboardButton {
+	return buttons
+}
+
+// ReplyKeyboardMarkup replaces the user's keyboard with predefined answers;
+// pressing a button sends its text as a message.
+type ReplyKeyboardMarkup struct {
+	Keyboard              [][]KeyboardButton `json:"keyboard"`
+	ResizeKeyboard        bool               `json:"resize_keyboard,omitempty"`
+	OneTimeKeyboard       bool               `json:"one_time_keyboard,omitempty"`
+	InputFieldPlaceholder string             `json:"input_field_placeholder,omitempty"`
+	Selective             bool               `json:"selective,omitempty"`
+}
+
+// KeyboardButton is one button of a reply keyboard.
+type KeyboardButton struct {
+	Text string `json:"text"`
+}
+
+// ReplyKeyboardRemove hides a reply keyboard shown earlier.
+type ReplyKeyboardRemove struct {
+	Selective bool
+}
+
+// MarshalJSON always sets remove_keyboard, which the API requires to be true.
+func (r ReplyKeyboardRemove) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RemoveKeyboard bool `json:"remove_keyboard"`
+		Selective      bool `json:"selective,omitempty"`
+	}{true, r.Selective})
+}
+
+func (InlineKeyboardMarkup) replyMarkup() {}
+func (ReplyKeyboardMarkup) replyMarkup()  {}
+func (ReplyKeyboardRemove) replyMarkup()  {}
@@ -0,0 +1,291 @@
+// Package queue sends Telegram messages within the Bot API flood limits.
+//
+// Messages to one chat are delivered in order and at most once per
+// ChatInterval; all chats together share a global rate. Flood-control errors
+// are retried after the retry_after the API asks for, and 5xx responses and
+// failures to connect with exponential backoff. Other network errors are not
+// retried: the message may have been delivered and would be sent twice.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"legalbot/internal/telegram"
+)
+
+// Sender delivers one message, e.g. *telegram.Client.
+type Sender interface {
+	SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error
+	SendMessageMode(ctx context.Context, chatID int64, text string, mode telegram.ParseMode, markup telegram.ReplyMarkup) error
+}
+
+// ErrClosed is returned for messages sent after Close.
+var ErrClosed = errors.New("queue: closed")
+
+// Queue orders and paces outgoing messages. Its Send methods block until the
+// message is delivered, fails permanently or ctx is done.
+type Queue struct {
+	api          Sender
+	chatInterval time.Duration
+	interval     time.Duration
+	retries      int
+	backoff      time.Duration
+	Logger       *slog.Logger
+
+	mu     sync.Mutex
+	lanes  map[int64]*lane
+	next   time.Time // earliest start of the next send across all chats
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// lane holds the pending messages of one chat. It is drained by a single
+// goroutine, which keeps per-chat order.
+type lane struct {
+	jobs []*job
+	last time.Time
+}
+
+type job struct {
+	ctx  context.Context
+	send func(ctx context.Context) error
+	done chan error
+}
+
+// New returns a queue sending through api with Telegram's limits: one
+// message per second per chat and 30 messages per second overall.
+func New(api Sender, opts ...func(*Queue)) *Queue {
+	q := &Queue{
+		api:          api,
+		chatInterval: time.Second,
+		interval:     time.Second / 30,
+		retries:      5,
+		backoff:      500 * time.Millisecond,
+		Logger:       slog.Default(),
+		lanes:        map[int64]*lane{},
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// WithChatInterval sets the minimum delay between messages to one chat.
+func WithChatInterval(d time.Duration) func(*Queue) {
+	return func(q *Queue) { q.chatInterval = d }
+}
+
+// WithGlobalRate sets how many messages per second are sent in total.
+func WithGlobalRate(perSecond int) func(*Queue) {
+	return func(q *Queue) { q.interval = time.Second / time.Duration(perSecond) }
+}
+
+// WithRetries sets how many times a failed send is retried and the initial
+// backoff for transient errors, which doubles after every attempt.
+func WithRetries(n int, backoff time.Duration) func(*Queue) {
+	return func(q *Queue) {
+		q.retries = n
+		q.backoff = backoff
+	}
+}
+
+// WithLogger sets a custom logger when creating a queue.
+func WithLogger(l *slog.Logger) func(*Queue) {
+	return func(q *Queue) { q.Logger = l }
+}
+
+// SendMessage queues a plain text message.
+func (q *Queue) SendMessage(ctx context.Context, chatID int64, text string) error {
+	return q.SendMessageMarkup(ctx, chatID, text, nil)
+}
+
+// SendMessageMarkup queues a text message with an optional keyboard.
+func (q *Queue) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	return q.enqueue(ctx, chatID, func(ctx context.Context) error {
+		return q.api.SendMessageMarkup(ctx, chatID, text, markup)
+	})
+}
+
+// SendFormatted queues a formatted message. If Telegram rejects its entities
+// the plain text version is queued in turn, so the fallback waits for the
+// rate limits like any other message.
+func (q *Queue) SendFormatted(ctx context.Context, chatID int64, f telegram.Formatted, markup telegram.ReplyMarkup) error {
+	err := q.enqueue(ctx, chatID, func(ctx context.Context) error {
+		return q.api.SendMessageMode(ctx, chatID, f.Text, f.ParseMode, markup)
+	})
+	if !telegram.IsEntityParseError(err) {
+		return err
+	}
+	if q.Logger != nil {
+		q.Logger.WarnContext(ctx, "telegram rejected formatting, sending plain text", "chat_id", chatID, "parse_mode", f.ParseMode, "err", err)
+	}
+	return q.SendMessageMarkup(ctx, chatID, f.Plain, markup)
+}
+
+// Close stops accepting messages and waits until queued ones are handled.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Shutdown is Close bounded by ctx. It returns ctx.Err() if messages are
+// still being sent when ctx is done; they keep being sent in the background.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending returns the number of messages waiting to be sent.
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, l := range q.lanes {
+		n += len(l.jobs)
+	}
+	return n
+}
+
+func (q *Queue) enqueue(ctx context.Context, chatID int64, send func(context.Context) error) error {
+	j := &job{ctx: ctx, send: send, done: make(chan error, 1)}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	l, ok := q.lanes[chatID]
+	if !ok {
+		l = &lane{}
+		q.lanes[chatID] = l
+		q.wg.Add(1)
+		go q.run(chatID, l)
+	}
+	l.jobs = append(l.jobs, j)
+	q.mu.Unlock()
+
+	select {
+	case err := <-j.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run drains a lane. It lingers for one chat interval after the last send
+// so a message queued right after does not skip the per-chat delay.
+func (q *Queue) run(chatID int64, l *lane) {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		if len(l.jobs) == 0 {
+			if wait := time.Until(l.last.Add(q.chatInterval)); wait > 0 {
+				q.mu.Unlock()
+				time.Sleep(wait)
+				continue
+			}
+			delete(q.lanes, chatID)
+			q.mu.Unlock()
+			return
+		}
+		j := l.jobs[0]
+		l.jobs = l.jobs[1:]
+		q.mu.Unlock()
+
+		j.done <- q.deliver(chatID, l, j)
+	}
+}
+
+// deliver sends one job, waiting for the rate limits before every attempt.
+func (q *Queue) deliver(chatID int64, l *lane, j *job) error {
+	backoff := q.backoff
+	for attempt := 0; ; attempt++ {
+		if err := j.ctx.Err(); err != nil {
+			return err
+		}
+		if err := sleep(j.ctx, time.Until(l.last.Add(q.chatInterval))); err != nil {
+			return err
+		}
+		if err := sleep(j.ctx, q.reserve()); err != nil {
+			return err
+		}
+		err := j.send(j.ctx)
+		l.last = time.Now()
+		if err == nil {
+			return nil
+		}
+		wait, retry := q.retryDelay(err, backoff)
+		if !retry || attempt >= q.retries || j.ctx.Err() != nil {
+			return err
+		}
+		if q.Logger != nil {
+			q.Logger.WarnContext(j.ctx, "telegram send failed, retrying", "chat_id", chatID, "attempt", attempt+1, "wait", wait, "err", err)
+		}
+		if err := sleep(j.ctx, wait); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// reserve claims the next global send slot and returns how long to wait for it.
+func (q *Queue) reserve() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if q.next.Before(now) {
+		q.next = now
+	}
+	slot := q.next
+	q.next = slot.Add(q.interval)
+	return slot.Sub(now)
+}
+
+// retryDelay decides whether err is worth retrying and after how long.
+func (q *Queue) retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *telegram.APIError
+	if !errors.As(err, &apiErr) {
+		return backoff, notSent(err)
+	}
+	if apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+	return backoff, apiErr.Temporary()
+}
+
+// notSent reports whether err shows that the request never reached
+// Telegram, so sending it again cannot duplicate the message.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("queue: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"legalbot/internal/telegram"
+)
+
+type sent struct {
+	chatID int64
+	text   string
+	at     time.Time
+}
+
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []sent
+	// errs are returned by the next calls, in order, before succeeding.
+	errs []error
+}
+
+func (f *fakeSender) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.sent = append(f.sent, sent{chatID: chatID, text: text, at: time.Now()})
+	return nil
+}
+
+func (f *fakeSender) SendMessageMode(ctx context.Context, chatID int64, text string, mode telegram.ParseMode, markup telegram.ReplyMarkup) error {
+	return f.SendMessageMarkup(ctx, chatID, text, markup)
+}
+
+func (f *fakeSender) messages() []sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]sent(nil), f.sent...)
+}
+
+func quiet() func(*Queue) {
+	return WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestQueuePerChatOrderAndSpacing(t *testing.T) {
+	api := &fakeSender{}
+	q := New(api, WithChatInterval(30*time.Millisecond), WithGlobalRate(1000), quiet())
+	var wg sync.WaitGroup
+	for _, text := range []string{"1", "2", "3", "4"} {
+		if err := q.SendMessage(context.Background(), 7, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A second chat is not held back by the first one.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.SendMessage(context.Background(), 8, "other")
+	}()
+	wg.Wait()
+	q.Close()
+
+	var chat7 []sent
+	for _, s := range api.messages() {
+		if s.chatID == 7 {
+			chat7 = append(chat7, s)
+		}
+	}
+	if len(chat7) != 4 {
+		t.Fatalf("expected 4 messages, got %+v", chat7)
+	}
+	for i, s := range chat7 {
+		if s.text != string(rune('1'+i)) {
+			t.Fatalf("out of order: %+v", chat7)
+		}
+		if i > 0 && s.at.Sub(chat7[i-1].at) < 25*time.Millisecond {
+			t.Fatalf("messages %d and %d sent %v apart", i-1, i, s.at.Sub(chat7[i-1].at))
+		}
+	}
+}
+
+func TestQueueConcurrentOrder(t *testing.T) {
+	api := &fakeSender{}
+	q := New(api, WithChatInterval(time.Millisecond), WithGlobalRate(10000), quiet())
+	// Messages enqueued from one goroutine keep their order even while other
+	// chats are sending.
+	var wg sync.WaitGroup
+	for chat := int64(1); chat <= 5; chat++ {
+		wg.Add(1)
+		go func(chat int64) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				q.SendMessage(context.Background(), chat, string(rune('a'+i)))
+			}
+		}(chat)
+	}
+	wg.Wait()
+	q.Close()
+	last := map[int64]string{}
+	for _, s := range api.messages() {
+		if s.text <= last[s.chatID] {
+			t.Fatalf("chat %d out of order: %q after %q", s.chatID, s.text, last[s.chatID])
+		}
+		last[s.chatID] = s.text
+	}
+	if len(api.messages()) != 50 {
+		t.Fatalf("expected 50 messages, got %d", len(api.messages()))
+	}
+}
+
+func TestQueueGlobalRate(t *testing.T) {
+	api := &fakeSender{}
+	q := New(api, WithChatInterval(time.Millisecond), WithGlobalRate(100), quiet())
+	start := time.Now()
+	var wg sync.WaitGroup
+	for chat := int64(1); chat <= 10; chat++ {
+		wg.Add(1)
+		go func(chat int64) {
+			defer wg.Done()
+			q.SendMessage(context.Background(), chat, "hi")
+		}(chat)
+	}
+	wg.Wait()
+	q.Close()
+	// Ten messages at 100/s need at least 90ms.
+	if d := time.Since(start); d < 85*time.Millisecond {
+		t.Fatalf("global rate not enforced: 10 messages in %v", d)
+	}
+}
+
+func TestQueueRetryAfter(t *testing.T) {
+	api := &fakeSender{errs: []error{&telegram.APIError{Code: 429, RetryAfter: 1}}}
+	q := New(api, WithChatInterval(time.Millisecond), quiet())
+	start := time.Now()
+	if err := q.SendMessage(context.Background(), 1, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Fatalf("retry_after not honoured: sent after %v", d)
+	}
+	if len(api.messages()) != 1 {
+		t.Fatalf("expected one delivery, got %+v", api.messages())
+	}
+	q.Close()
+}
+
+func TestQueueRetriesTransientErrors(t *testing.T) {
+	api := &fakeSender{errs: []error{
+		&telegram.APIError{Code: 502, Description: "Bad Gateway"},
+		&url.Error{Op: "Post", URL: "https://api.telegram.org", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}},
+	}}
+	q := New(api, WithChatInterval(time.Millisecond), WithRetries(3, time.Millisecond), quiet())
+	if err := q.SendMessage(context.Background(), 1, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.messages()) != 1 {
+		t.Fatalf("expected delivery after retries")
+	}
+	q.Close()
+}
+
+func TestQueueDoesNotResendAfterNetworkError(t *testing.T) {
+	for _, err := range []error{
+		&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+		context.DeadlineExceeded,
+		io.ErrUnexpectedEOF,
+	} {
+		api := &fakeSender{errs: []error{err}}
+		q := New(api, WithChatInterval(time.Millisecond), WithRetries(3, time.Millisecond), quiet())
+		if got := q.SendMessage(context.Background(), 1, "hi"); !errors.Is(got, err) {
+			t.Errorf("expected %v without retry, got %v", err, got)
+		}
+		if len(api.messages()) != 0 {
+			t.Errorf("message resent after %v", err)
+		}
+		q.Close()
+	}
+}
+
+func TestQueueFormattedFallbackIsPaced(t *testing.T) {
+	api := &fakeSender{errs: []error{&telegram.APIError{Code: 400, Description: "Bad Request: can't parse entities: Unexpected end tag at byte offset 3"}}}
+	q := New(api, WithChatInterval(50*time.Millisecond), WithRetries(3, time.Millisecond), quiet())
+	start := time.Now()
+	if err := q.SendFormatted(context.Background(), 1, telegram.Markdown("**hi**"), nil); err != nil {
+		t.Fatal(err)
+	}
+	got := api.messages()
+	if len(got) != 1 || got[0].text != "hi" {
+		t.Fatalf("expected the plain text fallback, got %+v", got)
+	}
+	if d := got[0].at.Sub(start); d < 50*time.Millisecond {
+		t.Fatalf("fallback sent %v after the rejected message, want at least the chat interval", d)
+	}
+	q.Close()
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	blocked := &telegram.APIError{Code: 403, Description: "Forbidden: bot was blocked by the user"}
+	api := &fakeSender{errs: []error{blocked}}
+	q := New(api, WithChatInterval(time.Millisecond), WithRetries(3, time.Millisecond), quiet())
+	if err := q.SendMessage(context.Background(), 1, "hi"); !errors.Is(err, blocked) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+
+	down := &telegram.APIError{Code: 500}
+	api.errs = []error{down, down, down}
+	q2 := New(api, WithChatInterval(time.Millisecond), WithRetries(2, time.Millisecond), quiet())
+	if err := q2.SendMessage(context.Background(), 1, "hi"); !errors.Is(err, down) {
+		t.Fatalf("expected error after retries, got %v", err)
+	}
+	if len(api.messages()) != 0 {
+		t.Fatal("nothing should be delivered")
+	}
+	q.Close()
+	q2.Close()
+}
+
+func TestQueueContextCanceled(t *testing.T) {
+	api := &fakeSender{}
+	q := New(api, WithChatInterval(200*time.Millisecond), quiet())
+	if err := q.SendMessage(context.Background(), 1, "first"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.SendMessage(ctx, 1, "second"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	q.Close()
+	if msgs := api.messages(); len(msgs) != 1 {
+		t.Fatalf("canceled message was sent: %+v", msgs)
+	}
+}
+
+func TestQueueClosed(t *testing.T) {
+	q := New(&fakeSender{}, quiet())
+	q.Close()
+	if err := q.SendMessage(context.Background(), 1, "hi"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+// blockingSender holds every send until release is closed.
+type blockingSender struct {
+	fakeSender
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSender) SendMessageMarkup(ctx context.Context, chatID int64, text string, markup telegram.ReplyMarkup) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.fakeSender.SendMessageMarkup(ctx, chatID, text, markup)
+}
+
+func TestQueueShutdownDeadline(t *testing.T) {
+	api := &blockingSender{started: make(chan struct{}, 1), release: make(chan struct{})}
+	q := New(api, quiet())
+	go q.SendMessage(context.Background(), 1, "slow")
+	<-api.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a send in progress = %v, want deadline exceeded", err)
+	}
+	close(api.release)
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := api.messages(); len(msgs) != 1 {
+		t.Fatalf("sent %+v, want the message in progress", msgs)
+	}
+}
@@ -0,0 +1,79 @@
+package telegram
+
+// Update is an incoming update delivered to the webhook. Only the fields the
+// bot uses are decoded.
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// Message is a chat message.
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from,omitempty"`
+	Chat      Chat   `json:"chat"`
+	Date      int64  `json:"date"`
+	Text      string `json:"text,omitempty"`
+	// MessageThreadID is the forum topic of the message. It is only a topic
+	// when IsTopicMessage is set; in other groups it identifies a reply thread.
+	MessageThreadID int64 `json:"message_thread_id,omitempty"`
+	IsTopicMessage  bool  `json:"is_topic_message,omitempty"`
+	// ReplyToMessage is the message this one replies to, without its own
+	// reply.
+	ReplyToMessage *Message `json:"reply_to_message,omitempty"`
+	// Caption is the text sent together with a document or photo.
+	Caption  string      `json:"caption,omitempty"`
+	Document *Document   `json:"document,omitempty"`
+	Photo    []PhotoSize `json:"photo,omitempty"`
+}
+
+// Document is a general file attached to a message.
+type Document struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// PhotoSize is one size of a photo. Messages list the sizes from smallest to
+// largest.
+type PhotoSize struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// User is a Telegram user or bot.
+type User struct {
+	ID           int64  `json:"id"`
+	IsBot        bool   `json:"is_bot"`
+	FirstName    string `json:"first_name"`
+	Username     string `json:"username,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+// Chat is the conversation a message belongs to.
+type Chat struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type"`
+	Title   string `json:"title,omitempty"`
+	IsForum bool   `json:"is_forum,omitempty"`
+}
+
+// IsGroup reports whether the chat is a group or supergroup.
+func (c Chat) IsGroup() bool {
+	return c.Type == ChatGroup || c.Type == ChatSupergroup
+}
+
+// CallbackQuery is sent when a user presses an inline keyboard button.
+// Message is the message the button was attached to.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data,omitempty"`
+}
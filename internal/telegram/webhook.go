@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AllowedUpdates lists the update types the bot handles. Telegram does not
+// deliver other types when it is passed to SetWebhook or GetUpdates.
+var AllowedUpdates = []string{"message", "callback_query"}
+
+// WebhookConfig describes the webhook registered with SetWebhook.
+type WebhookConfig struct {
+	URL string
+	// SecretToken is sent back in the X-Telegram-Bot-Api-Secret-Token header.
+	SecretToken    string
+	AllowedUpdates []string
+	// MaxConnections limits simultaneous webhook requests (1-100, 0 keeps
+	// Telegram's default of 40).
+	MaxConnections     int
+	DropPendingUpdates bool
+}
+
+// WebhookInfo is the current webhook status reported by getWebhookInfo.
+type WebhookInfo struct {
+	URL                  string   `json:"url"`
+	HasCustomCertificate bool     `json:"has_custom_certificate"`
+	PendingUpdateCount   int      `json:"pending_update_count"`
+	IPAddress            string   `json:"ip_address,omitempty"`
+	LastErrorDate        int64    `json:"last_error_date,omitempty"`
+	LastErrorMessage     string   `json:"last_error_message,omitempty"`
+	MaxConnections       int      `json:"max_connections,omitempty"`
+	AllowedUpdates       []string `json:"allowed_updates,omitempty"`
+}
+
+// LastError returns the time of the last delivery error, or the zero time.
+func (i WebhookInfo) LastError() time.Time {
+	if i.LastErrorDate == 0 {
+		return time.Time{}
+	}
+	return time.Unix(i.LastErrorDate, 0)
+}
+
+// SetWebhook registers cfg.URL to receive updates.
+func (c *Client) SetWebhook(ctx context.Context, cfg WebhookConfig) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("set webhook: empty url")
+	}
+	data := url.Values{}
+	data.Set("url", cfg.URL)
+	if cfg.SecretToken != "" {
+		data.Set("secret_token", cfg.SecretToken)
+	}
+	if cfg.AllowedUpdates != nil {
+		b, err := json.Marshal(cfg.AllowedUpdates)
+		if err != nil {
+			return fmt.Errorf("encode allowed updates: %w", err)
+		}
+		data.Set("allowed_updates", string(b))
+	}
+	if cfg.MaxConnections > 0 {
+		data.Set("max_connections", strconv.Itoa(cfg.MaxConnections))
+	}
+	if cfg.DropPendingUpdates {
+		data.Set("drop_pending_updates", "true")
+	}
+	return c.call(ctx, "setWebhook", data, nil)
+}
+
+// GetWebhookInfo returns the current webhook status.
+func (c *Client) GetWebhookInfo(ctx context.Context) (WebhookInfo, error) {
+	var info WebhookInfo
+	if err := c.call(ctx, "getWebhookInfo", url.Values{}, &info); err != nil {
+		return WebhookInfo{}, err
+	}
+	return info, nil
+}
@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetWebhook(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/setWebhook" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		r.ParseForm()
+		got = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true,"description":"Webhook was set"}`))
+	}))
+	defer srv.Close()
+
+	err := New("TOKEN", WithBaseURL(srv.URL)).SetWebhook(context.Background(), WebhookConfig{
+		URL:                "https://bot.example.com/",
+		SecretToken:        "s3cret",
+		AllowedUpdates:     AllowedUpdates,
+		MaxConnections:     20,
+		DropPendingUpdates: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"url":                  {"https://bot.example.com/"},
+		"secret_token":         {"s3cret"},
+		"allowed_updates":      {`["message","callback_query"]`},
+		"max_connections":      {"20"},
+		"drop_pending_updates": {"true"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected form %v", got)
+	}
+}
+
+func TestSetWebhookDefaults(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	c := New("TOKEN", WithBaseURL(srv.URL))
+	if err := c.SetWebhook(context.Background(), WebhookConfig{URL: "https://x"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("unset options were sent: %v", got)
+	}
+	if err := c.SetWebhook(context.Background(), WebhookConfig{}); err == nil {
+		t.Fatal("expected error for empty url")
+	}
+}
+
+func TestSetWebhookRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook: HTTPS url must be provided for webhook"}`))
+	}))
+	defer srv.Close()
+
+	err := New("TOKEN", WithBaseURL(srv.URL)).SetWebhook(context.Background(), WebhookConfig{URL: "http://x"})
+	if err == nil || err.Error() != "telegram: setWebhook: 400 Bad Request: bad webhook: HTTPS url must be provided for webhook" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestGetWebhookInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/getWebhookInfo" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"url":"https://bot.example.com/","has_custom_certificate":false,
+			"pending_update_count":3,"last_error_date":1700000000,"last_error_message":"Wrong response from the webhook: 502 Bad Gateway",
+			"max_connections":40,"ip_address":"203.0.113.7","allowed_updates":["message","callback_query"]}}`))
+	}))
+	defer srv.Close()
+
+	info, err := New("TOKEN", WithBaseURL(srv.URL)).GetWebhookInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WebhookInfo{
+		URL:                "https://bot.example.com/",
+		PendingUpdateCount: 3,
+		IPAddress:          "203.0.113.7",
+		LastErrorDate:      1700000000,
+		LastErrorMessage:   "Wrong response from the webhook: 502 Bad Gateway",
+		MaxConnections:     40,
+		AllowedUpdates:     []string{"message", "callback_query"},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if !info.LastError().Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("unexpected last error time %v", info.LastError())
+	}
+	if !(WebhookInfo{}).LastError().IsZero() {
+		t.Fatal("expected zero time without errors")
+	}
+}
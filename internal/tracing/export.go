@@ -0,0 +1,283 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/metrics"
+)
+
+var (
+	spansExported = metrics.NewCounter("tracing_spans_exported_total", "Spans accepted by the collector.")
+	spansDropped  = metrics.NewCounter("tracing_spans_dropped_total",
+		"Spans dropped because the export queue was full or the collector failed.")
+)
+
+// Tracer batches ended spans and posts them to an OTLP/HTTP collector.
+type Tracer struct {
+	// Endpoint is the full traces URL, e.g. http://collector:4318/v1/traces.
+	Endpoint string
+	// Service is reported as the service.name resource attribute.
+	Service string
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1.
+	SampleRatio float64
+	// BatchSize spans trigger an export before FlushInterval has passed.
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxQueue bounds the spans waiting for export; more are dropped so a
+	// collector outage cannot grow memory without limit.
+	MaxQueue int
+	HTTP     *http.Client
+	Logger   *slog.Logger
+
+	mu    sync.Mutex
+	queue []span
+	kick  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// New creates a tracer exporting to endpoint and starts its export loop.
+// Call Shutdown to flush the remaining spans.
+func New(endpoint, service string, opts ...func(*Tracer)) *Tracer {
+	t := &Tracer{
+		Endpoint:      endpoint,
+		Service:       service,
+		SampleRatio:   1,
+		BatchSize:     256,
+		FlushInterval: 5 * time.Second,
+		MaxQueue:      4096,
+		HTTP:          &http.Client{Timeout: 10 * time.Second},
+		Logger:        slog.Default(),
+		kick:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	go t.loop()
+	return t
+}
+
+// WithSampleRatio records only the given fraction of new traces.
+func WithSampleRatio(r float64) func(*Tracer) {
+	return func(t *Tracer) { t.SampleRatio = max(0, min(r, 1)) }
+}
+
+// WithBatch sets the batch size and the longest time a span waits for
+// export.
+func WithBatch(size int, interval time.Duration) func(*Tracer) {
+	return func(t *Tracer) {
+		t.BatchSize = size
+		t.FlushInterval = interval
+	}
+}
+
+// WithHTTPClient sets the client used to reach the collector.
+func WithHTTPClient(c *http.Client) func(*Tracer) {
+	return func(t *Tracer) { t.HTTP = c }
+}
+
+// WithLogger allows setting a custom logger when creating a new tracer.
+func WithLogger(l *slog.Logger) func(*Tracer) {
+	return func(t *Tracer) { t.Logger = l }
+}
+
+// FromConfig creates a tracer reporting as service unless cfg names
+// another, or returns nil when cfg sets no endpoint.
+func FromConfig(cfg config.Tracing, service string, opts ...func(*Tracer)) *Tracer {
+	endpoint := cfg.TracesURL()
+	if endpoint == "" {
+		return nil
+	}
+	opts = append([]func(*Tracer){WithSampleRatio(cfg.SampleRatio)}, opts...)
+	return New(endpoint, cfg.Service(service), opts...)
+}
+
+// Shutdown stops the export loop after exporting the queued spans, or when
+// ctx is done. Spans ended afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(s span) {
+	t.mu.Lock()
+	select {
+	case <-t.stop:
+		t.mu.Unlock()
+		spansDropped.Inc()
+		return
+	default:
+	}
+	if len(t.queue) >= t.MaxQueue {
+		t.mu.Unlock()
+		spansDropped.Inc()
+		return
+	}
+	t.queue = append(t.queue, s)
+	full := len(t.queue) >= t.BatchSize
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	tick := time.NewTicker(t.FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-t.kick:
+		case <-t.stop:
+			t.flush()
+			return
+		}
+		t.flush()
+	}
+}
+
+// flush exports the queued spans in batches of BatchSize.
+func (t *Tracer) flush() {
+	for {
+		t.mu.Lock()
+		n := min(len(t.queue), t.BatchSize)
+		batch := t.queue[:n:n]
+		t.queue = t.queue[n:]
+		t.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			spansDropped.Add(float64(n))
+			if t.Logger != nil {
+				t.Logger.Warn("export spans", "spans", n, "err", err)
+			}
+			continue
+		}
+		spansExported.Add(float64(n))
+	}
+}
+
+func (t *Tracer) export(spans []span) error {
+	payload, err := json.Marshal(exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: []keyValue{
+			{Key: "service.name", Value: anyValue{StringValue: &t.Service}},
+		}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "legalbot"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// The types below are the OTLP JSON encoding of ExportTraceServiceRequest.
+// IDs are hex and 64-bit integers are strings, as the encoding requires.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         Kind       `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	Status       status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// Status codes: 0 unset, 2 error.
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *Span) export(end time.Time) span {
+	out := span{
+		TraceID:    hex.EncodeToString(s.tc.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.tc.SpanID[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: s.attrs,
+	}
+	if s.tc.ParentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.tc.ParentID[:])
+	}
+	if s.err {
+		out.Status = status{Code: 2, Message: s.msg}
+	}
+	return out
+}
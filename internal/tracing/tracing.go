@@ -0,0 +1,199 @@
+// Package tracing records spans for the work done on a request and exports
+// them to an OpenTelemetry collector over OTLP/HTTP JSON.
+//
+// Spans build on the trace context of package reqctx, so the trace and span
+// IDs in the logs are the ones the collector sees, and a span started before
+// an outbound call becomes the parent of the receiving service's span.
+//
+// Tracing is off until a Tracer is installed with SetDefault. Until then
+// Start returns its context unchanged and a nil *Span, whose methods do
+// nothing, so instrumented code costs a pointer load.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"legalbot/internal/reqctx"
+)
+
+// Kind tells the collector what a span represents. The values are the OTLP
+// SpanKind enum.
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault installs t for Start, StartRequest and Middleware. A nil t
+// turns tracing off.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span as a child of the span in ctx, or as the root of a
+// new trace when ctx has none, and returns ctx carrying the new span. It
+// returns ctx unchanged and a nil span when tracing is off or the trace is
+// not sampled.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent, ok := reqctx.Trace(ctx)
+	if !ok {
+		parent = t.sample(reqctx.NewTrace())
+		ctx = reqctx.WithTrace(ctx, parent)
+		if !parent.Sampled() {
+			return ctx, nil
+		}
+		return ctx, t.span(parent, name, kind)
+	}
+	if !parent.Sampled() {
+		return ctx, nil
+	}
+	tc := parent.Child()
+	return reqctx.WithTrace(ctx, tc), t.span(tc, name, kind)
+}
+
+// StartRequest records the span reqctx assigned to an incoming request or
+// polled update, rather than starting a child of it, so the span the logs
+// name is the one exported. New traces are sampled here; traces continued
+// from a caller keep the caller's decision.
+func StartRequest(ctx context.Context, name string) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	tc, ok := reqctx.Trace(ctx)
+	if !ok {
+		return Start(ctx, name, Server)
+	}
+	if tc.ParentID == [8]byte{} {
+		tc = t.sample(tc)
+		ctx = reqctx.WithTrace(ctx, tc)
+	}
+	if !tc.Sampled() {
+		return ctx, nil
+	}
+	return ctx, t.span(tc, name, Server)
+}
+
+// Middleware records a server span named name for each request. Install it
+// inside reqctx.Middleware, which assigns the span.
+func Middleware(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := StartRequest(r.Context(), name)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		span.SetAttr("http.request.method", r.Method)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetInt("http.response.status_code", int64(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(sw.status)))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sample sets the sampled flag of a new trace from the trace ID, the way
+// OpenTelemetry's TraceIDRatioBased sampler does, so services configured
+// with the same ratio agree on which traces to keep.
+func (t *Tracer) sample(tc reqctx.TraceContext) reqctx.TraceContext {
+	tc.Flags &^= 1
+	if t.SampleRatio >= 1 || float64(binary.BigEndian.Uint64(tc.TraceID[8:])>>1) < t.SampleRatio*(1<<63) {
+		tc.Flags |= 1
+	}
+	return tc
+}
+
+func (t *Tracer) span(tc reqctx.TraceContext, name string, kind Kind) *Span {
+	return &Span{t: t, tc: tc, name: name, kind: kind, start: time.Now()}
+}
+
+// Span is one timed operation. A nil *Span is valid and records nothing.
+// A span is not safe for concurrent use.
+type Span struct {
+	t     *Tracer
+	tc    reqctx.TraceContext
+	name  string
+	kind  Kind
+	start time.Time
+	attrs []keyValue
+	err   bool
+	msg   string // error message
+	ended bool
+}
+
+// SetAttr records a string attribute.
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	v := value
+	s.attrs = append(s.attrs, keyValue{Key: key, Value: anyValue{StringValue: &v}})
+}
+
+// SetInt records an integer attribute.
+func (s *Span) SetInt(key string, value int64) {
+	if s == nil {
+		return
+	}
+	v := strconv.FormatInt(value, 10)
+	s.attrs = append(s.attrs, keyValue{Key: key, Value: anyValue{IntValue: &v}})
+}
+
+// SetError marks the span as failed with err's message. A nil err is
+// ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = true
+	s.msg = err.Error()
+}
+
+// EndError records err, if any, and ends the span. Defer it in functions
+// with a named error result:
+//
+//	defer func() { span.EndError(err) }()
+func (s *Span) EndError(err error) {
+	s.SetError(err)
+	s.End()
+}
+
+// End records the span's end time and queues it for export. Calls after the
+// first are ignored.
+func (s *Span) End() {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	s.t.enqueue(s.export(time.Now()))
+}
@@ -0,0 +1,267 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"legalbot/internal/config"
+	"legalbot/internal/reqctx"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// collector is an OTLP/HTTP receiver that keeps the spans posted to it.
+type collector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	service  string
+	received []span
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req exportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			c.service = *rs.Resource.Attributes[0].Value.StringValue
+			for _, ss := range rs.ScopeSpans {
+				c.received = append(c.received, ss.Spans...)
+			}
+		}
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) spans() map[string]span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := map[string]span{}
+	for _, s := range c.received {
+		out[s.Name] = s
+	}
+	return out
+}
+
+func install(t *testing.T, c *collector, opts ...func(*Tracer)) *Tracer {
+	t.Helper()
+	tr := New(c.URL+"/v1/traces", "bot", opts...)
+	SetDefault(tr)
+	t.Cleanup(func() { SetDefault(nil) })
+	return tr
+}
+
+func attr(s span, key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key != key {
+			continue
+		}
+		switch {
+		case kv.Value.StringValue != nil:
+			return *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			return *kv.Value.IntValue
+		}
+	}
+	return ""
+}
+
+func TestDisabledTracingDoesNotAllocate(t *testing.T) {
+	SetDefault(nil)
+	ctx := reqctx.Start(context.Background())
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := Start(ctx, "db.query", Client)
+		span.SetAttr("db.operation", "create_claim")
+		span.SetInt("http.response.status_code", 200)
+		span.EndError(nil)
+	})
+	if allocs != 0 {
+		t.Fatalf("allocs per span = %v, want 0", allocs)
+	}
+}
+
+func TestSpansExportedAsTree(t *testing.T) {
+	c := newCollector(t)
+	tr := install(t, c)
+
+	ctx := reqctx.Extract(context.Background(), reqctx.HeaderCarrier{"Traceparent": {parent}})
+	ctx, root := StartRequest(ctx, "bot.webhook")
+	_, child := Start(ctx, "openrouter.chat", Client)
+	child.SetAttr("model", "gpt")
+	child.SetInt("http.response.status_code", 502)
+	child.EndError(errors.New("bad gateway"))
+	root.End()
+	root.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := c.spans()
+	if len(c.received) != 2 || c.service != "bot" {
+		t.Fatalf("received %d spans from %q, want 2 from bot", len(c.received), c.service)
+	}
+	r, ch := got["bot.webhook"], got["openrouter.chat"]
+	if r.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || r.ParentSpanID != "00f067aa0ba902b7" || r.Kind != Server {
+		t.Fatalf("root span %+v does not continue the caller's trace", r)
+	}
+	tc, _ := reqctx.Trace(ctx)
+	if r.SpanID != tc.SpanIDString() {
+		t.Fatalf("root span %s, want the span reqctx assigned %s", r.SpanID, tc.SpanIDString())
+	}
+	if ch.TraceID != r.TraceID || ch.ParentSpanID != r.SpanID || ch.Kind != Client {
+		t.Fatalf("child span %+v is not a child of %s", ch, r.SpanID)
+	}
+	if attr(ch, "model") != "gpt" || attr(ch, "http.response.status_code") != "502" {
+		t.Fatalf("child attributes %+v", ch.Attributes)
+	}
+	if ch.Status.Code != 2 || ch.Status.Message != "bad gateway" || r.Status.Code != 0 {
+		t.Fatalf("statuses %+v %+v", ch.Status, r.Status)
+	}
+	if ch.Start == "" || ch.End < ch.Start {
+		t.Fatalf("times %s..%s", ch.Start, ch.End)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	c := newCollector(t)
+	tr := install(t, c, WithSampleRatio(0))
+
+	ctx, span := StartRequest(reqctx.Start(context.Background()), "bot.poll")
+	if span != nil {
+		t.Fatal("span recorded with sample ratio 0")
+	}
+	out := reqctx.HeaderCarrier{}
+	reqctx.Inject(ctx, out)
+	if got := out.Get(reqctx.HeaderTraceparent); got[len(got)-2:] != "00" {
+		t.Fatalf("traceparent %s does not pass on the decision not to sample", got)
+	}
+	if _, span := Start(ctx, "prompt.build", Client); span != nil {
+		t.Fatal("child of an unsampled span recorded")
+	}
+
+	// A caller's decision to sample is kept.
+	ctx = reqctx.Extract(context.Background(), reqctx.HeaderCarrier{"Traceparent": {parent}})
+	_, span = StartRequest(ctx, "prompt.server")
+	span.End()
+	tr.Shutdown(context.Background())
+	if _, ok := c.spans()["prompt.server"]; !ok || len(c.received) != 1 {
+		t.Fatalf("received %+v, want only the span of the sampled caller", c.received)
+	}
+}
+
+func TestSampleRatioIsStable(t *testing.T) {
+	tr := &Tracer{SampleRatio: 0.25}
+	kept := 0
+	for range 4000 {
+		tc := reqctx.NewTrace()
+		a, b := tr.sample(tc), tr.sample(tc)
+		if a.Flags != b.Flags {
+			t.Fatal("sampling decision differs for the same trace")
+		}
+		if a.Sampled() {
+			kept++
+		}
+	}
+	if kept < 800 || kept > 1200 {
+		t.Fatalf("kept %d of 4000 traces at ratio 0.25", kept)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newCollector(t)
+	tr := install(t, c)
+
+	var inner reqctx.TraceContext
+	h := reqctx.Middleware(Middleware("prompt.server", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner, _ = reqctx.Trace(r.Context())
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})))
+	req := httptest.NewRequest(http.MethodPost, "/v1/prompt", nil)
+	req.Header.Set(reqctx.HeaderTraceparent, parent)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tr.Shutdown(context.Background())
+
+	s := c.spans()["prompt.server"]
+	if s.SpanID != inner.SpanIDString() || s.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("span %+v, handler ran in span %s", s, inner.SpanIDString())
+	}
+	if attr(s, "http.response.status_code") != "500" || attr(s, "http.request.method") != "POST" || s.Status.Code != 2 || s.Status.Message != "Internal Server Error" {
+		t.Fatalf("span %+v", s)
+	}
+}
+
+func TestBatchesAndQueueBound(t *testing.T) {
+	c := newCollector(t)
+	tr := install(t, c, WithBatch(2, time.Hour))
+
+	for range 2 {
+		_, span := Start(context.Background(), "telegram.sendMessage", Client)
+		span.End()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.spans()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(c.spans()) == 0 {
+		t.Fatal("a full batch was not exported before the flush interval")
+	}
+	tr.Shutdown(context.Background())
+
+	tr = install(t, c, func(t *Tracer) { t.MaxQueue = 1 })
+	before := spansDropped.Value()
+	for range 3 {
+		_, span := Start(context.Background(), "db.query", Client)
+		span.End()
+	}
+	if got := spansDropped.Value() - before; got != 2 {
+		t.Fatalf("dropped %v spans over the queue bound, want 2", got)
+	}
+	tr.Shutdown(context.Background())
+}
+
+func TestExportFailureIsCounted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	tr := New(srv.URL, "bot", WithLogger(nil))
+	SetDefault(tr)
+	defer SetDefault(nil)
+
+	before := spansDropped.Value()
+	_, span := Start(context.Background(), "prompt.build", Client)
+	span.End()
+	tr.Shutdown(context.Background())
+	if got := spansDropped.Value() - before; got != 1 {
+		t.Fatalf("dropped %v spans after a collector error, want 1", got)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	if tr := FromConfig(config.Tracing{SampleRatio: 1}, "bot"); tr != nil {
+		t.Fatal("tracing on without an endpoint")
+	}
+	tr := FromConfig(config.Tracing{Endpoint: "http://collector:4318/", ServiceName: "bot-canary", SampleRatio: 0.1}, "bot")
+	defer tr.Shutdown(context.Background())
+	if tr.Endpoint != "http://collector:4318/v1/traces" || tr.Service != "bot-canary" || tr.SampleRatio != 0.1 {
+		t.Fatalf("tracer %s %s %v", tr.Endpoint, tr.Service, tr.SampleRatio)
+	}
+}
@@ -0,0 +1,127 @@
+package vector
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Flat is an exact index that compares the query with every vector. It is the
+// right choice for corpora of a few thousand articles.
+type Flat struct {
+	mu   sync.RWMutex
+	dim  int
+	ids  []string
+	vecs [][]float32
+	pos  map[string]int
+}
+
+// NewFlat returns an empty flat index.
+func NewFlat() *Flat {
+	return &Flat{pos: map[string]int{}}
+}
+
+// Add inserts the vector for id.
+func (f *Flat) Add(id string, vec []float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.pos[id]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicate, id)
+	}
+	if f.dim == 0 {
+		f.dim = len(vec)
+	} else if len(vec) != f.dim {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimension, len(vec), f.dim)
+	}
+	f.pos[id] = len(f.ids)
+	f.ids = append(f.ids, id)
+	f.vecs = append(f.vecs, normalize(vec))
+	return nil
+}
+
+// Has reports whether id is stored.
+func (f *Flat) Has(id string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.pos[id]
+	return ok
+}
+
+// Vector returns the stored vector of id.
+func (f *Flat) Vector(id string) ([]float32, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	i, ok := f.pos[id]
+	if !ok {
+		return nil, false
+	}
+	return f.vecs[i], true
+}
+
+// Kind returns KindFlat.
+func (f *Flat) Kind() string { return KindFlat }
+
+// Len returns the number of stored vectors.
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.ids)
+}
+
+// Search returns the k most similar vectors.
+func (f *Flat) Search(query []float32, k int) []Match {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if k <= 0 || len(query) != f.dim {
+		return nil
+	}
+	q := normalize(query)
+	res := make([]Match, len(f.ids))
+	for i, v := range f.vecs {
+		res[i] = Match{ID: f.ids[i], Score: dot(q, v)}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].ID < res[j].ID
+	})
+	if len(res) > k {
+		res = res[:k]
+	}
+	return res
+}
+
+type flatSnapshot struct {
+	Dim  int
+	IDs  []string
+	Vecs [][]float32
+}
+
+// Save writes the index to w.
+func (f *Flat) Save(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header{Kind: KindFlat}); err != nil {
+		return err
+	}
+	return enc.Encode(flatSnapshot{Dim: f.dim, IDs: f.ids, Vecs: f.vecs})
+}
+
+func (f *Flat) decode(dec *gob.Decoder) error {
+	var s flatSnapshot
+	if err := dec.Decode(&s); err != nil {
+		return fmt.Errorf("decode flat index: %w", err)
+	}
+	if len(s.IDs) != len(s.Vecs) {
+		return fmt.Errorf("decode flat index: %d ids for %d vectors", len(s.IDs), len(s.Vecs))
+	}
+	f.dim, f.ids, f.vecs = s.Dim, s.IDs, s.Vecs
+	for i, id := range f.ids {
+		f.pos[id] = i
+	}
+	return nil
+}
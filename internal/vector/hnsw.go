@@ -0,0 +1,323 @@
+package vector
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// HNSW is an approximate index based on hierarchical navigable small world
+// graphs (Malkov & Yashunin, 2016). Search cost grows logarithmically with
+// the number of vectors at the price of occasionally missing a neighbour.
+type HNSW struct {
+	mu sync.RWMutex
+
+	m              int
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	rng            *rand.Rand
+
+	dim      int
+	nodes    []hnswNode
+	pos      map[string]int
+	entry    int
+	maxLevel int
+}
+
+type hnswNode struct {
+	ID    string
+	Vec   []float32
+	Links [][]int32
+}
+
+// NewHNSW returns an empty index. Defaults: M=16, efConstruction=200,
+// efSearch=64.
+func NewHNSW(opts ...func(*HNSW)) *HNSW {
+	h := &HNSW{
+		m:              16,
+		efConstruction: 200,
+		efSearch:       64,
+		rng:            rand.New(rand.NewSource(1)),
+		pos:            map[string]int{},
+		entry:          -1,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.levelMult = 1 / math.Log(float64(h.m))
+	return h
+}
+
+// WithM sets the number of links per node on upper layers (twice that on
+// layer 0).
+func WithM(m int) func(*HNSW) {
+	return func(h *HNSW) { h.m = m }
+}
+
+// WithEfConstruction sets the candidate list size used while inserting.
+func WithEfConstruction(ef int) func(*HNSW) {
+	return func(h *HNSW) { h.efConstruction = ef }
+}
+
+// WithEfSearch sets the candidate list size used while searching.
+func WithEfSearch(ef int) func(*HNSW) {
+	return func(h *HNSW) { h.efSearch = ef }
+}
+
+// WithSeed seeds the level generator, making the graph reproducible.
+func WithSeed(seed int64) func(*HNSW) {
+	return func(h *HNSW) { h.rng = rand.New(rand.NewSource(seed)) }
+}
+
+type candidate struct {
+	id   int
+	dist float32
+}
+
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (h *HNSW) dist(q []float32, id int) float32 {
+	return 1 - dot(q, h.nodes[id].Vec)
+}
+
+func (h *HNSW) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+// searchLayer returns up to ef nodes closest to q on one layer, nearest first.
+func (h *HNSW) searchLayer(q []float32, entries []int, ef, level int) []candidate {
+	visited := make(map[int]bool, ef*4)
+	cands := &minHeap{}
+	res := &maxHeap{}
+	for _, e := range entries {
+		visited[e] = true
+		c := candidate{id: e, dist: h.dist(q, e)}
+		heap.Push(cands, c)
+		heap.Push(res, c)
+	}
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(candidate)
+		if res.Len() >= ef && c.dist > (*res)[0].dist {
+			break
+		}
+		for _, n := range h.nodes[c.id].Links[level] {
+			id := int(n)
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			d := h.dist(q, id)
+			if res.Len() < ef || d < (*res)[0].dist {
+				heap.Push(cands, candidate{id: id, dist: d})
+				heap.Push(res, candidate{id: id, dist: d})
+				if res.Len() > ef {
+					heap.Pop(res)
+				}
+			}
+		}
+	}
+	out := make([]candidate, res.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(res).(candidate)
+	}
+	return out
+}
+
+// greedy walks down from the top layer to level+1 keeping the single closest
+// node, which becomes the entry point for the lower layers.
+func (h *HNSW) greedy(q []float32, level int) int {
+	ep := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.searchLayer(q, []int{ep}, 1, l)[0].id
+	}
+	return ep
+}
+
+// Add inserts the vector for id.
+func (h *HNSW) Add(id string, vec []float32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.pos[id]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicate, id)
+	}
+	if h.dim == 0 {
+		h.dim = len(vec)
+	} else if len(vec) != h.dim {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimension, len(vec), h.dim)
+	}
+
+	q := normalize(vec)
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelMult)
+	idx := len(h.nodes)
+	h.nodes = append(h.nodes, hnswNode{ID: id, Vec: q, Links: make([][]int32, level+1)})
+	h.pos[id] = idx
+	if h.entry < 0 {
+		h.entry, h.maxLevel = idx, level
+		return nil
+	}
+
+	entries := []int{h.greedy(q, level)}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		cands := h.searchLayer(q, entries, h.efConstruction, l)
+		neighbours := cands
+		if len(neighbours) > h.m {
+			neighbours = neighbours[:h.m]
+		}
+		links := make([]int32, len(neighbours))
+		for i, c := range neighbours {
+			links[i] = int32(c.id)
+			h.link(c.id, idx, l)
+		}
+		h.nodes[idx].Links[l] = links
+		entries = entries[:0]
+		for _, c := range cands {
+			entries = append(entries, c.id)
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = idx, level
+	}
+	return nil
+}
+
+// link adds a back link from node to peer, pruning node's links to the
+// closest ones when it has too many.
+func (h *HNSW) link(node, peer, level int) {
+	links := append(h.nodes[node].Links[level], int32(peer))
+	if limit := h.maxLinks(level); len(links) > limit {
+		v := h.nodes[node].Vec
+		sort.Slice(links, func(i, j int) bool {
+			return h.dist(v, int(links[i])) < h.dist(v, int(links[j]))
+		})
+		links = links[:limit]
+	}
+	h.nodes[node].Links[level] = links
+}
+
+// Has reports whether id is stored.
+func (h *HNSW) Has(id string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.pos[id]
+	return ok
+}
+
+// Vector returns the stored vector of id.
+func (h *HNSW) Vector(id string) ([]float32, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i, ok := h.pos[id]
+	if !ok {
+		return nil, false
+	}
+	return h.nodes[i].Vec, true
+}
+
+// Kind returns KindHNSW.
+func (h *HNSW) Kind() string { return KindHNSW }
+
+// Len returns the number of stored vectors.
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes)
+}
+
+// Search returns approximately the k most similar vectors.
+func (h *HNSW) Search(query []float32, k int) []Match {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if k <= 0 || h.entry < 0 || len(query) != h.dim {
+		return nil
+	}
+	q := normalize(query)
+	ep := h.greedy(q, 0)
+	cands := h.searchLayer(q, []int{ep}, max(h.efSearch, k), 0)
+	if len(cands) > k {
+		cands = cands[:k]
+	}
+	res := make([]Match, len(cands))
+	for i, c := range cands {
+		res[i] = Match{ID: h.nodes[c.id].ID, Score: 1 - c.dist}
+	}
+	return res
+}
+
+type hnswSnapshot struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+	Dim            int
+	Entry          int
+	MaxLevel       int
+	Nodes          []hnswNode
+}
+
+// Save writes the index including its graph to w.
+func (h *HNSW) Save(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header{Kind: KindHNSW}); err != nil {
+		return err
+	}
+	return enc.Encode(hnswSnapshot{
+		M:              h.m,
+		EfConstruction: h.efConstruction,
+		EfSearch:       h.efSearch,
+		Dim:            h.dim,
+		Entry:          h.entry,
+		MaxLevel:       h.maxLevel,
+		Nodes:          h.nodes,
+	})
+}
+
+func (h *HNSW) decode(dec *gob.Decoder) error {
+	var s hnswSnapshot
+	if err := dec.Decode(&s); err != nil {
+		return fmt.Errorf("decode hnsw index: %w", err)
+	}
+	if s.M < 2 || s.Entry >= len(s.Nodes) {
+		return fmt.Errorf("decode hnsw index: corrupt snapshot")
+	}
+	h.m, h.efConstruction, h.efSearch = s.M, s.EfConstruction, s.EfSearch
+	h.levelMult = 1 / math.Log(float64(h.m))
+	h.dim, h.entry, h.maxLevel, h.nodes = s.Dim, s.Entry, s.MaxLevel, s.Nodes
+	for i, n := range h.nodes {
+		h.pos[n.ID] = i
+	}
+	return nil
+}
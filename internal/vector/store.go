@@ -0,0 +1,147 @@
+// Package vector provides in-process vector indexes for cosine similarity
+// search with on-disk persistence.
+package vector
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Match is a search result; Score is the cosine similarity to the query.
+type Match struct {
+	ID    string
+	Score float32
+}
+
+// Store is a pluggable vector index.
+type Store interface {
+	// Add inserts a vector under id. All vectors must have the same dimension
+	// and ids cannot be added twice.
+	Add(id string, vec []float32) error
+	// Has reports whether id is stored.
+	Has(id string) bool
+	// Vector returns the stored vector of id, scaled to unit length.
+	Vector(id string) ([]float32, bool)
+	// Kind returns the index kind, KindFlat or KindHNSW.
+	Kind() string
+	// Len returns the number of stored vectors.
+	Len() int
+	// Search returns up to k most similar vectors, best first.
+	Search(query []float32, k int) []Match
+	// Save writes the index to w in a format readable by Load.
+	Save(w io.Writer) error
+}
+
+var (
+	// ErrDimension is returned when a vector's dimension differs from the index.
+	ErrDimension = errors.New("vector: dimension mismatch")
+	// ErrDuplicate is returned when an id is added twice.
+	ErrDuplicate = errors.New("vector: duplicate id")
+)
+
+// Index kinds accepted by New and stored in saved files.
+const (
+	KindFlat = "flat"
+	KindHNSW = "hnsw"
+)
+
+// New returns an empty index of the given kind.
+func New(kind string) (Store, error) {
+	switch kind {
+	case KindFlat:
+		return NewFlat(), nil
+	case KindHNSW:
+		return NewHNSW(), nil
+	default:
+		return nil, fmt.Errorf("vector: unknown index kind %q", kind)
+	}
+}
+
+// header precedes every saved index.
+type header struct {
+	Kind string
+}
+
+// Load reads an index written by Store.Save.
+func Load(r io.Reader) (Store, error) {
+	dec := gob.NewDecoder(r)
+	var h header
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("decode header: %w", err)
+	}
+	switch h.Kind {
+	case KindFlat:
+		f := NewFlat()
+		if err := f.decode(dec); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case KindHNSW:
+		h := NewHNSW()
+		if err := h.decode(dec); err != nil {
+			return nil, err
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("vector: unknown index kind %q", h.Kind)
+	}
+}
+
+// LoadFile reads an index from path.
+func LoadFile(path string) (Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// SaveFile writes s to path atomically via a temporary file.
+func SaveFile(path string, s Store) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := s.Save(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// normalize returns a unit-length copy of v so cosine similarity is a dot
+// product. Zero vectors are returned as is.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		copy(out, v)
+		return out
+	}
+	n := float32(1 / math.Sqrt(sum))
+	for i, x := range v {
+		out[i] = x * n
+	}
+	return out
+}
+
+func dot(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
@@ -0,0 +1,164 @@
+package vector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func randomVectors(n, dim int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	out := make([][]float32, n)
+	for i := range out {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func fill(t *testing.T, s Store, vecs [][]float32) {
+	t.Helper()
+	for i, v := range vecs {
+		if err := s.Add(fmt.Sprintf("v%d", i), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFlatSearch(t *testing.T) {
+	f := NewFlat()
+	fill(t, f, [][]float32{{1, 0}, {0, 1}, {1, 1}})
+	got := f.Search([]float32{2, 0.1}, 2)
+	if len(got) != 2 || got[0].ID != "v0" || got[1].ID != "v2" {
+		t.Fatalf("unexpected matches %+v", got)
+	}
+	if got[0].Score < 0.99 {
+		t.Fatalf("expected cosine close to 1, got %v", got[0].Score)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	for _, kind := range []string{KindFlat, KindHNSW} {
+		s, err := New(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add("a", []float32{1, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add("a", []float32{0, 1}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("%s: expected ErrDuplicate, got %v", kind, err)
+		}
+		if err := s.Add("b", []float32{1, 0, 0}); !errors.Is(err, ErrDimension) {
+			t.Errorf("%s: expected ErrDimension, got %v", kind, err)
+		}
+		if got := s.Search([]float32{1}, 1); got != nil {
+			t.Errorf("%s: expected no matches for wrong dimension", kind)
+		}
+	}
+}
+
+func TestNewUnknownKind(t *testing.T) {
+	if _, err := New("annoy"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const k = 10
+	vecs := randomVectors(1000, 32, 1)
+	flat := NewFlat()
+	hnsw := NewHNSW(WithSeed(7))
+	fill(t, flat, vecs)
+	fill(t, hnsw, vecs)
+
+	hits, total := 0, 0
+	for _, q := range randomVectors(50, 32, 2) {
+		exact := map[string]bool{}
+		for _, m := range flat.Search(q, k) {
+			exact[m.ID] = true
+		}
+		for _, m := range hnsw.Search(q, k) {
+			if exact[m.ID] {
+				hits++
+			}
+		}
+		total += k
+	}
+	if recall := float64(hits) / float64(total); recall < 0.95 {
+		t.Fatalf("recall@%d = %.2f, want >= 0.95", k, recall)
+	}
+}
+
+func TestHNSWSmall(t *testing.T) {
+	h := NewHNSW()
+	if got := h.Search([]float32{1, 0}, 1); got != nil {
+		t.Fatalf("expected no matches on empty index")
+	}
+	fill(t, h, [][]float32{{1, 0}, {0, 1}})
+	got := h.Search([]float32{0, 3}, 5)
+	if len(got) != 2 || got[0].ID != "v1" {
+		t.Fatalf("unexpected matches %+v", got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	vecs := randomVectors(200, 8, 3)
+	query := randomVectors(1, 8, 4)[0]
+	for _, kind := range []string{KindFlat, KindHNSW} {
+		s, err := New(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fill(t, s, vecs)
+		var buf bytes.Buffer
+		if err := s.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if loaded.Len() != s.Len() || !loaded.Has("v199") || loaded.Kind() != kind {
+			t.Fatalf("%s: loaded index lost vectors or its kind", kind)
+		}
+		if v, ok := loaded.Vector("v7"); !ok || fmt.Sprint(v) != fmt.Sprint(normalize(vecs[7])) {
+			t.Fatalf("%s: vector v7 = %v", kind, v)
+		}
+		want, got := s.Search(query, 5), loaded.Search(query, 5)
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Fatalf("%s: results differ after load:\n%v\n%v", kind, want, got)
+		}
+		if err := loaded.Add("new", query); err != nil {
+			t.Fatalf("%s: add after load: %v", kind, err)
+		}
+	}
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "laws.idx")
+	f := NewFlat()
+	fill(t, f, [][]float32{{1, 2, 3}})
+	if err := SaveFile(path, f); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.(*Flat); !ok || loaded.Len() != 1 {
+		t.Fatalf("unexpected index %T with %d vectors", loaded, loaded.Len())
+	}
+}
+
+func TestLoadGarbage(t *testing.T) {
+	if _, err := Load(bytes.NewReader([]byte("not an index"))); err == nil {
+		t.Fatal("expected error")
+	}
+}
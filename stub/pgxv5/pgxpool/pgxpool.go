@@ -172,3 +172,20 @@ func (r Row) Scan(dest ...interface{}) error {
 }
 
 type CommandTag struct{}
+
+// Tx runs statements on the pool; the stub has no isolation to provide.
+type Tx struct {
+	p *Pool
+}
+
+func (p *Pool) Begin(ctx context.Context) (*Tx, error) {
+	return &Tx{p: p}, nil
+}
+
+func (t *Tx) Exec(ctx context.Context, query string, args ...interface{}) (CommandTag, error) {
+	return t.p.Exec(ctx, query, args...)
+}
+
+func (t *Tx) Commit(ctx context.Context) error { return nil }
+
+func (t *Tx) Rollback(ctx context.Context) error { return nil }